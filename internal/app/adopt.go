@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/lockfile"
+	"github.com/gelleson/autoport/internal/scanner"
+)
+
+// adoptedKey is a selected key whose project files set it to a literal
+// port.
+type adoptedKey struct {
+	Key    string
+	Port   int
+	Source string
+}
+
+// runAdopt imports the ports a legacy project hardcodes in its files: it
+// writes them to the lockfile, so `--use-lock` keeps every port as it is,
+// and suggests groups for keys that share a port so they stay linked when
+// the lockfile is regenerated. Values in the environment are not adopted;
+// they are not part of the project.
+func (a *App) runAdopt(ctx context.Context, opts Options, res resolvedOptions) error {
+	if res.EnvOnly {
+		return errors.New("adopt reads project files; --env-only does not apply")
+	}
+	path := lockfile.PathFor(opts.CWD)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists; adopt only starts a project, remove it to adopt again", filepath.Base(path))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("adopt: %w", err)
+	}
+
+	res.FilesOnly = true
+	discoveries, _, err := a.scanDiscoveries(ctx, opts.CWD, res)
+	if err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+	_, keys, err := a.applySelection(discoveries, nil, res)
+	if err != nil {
+		return err
+	}
+
+	var adopted []adoptedKey
+	var skipped []scanner.Discovery
+	for _, d := range discoveries {
+		if _, ok := fileRoles[d.Kind]; !ok || !slices.Contains(keys, d.Key) {
+			continue
+		}
+		if p, err := strconv.Atoi(d.Value); err == nil && p > 0 && p <= 65535 {
+			adopted = append(adopted, adoptedKey{Key: d.Key, Port: p, Source: d.Source})
+		} else {
+			skipped = append(skipped, d)
+		}
+	}
+	slices.SortFunc(adopted, func(x, y adoptedKey) int { return strings.Compare(x.Key, y.Key) })
+	slices.SortFunc(skipped, func(x, y scanner.Discovery) int { return strings.Compare(x.Key, y.Key) })
+
+	if len(adopted) == 0 {
+		fmt.Fprintln(a.stdout, "no keys with literal port values found; nothing to adopt")
+		return nil
+	}
+	fmt.Fprintf(a.stdout, "adopting %d keys from project files:\n", len(adopted))
+	for _, k := range adopted {
+		fmt.Fprintf(a.stdout, "  %s=%d (%s)\n", k.Key, k.Port, k.Source)
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintln(a.stdout, "skipped, not a literal port (autoport allocates these):")
+		for _, d := range skipped {
+			fmt.Fprintf(a.stdout, "  %s=%q (%s)\n", d.Key, d.Value, d.Source)
+		}
+	}
+
+	if groups := a.adoptGroups(adopted); len(groups) > 0 {
+		snippet, err := json.MarshalIndent(map[string]any{"groups": groups}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("adopt: %w", err)
+		}
+		fmt.Fprintf(a.stdout, "keys sharing a port; add to .autoport.json to keep them linked:\n%s\n", snippet)
+	}
+
+	overrides := make(map[string]string, len(adopted))
+	for _, k := range adopted {
+		overrides[k.Key] = strconv.Itoa(k.Port)
+	}
+	if opts.DryRun {
+		fmt.Fprintf(a.stdout, "would write %s with %d assignments\n", filepath.Base(path), len(overrides))
+		return nil
+	}
+	if err := a.writeLockfile(ctx, opts, res.Range, overrides); err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stdout, "run commands with --use-lock to keep these ports, e.g. autoport --use-lock npm start")
+	return nil
+}
+
+// adoptGroups names a group for each port that several adopted keys share,
+// unless one of the keys already belongs to a configured group.
+func (a *App) adoptGroups(adopted []adoptedKey) map[string][]string {
+	byPort := map[int][]string{}
+	for _, k := range adopted {
+		byPort[k.Port] = append(byPort[k.Port], k.Key)
+	}
+	groups := map[string][]string{}
+	for p, keys := range byPort {
+		if len(keys) < 2 || slices.ContainsFunc(keys, func(key string) bool {
+			_, ok := a.config.GroupOf(key)
+			return ok
+		}) {
+			continue
+		}
+		groups[fmt.Sprintf("port_%d", p)] = keys
+	}
+	return groups
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/internal/lockfile"
+)
+
+func TestApp_AdoptLocksHardcodedPorts(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, ".env"), []byte("API_PORT=3000\nHTTP_PORT=3000\nDB_PORT=${PGPORT}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{"API_PORT=9999"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	if err := app.Run(context.Background(), Options{Mode: "adopt", CWD: tmp}, nil); err != nil {
+		t.Fatalf("adopt error: %v", err)
+	}
+	out := stdout.String()
+	for _, want := range []string{"API_PORT=3000 (.env)", "HTTP_PORT=3000 (.env)", `DB_PORT="" (.env)`, `"port_3000": [`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("adopt output missing %q:\n%s", want, out)
+		}
+	}
+	lf, err := lockfile.Read(filepath.Join(tmp, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("read lockfile: %v", err)
+	}
+	if got := lockfile.ToMap(lf.Assignments); !reflect.DeepEqual(got, map[string]string{"API_PORT": "3000", "HTTP_PORT": "3000"}) {
+		t.Fatalf("lockfile assignments = %v", got)
+	}
+
+	stdout.Reset()
+	if err := app.Run(context.Background(), Options{Mode: "run", UseLock: true, CWD: tmp, Format: "dotenv"}, nil); err != nil {
+		t.Fatalf("use-lock run error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "API_PORT=3000") {
+		t.Fatalf("--use-lock should keep the adopted port, got:\n%s", stdout.String())
+	}
+
+	if err := app.Run(context.Background(), Options{Mode: "adopt", CWD: tmp}, nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("adopting over a lockfile should fail, got %v", err)
+	}
+}
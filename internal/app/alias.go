@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// hostSuffix names the variable carrying a key's loopback alias.
+const hostSuffix = "_HOST"
+
+func (a *App) aliasEnabled(opts Options) bool {
+	return opts.LoopbackAlias || a.config.LoopbackAlias
+}
+
+// loopbackAlias derives the project's loopback address from its seed, in
+// 127.0.0.2-127.0.0.254 so 127.0.0.1 stays shared.
+func loopbackAlias(seed uint32) string {
+	return fmt.Sprintf("127.0.0.%d", 2+seed%253)
+}
+
+// aliasHosts adds <KEY>_HOST=alias for every assigned key. Without an
+// alias it returns overrides unchanged.
+func aliasHosts(overrides map[string]string, alias string) map[string]string {
+	if alias == "" {
+		return overrides
+	}
+	out := make(map[string]string, 2*len(overrides))
+	for key, value := range overrides {
+		out[key] = value
+		out[key+hostSuffix] = alias
+	}
+	return out
+}
+
+// loopbackAliasCheck reports whether the project's alias can be bound.
+// Linux and Windows route all of 127.0.0.0/8 to the loopback interface;
+// macOS only has 127.0.0.1 until an alias is added to lo0.
+func (a *App) loopbackAliasCheck(ctx context.Context, opts Options) (doctorCheck, bool) {
+	if !a.aliasEnabled(opts) {
+		return doctorCheck{}, false
+	}
+	si, err := a.computeSeed(ctx, opts)
+	if err != nil {
+		return newCheck("loopback_alias.seed_error", "fatal", msgf("%s", err)), true
+	}
+	alias := loopbackAlias(si.Value)
+	ln, err := net.Listen("tcp", net.JoinHostPort(alias, "0"))
+	if err != nil {
+		parts := []message{msgf("cannot bind %s: %s", alias, err)}
+		if runtime.GOOS == "darwin" {
+			parts = append(parts, msgf("macOS only routes 127.0.0.1; add the alias with: sudo ifconfig lo0 alias %s up", alias))
+		}
+		check := newCheck("loopback_alias.unbindable", "fatal", parts...)
+		return check.with("alias", alias).with("error", err.Error()), true
+	}
+	ln.Close()
+	return newCheck("loopback_alias.ok", "ok", msgf("alias %s is bindable", alias)).with("alias", alias), true
+}
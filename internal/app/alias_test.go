@@ -0,0 +1,47 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_LoopbackAliasExportsHostsAndProbesAlias(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only Linux routes all of 127.0.0.0/8 without configuration")
+	}
+	seed := uint32(7)
+	alias := loopbackAlias(seed)
+	if alias != "127.0.0.9" {
+		t.Fatalf("loopbackAlias(7) = %s", alias)
+	}
+	export := func(loopback bool) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(WithConfig(&config.Config{Presets: map[string]config.Preset{}}), WithStdout(&stdout), WithEnviron([]string{"PORT=1"}))
+		opts := Options{Mode: "run", Format: "dotenv", Range: "20000-29999", CWD: "/work/shop", Seed: &seed, LoopbackAlias: loopback}
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return stdout.String()
+	}
+
+	// Another project holds the preferred port on 127.0.0.1.
+	preferred := strings.TrimSpace(strings.TrimPrefix(export(false), "PORT="))
+	ln, err := net.Listen("tcp", "127.0.0.1:"+preferred)
+	if err != nil {
+		t.Skipf("preferred port %s busy: %v", preferred, err)
+	}
+	defer ln.Close()
+	if got := export(false); got == "PORT="+preferred+"\n" {
+		t.Fatalf("without an alias the busy port must be skipped, got %q", got)
+	}
+	if got, want := export(true), "PORT="+preferred+"\nPORT_HOST="+alias+"\n"; got != want {
+		t.Fatalf("with --loopback-alias = %q, want %q", got, want)
+	}
+}
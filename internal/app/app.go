@@ -6,37 +6,128 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/internal/gitinfo"
+	"github.com/gelleson/autoport/internal/lastrun"
 	"github.com/gelleson/autoport/internal/lockfile"
+	"github.com/gelleson/autoport/internal/mdns"
+	"github.com/gelleson/autoport/internal/msg"
+	"github.com/gelleson/autoport/internal/portowner"
+	"github.com/gelleson/autoport/internal/reservation"
 	"github.com/gelleson/autoport/internal/scanner"
+	"github.com/gelleson/autoport/internal/snapshot"
 	"github.com/gelleson/autoport/pkg/port"
 )
 
 // Options represents the input options for the application.
 type Options struct {
-	Mode      string
-	Ignores   []string
-	Includes  []string
-	Excludes  []string
-	Presets   []string
-	PortEnv   []string
-	Range     string
-	Format    string
-	Quiet     bool
-	DryRun    bool
-	CWD       string
-	Namespace string
-	Seed      *uint32
-	UseLock   bool
+	Mode             string
+	Ignores          []string
+	Includes         []string
+	Excludes         []string
+	Presets          []string
+	PortEnv          []string
+	Range            string
+	Format           string
+	Quiet            bool
+	DryRun           bool
+	CWD              string
+	Namespace        string
+	NamespaceFrom    string
+	Seed             *uint32
+	UseLock          bool
+	PreferCurrent    bool
+	RespectExisting  bool
+	LoopbackAlias    bool
+	NoProcessGroup   bool
+	Workdir          string
+	Umask            *int
+	OnlyOverrides    bool
+	EnvFilter        []string
+	AssumeKeys       []string
+	DocsCheck        bool
+	DocsWrite        bool
+	Record           string
+	Replay           string
+	RequirePreferred bool
+	Pure             bool
+	ShowEnv          bool
+	RedactEnv        bool
+	MDNS             bool
+	Listen           string
+	Health           bool
+	FromSnapshot     string
+	SeedFrom         string
+	SeedString       string
+	SeedRoot         string
+	Script           string
+	Yes              bool
+	ManageGitignore  bool
+	HealthyTimeout   time.Duration
+	Revert           bool
+	CacheTTL         time.Duration
+	Timeout          time.Duration
+	ProbeTTL         time.Duration
+	Provenance       string
+	FilesOnly        bool
+	EnvOnly          bool
+	Origins          map[string]string
+	URLs             bool
+	Silent           bool
+	NoTruncate       bool
+	ChangedOnly      bool
+	Metrics          string
+	// ExcludeCategories drops discovered keys by category (see
+	// categoryOf).
+	ExcludeCategories []string
+	// TokenFile holds the bearer token `autoport serve` requires; empty
+	// means serve.token in the state dir.
+	TokenFile string
+	// RequireKeys must all be assigned a port, or the run fails before
+	// anything starts.
+	RequireKeys []string
+	// Probe is the protocol ports are checked for, "tcp", "udp", or
+	// "both"; empty keeps the single TCP bind.
+	Probe string
+	// Reserve holds the assigned ports until the command starts; PassFDs
+	// also hands them to it as socket-activation descriptors.
+	Reserve bool
+	PassFDs bool
+	// Projects, KeysPerProject, and Trials describe the org layout
+	// `autoport simulate` samples.
+	Projects       int
+	KeysPerProject int
+	Trials         int
+	// MergeWith names an existing env file export mode sets the assigned
+	// ports in (--merge-with); DocsWrite (--write) rewrites it in place.
+	MergeWith string
+	// Mnemonics adds a pronounceable word per port and one for the whole
+	// set to the summary, JSON output, and explain (--mnemonics).
+	Mnemonics bool
+	// Notify shows a desktop notification when planning fails, doctor
+	// finds fatal issues, or the command exits non-zero (--notify).
+	Notify bool
+	// OnHUP is what SIGHUP does while a command runs: reload or restart
+	// (--on-hup); empty leaves the signal's default.
+	OnHUP string
+	// Shell is the shell -f shell output and --revert are written for
+	// (--shell); empty means POSIX.
+	Shell string
+	// Watch replans when the project's .env files or config change,
+	// restarting the command or printing the exports again (--watch).
+	Watch bool
 }
 
 // ExitError allows command modes to signal specific process exit codes.
@@ -61,31 +152,150 @@ type Executor interface {
 	Run(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error
 }
 
+// StartObserver is an optional Executor extension that reports the child's
+// pid once it has started.
+type StartObserver interface {
+	RunObserved(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer, onStart func(pid int)) error
+}
+
 // DefaultExecutor is the standard implementation that runs OS commands.
-type DefaultExecutor struct{}
+// The command runs in a process group of its own (a Job Object on
+// Windows), so its descendants are stopped with it and cleaned up after it.
+type DefaultExecutor struct {
+	// NoProcessGroup runs the command in autoport's process group instead;
+	// only the command itself is stopped (--no-process-group).
+	NoProcessGroup bool
+	// Dir is the command's working directory; empty means autoport's own
+	// (--workdir).
+	Dir string
+	// Umask, when set, is the file mode creation mask the command starts
+	// with (--umask). It is not supported on Windows.
+	Umask *int
+	// Files are passed to the command as descriptors 3 and up, with
+	// LISTEN_PID set to its pid for socket activation (--pass-fds). They
+	// are not supported on Windows.
+	Files []*os.File
+}
 
 // Run executes the command using the standard library's os/exec.
 func (d DefaultExecutor) Run(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+	return d.RunObserved(ctx, name, args, env, stdout, stderr, nil)
+}
+
+// RunObserved is like Run and calls onStart with the child pid after start.
+func (d DefaultExecutor) RunObserved(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer, onStart func(pid int)) error {
+	if len(d.Files) > 0 {
+		// sd_listen_fds(3) only trusts LISTEN_FDS when LISTEN_PID is the
+		// reader's own pid, which is known only in the child; a shell
+		// sets it and execs the command in place.
+		args = append([]string{"-c", `LISTEN_PID=$$; export LISTEN_PID; exec "$@"`, "sh", name}, args...)
+		name = "/bin/sh"
+	}
 	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Env = env
+	cmd.ExtraFiles = d.Files
+	cmd.Dir = d.Dir
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
-	return cmd.Run()
+	started, done := func() {}, func() {}
+	if !d.NoProcessGroup {
+		started, done = startGroup(cmd)
+	}
+	start := cmd.Start
+	if d.Umask != nil {
+		start = func() error { return withUmask(*d.Umask, cmd.Start) }
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	started()
+	if onStart != nil {
+		onStart(cmd.Process.Pid)
+	}
+	err := cmd.Wait()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// The command succeeded; a descendant still held its output open.
+		err = nil
+	}
+	done()
+	return err
 }
 
 // App encapsulates the main application logic and its dependencies.
 type App struct {
-	config   *config.Config
-	executor Executor
-	stdout   io.Writer
-	stderr   io.Writer
-	logger   *slog.Logger
-	environ  []string
-	isFree   port.IsFreeFunc
+	config    *config.Config
+	executor  Executor
+	stdin     io.Reader
+	stdout    io.Writer
+	stderr    io.Writer
+	logger    *slog.Logger
+	environ   []string
+	isFree    checkFunc
+	publish   PublishFunc
+	stateDir  string
+	cacheDir  string
+	portOwner PortOwnerFunc
+	// listeners reads the system's listening sockets to name the owners
+	// of busy ports when no PortOwnerFunc is set.
+	listeners func() (portowner.Table, error)
+	now       func() time.Time
+	fsys      fs.FS
+	// distinct makes each allocated port busy for the plan's later keys;
+	// batch mode sets it so no two keys anywhere share a port.
+	distinct bool
+	// reservations, when set, replaces the configured reservations file.
+	reservations reservation.Store
+	metrics      *appMetrics
+	// text renders user-facing text output in the environment's language.
+	text *msg.Printer
+	// approved records untrusted config files the user agreed to run
+	// commands from.
+	approved map[string]bool
+	// inherited holds the keys of the current plan kept from the invoking
+	// environment, reported with source "inherited".
+	inherited map[string]bool
+	// branch, when set, stands in for the git branch; docs mode plans as
+	// if on the mainline.
+	branch string
+	// branches memoizes branch_resolver_cmd output per project path.
+	branches map[string]branchResult
+	// recording collects the inputs of the current plan for --record;
+	// replaying supplies them from a trace under --replay.
+	recording *allocTrace
+	replaying *allocTrace
+	// probeHost is the address the default port check binds on; empty
+	// means every interface.
+	probeHost string
+	// protocol is the one --probe sets for the current Run.
+	protocol port.Protocol
+	// probeCheck tells whether the default port check can work; nil for
+	// injected checkers. bindErr is its failure in the current Run.
+	probeCheck func() error
+	bindErr    error
+	// discoverers and formatters are extensions registered through
+	// WithDiscoverer and WithFormatter; config plugins add to them.
+	discoverers map[string]Discoverer
+	formatters  map[string]Formatter
+	// noPrompt refuses untrusted commands without asking; set while ide
+	// serve and serve answer a query, which nobody is there to confirm.
+	noPrompt bool
+	// mnemonics mirrors Options.Mnemonics for the output helpers.
+	mnemonics bool
+	// shell is the syntax of Options.Shell for the output helpers.
+	shell shellSyntax
+	// reloadSignals delivers --on-hup requests; replan plans the current
+	// project again for them.
+	reloadSignals func() (<-chan os.Signal, func(), error)
+	replan        func(ctx context.Context) (map[string]string, error)
+	// watchInterval is how often --watch looks at the watched files.
+	watchInterval time.Duration
 }
 
+// PublishFunc advertises services on the local network until ctx is done.
+type PublishFunc func(ctx context.Context, services []mdns.Service) error
+
 // AppOption defines a functional option for configuring the App.
 type AppOption func(*App)
 
@@ -99,6 +309,11 @@ func WithExecutor(e Executor) AppOption {
 	return func(a *App) { a.executor = e }
 }
 
+// WithStdin sets the standard input reader, used by `ide serve`.
+func WithStdin(r io.Reader) AppOption {
+	return func(a *App) { a.stdin = r }
+}
+
 // WithStdout sets the standard output writer.
 func WithStdout(w io.Writer) AppOption {
 	return func(a *App) { a.stdout = w }
@@ -114,6 +329,12 @@ func WithLogger(l *slog.Logger) AppOption {
 	return func(a *App) { a.logger = l }
 }
 
+// WithMessages sets the printer for text output instead of the one chosen
+// from the environment's language variables.
+func WithMessages(p *msg.Printer) AppOption {
+	return func(a *App) { a.text = p }
+}
+
 // WithEnviron sets the base environment variables.
 func WithEnviron(env []string) AppOption {
 	return func(a *App) { a.environ = env }
@@ -121,7 +342,53 @@ func WithEnviron(env []string) AppOption {
 
 // WithIsFree sets the port availability checker.
 func WithIsFree(fn port.IsFreeFunc) AppOption {
-	return func(a *App) { a.isFree = fn }
+	return func(a *App) {
+		a.isFree = func(_ port.Protocol, p int) bool { return fn(p) }
+		a.probeCheck, a.listeners = nil, nil
+	}
+}
+
+// WithPublisher sets the mDNS publisher used by --mdns.
+func WithPublisher(fn PublishFunc) AppOption {
+	return func(a *App) { a.publish = fn }
+}
+
+// WithStateDir sets the directory last-run state is kept in. An empty dir
+// disables change tracking.
+func WithStateDir(dir string) AppOption {
+	return func(a *App) { a.stateDir = dir }
+}
+
+// WithCacheDir sets the directory --cache-ttl keeps recent results in. An
+// empty dir disables the cache.
+func WithCacheDir(dir string) AppOption {
+	return func(a *App) { a.cacheDir = dir }
+}
+
+// WithReservations sets the shared port reservations store, replacing the
+// file named by the config's reservations.path.
+func WithReservations(store reservation.Store) AppOption {
+	return func(a *App) { a.reservations = store }
+}
+
+// WithPortOwner sets the resolver used to name processes holding ports in
+// exhaustion errors, --require-preferred failures, and doctor.
+func WithPortOwner(fn PortOwnerFunc) AppOption {
+	return func(a *App) { a.portOwner = fn }
+}
+
+// WithClock sets the time source used for lockfile, snapshot, and last-run
+// timestamps and health uptime.
+func WithClock(now func() time.Time) AppOption {
+	return func(a *App) { a.now = now }
+}
+
+// WithFS makes project files (env files and the lockfile) be read from fsys
+// instead of the OS file system. Absolute paths map to fsys names without
+// the leading slash, so a project at /repo reads /repo/.env as "repo/.env".
+// Writes (lockfile, last-run state) still go to the OS file system.
+func WithFS(fsys fs.FS) AppOption {
+	return func(a *App) { a.fsys = fsys }
 }
 
 // New creates a new App with default dependencies and optional overrides.
@@ -129,36 +396,142 @@ func New(opts ...AppOption) *App {
 	a := &App{
 		config:   config.LoadDefault(),
 		executor: DefaultExecutor{},
+		stdin:    os.Stdin,
 		stdout:   os.Stdout,
 		stderr:   os.Stderr,
 		logger:   slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo})),
 		environ:  os.Environ(),
-		isFree:   port.DefaultIsFree,
+		publish:  mdns.Publish,
+		now:      time.Now,
+		metrics:  newAppMetrics(),
+
+		reloadSignals: notifyReload,
+		shell:         posixShell,
+		watchInterval: defaultWatchInterval,
 	}
+	a.probeCheck = canBind
+	a.listeners = portowner.Listeners
+	a.isFree = a.defaultCheck
 	for _, opt := range opts {
 		opt(a)
 	}
+	if a.text == nil {
+		a.text = msg.NewPrinter(msg.Lang(a.environ))
+	}
 	return a
 }
 
 type resolvedOptions struct {
-	Range      string
-	Ignores    []string
-	Includes   []string
-	Excludes   []string
-	IgnoreDirs []string
-	MaxDepth   int
-	Warnings   []string
-	Strict     bool
+	Range    string
+	Ignores  []string
+	Includes []string
+	Excludes []string
+	// ExcludePatterns are globs over key names from presets.
+	ExcludePatterns []string
+	// ExcludeCategories are key categories from flags and presets.
+	ExcludeCategories []string
+	IgnoreDirs        []string
+	MaxDepth          int
+	Warnings          []warning
+	Strict            bool
+	Origins           []optionOrigin
+
+	// ExcludeCompose drops keys that only a compose project .env sets.
+	ExcludeCompose bool
+	// KeepIgnored reports prefix-ignored keys as excluded decisions.
+	KeepIgnored bool
+	// FilesOnly and EnvOnly limit discovery to files or to the
+	// environment.
+	FilesOnly bool
+	EnvOnly   bool
+	// ruleOrigins records where each ignore prefix, include, exclude, and
+	// manual key came from, for the explain decision trace.
+	ruleOrigins map[selectionRule]string
+}
+
+// noteRule records origin for each value of a selection field unless an
+// earlier source (the CLI comes first) already supplied it.
+func (r *resolvedOptions) noteRule(field string, values []string, origin string) {
+	if r.ruleOrigins == nil {
+		r.ruleOrigins = map[selectionRule]string{}
+	}
+	for _, v := range values {
+		ref := selectionRule{Rule: field, Value: v}
+		if _, ok := r.ruleOrigins[ref]; !ok {
+			r.ruleOrigins[ref] = origin
+		}
+	}
+}
+
+// rule returns the selection rule for field and value with its origin.
+func (r resolvedOptions) rule(field, value string) selectionRule {
+	return selectionRule{Rule: field, Value: value, Origin: r.ruleOrigins[selectionRule{Rule: field, Value: value}]}
+}
+
+// includeOrigins lists the distinct origins of the include_keys allow-list.
+func (r resolvedOptions) includeOrigins() string {
+	var origins []string
+	for _, key := range r.Includes {
+		if o := r.ruleOrigins[selectionRule{Rule: ruleIncludeKeys, Value: key}]; !slices.Contains(origins, o) {
+			origins = append(origins, o)
+		}
+	}
+	return strings.Join(origins, "; ")
+}
+
+// optionOrigin records where the effective value of an option came from,
+// similar to git config --show-origin.
+type optionOrigin struct {
+	Option string `json:"option"`
+	Value  string `json:"value"`
+	Origin string `json:"origin"`
+}
+
+const originDefault = "built-in default"
+
+// originOf reports the origin the CLI layer recorded for name, falling back
+// to "cli" for values set by the caller and the built-in default otherwise.
+func (o Options) originOf(name string, set bool) string {
+	if src, ok := o.Origins[name]; ok {
+		return src
+	}
+	if set {
+		return "cli"
+	}
+	return originDefault
 }
 
 type keyDecision struct {
 	Key      string
 	Source   string
+	Kind     string
 	Included bool
 	Reason   string
+	Rule     selectionRule
+	Category string
+}
+
+// selectionRule identifies the rule behind a key decision: the config field
+// or flag kind, the matching value, and where that value was configured.
+type selectionRule struct {
+	Rule   string `json:"rule"`
+	Value  string `json:"value,omitempty"`
+	Origin string `json:"origin,omitempty"`
 }
 
+// Selection rule names reported in explain's decision trace.
+const (
+	ruleDiscovered      = "discovered"
+	ruleIgnorePrefix    = "ignore_prefixes"
+	ruleExcludeKeys     = "exclude_keys"
+	ruleExcludePattern  = "exclude_patterns"
+	ruleExcludeCategory = "exclude_categories"
+	ruleIncludeKeys     = "include_keys"
+	ruleNotIncluded     = "not_in_include_keys"
+	ruleManualKey       = "manual_key"
+	ruleComposeEnvOff   = "exclude_compose_env"
+)
+
 type assignedPort struct {
 	Key       string
 	Value     string
@@ -166,6 +539,17 @@ type assignedPort struct {
 	Assigned  int
 	Probes    int
 	FromLock  bool
+	FromSnap  bool
+	Group     string
+	Base      int
+	Current   bool
+	// Inherited marks a value kept from the invoking environment under
+	// --respect-existing.
+	Inherited bool
+	// Pinned marks a port fixed by config ports; KeyRange is the range
+	// spec config ports confined the key to.
+	Pinned   bool
+	KeyRange string
 }
 
 // Run executes the main application workflow.
@@ -173,57 +557,404 @@ func (a *App) Run(ctx context.Context, opts Options, args []string) error {
 	if opts.Mode == "" {
 		opts.Mode = "run"
 	}
+	if opts.Silent {
+		// Only the child's IO and fatal errors remain; warnings are dropped.
+		opts.Quiet = true
+		logger := a.logger
+		a.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		defer func() { a.logger = logger }()
+	}
 	if a.config == nil {
 		a.config = &config.Config{Presets: map[string]config.Preset{}}
 	}
+	if opts.Mode == "hook" {
+		var done bool
+		var err error
+		if opts, args, done, err = a.applyHook(opts, args); done || err != nil {
+			return err
+		}
+	}
 	if a.config.HasErrors() {
 		return joinErrors("config", a.config.Errors)
 	}
-
-	res, err := a.resolveOptions(opts)
+	a.mnemonics = opts.Mnemonics
+	sh, err := shellFor(opts.Shell)
 	if err != nil {
 		return err
 	}
+	a.shell = sh
 
-	if opts.Mode == "doctor" {
-		return a.runDoctor(ctx, opts, res)
+	if opts.Revert {
+		return a.printRevert(opts, args)
 	}
-
-	r, err := port.ParseRange(res.Range)
+	opts, err = a.applyWorkdir(opts)
+	if err != nil {
+		return err
+	}
+	if d, ok := a.executor.(DefaultExecutor); ok {
+		d.NoProcessGroup = d.NoProcessGroup || opts.NoProcessGroup
+		if opts.Workdir != "" {
+			d.Dir = opts.CWD
+		}
+		if opts.Umask != nil {
+			d.Umask = opts.Umask
+		}
+		a.executor = d
+	}
+	if err := validateEnvFilter(opts.EnvFilter); err != nil {
+		return err
+	}
+	if err := validateOnHUP(opts.OnHUP); err != nil {
+		return err
+	}
+	if err := validateWatch(opts); err != nil {
+		return err
+	}
+	if err := validateReserve(opts, args, a.executor); err != nil {
+		return err
+	}
+	a.protocol = ""
+	if opts.Probe != "" {
+		if a.protocol, err = port.ParseProtocol(opts.Probe); err != nil {
+			return fmt.Errorf("--probe: %w", err)
+		}
+	}
+	cmdCtx := ctx
+	ctx, cancel, err := pipelineContext(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	if opts.Mode == "docs" {
+		if opts.DocsCheck && opts.DocsWrite {
+			return errors.New("--check and --write are mutually exclusive")
+		}
+		defer a.docsMode(&opts)()
+	}
+	if opts.Mode == "simulate" {
+		return a.bounded(ctx, opts, func(ctx context.Context) error {
+			return a.runSimulate(ctx, opts)
+		})
+	}
+	if opts.UseLock && opts.FromSnapshot != "" {
+		return errors.New("--use-lock and --from-snapshot are mutually exclusive")
+	}
+	if opts.Record != "" && opts.Replay != "" {
+		return errors.New("--record and --replay are mutually exclusive")
+	}
+	if opts.FilesOnly && opts.EnvOnly {
+		return errors.New("--files-only and --env-only are mutually exclusive")
+	}
+	if opts.Replay != "" {
+		restore, err := a.startReplay(&opts, args)
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+	if opts.Metrics != "" {
+		stop, err := a.serveMetrics(opts.Metrics)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+	opts, args, err = a.applyScript(opts, args)
+	if err != nil {
+		return err
+	}
+	opts, err = a.applyNamespaceFrom(ctx, opts)
 	if err != nil {
-		return fmt.Errorf("range: %w", err)
+		return err
+	}
+	opts = a.checkSandbox(opts)
+	var probe checkFunc
+	if opts.Mode == "status" {
+		// Status looks up the ports a run asks for, whoever holds them
+		// now, and checks them itself.
+		probe, opts.Pure = a.isFree, true
+	}
+	if opts.Pure {
+		// Every port counts as free, so each key gets its preferred port
+		// and the result depends only on the inputs.
+		isFree := a.isFree
+		a.isFree = func(port.Protocol, int) bool { return true }
+		defer func() { a.isFree = isFree }()
+	} else if a.replaying == nil {
+		defer a.avoidReservations(opts.CWD)()
+	}
+	if err := a.confirmPlanCommands(opts); err != nil {
+		return err
+	}
+	if opts.Mode == "ide" {
+		defer a.cacheProbes(opts.ProbeTTL)()
+		return a.serveIDE(cmdCtx, opts)
+	}
+	if opts.Mode == "serve" {
+		defer a.cacheProbes(opts.ProbeTTL)()
+		return a.runServe(cmdCtx, opts)
+	}
+	if opts.Mode == "batch" {
+		return a.bounded(ctx, opts, func(ctx context.Context) error {
+			return a.runBatch(ctx, opts, args)
+		})
 	}
 
-	seed := a.computeSeed(opts)
-	discoveries, scanStats, scanErr := a.scanDiscoveries(ctx, opts.CWD, res)
-	if scanErr != nil {
-		return fmt.Errorf("scan: %w", scanErr)
+	var project *composeProject
+	if opts.Mode == "compose" {
+		// Each published host port becomes a key of its own.
+		project, err = readComposeProject(opts.CWD, args)
+		if err != nil {
+			return err
+		}
+		opts.PortEnv = append(slices.Clone(opts.PortEnv), project.keys()...)
+	}
+	var procs []process
+	if opts.Mode == "up" {
+		// Each process gets a key of its own for PORT.
+		procs, err = a.readProcesses(opts, args)
+		if err != nil {
+			return err
+		}
+		opts.PortEnv = append(slices.Clone(opts.PortEnv), processKeys(procs)...)
+	}
+	if opts.Mode == "status" {
+		// Processes name the command expected on each of their ports.
+		procs, err = a.statusProcesses(opts)
+		if err != nil {
+			return err
+		}
+		opts.PortEnv = append(slices.Clone(opts.PortEnv), processKeys(procs)...)
 	}
 
-	decisions, finalKeys, err := a.applySelection(discoveries, opts.PortEnv, res)
+	res, err := a.resolveOptions(opts)
 	if err != nil {
 		return err
 	}
+	if a.bindErr != nil {
+		res.Warnings = append(res.Warnings, a.bindWarning())
+	}
+
+	if opts.Mode == "doctor" {
+		return a.bounded(ctx, opts, func(ctx context.Context) error {
+			return a.runDoctor(ctx, opts, res)
+		})
+	}
+	if opts.Mode == "adopt" {
+		return a.bounded(ctx, opts, func(ctx context.Context) error {
+			return a.runAdopt(ctx, opts, res)
+		})
+	}
 
-	assignments, overrides, assignWarnings, err := a.assignWithOptionalLock(opts, r, seed, finalKeys)
+	if opts.Record != "" {
+		// Probe outcomes are only seen when planning, never from the cache.
+		opts.CacheTTL = 0
+		defer a.startRecording(opts)()
+	}
+	if opts.Provenance != "" {
+		// Cached plans do not keep the decisions naming what was read.
+		opts.CacheTTL = 0
+	}
+	var p *plan
+	err = a.bounded(ctx, opts, func(ctx context.Context) (err error) {
+		p, err = a.planCached(ctx, opts, res)
+		return err
+	})
 	if err != nil {
+		a.notifyFailure(cmdCtx, opts, "autoport: allocation failed", err)
 		return err
 	}
-	warnings := append([]string{}, res.Warnings...)
-	warnings = append(warnings, assignWarnings...)
+	if opts.Record != "" {
+		if err := a.writeTrace(opts.Record, p); err != nil {
+			return err
+		}
+	}
+	if opts.Provenance != "" {
+		if err := a.writeProvenance(opts.Provenance, opts, p); err != nil {
+			return err
+		}
+	}
+	if a.replaying != nil {
+		a.checkReplay(p)
+	}
+	if err := checkRequiredKeys(opts, p); err != nil {
+		a.notifyFailure(cmdCtx, opts, "autoport: allocation failed", err)
+		return err
+	}
+	if err := promoteWarnings(p.Warnings, a.config.WarningsAsErrors); err != nil {
+		a.notifyFailure(cmdCtx, opts, "autoport: allocation failed", err)
+		return err
+	}
+	a.inherited = map[string]bool{}
+	for _, as := range p.Assignments {
+		if as.Inherited {
+			a.inherited[as.Key] = true
+		}
+	}
+	if opts.Mode == "run" && opts.Format != "json" {
+		// JSON output carries warnings itself; other formats keep stdout
+		// clean for eval and report them on stderr.
+		for _, w := range p.AssignWarnings {
+			a.logger.Warn(a.warningText(w), slog.String("code", w.Code))
+		}
+	}
 
 	switch opts.Mode {
 	case "explain":
-		return a.renderExplain(opts, args, res, r, seed, decisions, assignments, warnings, scanStats)
+		forecast, err := a.forecast(ctx, opts, res, p)
+		if err != nil {
+			return fmt.Errorf("forecast: %w", err)
+		}
+		return a.renderExplain(opts, args, res, p.Range, p.Seed, p.Decisions, p.Assignments, p.Warnings, p.Stats, forecast)
+	case "docs":
+		return a.renderDocs(opts, args, p)
+	case "status":
+		return a.renderStatus(opts, args, procs, p, probe)
 	case "lock":
-		return a.writeLockfile(opts, res.Range, overrides)
+		return a.writeLockfile(ctx, opts, res.Range, p.Overrides)
+	case "compose":
+		return a.renderCompose(opts, project, aliasHosts(p.Overrides, p.Alias))
+	case "up":
+		if !opts.DryRun {
+			if err := a.confirmProcesses(opts, procs); err != nil {
+				return err
+			}
+			if err := a.confirmHooks(opts, true); err != nil {
+				return err
+			}
+		}
+		return a.runUp(cmdCtx, opts, procs, aliasHosts(p.Overrides, p.Alias))
 	case "run":
-		return a.runOrExport(ctx, opts, args, res.Range, overrides, warnings)
+		changes, previous, branchWarnings := a.trackLastRun(ctx, opts, res.Range, p.Seed.Value, p.Assignments)
+		var unchanged map[string]bool
+		if opts.ChangedOnly {
+			unchanged = a.unchangedKeys(ctx, opts, previous, p.Assignments)
+		}
+		if !opts.DryRun {
+			if err := a.confirmHooks(opts, len(args) > 0); err != nil {
+				return err
+			}
+			a.fireOnChange(cmdCtx, changes, a.buildExecEnv(a.environ, p.Overrides))
+		}
+		if opts.OnHUP != "" || opts.Watch {
+			loaded := a.config
+			a.replan = func(ctx context.Context) (map[string]string, error) {
+				res := res
+				if a.config != loaded {
+					// --watch read the config again; its presets and
+					// scanner settings apply from now on.
+					var err error
+					if res, err = a.resolveOptions(opts); err != nil {
+						return nil, err
+					}
+				}
+				next, err := a.plan(ctx, opts, res)
+				if err != nil {
+					return nil, err
+				}
+				return aliasHosts(next.Overrides, next.Alias), nil
+			}
+		}
+		if err := promoteWarnings(branchWarnings, a.config.WarningsAsErrors); err != nil {
+			return err
+		}
+		warnings := p.Warnings
+		if opts.Format == "json" {
+			warnings = append(slices.Clone(warnings), branchWarnings...)
+		} else {
+			for _, w := range branchWarnings {
+				a.logger.Warn(a.warningText(w), slog.String("code", w.Code))
+			}
+		}
+		return a.runOrExport(cmdCtx, opts, args, res.Range, p.Seed.Value, aliasHosts(p.Overrides, p.Alias), warnings, changes, unchanged)
+	case "proxy":
+		return a.runProxy(cmdCtx, opts, p.Assignments)
+	case "snapshot":
+		snap := snapshot.New(opts.CWD, p.Seed.Value, res.Range, opts.Namespace, p.Overrides, a.now().UTC().Format(time.RFC3339))
+		return snapshot.Write(a.stdout, snap)
 	default:
 		return fmt.Errorf("unknown mode %q", opts.Mode)
 	}
 }
 
+// plan is the outcome of discovery, selection, and allocation for one
+// project, shared by every mode that reports or uses assignments.
+type plan struct {
+	Range          port.Range
+	Seed           seedInfo
+	Decisions      []keyDecision
+	Assignments    []assignedPort
+	Overrides      map[string]string
+	Warnings       []warning
+	AssignWarnings []warning
+	Stats          scanner.Stats
+	// Alias is the project's loopback address under --loopback-alias.
+	Alias string
+}
+
+func (a *App) plan(ctx context.Context, opts Options, res resolvedOptions) (*plan, error) {
+	r, err := port.ParseRange(res.Range)
+	if err != nil {
+		return nil, fmt.Errorf("range: %w", err)
+	}
+
+	var si seedInfo
+	var discoveries []scanner.Discovery
+	var scanStats scanner.Stats
+	if a.replaying != nil {
+		// The recorded project need not exist here: seed and discoveries
+		// come from the trace.
+		si = a.replaying.replaySeed(opts.Replay)
+		discoveries = a.replaying.discoveries()
+	} else {
+		si, err = a.computeSeed(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		var scanErr error
+		discoveries, scanStats, scanErr = a.scanDiscoveries(ctx, opts.CWD, res)
+		if scanErr != nil {
+			return nil, fmt.Errorf("scan: %w", scanErr)
+		}
+	}
+	var alias string
+	if a.aliasEnabled(opts) {
+		// Ports only need to be free on the project's own address.
+		alias = loopbackAlias(si.Value)
+		probeHost := a.probeHost
+		a.probeHost = alias
+		defer func() { a.probeHost = probeHost }()
+	}
+	if a.recording != nil {
+		a.recording.recordPlanInputs(opts, res, a.config, si, discoveries)
+	}
+
+	decisions, finalKeys, err := a.applySelection(discoveries, opts.PortEnv, res)
+	if err != nil {
+		return nil, err
+	}
+
+	current := currentValues(discoveries)
+	assignments, overrides, assignWarnings, err := a.assignWithOptionalLock(ctx, opts, r, si.Value, finalKeys, current)
+	if err != nil {
+		return nil, err
+	}
+	warnings := append([]warning{}, res.Warnings...)
+	warnings = append(warnings, a.unmanagedWarnings(discoveries, finalKeys)...)
+	warnings = append(warnings, assignWarnings...)
+	return &plan{
+		Range:          r,
+		Seed:           si,
+		Decisions:      decisions,
+		Assignments:    assignments,
+		Overrides:      overrides,
+		Warnings:       warnings,
+		AssignWarnings: assignWarnings,
+		Stats:          scanStats,
+		Alias:          alias,
+	}, nil
+}
+
 func (a *App) resolveOptions(opts Options) (resolvedOptions, error) {
 	res := resolvedOptions{
 		Range:    port.DefaultRange,
@@ -231,8 +962,11 @@ func (a *App) resolveOptions(opts Options) (resolvedOptions, error) {
 		Includes: append([]string{}, opts.Includes...),
 		Excludes: append([]string{}, opts.Excludes...),
 		Strict:   a.config.Strict,
-		Warnings: append([]string{}, a.config.Warnings...),
 	}
+	for _, w := range a.config.Warnings {
+		res.Warnings = append(res.Warnings, warning{Code: WarnConfigDeprecated, Message: w})
+	}
+	res.Warnings = append(res.Warnings, validateWarningPolicy(a.config.WarningsAsErrors)...)
 
 	if opts.Range != "" {
 		res.Range = opts.Range
@@ -243,61 +977,258 @@ func (a *App) resolveOptions(opts Options) (resolvedOptions, error) {
 	if len(a.config.Scanner.IgnoreDirs) > 0 {
 		res.IgnoreDirs = append([]string{}, a.config.Scanner.IgnoreDirs...)
 	}
+	res.ExcludeCompose = a.config.Scanner.ExcludeComposeEnv
+	res.KeepIgnored = opts.Mode == "explain"
+	res.FilesOnly, res.EnvOnly = opts.FilesOnly, opts.EnvOnly
+	res.noteRule(ruleIgnorePrefix, opts.Ignores, opts.originOf("ignores", true))
+	res.noteRule(ruleIncludeKeys, opts.Includes, opts.originOf("includes", true))
+	res.noteRule(ruleExcludeKeys, opts.Excludes, opts.originOf("excludes", true))
+	res.ExcludeCategories = append(res.ExcludeCategories, opts.ExcludeCategories...)
+	res.noteRule(ruleExcludeCategory, opts.ExcludeCategories, opts.originOf("exclude_categories", true))
+	res.noteRule(ruleManualKey, opts.PortEnv, opts.originOf("keys", true))
+	if res.ExcludeCompose {
+		origin := "config scanner.exclude_compose_env"
+		if path := a.config.Origin("scanner.exclude_compose_env"); path != "" {
+			origin += " (" + path + ")"
+		}
+		res.noteRule(ruleComposeEnvOff, []string{""}, origin)
+	}
+
+	if a.replaying != nil {
+		// Replay drops presets; their key patterns come from the trace.
+		res.ExcludePatterns = a.replaying.ExcludePatterns
+		res.noteRule(ruleExcludePattern, res.ExcludePatterns, "replay "+opts.Replay)
+	}
 
+	rangeOrigin := originDefault
 	for _, presetName := range opts.Presets {
 		preset, ok := a.lookupPreset(presetName)
 		if !ok {
 			if res.Strict {
 				return resolvedOptions{}, fmt.Errorf("unknown preset %q (strict mode)", presetName)
 			}
-			w := fmt.Sprintf("preset not found: %s", presetName)
-			res.Warnings = append(res.Warnings, w)
+			res.Warnings = append(res.Warnings, newWarning(WarnPresetMissing, "preset not found: %s", presetName).with("preset", presetName))
 			a.logger.Warn("preset not found", slog.String("preset", presetName))
 			continue
 		}
 		res.Ignores = append(res.Ignores, preset.IgnorePrefixes...)
 		res.Includes = append(res.Includes, preset.IncludeKeys...)
 		res.Excludes = append(res.Excludes, preset.ExcludeKeys...)
+		res.ExcludePatterns = append(res.ExcludePatterns, preset.ExcludePatterns...)
+		res.ExcludeCategories = append(res.ExcludeCategories, preset.ExcludeCategories...)
+		origin := a.presetOrigin(presetName)
+		res.noteRule(ruleIgnorePrefix, preset.IgnorePrefixes, origin)
+		res.noteRule(ruleIncludeKeys, preset.IncludeKeys, origin)
+		res.noteRule(ruleExcludeKeys, preset.ExcludeKeys, origin)
+		res.noteRule(ruleExcludePattern, preset.ExcludePatterns, origin)
+		res.noteRule(ruleExcludeCategory, preset.ExcludeCategories, origin)
 		if preset.Range != "" && opts.Range == "" {
 			res.Range = preset.Range
+			rangeOrigin = a.presetOrigin(presetName)
 		}
 	}
 
 	if opts.Range != "" {
 		res.Range = opts.Range
+		rangeOrigin = opts.originOf("range", true)
+	}
+	expanded, err := a.config.ExpandRange(res.Range)
+	if err != nil {
+		return resolvedOptions{}, fmt.Errorf("range: %w", err)
+	}
+	if expanded != res.Range {
+		rangeOrigin += fmt.Sprintf(", named range %s", res.Range)
+		if path := a.config.Origin("ranges." + res.Range); path != "" {
+			rangeOrigin += fmt.Sprintf(" (%s)", path)
+		}
+		res.Range = expanded
+	}
+	res.Origins = []optionOrigin{
+		{Option: "range", Value: res.Range, Origin: rangeOrigin},
+		{Option: "namespace", Value: opts.Namespace, Origin: opts.originOf("namespace", opts.Namespace != "")},
+		{Option: "presets", Value: strings.Join(opts.Presets, ","), Origin: opts.originOf("presets", len(opts.Presets) > 0)},
+		{Option: "format", Value: opts.Format, Origin: opts.originOf("format", false)},
 	}
 	res.Ignores = dedupeSorted(res.Ignores)
 	res.Includes = dedupeSorted(res.Includes)
 	res.Excludes = dedupeSorted(res.Excludes)
+	res.ExcludePatterns = dedupeSorted(res.ExcludePatterns)
+	res.ExcludeCategories = dedupeSorted(res.ExcludeCategories)
+	if err := a.validateCategories(res.ExcludeCategories); err != nil {
+		return resolvedOptions{}, fmt.Errorf("exclude categories: %w", err)
+	}
 	return res, nil
 }
 
+// lookupPreset returns the named preset. A config preset named like a
+// built-in was merged over it at load time, so it takes precedence.
 func (a *App) lookupPreset(name string) (config.Preset, bool) {
-	if preset, ok := config.BuiltInPresets[name]; ok {
-		return preset, true
-	}
-	if a.config == nil {
-		return config.Preset{}, false
+	if a.config != nil {
+		if preset, ok := a.config.Presets[name]; ok {
+			return preset, true
+		}
 	}
-	preset, ok := a.config.Presets[name]
+	preset, ok := config.BuiltInPresets[name]
 	return preset, ok
 }
 
-func (a *App) computeSeed(opts Options) uint32 {
+// presetOrigin describes where a preset is defined.
+func (a *App) presetOrigin(name string) string {
+	_, builtIn := config.BuiltInPresets[name]
+	path := a.config.Origin("presets." + name)
+	switch {
+	case builtIn && path != "":
+		return fmt.Sprintf("preset %s (%s over built-in)", name, path)
+	case builtIn:
+		return fmt.Sprintf("preset %s (built-in)", name)
+	case path != "":
+		return fmt.Sprintf("preset %s (%s)", name, path)
+	}
+	return "preset " + name
+}
+
+// seedInfo is the resolved deterministic seed plus the material it was
+// derived from and where that choice came from, for explain output.
+type seedInfo struct {
+	Value    uint32
+	Material string
+	Origin   string
+}
+
+func (a *App) computeSeed(ctx context.Context, opts Options) (seedInfo, error) {
 	if opts.Seed != nil {
-		return *opts.Seed
+		return seedInfo{Value: *opts.Seed, Material: "explicit", Origin: opts.originOf("seed", true)}, nil
+	}
+	if opts.SeedString != "" {
+		return seedInfo{Value: port.SeedForMaterial("string:"+opts.SeedString, opts.Namespace), Material: "string:" + opts.SeedString, Origin: opts.originOf("seed", true)}, nil
+	}
+	seedFrom := opts.SeedFrom
+	origin := opts.originOf("seed", seedFrom != "")
+	if seedFrom == "" && a.config.SeedFrom != "" {
+		seedFrom = a.config.SeedFrom
+		origin = "config seed_from"
+		if path := a.config.Origin("seed_from"); path != "" {
+			origin += " (" + path + ")"
+		}
 	}
-	return port.SeedFor(opts.CWD, opts.Namespace)
+	if seedFrom == "" || seedFrom == "path" {
+		root, rootOrigin, err := a.seedRoot(opts)
+		if err != nil {
+			return seedInfo{}, err
+		}
+		path, inRepo := a.seedPath(ctx, opts.CWD, root == "git")
+		norm := a.seedPathOrigin()
+		if root == "git" {
+			rootOrigin = "seed root git: " + rootOrigin
+			if !inRepo {
+				rootOrigin += ", not in a git work tree so cwd is used"
+			}
+			if norm != "" {
+				norm = rootOrigin + "; config " + norm
+			} else {
+				norm = rootOrigin
+			}
+		} else if norm != "" {
+			norm = "config " + norm
+		}
+		if a.config.SeedBranch {
+			// Feature branches get their own ports; mainline branches keep
+			// the plain path seed.
+			branch, _ := a.gitBranch(ctx, opts.CWD)
+			if a.config.BranchSeeded(branch) {
+				material := path + "@" + branch
+				origin = "config seed_branch"
+				if file := a.config.Origin("seed_branch"); file != "" {
+					origin += " (" + file + ")"
+				}
+				if norm != "" {
+					origin += "; " + norm
+				}
+				return seedInfo{Value: port.SeedForMaterial(material, opts.Namespace), Material: "path:" + material, Origin: origin}, nil
+			}
+		}
+		if norm != "" {
+			origin += "; " + norm
+		}
+		return seedInfo{Value: port.SeedFor(path, opts.Namespace), Material: "path:" + path, Origin: origin}, nil
+	}
+
+	// Any other value names a git remote: the same repository yields the
+	// same seed regardless of where it is cloned.
+	url, err := gitinfo.RemoteURL(ctx, opts.CWD, seedFrom)
+	if err != nil {
+		return seedInfo{}, fmt.Errorf("seed from remote %q: %w", seedFrom, err)
+	}
+	branch, err := a.gitBranch(ctx, opts.CWD)
+	if err != nil {
+		return seedInfo{}, fmt.Errorf("seed from remote %q: %w", seedFrom, err)
+	}
+	material := gitinfo.NormalizeRemote(url) + "@" + branch
+	return seedInfo{Value: port.SeedForMaterial(material, opts.Namespace), Material: "remote:" + material, Origin: origin}, nil
+}
+
+// gitBranch returns the branch seeds and caches are keyed by.
+func (a *App) gitBranch(ctx context.Context, cwd string) (string, error) {
+	if a.branch != "" {
+		return a.branch, nil
+	}
+	if a.config.BranchResolverCmd != "" {
+		return a.resolveBranch(ctx, cwd)
+	}
+	return gitinfo.Branch(ctx, cwd)
 }
 
 func (a *App) scanDiscoveries(ctx context.Context, cwd string, res resolvedOptions) ([]scanner.Discovery, scanner.Stats, error) {
-	s := scanner.New(cwd,
+	discoveries, stats, err := a.newScanner(cwd, res).ScanDetailed(ctx)
+	if err != nil || res.EnvOnly {
+		return discoveries, stats, err
+	}
+	discoveries, err = a.discoverPlugins(ctx, cwd, res, discoveries)
+	return discoveries, stats, err
+}
+
+// newScanner returns the scanner for cwd as res configures it; extra
+// options are applied last.
+func (a *App) newScanner(cwd string, res resolvedOptions, extra ...scanner.Option) *scanner.Scanner {
+	opts := []scanner.Option{
 		scanner.WithIgnores(res.Ignores),
 		scanner.WithEnviron(a.environ),
 		scanner.WithIgnoreDirs(res.IgnoreDirs),
 		scanner.WithMaxDepth(res.MaxDepth),
-	)
-	return s.ScanDetailed(ctx)
+		scanner.WithExcludeCompose(res.ExcludeCompose),
+		scanner.WithKeepIgnored(res.KeepIgnored),
+		scanner.WithEnvironmentScan(!res.FilesOnly),
+		scanner.WithFileScan(!res.EnvOnly),
+		scanner.WithFS(a.projectFS(cwd)),
+	}
+	return scanner.New(cwd, append(opts, extra...)...)
+}
+
+// unmanagedWarnings reports selected keys whose task runner file value
+// overrides the environment, when config scanner.warn_unmanaged is set.
+func (a *App) unmanagedWarnings(discoveries []scanner.Discovery, keys []string) []warning {
+	if !a.config.Scanner.WarnUnmanaged {
+		return nil
+	}
+	var warnings []warning
+	for _, d := range discoveries {
+		if d.Unmanaged && slices.Contains(keys, d.Key) {
+			w := newWarning(WarnUnmanagedPort, "%s is set in %s in a way that overrides the environment, so the assigned port will not reach it", d.Key, d.Source).with("key", d.Key).with("source", d.Source)
+			warnings = append(warnings, w)
+			a.logger.Warn(a.warningText(w), slog.String("code", w.Code))
+		}
+	}
+	return warnings
+}
+
+// matchPattern returns the first of patterns matching key, or "".
+func matchPattern(patterns []string, key string) string {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, key); ok {
+			return pattern
+		}
+	}
+	return ""
 }
 
 func (a *App) applySelection(discoveries []scanner.Discovery, manual []string, res resolvedOptions) ([]keyDecision, []string, error) {
@@ -308,161 +1239,623 @@ func (a *App) applySelection(discoveries []scanner.Discovery, manual []string, r
 	decisions := make([]keyDecision, 0, len(discoveries)+len(manual))
 
 	for _, d := range discoveries {
+		if d.IgnoredBy != "" {
+			decisions = append(decisions, keyDecision{
+				Key:      d.Key,
+				Source:   d.Source,
+				Kind:     d.Kind,
+				Reason:   "ignored by prefix " + d.IgnoredBy,
+				Rule:     res.rule(ruleIgnorePrefix, d.IgnoredBy),
+				Category: a.categoryOf(d.Key),
+			})
+			continue
+		}
 		included := true
 		reason := "discovered"
+		rule := selectionRule{Rule: ruleDiscovered, Origin: d.Source}
+		category := a.categoryOf(d.Key)
 		if _, excluded := excludeSet[d.Key]; excluded {
 			included = false
 			reason = "excluded by exact key"
+			rule = res.rule(ruleExcludeKeys, d.Key)
+		} else if pattern := matchPattern(res.ExcludePatterns, d.Key); pattern != "" {
+			included = false
+			reason = "excluded by pattern " + pattern
+			rule = res.rule(ruleExcludePattern, pattern)
+		} else if slices.Contains(res.ExcludeCategories, category) {
+			included = false
+			reason = "excluded by category " + category
+			rule = res.rule(ruleExcludeCategory, category)
+		} else if res.ExcludeCompose && d.Kind == scanner.KindCompose {
+			included = false
+			reason = "compose project .env (scanner.exclude_compose_env)"
+			rule = res.rule(ruleComposeEnvOff, "")
 		}
 		if len(includeSet) > 0 {
 			if _, ok := includeSet[d.Key]; !ok {
 				included = false
 				reason = "not in include_keys"
+				rule = selectionRule{Rule: ruleNotIncluded, Origin: res.includeOrigins()}
 			} else if included {
 				reason = "included by include_keys"
+				rule = res.rule(ruleIncludeKeys, d.Key)
+			}
+		}
+
+		decisions = append(decisions, keyDecision{
+			Key:      d.Key,
+			Source:   d.Source,
+			Kind:     d.Kind,
+			Included: included,
+			Reason:   reason,
+			Rule:     rule,
+			Category: category,
+		})
+		if included {
+			keySet[d.Key] = struct{}{}
+		}
+	}
+
+	for _, key := range manual {
+		if !isValidEnvVarName(key) {
+			return nil, nil, fmt.Errorf("invalid env key %q", key)
+		}
+		keySet[key] = struct{}{}
+		decisions = append(decisions, keyDecision{
+			Key:      key,
+			Source:   "manual",
+			Included: true,
+			Reason:   "included by -k",
+			Rule:     res.rule(ruleManualKey, key),
+			Category: a.categoryOf(key),
+		})
+	}
+
+	finalKeys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		finalKeys = append(finalKeys, key)
+	}
+	sort.Strings(finalKeys)
+	sort.Slice(decisions, func(i, j int) bool {
+		if decisions[i].Key == decisions[j].Key {
+			return decisions[i].Source < decisions[j].Source
+		}
+		return decisions[i].Key < decisions[j].Key
+	})
+	return decisions, finalKeys, nil
+}
+
+// currentValues maps discovered keys to the values project files assign
+// them today. Values from the environment are left out: they may be ports
+// an earlier run exported into the shell, not the project's own.
+func currentValues(discoveries []scanner.Discovery) map[string]string {
+	out := make(map[string]string, len(discoveries))
+	for _, d := range discoveries {
+		if d.Value != "" && d.Kind != scanner.KindEnvironment {
+			out[d.Key] = d.Value
+		}
+	}
+	return out
+}
+
+func (a *App) assignWithOptionalLock(ctx context.Context, opts Options, r port.Range, seed uint32, keys []string, current map[string]string) ([]assignedPort, map[string]string, []warning, error) {
+	// kept holds current values retained by --prefer-current and
+	// --respect-existing so that no other key is allocated onto them.
+	kept := map[int]bool{}
+	freeFor := func(proto port.Protocol) port.IsFreeFunc {
+		check := a.checkFor(proto)
+		return func(p int) bool { return !kept[p] && check(p) }
+	}
+	isFree := freeFor(a.protocol)
+	allocator := port.Allocator{Seed: seed, Range: r, IsFree: isFree}
+	warnings := []warning{}
+
+	inherited := a.inheritedValues(opts)
+	locked := map[string]string{}
+	if opts.UseLock {
+		path := lockfile.PathFor(opts.CWD)
+		lf, err := a.readLockfile(ctx, path)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("read lockfile: %w", err)
+		}
+		if lf.CWDFingerprint != lockfile.Fingerprint(opts.CWD) {
+			return nil, nil, nil, fmt.Errorf("lockfile cwd fingerprint mismatch")
+		}
+		if opts.Range != "" && !sameRange(lf.Range, r) {
+			w := newWarning(WarnLockfileRangeDrift, "lockfile range %s differs from CLI range %s", lf.Range, opts.Range)
+			warnings = append(warnings, w.with("lockfile_range", lf.Range).with("cli_range", opts.Range))
+		}
+		locked = lockfile.ToMap(lf.Assignments)
+	}
+	if opts.FromSnapshot != "" {
+		snap, err := snapshot.Read(opts.FromSnapshot)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("read snapshot: %w", err)
+		}
+		// A snapshot reproduces its full key set, even keys this checkout
+		// would not discover on its own.
+		locked = snap.ToMap()
+		keys = dedupeSorted(append(append([]string{}, keys...), sortedKeys(locked)...))
+	}
+	if t := a.replaying; t != nil {
+		locked, inherited = t.Locked, t.Inherited
+		keys = dedupeSorted(append(append([]string{}, keys...), sortedKeys(locked)...))
+	}
+	if t := a.recording; t != nil {
+		t.Locked, t.Inherited = locked, inherited
+	}
+
+	keys = orderKeys(keys, a.config.KeyOrder)
+	for _, key := range keys {
+		// Inherited ports are taken before any key is allocated.
+		if p, err := strconv.Atoi(inherited[key]); err == nil {
+			kept[p] = true
+		}
+	}
+	results := make([]assignedPort, 0, len(keys))
+	overrides := make(map[string]string, len(keys))
+	pinned, err := a.assignPinned(ctx, opts, seed, keys, locked, inherited, kept, freeFor)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	canonical, err := a.assignCanonical(ctx, allocator, keys, locked)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if opts.RequirePreferred {
+		for _, key := range keys {
+			if as, ok := canonical[key]; ok && as.Probes > 0 {
+				return nil, nil, nil, fmt.Errorf("preferred port %d for %s is in use%s (--require-preferred)", as.Preferred, key, heldBy(a.portOwners(), as.Preferred))
 			}
 		}
+	}
+
+	// Keys in the same group share the port allocated for the first member;
+	// only the first member consumes an allocation slot.
+	groupPorts := map[string]assignedPort{}
+	for _, key := range keys {
+		// A group shares the port a member keeps from the environment or
+		// the lockfile, or is configured with, wherever that member sorts.
+		group, _ := a.config.GroupOf(key)
+		if group == "" || groupPorts[group].Key != "" {
+			continue
+		}
+		val, ok := inherited[key]
+		if !ok {
+			val, ok = locked[key]
+		}
+		if p, err := strconv.Atoi(val); ok && err == nil {
+			groupPorts[group] = assignedPort{Key: key, Value: val, Preferred: p, Assigned: p, Group: group}
+		} else if as, ok := pinned[key]; ok {
+			groupPorts[group] = as
+		}
+	}
+	slot := 0
+	for _, key := range keys {
+		group, _ := a.config.GroupOf(key)
+		if val, ok := inherited[key]; ok {
+			p, _ := strconv.Atoi(val)
+			results = append(results, assignedPort{Key: key, Value: val, Preferred: p, Assigned: p, Inherited: true, Group: group})
+			overrides[key] = val
+			continue
+		}
+		if val, ok := locked[key]; ok {
+			fromSnap := opts.FromSnapshot != ""
+			p, err := strconv.Atoi(val)
+			if err != nil {
+				if fromSnap {
+					return nil, nil, nil, fmt.Errorf("snapshot value for %s is not numeric", key)
+				}
+				return nil, nil, nil, fmt.Errorf("lockfile value for %s is not numeric", key)
+			}
+			results = append(results, assignedPort{Key: key, Value: val, Preferred: p, Assigned: p, Probes: 0, FromLock: !fromSnap, FromSnap: fromSnap, Group: group})
+			overrides[key] = val
+			continue
+		}
+		if as, ok := pinned[key]; ok {
+			as.Group = group
+			results = append(results, as)
+			overrides[key] = as.Value
+			continue
+		}
+		if as, ok := canonical[key]; ok {
+			as.Group = group
+			if _, taken := groupPorts[group]; group != "" && !taken {
+				groupPorts[group] = as
+			}
+			results = append(results, as)
+			overrides[key] = as.Value
+			continue
+		}
+		if shared, ok := groupPorts[group]; ok && group != "" {
+			shared.Key = key
+			results = append(results, shared)
+			overrides[key] = shared.Value
+			continue
+		}
+		alloc := allocator
+		if proto := a.protocolFor(key); proto != a.protocol {
+			alloc.IsFree = freeFor(proto)
+		}
+		if p, ok := keepCurrent(opts, r, current[key], results, alloc.IsFree); ok {
+			kept[p] = true
+			as := assignedPort{Key: key, Value: strconv.Itoa(p), Preferred: p, Assigned: p, Current: true, Group: group}
+			if group != "" {
+				groupPorts[group] = as
+			}
+			results = append(results, as)
+			overrides[key] = as.Value
+			continue
+		}
+		assigned, preferred, probes, err := alloc.PortForContext(ctx, slot)
+		var exhausted *port.ExhaustedError
+		if errors.As(err, &exhausted) {
+			return nil, nil, nil, a.allocationError(key, len(keys), results, r, err)
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("find port for %s: %w", key, err)
+		}
+		if opts.RequirePreferred && probes > 0 {
+			return nil, nil, nil, fmt.Errorf("preferred port %d for %s is in use%s (--require-preferred)", preferred, key, heldBy(a.portOwners(), preferred))
+		}
+		slot++
+		a.metrics.recordAllocation(probes)
+		if a.distinct {
+			kept[assigned] = true
+		}
+		v := strconv.Itoa(assigned)
+		as := assignedPort{Key: key, Value: v, Preferred: preferred, Assigned: assigned, Probes: probes, Group: group}
+		if group != "" {
+			groupPorts[group] = as
+		}
+		results = append(results, as)
+		overrides[key] = v
+	}
+	return results, overrides, warnings, nil
+}
+
+// inheritedValues returns the values the invoking environment sets, which
+// --respect-existing (or config respect_existing) keeps as they are.
+func (a *App) inheritedValues(opts Options) map[string]string {
+	if !opts.RespectExisting && !a.config.RespectExisting {
+		return nil
+	}
+	out := map[string]string{}
+	for _, kv := range a.environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && v != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// orderKeys returns the sorted keys in allocation order: the keys listed in
+// order first, in that order, then every other key alphabetically. Listed
+// keys the project lacks are skipped.
+func orderKeys(keys, order []string) []string {
+	if len(order) == 0 {
+		return keys
+	}
+	present := makeSet(keys)
+	out := make([]string, 0, len(keys))
+	for _, key := range order {
+		if _, ok := present[key]; ok {
+			out = append(out, key)
+			delete(present, key)
+		}
+	}
+	for _, key := range keys {
+		if _, ok := present[key]; ok {
+			out = append(out, key)
+		}
+	}
+	return out
+}
 
-		decisions = append(decisions, keyDecision{
-			Key:      d.Key,
-			Source:   d.Source,
-			Included: included,
-			Reason:   reason,
-		})
-		if included {
-			keySet[d.Key] = struct{}{}
+// sameRange reports whether spec describes the same ports as r, ignoring
+// spelling differences such as named ranges or segment order.
+func sameRange(spec string, r port.Range) bool {
+	other, err := port.ParseRange(spec)
+	return err == nil && other.String() == r.String()
+}
+
+// keepCurrent reports whether value should be kept under --prefer-current: it
+// must be a port inside the range that is free and not already assigned.
+func keepCurrent(opts Options, r port.Range, value string, assigned []assignedPort, isFree port.IsFreeFunc) (int, bool) {
+	if !opts.PreferCurrent || value == "" {
+		return 0, false
+	}
+	p, err := strconv.Atoi(value)
+	if err != nil || !r.Contains(p) {
+		return 0, false
+	}
+	for _, as := range assigned {
+		if as.Assigned == p {
+			return 0, false
 		}
 	}
+	return p, isFree(p)
+}
 
-	for _, key := range manual {
-		if !isValidEnvVarName(key) {
-			return nil, nil, fmt.Errorf("invalid env key %q", key)
+// assignCanonical shifts every selected key with a configured canonical port by
+// one shared deterministic offset. Locked keys keep their locked values.
+func (a *App) assignCanonical(ctx context.Context, allocator port.Allocator, keys []string, locked map[string]string) (map[string]assignedPort, error) {
+	bases := []int{}
+	canonicalKeys := []string{}
+	for _, key := range keys {
+		base, ok := a.config.Canonical.Ports[key]
+		if _, configured := a.config.Ports[key]; !ok || configured {
+			continue
 		}
-		keySet[key] = struct{}{}
-		decisions = append(decisions, keyDecision{
-			Key:      key,
-			Source:   "manual",
-			Included: true,
-			Reason:   "included by -k",
-		})
+		if _, isLocked := locked[key]; isLocked {
+			continue
+		}
+		bases = append(bases, base)
+		canonicalKeys = append(canonicalKeys, key)
+	}
+	if len(bases) == 0 {
+		return nil, nil
 	}
 
-	finalKeys := make([]string, 0, len(keySet))
-	for key := range keySet {
-		finalKeys = append(finalKeys, key)
+	offset, preferred, probes, err := allocator.SharedOffsetContext(ctx, bases, a.config.Canonical.Span)
+	if err != nil {
+		return nil, fmt.Errorf("canonical offset for %s: %w", strings.Join(canonicalKeys, ","), err)
 	}
-	sort.Strings(finalKeys)
-	sort.Slice(decisions, func(i, j int) bool {
-		if decisions[i].Key == decisions[j].Key {
-			return decisions[i].Source < decisions[j].Source
+	out := make(map[string]assignedPort, len(canonicalKeys))
+	for i, key := range canonicalKeys {
+		assigned := bases[i] + offset
+		out[key] = assignedPort{
+			Key:       key,
+			Value:     strconv.Itoa(assigned),
+			Preferred: bases[i] + preferred,
+			Assigned:  assigned,
+			Probes:    probes,
+			Base:      bases[i],
 		}
-		return decisions[i].Key < decisions[j].Key
-	})
-	return decisions, finalKeys, nil
+	}
+	return out, nil
 }
 
-func (a *App) assignWithOptionalLock(opts Options, r port.Range, seed uint32, keys []string) ([]assignedPort, map[string]string, []string, error) {
-	allocator := port.Allocator{Seed: seed, Range: r, IsFree: a.isFree}
-	warnings := []string{}
-
-	locked := map[string]string{}
-	if opts.UseLock {
-		path := lockfile.PathFor(opts.CWD)
-		lf, err := lockfile.Read(path)
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("read lockfile: %w", err)
+// assignPinned assigns the keys config ports pins or confines to a range of
+// their own, before any other key, and marks their ports kept so that
+// nothing else is allocated onto them. A pinned port that is in use is an
+// error: the key cannot move. Ranged keys take deterministic slots in their
+// range, counted per range. Locked and inherited keys keep their values.
+func (a *App) assignPinned(ctx context.Context, opts Options, seed uint32, keys []string, locked, inherited map[string]string, kept map[int]bool, freeFor func(port.Protocol) port.IsFreeFunc) (map[string]assignedPort, error) {
+	out := map[string]assignedPort{}
+	checked := map[int]bool{}
+	for _, key := range keys {
+		spec, ok := a.config.Ports[key]
+		if !ok || spec.Range != "" {
+			continue
 		}
-		if lf.CWDFingerprint != lockfile.Fingerprint(opts.CWD) {
-			return nil, nil, nil, fmt.Errorf("lockfile cwd fingerprint mismatch")
+		if _, ok := locked[key]; ok {
+			continue
+		}
+		if _, ok := inherited[key]; ok {
+			continue
 		}
-		if lf.Range != opts.Range && opts.Range != "" {
-			warnings = append(warnings, fmt.Sprintf("lockfile range %s differs from CLI range %s", lf.Range, opts.Range))
+		// Config validation lets only a group's members share a pin, and
+		// the first of them has checked it.
+		if !checked[spec.Port] && !freeFor(a.protocolFor(key))(spec.Port) {
+			return nil, fmt.Errorf("pinned port %d for %s is in use%s", spec.Port, key, heldBy(a.portOwners(), spec.Port))
 		}
-		locked = lockfile.ToMap(lf.Assignments)
+		checked[spec.Port] = true
+		kept[spec.Port] = true
+		out[key] = assignedPort{Key: key, Value: strconv.Itoa(spec.Port), Preferred: spec.Port, Assigned: spec.Port, Pinned: true}
 	}
-
-	results := make([]assignedPort, 0, len(keys))
-	overrides := make(map[string]string, len(keys))
-	for i, key := range keys {
-		if val, ok := locked[key]; ok {
-			p, err := strconv.Atoi(val)
-			if err != nil {
-				return nil, nil, nil, fmt.Errorf("lockfile value for %s is not numeric", key)
-			}
-			results = append(results, assignedPort{Key: key, Value: val, Preferred: p, Assigned: p, Probes: 0, FromLock: true})
-			overrides[key] = val
+	slots := map[string]int{}
+	for _, key := range keys {
+		spec, ok := a.config.Ports[key]
+		if !ok || spec.Range == "" {
 			continue
 		}
-		assigned, preferred, probes, err := allocator.PortForWithStats(i)
+		if _, ok := locked[key]; ok {
+			continue
+		}
+		if _, ok := inherited[key]; ok {
+			continue
+		}
+		r, err := a.config.KeyRange(key)
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("find port for %s: %w", key, err)
+			return nil, fmt.Errorf("ports range for %s: %w", key, err)
 		}
-		v := strconv.Itoa(assigned)
-		results = append(results, assignedPort{Key: key, Value: v, Preferred: preferred, Assigned: assigned, Probes: probes})
-		overrides[key] = v
+		alloc := port.Allocator{Seed: seed, Range: r, IsFree: freeFor(a.protocolFor(key))}
+		assigned, preferred, probes, err := alloc.PortForContext(ctx, slots[spec.Range])
+		if err != nil {
+			return nil, fmt.Errorf("find port for %s in its range %s: %w", key, spec.Range, err)
+		}
+		if opts.RequirePreferred && probes > 0 {
+			return nil, fmt.Errorf("preferred port %d for %s is in use%s (--require-preferred)", preferred, key, heldBy(a.portOwners(), preferred))
+		}
+		slots[spec.Range]++
+		a.metrics.recordAllocation(probes)
+		kept[assigned] = true
+		out[key] = assignedPort{Key: key, Value: strconv.Itoa(assigned), Preferred: preferred, Assigned: assigned, Probes: probes, KeyRange: spec.Range}
 	}
-	return results, overrides, warnings, nil
+	return out, nil
 }
 
-func (a *App) writeLockfile(opts Options, rangeSpec string, overrides map[string]string) error {
+func (a *App) writeLockfile(ctx context.Context, opts Options, rangeSpec string, overrides map[string]string) error {
 	path := lockfile.PathFor(opts.CWD)
-	if err := lockfile.Write(path, opts.CWD, rangeSpec, overrides); err != nil {
+	writeOpts := []lockfile.WriteOption{lockfile.WithCreatedAt(a.now())}
+	if opts.SeedString != "" {
+		writeOpts = append(writeOpts, lockfile.WithSeedString(opts.SeedString))
+	}
+	if err := lockfile.WriteContext(ctx, path, opts.CWD, rangeSpec, overrides, writeOpts...); err != nil {
 		return err
 	}
 	fmt.Fprintf(a.stdout, "wrote %s with %d assignments\n", filepath.Base(path), len(overrides))
-	return nil
+	return a.applyLockfilePolicy(ctx, opts, path)
 }
 
-func (a *App) runOrExport(ctx context.Context, opts Options, args []string, rangeSpec string, overrides map[string]string, warnings []string) error {
-	if len(args) == 0 {
-		mode := "export"
-		if opts.DryRun {
-			mode = "preview"
+func (a *App) runOrExport(ctx context.Context, opts Options, args []string, rangeSpec string, seed uint32, overrides map[string]string, warnings []warning, changes []lastrun.Change, unchanged map[string]bool) error {
+	var urls map[string]string
+	if opts.URLs {
+		urls = overrideURLs(overrides)
+	}
+	if opts.MergeWith != "" || len(args) == 0 {
+		export := func(overrides map[string]string) error {
+			if opts.MergeWith != "" {
+				return a.mergeEnvFile(opts, args, overrides)
+			}
+			mode := "export"
+			if opts.DryRun {
+				mode = "preview"
+			}
+			if f, ok, err := a.formatter(opts.Format); ok || err != nil {
+				if err != nil {
+					return err
+				}
+				return f.Format(ctx, a.stdout, FormatInput{CWD: opts.CWD, Range: rangeSpec, Overrides: overrides})
+			}
+			if opts.URLs {
+				urls = overrideURLs(overrides)
+			}
+			a.printPrimaryOutput(opts.Format, mode, opts.CWD, rangeSpec, nil, overrides, warnings, urls)
+			return nil
 		}
-		a.printPrimaryOutput(opts.Format, mode, opts.CWD, rangeSpec, nil, overrides, warnings)
-		return nil
+		if opts.Watch {
+			return a.watchExports(ctx, opts, overrides, export)
+		}
+		return export(overrides)
 	}
 
 	if opts.DryRun {
+		var env []childEnvVar
+		if opts.ShowEnv {
+			env = a.childEnv(a.commandEnviron(opts), overrides, opts.RedactEnv)
+		}
 		if opts.Format == "json" {
-			a.printJSONOutput(a.stdout, "preview", opts.CWD, rangeSpec, args, overrides, warnings)
+			a.printJSONOutput(a.stdout, "preview", opts.CWD, rangeSpec, args, overrides, warnings, env, urls)
 		} else {
-			a.printOverrideSummary(args[0], args[1:], overrides)
+			a.printOverrideSummary(args[0], args[1:], overrides, changes, unchanged, urls, opts.NoTruncate)
+			a.printChildEnv(env)
 		}
-		return nil
+		return a.applyLinks(opts.CWD, overrides, true, opts.Quiet)
+	}
+
+	var reserved []reservedPort
+	if opts.Reserve || opts.PassFDs {
+		var err error
+		if reserved, err = a.reservePorts(overrides); err != nil {
+			return err
+		}
+		defer releasePorts(reserved)
 	}
 
-	env := a.buildExecEnv(overrides)
+	// Hooks get the full environment; --only-overrides and --env-filter
+	// shape only what the command inherits.
+	env := a.buildExecEnv(a.environ, overrides)
+	cmdEnv := a.buildExecEnv(a.commandEnviron(opts), overrides)
 	cmdName := args[0]
 	cmdArgs := args[1:]
 	if !opts.Quiet {
 		if opts.Format == "json" {
-			a.printJSONOutput(a.stderr, "execute", opts.CWD, rangeSpec, args, overrides, warnings)
+			a.printJSONOutput(a.stderr, "execute", opts.CWD, rangeSpec, args, overrides, warnings, nil, urls)
 		} else {
-			a.printOverrideSummary(cmdName, cmdArgs, overrides)
+			a.printOverrideSummary(cmdName, cmdArgs, overrides, changes, unchanged, urls, opts.NoTruncate)
+		}
+	}
+	if err := a.renderTemplates(opts.CWD, overrides, env); err != nil {
+		return err
+	}
+	if err := a.applyLinks(opts.CWD, overrides, false, opts.Quiet); err != nil {
+		return err
+	}
+	if err := a.runHooks(ctx, "pre_run", a.config.Hooks.PreRun, env); err != nil {
+		return err
+	}
+	stopPublish := a.startPublishing(ctx, opts, overrides)
+	health, err := a.startHealth(ctx, opts, rangeSpec, seed, overrides)
+	if err != nil {
+		stopPublish()
+		return err
+	}
+	a.publishReservations(opts.CWD, overrides)
+	var extraEnv []string
+	if health != nil {
+		extraEnv = append(extraEnv, fmt.Sprintf("AUTOPORT_HEALTH_PORT=%d", health.port))
+	}
+	env = append(env, extraEnv...)
+	cmdEnv = append(cmdEnv, extraEnv...)
+	run := func(ctx context.Context, overrides map[string]string, cmdEnv []string) error {
+		runCtx, stopReadiness := a.startReadiness(ctx, opts, overrides)
+		err := a.executeReserved(runCtx, opts, reserved, cmdName, cmdArgs, cmdEnv, health.started)
+		if readyErr := stopReadiness(); readyErr != nil {
+			err = readyErr
+		}
+		return err
+	}
+	a.metrics.leases.Set(int64(len(overrides)))
+	var runErr error
+	if (opts.OnHUP != "" || opts.Watch) && a.replan != nil {
+		var final map[string]string
+		final, runErr = a.runReloading(ctx, opts, overrides, extraEnv, run)
+		if !maps.Equal(final, overrides) {
+			overrides = final
+			env = append(a.buildExecEnv(a.environ, overrides), extraEnv...)
+		}
+	} else {
+		runErr = run(ctx, overrides, cmdEnv)
+	}
+	a.metrics.leases.Set(0)
+	health.stop()
+	stopPublish()
+	a.releaseReservations(opts.CWD)
+	sig, runErr := commandExit(ctx, cmdName, runErr)
+	if opts.Format == "json" && !opts.Quiet {
+		a.printExitPayload(args, runErr, sig)
+	}
+	if runErr != nil && ctx.Err() == nil {
+		// A command stopped by Ctrl-C or autoport's own shutdown is not
+		// worth a notification.
+		ports := make([]string, 0, len(overrides))
+		for _, key := range sortedKeys(overrides) {
+			ports = append(ports, key+"="+overrides[key])
 		}
+		a.notifyFailure(ctx, opts, fmt.Sprintf("autoport: %s exited with code %d", cmdName, exitCodeOf(runErr)), fmt.Errorf("%w\n%s", runErr, strings.Join(ports, " ")))
+	}
+	if len(a.config.Hooks.OnExit) == 0 {
+		return runErr
+	}
+
+	// Teardown must run even when the child was stopped by a signal.
+	exitEnv := append(env, fmt.Sprintf("AUTOPORT_EXIT_CODE=%d", exitCodeOf(runErr)))
+	hookErr := a.runHooks(context.WithoutCancel(ctx), "on_exit", a.config.Hooks.OnExit, exitEnv)
+	if runErr != nil {
+		return runErr
 	}
-	return a.executor.Run(ctx, cmdName, cmdArgs, env, a.stdout, a.stderr)
+	return hookErr
 }
 
 type explainRange struct {
-	Start int `json:"start"`
-	End   int `json:"end"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Spec  string `json:"spec"`
+	Size  int    `json:"size"`
 }
 
 type explainInputs struct {
-	Presets   []string `json:"presets"`
-	Ignores   []string `json:"ignores"`
-	Includes  []string `json:"includes"`
-	Excludes  []string `json:"excludes"`
-	Namespace string   `json:"namespace,omitempty"`
+	Presets  []string `json:"presets"`
+	Ignores  []string `json:"ignores"`
+	Includes []string `json:"includes"`
+	Excludes []string `json:"excludes"`
+	// ExcludePatterns are preset globs over key names.
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+	// ExcludeCategories are key categories from flags and presets.
+	ExcludeCategories []string `json:"exclude_categories,omitempty"`
+	Namespace         string   `json:"namespace,omitempty"`
 }
 
 type explainKey struct {
-	Key      string `json:"key"`
-	Source   string `json:"source"`
-	Included bool   `json:"included"`
-	Reason   string `json:"reason"`
+	Key      string        `json:"key"`
+	Source   string        `json:"source"`
+	Kind     string        `json:"kind,omitempty"`
+	Included bool          `json:"included"`
+	Reason   string        `json:"reason"`
+	Rule     selectionRule `json:"rule"`
+	Category string        `json:"category"`
 }
 
 type explainAssignment struct {
@@ -470,192 +1863,470 @@ type explainAssignment struct {
 	Preferred int    `json:"preferred"`
 	Assigned  int    `json:"assigned"`
 	Probes    int    `json:"probes"`
+	Group     string `json:"group,omitempty"`
+	Base      int    `json:"base,omitempty"`
+	Current   bool   `json:"current,omitempty"`
+	Snapshot  bool   `json:"snapshot,omitempty"`
+	Source    string `json:"source,omitempty"`
+	// Origin is the config file defining the key's pin, range, group, or
+	// canonical port.
+	Origin string `json:"origin,omitempty"`
+	// Mnemonic spells Assigned as a word under --mnemonics.
+	Mnemonic string `json:"mnemonic,omitempty"`
 }
 
 type explainPayload struct {
 	Mode        string              `json:"mode"`
 	CWD         string              `json:"cwd"`
 	Seed        uint32              `json:"seed"`
+	SeedSource  string              `json:"seed_material,omitempty"`
+	Mnemonic    string              `json:"mnemonic,omitempty"`
 	Range       explainRange        `json:"range"`
 	Inputs      explainInputs       `json:"inputs"`
+	Origins     []optionOrigin      `json:"origins"`
 	Keys        []explainKey        `json:"keys"`
 	Assignments []explainAssignment `json:"assignments"`
-	Warnings    []string            `json:"warnings,omitempty"`
+	Warnings    []warning           `json:"warnings,omitempty"`
 	Stats       scanner.Stats       `json:"stats"`
+	Forecast    *explainForecast    `json:"forecast,omitempty"`
 }
 
-func (a *App) renderExplain(opts Options, args []string, res resolvedOptions, r port.Range, seed uint32, decisions []keyDecision, assignments []assignedPort, warnings []string, stats scanner.Stats) error {
-	if opts.Format == "json" {
-		payload := explainPayload{
-			Mode:  "explain",
-			CWD:   opts.CWD,
-			Seed:  seed,
-			Range: explainRange{Start: r.Start, End: r.End},
-			Inputs: explainInputs{
-				Presets:   append([]string{}, opts.Presets...),
-				Ignores:   append([]string{}, res.Ignores...),
-				Includes:  append([]string{}, res.Includes...),
-				Excludes:  append([]string{}, res.Excludes...),
-				Namespace: opts.Namespace,
-			},
-			Warnings: append([]string{}, warnings...),
-			Stats:    stats,
-		}
-		for _, d := range decisions {
-			payload.Keys = append(payload.Keys, explainKey{Key: d.Key, Source: d.Source, Included: d.Included, Reason: d.Reason})
-		}
-		for _, as := range assignments {
-			payload.Assignments = append(payload.Assignments, explainAssignment{Key: as.Key, Preferred: as.Preferred, Assigned: as.Assigned, Probes: as.Probes})
-		}
+func (a *App) renderExplain(opts Options, args []string, res resolvedOptions, r port.Range, seed seedInfo, decisions []keyDecision, assignments []assignedPort, warnings []warning, stats scanner.Stats, forecast *explainForecast) error {
+	switch opts.Format {
+	case "json":
+		payload := a.explainPayload(opts, res, r, seed, decisions, assignments, warnings, stats, forecast)
 		enc := json.NewEncoder(a.stdout)
 		return enc.Encode(payload)
+	case "html":
+		return a.renderExplainHTML(a.explainPayload(opts, res, r, seed, decisions, assignments, warnings, stats, forecast))
 	}
 
-	fmt.Fprintf(a.stdout, "autoport explain\n")
-	fmt.Fprintf(a.stdout, "cwd: %s\n", opts.CWD)
-	fmt.Fprintf(a.stdout, "seed: %d\n", seed)
-	fmt.Fprintf(a.stdout, "range: %d-%d\n", r.Start, r.End)
-	fmt.Fprintf(a.stdout, "presets: %s\n", strings.Join(opts.Presets, ","))
-	fmt.Fprintf(a.stdout, "ignores: %s\n", strings.Join(res.Ignores, ","))
-	fmt.Fprintf(a.stdout, "includes: %s\n", strings.Join(res.Includes, ","))
-	fmt.Fprintf(a.stdout, "excludes: %s\n", strings.Join(res.Excludes, ","))
-	fmt.Fprintf(a.stdout, "\nkeys:\n")
-	for _, d := range decisions {
-		mark := "x"
-		if d.Included {
-			mark = "✓"
+	a.text.Fprintf(a.stdout, "autoport explain\n")
+	a.text.Fprintf(a.stdout, "cwd: %s\n", opts.CWD)
+	a.text.Fprintf(a.stdout, "seed: %d (%s)\n", seed.Value, seed.Material)
+	a.text.Fprintf(a.stdout, "range: %s\n", r)
+	if a.mnemonics {
+		a.text.Fprintf(a.stdout, "mnemonic: %s\n", planMnemonic(assignedPorts(assignments)))
+	}
+	a.text.Fprintf(a.stdout, "presets: %s\n", strings.Join(opts.Presets, ","))
+	a.text.Fprintf(a.stdout, "ignores: %s\n", strings.Join(res.Ignores, ","))
+	a.text.Fprintf(a.stdout, "includes: %s\n", strings.Join(res.Includes, ","))
+	a.text.Fprintf(a.stdout, "excludes: %s\n", strings.Join(res.Excludes, ","))
+	if len(res.ExcludePatterns) > 0 {
+		a.text.Fprintf(a.stdout, "exclude patterns: %s\n", strings.Join(res.ExcludePatterns, ","))
+	}
+	if len(res.ExcludeCategories) > 0 {
+		a.text.Fprintf(a.stdout, "exclude categories: %s\n", strings.Join(res.ExcludeCategories, ","))
+	}
+	a.text.Fprintf(a.stdout, "\norigins:\n")
+	for _, o := range explainOrigins(res, seed) {
+		value := o.Value
+		if value == "" {
+			value = a.text.Translate("(none)")
 		}
-		fmt.Fprintf(a.stdout, "  [%s] %s (%s) - %s\n", mark, d.Key, d.Source, d.Reason)
+		a.text.Fprintf(a.stdout, "  %s: %s [%s]\n", o.Option, value, o.Origin)
 	}
-	fmt.Fprintf(a.stdout, "\nassignments:\n")
+	a.text.Fprintf(a.stdout, "\nkeys:\n")
+	for _, category := range a.categories() {
+		group := slices.DeleteFunc(slices.Clone(decisions), func(d keyDecision) bool { return d.Category != category })
+		if len(group) > 0 {
+			a.text.Fprintf(a.stdout, "  %s:\n", category)
+		}
+		for _, d := range group {
+			a.renderExplainKey(d)
+		}
+	}
+	a.text.Fprintf(a.stdout, "\nassignments:\n")
 	for _, as := range assignments {
 		suffix := ""
+		if as.Base > 0 {
+			suffix += fmt.Sprintf(" base=%d", as.Base)
+		}
+		if as.Group != "" {
+			suffix += fmt.Sprintf(" group=%s", as.Group)
+		}
+		if as.KeyRange != "" {
+			suffix += fmt.Sprintf(" range=%s", as.KeyRange)
+		}
+		if as.Pinned {
+			suffix += " (pinned)"
+		}
 		if as.FromLock {
-			suffix = " (lock)"
+			suffix += " (lock)"
+		}
+		if as.FromSnap {
+			suffix += " (snapshot)"
 		}
-		fmt.Fprintf(a.stdout, "  %s: preferred=%d assigned=%d probes=%d%s\n", as.Key, as.Preferred, as.Assigned, as.Probes, suffix)
+		if as.Current {
+			suffix += " (current)"
+		}
+		if as.Inherited {
+			suffix += " (" + sourceInherited + ")"
+		}
+		if origin := a.assignmentOrigin(as); origin != "" {
+			suffix += " [" + origin + "]"
+		}
+		if a.mnemonics {
+			suffix += " mnemonic=" + proquint(uint16(as.Assigned))
+		}
+		a.text.Fprintf(a.stdout, "  %s: preferred=%d assigned=%d probes=%d%s\n", as.Key, as.Preferred, as.Assigned, as.Probes, suffix)
 	}
-	fmt.Fprintf(a.stdout, "\nscan stats: files=%d env_files=%d skipped_ignore_dirs=%d skipped_max_depth=%d\n", stats.FilesVisited, stats.EnvFilesParsed, stats.SkippedIgnore, stats.SkippedMaxDepth)
+	a.printForecast(forecast)
+	a.text.Fprintf(a.stdout, "\nscan stats: files=%d env_files=%d compose_env_files=%d task_files=%d skipped_ignore_dirs=%d skipped_max_depth=%d\n", stats.FilesVisited, stats.EnvFilesParsed, stats.ComposeEnvFiles, stats.TaskFilesParsed, stats.SkippedIgnore, stats.SkippedMaxDepth)
 	if len(warnings) > 0 {
-		fmt.Fprintf(a.stdout, "\nwarnings:\n")
+		a.text.Fprintf(a.stdout, "\nwarnings:\n")
 		for _, w := range warnings {
-			fmt.Fprintf(a.stdout, "  - %s\n", w)
+			a.text.Fprintf(a.stdout, "  - %s\n", a.warningText(w))
 		}
 	}
 	return nil
 }
 
+// renderExplainKey prints one key decision under its category heading.
+func (a *App) renderExplainKey(d keyDecision) {
+	mark := "x"
+	if d.Included {
+		mark = "✓"
+	}
+	source := d.Source
+	if d.Kind == scanner.KindCompose {
+		source += ", compose"
+	}
+	reason := d.Reason
+	if d.Rule.Rule != ruleDiscovered && d.Rule.Origin != "" {
+		reason += " [" + d.Rule.Origin + "]"
+	}
+	a.text.Fprintf(a.stdout, "    [%s] %s (%s) - %s\n", mark, d.Key, source, reason)
+}
+
+// explainPayload is the data behind JSON and HTML explain output.
+func (a *App) explainPayload(opts Options, res resolvedOptions, r port.Range, seed seedInfo, decisions []keyDecision, assignments []assignedPort, warnings []warning, stats scanner.Stats, forecast *explainForecast) explainPayload {
+	payload := explainPayload{
+		Mode:       "explain",
+		CWD:        opts.CWD,
+		Seed:       seed.Value,
+		SeedSource: seed.Material,
+		Range:      explainRange{Start: r.Start, End: r.End, Spec: r.String(), Size: r.Size()},
+		Inputs: explainInputs{
+			Presets:           append([]string{}, opts.Presets...),
+			Ignores:           append([]string{}, res.Ignores...),
+			Includes:          append([]string{}, res.Includes...),
+			Excludes:          append([]string{}, res.Excludes...),
+			ExcludePatterns:   res.ExcludePatterns,
+			ExcludeCategories: res.ExcludeCategories,
+			Namespace:         opts.Namespace,
+		},
+		Origins:  explainOrigins(res, seed),
+		Warnings: append([]warning{}, warnings...),
+		Stats:    stats,
+		Forecast: forecast,
+	}
+	for _, d := range decisions {
+		payload.Keys = append(payload.Keys, explainKey{Key: d.Key, Source: d.Source, Kind: d.Kind, Included: d.Included, Reason: d.Reason, Rule: d.Rule, Category: d.Category})
+	}
+	for _, as := range assignments {
+		entry := explainAssignment{Key: as.Key, Preferred: as.Preferred, Assigned: as.Assigned, Probes: as.Probes, Group: as.Group, Base: as.Base, Current: as.Current, Snapshot: as.FromSnap, Source: assignmentSource(as), Origin: a.assignmentOrigin(as)}
+		if a.mnemonics {
+			entry.Mnemonic = proquint(uint16(as.Assigned))
+		}
+		payload.Assignments = append(payload.Assignments, entry)
+	}
+	if a.mnemonics {
+		payload.Mnemonic = planMnemonic(assignedPorts(assignments))
+	}
+	return payload
+}
+
+// explainOrigins lists the effective value and origin of every resolved
+// option, including the seed.
+func explainOrigins(res resolvedOptions, seed seedInfo) []optionOrigin {
+	origins := append([]optionOrigin{}, res.Origins...)
+	return append(origins, optionOrigin{Option: "seed", Value: fmt.Sprintf("%d (%s)", seed.Value, seed.Material), Origin: seed.Origin})
+}
+
+// doctorCheck is one doctor finding. ID names the specific finding
+// ("<name>.<finding>") and stays stable across releases, so tools can key
+// on it; Details carries the finding's values as structured data.
 type doctorCheck struct {
-	Name    string `json:"name"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Status   string         `json:"status"`
+	Severity string         `json:"severity"`
+	Message  string         `json:"message"`
+	Details  map[string]any `json:"details,omitempty"`
+
+	// parts rebuild Message through the message catalog for text output.
+	parts []message
+}
+
+// message is an English format string and its arguments, kept apart so
+// text output can render it in the user's language.
+type message struct {
+	format string
+	args   []any
+}
+
+func msgf(format string, args ...any) message {
+	return message{format: format, args: args}
+}
+
+// newCheck builds the doctor check id, named by the part of id before the
+// first dot, whose message joins parts with "; ".
+func newCheck(id, status string, parts ...message) doctorCheck {
+	english := make([]string, len(parts))
+	for i, m := range parts {
+		english[i] = fmt.Sprintf(m.format, m.args...)
+	}
+	name, _, _ := strings.Cut(id, ".")
+	return doctorCheck{
+		ID:       id,
+		Name:     name,
+		Status:   status,
+		Severity: checkSeverities[status],
+		Message:  strings.Join(english, "; "),
+		parts:    parts,
+	}
+}
+
+// checkSeverities maps doctor statuses to the severities editors and
+// dashboards use for diagnostics.
+var checkSeverities = map[string]string{"ok": "info", "warn": "warning", "fatal": "error"}
+
+// with returns a copy of c with a detail added.
+func (c doctorCheck) with(key string, value any) doctorCheck {
+	details := make(map[string]any, len(c.Details)+1)
+	for k, v := range c.Details {
+		details[k] = v
+	}
+	details[key] = value
+	c.Details = details
+	return c
+}
+
+// checkText returns c's message in the user's language.
+func (a *App) checkText(c doctorCheck) string {
+	if len(c.parts) == 0 {
+		return c.Message
+	}
+	out := make([]string, len(c.parts))
+	for i, m := range c.parts {
+		out[i] = a.text.Sprintf(m.format, m.args...)
+	}
+	return strings.Join(out, "; ")
 }
 
 type doctorPayload struct {
-	Mode   string        `json:"mode"`
-	Checks []doctorCheck `json:"checks"`
+	Mode string `json:"mode"`
+	// Project is the project directory when it was given with --project
+	// or --workdir.
+	Project  string        `json:"project,omitempty"`
+	Checks   []doctorCheck `json:"checks"`
+	Warnings []warning     `json:"warnings,omitempty"`
 }
 
 func (a *App) runDoctor(ctx context.Context, opts Options, res resolvedOptions) error {
 	checks := []doctorCheck{}
+	warnings := append([]warning{}, res.Warnings...)
 	fatal := false
 	warn := false
 
 	if len(a.config.Errors) > 0 {
-		checks = append(checks, doctorCheck{Name: "config", Status: "fatal", Message: joinErrors("config", a.config.Errors).Error()})
+		errs := make([]string, len(a.config.Errors))
+		for i, err := range a.config.Errors {
+			errs[i] = err.Error()
+		}
+		check := newCheck("config.invalid", "fatal", msgf("%s", joinErrors("config", a.config.Errors)))
+		checks = append(checks, check.with("errors", errs))
 		fatal = true
 	} else if len(a.config.Warnings) > 0 {
-		checks = append(checks, doctorCheck{Name: "config", Status: "warn", Message: strings.Join(a.config.Warnings, "; ")})
-		warn = true
+		parts := make([]message, 0, len(a.config.Warnings))
+		for _, w := range a.config.Warnings {
+			parts = append(parts, msgf("%s", w))
+		}
+		status := "warn"
+		if _, promoted := makeSet(a.config.WarningsAsErrors)[WarnConfigDeprecated]; promoted {
+			status = "fatal"
+			fatal = true
+		} else {
+			warn = true
+		}
+		check := newCheck("config.deprecated", status, parts...)
+		checks = append(checks, check.with("warnings", a.config.Warnings))
 	} else {
-		checks = append(checks, doctorCheck{Name: "config", Status: "ok", Message: "configuration parsed successfully"})
+		checks = append(checks, newCheck("config.ok", "ok", msgf("configuration parsed successfully")))
 	}
 
 	r, err := port.ParseRange(res.Range)
 	if err != nil {
-		checks = append(checks, doctorCheck{Name: "range", Status: "fatal", Message: err.Error()})
+		check := newCheck("range.invalid", "fatal", msgf("%s", err))
+		checks = append(checks, check.with("range", res.Range))
 		fatal = true
 	} else {
-		status := "ok"
-		msg := fmt.Sprintf("range %d-%d (size=%d)", r.Start, r.End, r.Size())
+		id, status := "range.ok", "ok"
+		parts := []message{msgf("range %s (size=%d)", r, r.Size())}
 		if r.Size() < 10 {
-			status = "warn"
-			msg = msg + "; very small range may cause collisions"
+			id, status = "range.small", "warn"
+			parts = append(parts, msgf("very small range may cause collisions"))
+			warn = true
+		}
+		overlaps := r.Overlaps()
+		if len(overlaps) > 0 {
+			id, status = "range.overlapping_segments", "warn"
+			parts = append(parts, msgf("overlapping segments: %s", strings.Join(overlaps, ", ")))
 			warn = true
 		}
-		checks = append(checks, doctorCheck{Name: "range", Status: status, Message: msg})
+		check := newCheck(id, status, parts...).with("range", r.String()).with("size", r.Size())
+		if len(overlaps) > 0 {
+			check = check.with("overlaps", overlaps)
+		}
+		checks = append(checks, check)
 	}
 
-	start := time.Now()
+	start := a.now()
 	discoveries, stats, scanErr := a.scanDiscoveries(ctx, opts.CWD, res)
-	dur := time.Since(start)
+	dur := a.now().Sub(start)
 	if scanErr != nil {
-		checks = append(checks, doctorCheck{Name: "scan", Status: "fatal", Message: scanErr.Error()})
+		checks = append(checks, newCheck("scan.failed", "fatal", msgf("%s", scanErr)))
 		fatal = true
 	} else {
-		status := "ok"
-		msg := fmt.Sprintf("found %d keys in %s; files=%d env_files=%d", len(discoveries), dur.Truncate(time.Millisecond), stats.FilesVisited, stats.EnvFilesParsed)
+		id, status := "scan.ok", "ok"
+		parts := []message{msgf("found %d keys in %s", len(discoveries), dur.Truncate(time.Millisecond)), msgf("files=%d env_files=%d", stats.FilesVisited, stats.EnvFilesParsed)}
 		if stats.SkippedMaxDepth > 0 {
-			status = "warn"
-			msg = msg + fmt.Sprintf("; max_depth skipped %d directories", stats.SkippedMaxDepth)
+			id, status = "scan.max_depth", "warn"
+			parts = append(parts, msgf("max_depth skipped %d directories", stats.SkippedMaxDepth))
 			warn = true
 		}
-		checks = append(checks, doctorCheck{Name: "scan", Status: status, Message: msg})
+		check := newCheck(id, status, parts...).
+			with("keys", len(discoveries)).
+			with("files", stats.FilesVisited).
+			with("env_files", stats.EnvFilesParsed).
+			with("skipped_max_depth", stats.SkippedMaxDepth).
+			with("duration_ms", dur.Milliseconds())
+		checks = append(checks, check)
 	}
 
-	if _, err := port.ParseRange(res.Range); err == nil {
+	if a.bindErr != nil {
+		check := newCheck("port_availability.bind_unavailable", "warn", msgf("cannot bind sockets (%s); ports are assigned without checking availability", a.bindErr))
+		checks = append(checks, check.with("error", a.bindErr.Error()))
+		warn = true
+	} else if _, err := port.ParseRange(res.Range); err == nil {
 		freeCount := 0
-		sample := []int{r.Start, (r.Start + r.End) / 2, r.End}
+		sample := []int{r.At(0), r.At(r.Size() / 2), r.At(r.Size() - 1)}
+		var busy []int
 		for _, p := range sample {
-			if a.isFree(p) {
+			if a.isFree(a.protocol, p) {
 				freeCount++
+			} else {
+				busy = append(busy, p)
 			}
 		}
+		holders := a.busyPortOwners(busy)
+		var held []message
+		for _, h := range holders {
+			held = append(held, msgf("port %d is held by %s", h.Port, portowner.Owner{PID: h.PID, Name: h.Process}))
+		}
+		var check doctorCheck
 		if freeCount == 0 {
-			checks = append(checks, doctorCheck{Name: "port_availability", Status: "fatal", Message: "no sampled ports are available"})
+			check = newCheck("port_availability.none_free", "fatal", append([]message{msgf("no sampled ports are available")}, held...)...)
 			fatal = true
 		} else if freeCount < len(sample) {
-			checks = append(checks, doctorCheck{Name: "port_availability", Status: "warn", Message: fmt.Sprintf("%d/%d sampled ports are available", freeCount, len(sample))})
+			check = newCheck("port_availability.some_busy", "warn", append([]message{msgf("%d/%d sampled ports are available", freeCount, len(sample))}, held...)...)
 			warn = true
 		} else {
-			checks = append(checks, doctorCheck{Name: "port_availability", Status: "ok", Message: "sampled ports are available"})
+			check = newCheck("port_availability.ok", "ok", msgf("sampled ports are available"))
+		}
+		check = check.with("sampled", sample).with("free", freeCount)
+		if len(holders) > 0 {
+			check = check.with("owners", holders)
+		}
+		checks = append(checks, check)
+	}
+
+	if check, ok := a.loopbackAliasCheck(ctx, opts); ok {
+		checks = append(checks, check)
+		fatal = fatal || check.Status == "fatal"
+	}
+
+	if check, ok := a.seedPathCheck(opts.CWD); ok {
+		checks = append(checks, check)
+		warn = warn || check.Status == "warn"
+	}
+
+	if check, ok := a.localConfigCheck(ctx, opts.CWD); ok {
+		checks = append(checks, check)
+		warn = warn || check.Status == "warn"
+	}
+
+	var keys map[string]struct{}
+	if scanErr == nil {
+		keys = makeSet(opts.PortEnv)
+		for _, d := range discoveries {
+			keys[d.Key] = struct{}{}
 		}
 	}
+	if check, ok := a.linksCheck(opts.CWD, keys); ok {
+		checks = append(checks, check)
+		warn = warn || check.Status == "warn"
+	}
 
 	lockPath := lockfile.PathFor(opts.CWD)
-	if _, statErr := os.Stat(lockPath); statErr == nil {
-		lf, err := lockfile.Read(lockPath)
+	if statErr := a.statFile(lockPath); statErr == nil {
+		lf, err := a.readLockfile(ctx, lockPath)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
-			checks = append(checks, doctorCheck{Name: "lockfile", Status: "warn", Message: err.Error()})
+			check := newCheck("lockfile.unreadable", "warn", msgf("%s", err))
+			checks = append(checks, check.with("path", lockPath))
 			warn = true
 		} else {
-			status := "ok"
-			msg := fmt.Sprintf("lockfile version=%d assignments=%d", lf.Version, len(lf.Assignments))
-			if lf.CWDFingerprint != lockfile.Fingerprint(opts.CWD) {
-				status = "warn"
-				msg = "lockfile cwd fingerprint mismatch"
+			check := newCheck("lockfile.ok", "ok", msgf("lockfile version=%d assignments=%d", lf.Version, len(lf.Assignments)))
+			check = check.with("path", lockPath).with("version", lf.Version).with("assignments", len(lf.Assignments))
+			if fp := lockfile.Fingerprint(opts.CWD); lf.CWDFingerprint != fp {
+				check = newCheck("lockfile.fingerprint_mismatch", "warn", msgf("lockfile cwd fingerprint mismatch"))
+				check = check.with("path", lockPath).with("lockfile", lf.CWDFingerprint).with("cwd", fp)
 				warn = true
+				w := newWarning(WarnLockFingerprint, "lockfile cwd fingerprint mismatch")
+				warnings = append(warnings, w.with("lockfile", lf.CWDFingerprint).with("cwd", fp))
 			}
-			checks = append(checks, doctorCheck{Name: "lockfile", Status: status, Message: msg})
+			checks = append(checks, check)
+		}
+		if check, ok := a.lockfilePolicyCheck(ctx, opts.CWD, lockPath); ok {
+			checks = append(checks, check)
+			warn = warn || check.Status == "warn"
 		}
 	} else if errors.Is(statErr, os.ErrNotExist) {
-		checks = append(checks, doctorCheck{Name: "lockfile", Status: "ok", Message: "no lockfile present"})
+		checks = append(checks, newCheck("lockfile.absent", "ok", msgf("no lockfile present")))
 	}
 
 	if opts.Format == "json" {
-		payload := doctorPayload{Mode: "doctor", Checks: checks}
+		payload := doctorPayload{Mode: "doctor", Checks: checks, Warnings: warnings}
+		if opts.Workdir != "" {
+			payload.Project = opts.CWD
+		}
 		enc := json.NewEncoder(a.stdout)
 		if err := enc.Encode(payload); err != nil {
 			return err
 		}
 	} else {
-		fmt.Fprintln(a.stdout, "autoport doctor")
+		if opts.Workdir != "" {
+			a.text.Fprintf(a.stdout, "autoport doctor %s\n", opts.CWD)
+		} else {
+			a.text.Fprintf(a.stdout, "autoport doctor\n")
+		}
 		for _, c := range checks {
-			fmt.Fprintf(a.stdout, "- [%s] %s: %s\n", c.Status, c.Name, c.Message)
+			fmt.Fprintf(a.stdout, "- [%s] %s: %s\n", c.Status, c.Name, a.checkText(c))
 		}
 	}
 
 	if fatal {
+		var failed []string
+		for _, c := range checks {
+			if c.Status == "fatal" {
+				failed = append(failed, c.Name)
+			}
+		}
+		a.notifyFailure(ctx, opts, "autoport doctor: fatal issues", errors.New(strings.Join(failed, ", ")))
 		return &ExitError{Code: 2, Err: errors.New("doctor found fatal issues")}
 	}
 	if warn {
@@ -667,7 +2338,12 @@ func (a *App) runDoctor(ctx context.Context, opts Options, res resolvedOptions)
 func (a *App) printExports(overrides map[string]string) {
 	keys := sortedKeys(overrides)
 	for _, key := range keys {
-		fmt.Fprintf(a.stdout, "export %s=%s\n", key, overrides[key])
+		fmt.Fprintln(a.stdout, a.shell.export(key, overrides[key]))
+	}
+	// A nested export keeps the outermost revert, which restores the
+	// environment from before the first one.
+	if len(keys) > 0 && a.shell.sep != "" && !slices.ContainsFunc(a.environ, func(kv string) bool { return strings.HasPrefix(kv, revertVar+"=") }) {
+		fmt.Fprintln(a.stdout, a.shell.restore(revertVar, a.revertScript(overrides)))
 	}
 }
 
@@ -688,38 +2364,62 @@ func (a *App) printYAML(overrides map[string]string) {
 type outputBinding struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
+	URL   string `json:"url,omitempty"`
+	// Mnemonic spells the port as a word under --mnemonics.
+	Mnemonic string `json:"mnemonic,omitempty"`
+	// Source is "inherited" for values kept from the environment.
+	Source string `json:"source,omitempty"`
 }
 
 type outputPayload struct {
-	Mode      string          `json:"mode"`
-	CWD       string          `json:"cwd"`
-	Range     string          `json:"range"`
-	Command   []string        `json:"command,omitempty"`
+	Mode    string   `json:"mode"`
+	CWD     string   `json:"cwd"`
+	Range   string   `json:"range"`
+	Command []string `json:"command,omitempty"`
+	// Mnemonic names the whole set of ports under --mnemonics.
+	Mnemonic  string          `json:"mnemonic,omitempty"`
 	Overrides []outputBinding `json:"overrides"`
-	Warnings  []string        `json:"warnings,omitempty"`
+	Warnings  []warning       `json:"warnings,omitempty"`
+	Env       []childEnvVar   `json:"env,omitempty"`
 }
 
-func (a *App) printPrimaryOutput(format, mode, cwd, rangeSpec string, command []string, overrides map[string]string, warnings []string) {
+func (a *App) printPrimaryOutput(format, mode, cwd, rangeSpec string, command []string, overrides map[string]string, warnings []warning, urls map[string]string) {
 	switch format {
 	case "json":
-		a.printJSONOutput(a.stdout, mode, cwd, rangeSpec, command, overrides, warnings)
+		a.printJSONOutput(a.stdout, mode, cwd, rangeSpec, command, overrides, warnings, nil, urls)
 	case "dotenv":
 		a.printDotenv(overrides)
 	case "yaml":
 		a.printYAML(overrides)
+	case "compose":
+		a.printCompose(overrides)
+	case "k8s":
+		a.printK8s(overrides)
+	case "skaffold":
+		a.printSkaffold(overrides)
 	default:
 		a.printExports(overrides)
 	}
 }
 
-func (a *App) printJSONOutput(w io.Writer, mode, cwd, rangeSpec string, command []string, overrides map[string]string, warnings []string) {
+func (a *App) printJSONOutput(w io.Writer, mode, cwd, rangeSpec string, command []string, overrides map[string]string, warnings []warning, env []childEnvVar, urls map[string]string) {
 	bindings := make([]outputBinding, 0, len(overrides))
+	var mnemonics map[string]string
+	if a.mnemonics {
+		mnemonics = portMnemonics(overrides)
+	}
 	keys := sortedKeys(overrides)
 	for _, key := range keys {
-		bindings = append(bindings, outputBinding{
-			Key:   key,
-			Value: overrides[key],
-		})
+		binding := outputBinding{
+			Key:      key,
+			Value:    overrides[key],
+			URL:      urls[key],
+			Mnemonic: mnemonics[key],
+		}
+		if a.inherited[key] {
+			binding.Source = sourceInherited
+		}
+		bindings = append(bindings, binding)
 	}
 
 	payload := outputPayload{
@@ -727,11 +2427,15 @@ func (a *App) printJSONOutput(w io.Writer, mode, cwd, rangeSpec string, command
 		CWD:       cwd,
 		Range:     rangeSpec,
 		Overrides: bindings,
-		Warnings:  append([]string{}, warnings...),
+		Warnings:  append([]warning{}, warnings...),
+		Env:       env,
 	}
 	if len(command) > 0 {
 		payload.Command = append([]string{}, command...)
 	}
+	if a.mnemonics {
+		payload.Mnemonic = planMnemonic(overrides)
+	}
 
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(payload); err != nil {
@@ -739,26 +2443,114 @@ func (a *App) printJSONOutput(w io.Writer, mode, cwd, rangeSpec string, command
 	}
 }
 
-func (a *App) buildExecEnv(overrides map[string]string) []string {
-	env := append([]string{}, a.environ...)
+// buildExecEnv returns base with the overrides added.
+func (a *App) buildExecEnv(base []string, overrides map[string]string) []string {
+	env := append([]string{}, base...)
 	for key, value := range overrides {
 		env = append(env, fmt.Sprintf("%s=%s", key, value))
 	}
 	return env
 }
 
-func (a *App) printOverrideSummary(cmdName string, cmdArgs []string, overrides map[string]string) {
+// childEnvVar is one variable of the merged child environment as shown by
+// --show-env. Shadowed holds the parent value an override replaces.
+type childEnvVar struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Override bool   `json:"override,omitempty"`
+	Shadowed string `json:"shadowed,omitempty"`
+	Redacted bool   `json:"redacted,omitempty"`
+}
+
+const redactedValue = "<redacted>"
+
+// childEnv returns the environment the child would see given the base it
+// inherits, sorted by key. With redact, values not set by autoport are
+// hidden.
+func (a *App) childEnv(base []string, overrides map[string]string, redact bool) []childEnvVar {
+	merged := map[string]childEnvVar{}
+	for _, kv := range base {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		merged[key] = childEnvVar{Key: key, Value: value}
+	}
+	for key, value := range overrides {
+		v := childEnvVar{Key: key, Value: value, Override: true}
+		if parent, ok := merged[key]; ok && parent.Value != value {
+			v.Shadowed = parent.Value
+		}
+		merged[key] = v
+	}
+
+	out := make([]childEnvVar, 0, len(merged))
+	for _, key := range sortedEnvKeys(merged) {
+		v := merged[key]
+		if redact && !v.Override {
+			v.Value = redactedValue
+			v.Redacted = true
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func (a *App) printChildEnv(env []childEnvVar) {
+	for _, v := range env {
+		switch {
+		case v.Shadowed != "":
+			fmt.Fprintf(a.stdout, "%s=%s  # autoport (shadows %s)\n", v.Key, v.Value, v.Shadowed)
+		case v.Override:
+			fmt.Fprintf(a.stdout, "%s=%s  # autoport\n", v.Key, v.Value)
+		default:
+			fmt.Fprintf(a.stdout, "%s=%s\n", v.Key, v.Value)
+		}
+	}
+}
+
+func sortedEnvKeys(values map[string]childEnvVar) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printOverrideSummary prints the overrides table to stderr, leaving out
+// the unchanged keys under --changed-only and counting them instead.
+func (a *App) printOverrideSummary(cmdName string, cmdArgs []string, overrides map[string]string, changes []lastrun.Change, unchanged map[string]bool, urls map[string]string, noTruncate bool) {
 	keys := sortedKeys(overrides)
 
-	keyWidth := len("ENV")
-	valueWidth := len("PORT")
+	headers := []string{"ENV", "PORT"}
+	var mnemonics map[string]string
+	if a.mnemonics {
+		mnemonics = portMnemonics(overrides)
+		headers = append(headers, "MNEMONIC")
+	}
+	if len(urls) > 0 {
+		headers = append(headers, "URL")
+	}
+	rows := make([][]string, 0, len(keys))
+	hidden := 0
 	for _, key := range keys {
-		if len(key) > keyWidth {
-			keyWidth = len(key)
+		if unchanged[key] {
+			hidden++
+			continue
+		}
+		value := overrides[key]
+		if a.inherited[key] {
+			value += " (" + sourceInherited + ")"
 		}
-		if len(overrides[key]) > valueWidth {
-			valueWidth = len(overrides[key])
+		row := []string{key, value}
+		if a.mnemonics {
+			row = append(row, mnemonics[key])
 		}
+		if len(urls) > 0 {
+			row = append(row, urls[key])
+		}
+		rows = append(rows, row)
 	}
 
 	command := cmdName
@@ -766,15 +2558,52 @@ func (a *App) printOverrideSummary(cmdName string, cmdArgs []string, overrides m
 		command = fmt.Sprintf("%s %s", cmdName, strings.Join(cmdArgs, " "))
 	}
 
-	border := fmt.Sprintf("+-%s-+-%s-+\n", strings.Repeat("-", keyWidth), strings.Repeat("-", valueWidth))
+	if a.mnemonics {
+		command += " [" + planMnemonic(overrides) + "]"
+	}
 	fmt.Fprintf(a.stderr, "\nautoport overrides (%d) -> %s\n", len(keys), command)
-	fmt.Fprint(a.stderr, border)
-	fmt.Fprintf(a.stderr, "| %-*s | %-*s |\n", keyWidth, "ENV", valueWidth, "PORT")
-	fmt.Fprint(a.stderr, border)
-	for _, key := range keys {
-		fmt.Fprintf(a.stderr, "| %-*s | %-*s |\n", keyWidth, key, valueWidth, overrides[key])
+	if len(rows) > 0 {
+		printTable(a.stderr, headers, rows, tableLayout{Width: terminalWidth(a.stderr, a.environ), NoTruncate: noTruncate})
+	}
+	if hidden > 0 {
+		fmt.Fprintf(a.stderr, "%d unchanged not shown\n", hidden)
+	}
+	if len(changes) > 0 {
+		fmt.Fprintf(a.stderr, "changed since last run:\n")
+		for _, c := range changes {
+			fmt.Fprintf(a.stderr, "  %s: %d -> %d (%s)\n", c.Key, c.Previous, c.Current, c.Reason)
+		}
+	}
+}
+
+// sourceInherited is the reported source of values kept from the invoking
+// environment under --respect-existing.
+const sourceInherited = "inherited"
+
+func assignmentSource(as assignedPort) string {
+	switch {
+	case as.Inherited:
+		return sourceInherited
+	case as.Pinned:
+		return "pinned"
+	case as.KeyRange != "":
+		return "key_range"
+	}
+	return ""
+}
+
+// assignmentOrigin names the config file that defined the pin, key range,
+// group, or canonical port an assignment was derived from, if any.
+func (a *App) assignmentOrigin(as assignedPort) string {
+	switch {
+	case (as.Pinned || as.KeyRange != "") && a.config.Origin("ports."+as.Key) != "":
+		return a.config.Origin("ports." + as.Key)
+	case as.Group != "":
+		return a.config.Origin("groups." + as.Group)
+	case as.Base > 0:
+		return a.config.Origin("canonical.ports." + as.Key)
 	}
-	fmt.Fprint(a.stderr, border)
+	return ""
 }
 
 func sortedKeys(values map[string]string) []string {
@@ -4,15 +4,23 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/gelleson/autoport/internal/config"
 	"github.com/gelleson/autoport/internal/lockfile"
+	"github.com/gelleson/autoport/internal/msg"
+	"github.com/gelleson/autoport/internal/snapshot"
 )
 
 type MockExecutor struct {
@@ -29,6 +37,62 @@ func (m *MockExecutor) Run(ctx context.Context, name string, args []string, env
 	return m.Err
 }
 
+// RecordingExecutor records every command run, e.g. hooks around the child.
+type RecordingExecutor struct {
+	Calls []MockExecutor
+	// FailName makes Run return an error for commands with this name.
+	FailName string
+}
+
+func (r *RecordingExecutor) Run(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+	r.Calls = append(r.Calls, MockExecutor{CapturedName: name, CapturedArgs: args, CapturedEnv: env})
+	if name == r.FailName {
+		return &ExitError{Code: 3}
+	}
+	return nil
+}
+
+// executorFunc adapts a func to Executor, for tests whose fake command
+// needs behavior of its own.
+type executorFunc func(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error
+
+func (f executorFunc) Run(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+	return f(ctx, name, args, env, stdout, stderr)
+}
+
+// observedExecutor is an executorFunc whose command reports pid on start.
+type observedExecutor struct {
+	executorFunc
+	pid int
+}
+
+func (o observedExecutor) RunObserved(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer, onStart func(pid int)) error {
+	onStart(o.pid)
+	return o.executorFunc(ctx, name, args, env, stdout, stderr)
+}
+
+// blockingExecutor runs until its context is done or hold elapses.
+func blockingExecutor(hold time.Duration) executorFunc {
+	return func(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(hold):
+			return nil
+		}
+	}
+}
+
+func envValue(env []string, key string) string {
+	value := ""
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			value = v
+		}
+	}
+	return value
+}
+
 func TestApp_Run_Export(t *testing.T) {
 	var stdout bytes.Buffer
 	app := New(
@@ -202,6 +266,42 @@ func TestApp_Explain_JSON(t *testing.T) {
 	}
 }
 
+func TestApp_Explain_ExcludesComposeEnvKeys(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte("services: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("DB_PORT=5432\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}, Scanner: config.ScannerConfig{ExcludeComposeEnv: true}}),
+		WithStdout(&stdout),
+		WithEnviron(nil),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "explain", Format: "json", Range: "10000-11000", CWD: dir}, nil)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	var payload explainPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	for _, k := range payload.Keys {
+		if k.Key == "DB_PORT" {
+			if k.Included || k.Kind != "compose" {
+				t.Fatalf("DB_PORT = %+v, want excluded compose key", k)
+			}
+			return
+		}
+	}
+	t.Fatalf("DB_PORT missing from keys: %+v", payload.Keys)
+}
+
 func TestApp_Doctor_ExitWarning(t *testing.T) {
 	var stdout bytes.Buffer
 	app := New(
@@ -220,6 +320,220 @@ func TestApp_Doctor_ExitWarning(t *testing.T) {
 	}
 }
 
+func TestApp_Doctor_WarnsOnOverlappingRangeSegments(t *testing.T) {
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "doctor", Format: "json", CWD: t.TempDir(), Range: "3000-3999,3500-4999,!4444"}, nil)
+	if e, ok := err.(*ExitError); !ok || e.Code != 1 {
+		t.Fatalf("expected warning exit, got %v", err)
+	}
+	var payload doctorPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	for _, c := range payload.Checks {
+		if c.Name == "range" {
+			if c.Status != "warn" || !strings.Contains(c.Message, "3000-3999 overlaps 3500-4999") {
+				t.Fatalf("unexpected range check: %+v", c)
+			}
+			return
+		}
+	}
+	t.Fatal("range check missing")
+}
+
+func TestApp_Doctor_JSONChecksCarryIDSeverityAndDetails(t *testing.T) {
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return p != 3500 }),
+		WithPortOwner(func(p int) (PortOwner, bool) {
+			return PortOwner{PID: 31, Process: "postgres", Cmdline: "postgres -D data"}, p == 3500
+		}),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "doctor", Format: "json", CWD: t.TempDir(), Range: "3000-3999,3500-3999"}, nil)
+	if e, ok := err.(*ExitError); !ok || e.Code != 1 {
+		t.Fatalf("expected warning exit, got %v", err)
+	}
+	var payload struct {
+		Checks []struct {
+			ID       string         `json:"id"`
+			Name     string         `json:"name"`
+			Severity string         `json:"severity"`
+			Message  string         `json:"message"`
+			Details  map[string]any `json:"details"`
+		} `json:"checks"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	byID := map[string]int{}
+	for i, c := range payload.Checks {
+		byID[c.ID] = i
+	}
+	i, ok := byID["range.overlapping_segments"]
+	if !ok {
+		t.Fatalf("range.overlapping_segments missing: %s", stdout.String())
+	}
+	if c := payload.Checks[i]; c.Name != "range" || c.Severity != "warning" || c.Details["size"] != float64(1000) || c.Details["overlaps"] == nil {
+		t.Fatalf("unexpected range check: %+v", c)
+	}
+	i, ok = byID["port_availability.some_busy"]
+	if !ok {
+		t.Fatalf("port_availability.some_busy missing: %s", stdout.String())
+	}
+	if c := payload.Checks[i]; c.Severity != "warning" || c.Details["free"] != float64(2) || !strings.Contains(c.Message, "port 3500 is held by pid 31 (postgres)") {
+		t.Fatalf("unexpected port check: %+v", c)
+	}
+	if owners, _ := payload.Checks[i].Details["owners"].([]any); len(owners) != 1 || owners[0].(map[string]any)["cmdline"] != "postgres -D data" {
+		t.Fatalf("owners = %v", payload.Checks[i].Details["owners"])
+	}
+	if i, ok := byID["config.ok"]; !ok || payload.Checks[i].Severity != "info" {
+		t.Fatalf("config.ok missing or not info: %s", stdout.String())
+	}
+}
+
+func TestApp_Doctor_LocalizesTextOnly(t *testing.T) {
+	msg.Register("xx", msg.Catalog{
+		"range %s (size=%d)":                    "plage %s (%d ports)",
+		"very small range may cause collisions": "plage trop petite",
+	})
+	t.Cleanup(func() { msg.Register("xx", nil) })
+
+	run := func(format string) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithEnviron([]string{"LANG=xx_YY.UTF-8"}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		err := app.Run(context.Background(), Options{Mode: "doctor", Format: format, CWD: t.TempDir(), Range: "3000-3004"}, nil)
+		if e, ok := err.(*ExitError); !ok || e.Code != 1 {
+			t.Fatalf("expected warning exit, got %v", err)
+		}
+		return stdout.String()
+	}
+
+	if out := run("text"); !strings.Contains(out, "- [warn] range: plage 3000-3004 (5 ports); plage trop petite\n") {
+		t.Fatalf("text output not localized:\n%s", out)
+	}
+	var payload doctorPayload
+	if err := json.Unmarshal([]byte(run("json")), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	for _, c := range payload.Checks {
+		if c.Name == "range" && c.Message != "range 3000-3004 (size=5); very small range may cause collisions" {
+			t.Fatalf("json message should stay English: %q", c.Message)
+		}
+	}
+}
+
+func TestApp_Run_MultiRangeAvoidsExcludedPort(t *testing.T) {
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{"WEB_PORT=1"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	seed := uint32(1)
+	if err := app.Run(context.Background(), Options{CWD: "/test/path", Seed: &seed, Range: "3000-3001,4000-4001,!3001", Format: "dotenv"}, nil); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "PORT=4000") || !strings.Contains(stdout.String(), "WEB_PORT=4001") {
+		t.Fatalf("unexpected assignments:\n%s", stdout.String())
+	}
+}
+
+func TestApp_KeyOrderKeepsSlotsWhenKeysAreAdded(t *testing.T) {
+	assign := func(order []string, environ []string) map[string]string {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}, KeyOrder: order}),
+			WithStdout(&stdout),
+			WithEnviron(environ),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		seed := uint32(7)
+		if err := app.Run(context.Background(), Options{CWD: "/test/path", Seed: &seed, Range: "4000-4999", Format: "dotenv"}, nil); err != nil {
+			t.Fatalf("Run() error: %v", err)
+		}
+		ports := map[string]string{}
+		for _, line := range strings.Fields(stdout.String()) {
+			k, v, _ := strings.Cut(line, "=")
+			ports[k] = v
+		}
+		return ports
+	}
+	base := []string{"WEB_PORT=1", "API_PORT=1"}
+	grown := append([]string{"ADMIN_PORT=1"}, base...)
+
+	unordered, unorderedGrown := assign(nil, base), assign(nil, grown)
+	if unordered["API_PORT"] == unorderedGrown["API_PORT"] {
+		t.Fatalf("without key_order a new key sorting first should shift API_PORT: %v vs %v", unordered, unorderedGrown)
+	}
+
+	order := []string{"PORT", "WEB_PORT", "API_PORT", "GONE_PORT"}
+	before, after := assign(order, base), assign(order, grown)
+	for _, key := range []string{"PORT", "WEB_PORT", "API_PORT"} {
+		if before[key] != after[key] {
+			t.Fatalf("%s moved from %s to %s after adding ADMIN_PORT", key, before[key], after[key])
+		}
+	}
+	// Alphabetically the slots go API_PORT, PORT, WEB_PORT.
+	if before["PORT"] != unordered["API_PORT"] || before["WEB_PORT"] != unordered["PORT"] {
+		t.Fatalf("key_order should hand PORT the first slot and WEB_PORT the second: %v vs %v", before, unordered)
+	}
+}
+
+func TestApp_NamedRangeFromPresetAndCLI(t *testing.T) {
+	cfg := &config.Config{
+		Presets: map[string]config.Preset{"web": {Range: "frontend"}},
+		Ranges:  map[string]string{"frontend": "3000-3009", "backend": "8000-8009"},
+	}
+	for _, opts := range []Options{
+		{Presets: []string{"web"}},
+		{Range: "backend"},
+	} {
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(cfg),
+			WithStdout(&stdout),
+			WithEnviron([]string{}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.Mode = "explain"
+		opts.Format = "json"
+		opts.CWD = "/test/path"
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() error: %v", err)
+		}
+		var payload explainPayload
+		if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+			t.Fatalf("json parse: %v", err)
+		}
+		want := cfg.Ranges["frontend"]
+		if opts.Range != "" {
+			want = cfg.Ranges["backend"]
+		}
+		if payload.Range.Spec != want {
+			t.Fatalf("range = %q, want %q", payload.Range.Spec, want)
+		}
+	}
+}
+
 func TestApp_Lock_WriteAndUse(t *testing.T) {
 	tmp := t.TempDir()
 	var stdout bytes.Buffer
@@ -269,3 +583,778 @@ func TestApp_Run_NewFormats(t *testing.T) {
 		})
 	}
 }
+
+func TestApp_Run_GroupsShareOnePort(t *testing.T) {
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{
+			Presets: map[string]config.Preset{},
+			Groups:  map[string][]string{"web": {"APP_PORT", "HTTP_PORT", "PORT"}},
+		}),
+		WithStdout(&stdout),
+		WithEnviron([]string{"APP_PORT=1", "HTTP_PORT=2", "API_PORT=3"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "run", Format: "json", Range: "10000-11000", CWD: "/test/path"}, nil)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	var payload outputPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json output parse: %v", err)
+	}
+	values := map[string]string{}
+	for _, b := range payload.Overrides {
+		values[b.Key] = b.Value
+	}
+	if values["APP_PORT"] != values["HTTP_PORT"] || values["APP_PORT"] != values["PORT"] {
+		t.Fatalf("expected grouped keys to share a port: %v", values)
+	}
+	if values["API_PORT"] == values["PORT"] {
+		t.Fatalf("expected ungrouped key to get its own port: %v", values)
+	}
+}
+
+func TestApp_Run_GroupsShareLockedAndInheritedPorts(t *testing.T) {
+	tmp := t.TempDir()
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Groups: map[string][]string{"web": {"APP_PORT", "PORT"}}}
+	run := func(environ []string, opts Options) map[string]string {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(WithConfig(cfg), WithStdout(&stdout), WithEnviron(environ), WithIsFree(func(p int) bool { return true }))
+		opts.CWD, opts.Range = tmp, "10000-11000"
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run(%s) unexpected error: %v", opts.Mode, err)
+		}
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		return map[string]string{"PORT": envValue(lines, "PORT"), "APP_PORT": envValue(lines, "APP_PORT")}
+	}
+
+	// The lockfile holds only PORT; APP_PORT joins the group later.
+	if err := lockfile.Write(lockfile.PathFor(tmp), tmp, "10000-11000", map[string]string{"PORT": "10777"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, ".env"), []byte("APP_PORT=2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := run([]string{"PORT=1"}, Options{Mode: "run", Format: "dotenv", UseLock: true}); got["PORT"] != "10777" || got["APP_PORT"] != "10777" {
+		t.Fatalf("--use-lock = %v, want APP_PORT to share the locked PORT 10777", got)
+	}
+	if got := run([]string{"PORT=5000"}, Options{Mode: "run", Format: "dotenv", RespectExisting: true}); got["PORT"] != "5000" || got["APP_PORT"] != "5000" {
+		t.Fatalf("--respect-existing = %v, want APP_PORT to share the kept PORT 5000", got)
+	}
+}
+
+func TestApp_Run_CanonicalPortsShareOffset(t *testing.T) {
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{
+			Presets:   map[string]config.Preset{},
+			Canonical: config.CanonicalConfig{Ports: map[string]int{"WEB_PORT": 3000, "API_PORT": 4000}},
+		}),
+		WithStdout(&stdout),
+		WithEnviron([]string{"WEB_PORT=3000", "API_PORT=4000"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "explain", Format: "json", Range: "10000-11000", CWD: "/test/path"}, nil)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	var payload explainPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	got := map[string]int{}
+	for _, as := range payload.Assignments {
+		got[as.Key] = as.Assigned
+	}
+	webOffset := got["WEB_PORT"] - 3000
+	if webOffset < 1 || webOffset > 100 {
+		t.Fatalf("WEB_PORT offset out of span: %v", got)
+	}
+	if got["API_PORT"]-4000 != webOffset {
+		t.Fatalf("expected shared offset: %v", got)
+	}
+	if got["PORT"] < 10000 || got["PORT"] > 11000 {
+		t.Fatalf("expected non-canonical PORT from range: %v", got)
+	}
+}
+
+func TestApp_Run_PortsPinAndConfineKeys(t *testing.T) {
+	cfg := &config.Config{
+		Ranges: map[string]string{"debug": "9200-9209"},
+		Groups: map[string][]string{"web": {"ADMIN_PORT", "WEB_PORT"}},
+		Ports: map[string]config.PortSpec{
+			"WEB_PORT":   {Port: 3000},
+			"GRPC_PORT":  {Range: "50000-51000"},
+			"DEBUG_PORT": {Range: "debug"},
+		},
+	}
+	plan := func(isFree func(int) bool) (map[string]explainAssignment, error) {
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(cfg),
+			WithStdout(&stdout),
+			WithEnviron([]string{"ADMIN_PORT=1", "WEB_PORT=1", "GRPC_PORT=1", "DEBUG_PORT=1"}),
+			WithIsFree(isFree),
+		)
+		if err := app.Run(context.Background(), Options{Mode: "explain", Format: "json", Range: "10000-11000", CWD: "/test/path"}, nil); err != nil {
+			return nil, err
+		}
+		var payload explainPayload
+		if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+			t.Fatalf("json parse: %v", err)
+		}
+		got := map[string]explainAssignment{}
+		for _, as := range payload.Assignments {
+			got[as.Key] = as
+		}
+		return got, nil
+	}
+
+	got, err := plan(func(p int) bool { return true })
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if got["WEB_PORT"].Assigned != 3000 || got["WEB_PORT"].Source != "pinned" || got["ADMIN_PORT"].Assigned != 3000 {
+		t.Fatalf("expected WEB_PORT and its group pinned to 3000: %+v", got)
+	}
+	if p := got["GRPC_PORT"]; p.Assigned < 50000 || p.Assigned > 51000 || p.Source != "key_range" {
+		t.Fatalf("expected GRPC_PORT from its own range: %+v", p)
+	}
+	if p := got["DEBUG_PORT"].Assigned; p < 9200 || p > 9209 {
+		t.Fatalf("expected DEBUG_PORT from the named debug range: %d", p)
+	}
+	if p := got["PORT"].Assigned; p < 10000 || p > 11000 {
+		t.Fatalf("expected PORT from the global range: %d", p)
+	}
+
+	// Nothing else may take a configured port.
+	grpc := got["GRPC_PORT"].Assigned
+	got, err = plan(func(p int) bool { return p != grpc })
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if got["GRPC_PORT"].Assigned == grpc || got["GRPC_PORT"].Probes == 0 {
+		t.Fatalf("expected GRPC_PORT to probe past busy %d: %+v", grpc, got["GRPC_PORT"])
+	}
+
+	if _, err := plan(func(p int) bool { return p != 3000 }); err == nil || !strings.Contains(err.Error(), "pinned port 3000 for WEB_PORT is in use") {
+		t.Fatalf("expected a busy pin error, got %v", err)
+	}
+}
+
+func TestApp_Run_PreferCurrentKeepsFreeInRangeValue(t *testing.T) {
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{"SHELL_PORT=10789"}),
+		WithFS(fstest.MapFS{"test/path/.env": {Data: []byte("WEB_PORT=10456\nAPI_PORT=3000\nBUSY_PORT=10500\n")}}),
+		WithIsFree(func(p int) bool { return p != 10500 }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "run", Format: "dotenv", Range: "10000-11000", CWD: "/test/path", PreferCurrent: true}, nil)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	out := stdout.String()
+	if !strings.Contains(out, "WEB_PORT=10456\n") {
+		t.Fatalf("expected WEB_PORT to keep current value, got: %s", out)
+	}
+	if strings.Contains(out, "API_PORT=3000\n") {
+		t.Fatalf("expected out-of-range API_PORT to be reassigned, got: %s", out)
+	}
+	if strings.Contains(out, "BUSY_PORT=10500\n") {
+		t.Fatalf("expected busy BUSY_PORT to be reassigned, got: %s", out)
+	}
+	if strings.Contains(out, "SHELL_PORT=10789\n") {
+		t.Fatalf("expected SHELL_PORT, set only in the environment, to be reassigned, got: %s", out)
+	}
+}
+
+func TestApp_Run_RequirePreferredFailsWhenBusy(t *testing.T) {
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(io.Discard),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return p != 10000 }),
+		WithPortOwner(func(p int) (PortOwner, bool) { return PortOwner{PID: 7, Process: "vite"}, p == 10000 }),
+	)
+	seed := uint32(0)
+
+	err := app.Run(context.Background(), Options{Mode: "run", Range: "10000-10010", CWD: "/test/path", Seed: &seed}, nil)
+	if err != nil {
+		t.Fatalf("expected probing fallback without flag, got %v", err)
+	}
+
+	err = app.Run(context.Background(), Options{Mode: "run", Range: "10000-10010", CWD: "/test/path", Seed: &seed, RequirePreferred: true}, nil)
+	if err == nil || !strings.Contains(err.Error(), "preferred port 10000 for PORT is in use by pid 7 (vite)") {
+		t.Fatalf("expected require-preferred error, got %v", err)
+	}
+}
+
+func TestApp_Run_DryRunShowEnv(t *testing.T) {
+	var stdout bytes.Buffer
+	mockExec := &MockExecutor{}
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(mockExec),
+		WithStdout(&stdout),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"PORT=8080", "SECRET=hunter2"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	opts := Options{Mode: "run", Format: "json", Range: "10000-11000", CWD: "/test/path", DryRun: true, ShowEnv: true, RedactEnv: true}
+	if err := app.Run(context.Background(), opts, []string{"npm", "start"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if mockExec.CapturedName != "" {
+		t.Fatal("dry-run must not execute the command")
+	}
+
+	var payload outputPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	env := map[string]childEnvVar{}
+	for _, v := range payload.Env {
+		env[v.Key] = v
+	}
+	if v := env["PORT"]; !v.Override || v.Shadowed != "8080" || v.Value == "8080" {
+		t.Fatalf("expected PORT override shadowing 8080, got %+v", v)
+	}
+	if v := env["SECRET"]; !v.Redacted || v.Value == "hunter2" {
+		t.Fatalf("expected SECRET redacted, got %+v", v)
+	}
+}
+
+func TestApp_SnapshotRoundTrip(t *testing.T) {
+	tmp := t.TempDir()
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{"WEB_PORT=3000"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "snapshot", Range: "10000-10010", CWD: "/teammate/checkout"}, nil)
+	if err != nil {
+		t.Fatalf("snapshot run error: %v", err)
+	}
+	snapPath := filepath.Join(tmp, "snap.json")
+	if err := os.WriteFile(snapPath, stdout.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := snapshot.Read(snapPath)
+	if err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+	want := snap.ToMap()
+
+	// Another path and an empty environment still reproduce the snapshot.
+	stdout.Reset()
+	app = New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	err = app.Run(context.Background(), Options{Mode: "run", Format: "json", Range: "20000-30000", CWD: tmp, FromSnapshot: snapPath}, nil)
+	if err != nil {
+		t.Fatalf("from-snapshot run error: %v", err)
+	}
+	var payload outputPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	for _, b := range payload.Overrides {
+		if want[b.Key] != b.Value {
+			t.Fatalf("override %s=%s not from snapshot %v", b.Key, b.Value, want)
+		}
+	}
+	if len(payload.Overrides) != 2 {
+		t.Fatalf("expected PORT and WEB_PORT from snapshot, got %+v", payload.Overrides)
+	}
+}
+
+// initGitRepo creates a repository on branch main with the given origin URL.
+func initGitRepo(t *testing.T, origin string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"remote", "add", "origin", origin},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func explainSeed(t *testing.T, opts Options) explainPayload {
+	t.Helper()
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts.Mode = "explain"
+	opts.Format = "json"
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload explainPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	return payload
+}
+
+func TestApp_SeedFromRemoteIgnoresClonePath(t *testing.T) {
+	a := initGitRepo(t, "git@github.com:acme/shop.git")
+	b := initGitRepo(t, "https://github.com/acme/shop")
+
+	pa := explainSeed(t, Options{CWD: a, SeedFrom: "origin"})
+	pb := explainSeed(t, Options{CWD: b, SeedFrom: "origin"})
+	if pa.Seed != pb.Seed {
+		t.Fatalf("expected identical seeds for clones, got %d and %d", pa.Seed, pb.Seed)
+	}
+	if pa.SeedSource != "remote:github.com/acme/shop@main" {
+		t.Fatalf("seed material = %q", pa.SeedSource)
+	}
+	if explainSeed(t, Options{CWD: a}).Seed == explainSeed(t, Options{CWD: b}).Seed {
+		t.Fatal("expected path seeds to differ")
+	}
+}
+
+func TestApp_SeedBranchKeepsMainlinePorts(t *testing.T) {
+	dir := initGitRepo(t, "https://github.com/acme/shop")
+	seedOn := func() explainPayload {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}, SeedBranch: true}),
+			WithStdout(&stdout),
+			WithEnviron([]string{}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		if err := app.Run(context.Background(), Options{Mode: "explain", Format: "json", CWD: dir}, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		var payload explainPayload
+		if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+			t.Fatalf("json parse: %v", err)
+		}
+		return payload
+	}
+
+	plain := explainSeed(t, Options{CWD: dir})
+	if main := seedOn(); main.Seed != plain.Seed {
+		t.Fatalf("main seed = %d, want the path seed %d", main.Seed, plain.Seed)
+	}
+	if out, err := exec.Command("git", "-C", dir, "checkout", "-q", "-b", "feature/login").CombinedOutput(); err != nil {
+		t.Fatalf("git checkout: %v\n%s", err, out)
+	}
+	feature := seedOn()
+	if feature.Seed == plain.Seed || feature.SeedSource != "path:"+dir+"@feature/login" {
+		t.Fatalf("feature branch seed = %d (%s), want a branch seed", feature.Seed, feature.SeedSource)
+	}
+}
+
+func TestApp_SeedStringIsRecorded(t *testing.T) {
+	a := explainSeed(t, Options{CWD: "/a", SeedString: "my-service-dev"})
+	b := explainSeed(t, Options{CWD: "/b", SeedString: "my-service-dev"})
+	if a.Seed != b.Seed {
+		t.Fatalf("expected same seed for same string, got %d and %d", a.Seed, b.Seed)
+	}
+	if a.SeedSource != "string:my-service-dev" {
+		t.Fatalf("seed material = %q", a.SeedSource)
+	}
+
+	tmp := t.TempDir()
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(io.Discard),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	if err := app.Run(context.Background(), Options{Mode: "lock", CWD: tmp, SeedString: "my-service-dev"}, nil); err != nil {
+		t.Fatalf("lock run error: %v", err)
+	}
+	lf, err := lockfile.Read(lockfile.PathFor(tmp))
+	if err != nil {
+		t.Fatalf("read lockfile: %v", err)
+	}
+	if lf.SeedString != "my-service-dev" {
+		t.Fatalf("lockfile seed_string = %q", lf.SeedString)
+	}
+}
+
+func TestApp_Run_CancelAbortsProbing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	probed := 0
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(io.Discard),
+		WithEnviron([]string{"PORT=1"}),
+		WithIsFree(func(p int) bool {
+			probed++
+			if probed == 3 {
+				cancel()
+			}
+			return false
+		}),
+	)
+	err := app.Run(ctx, Options{Mode: "run", Range: "10000-60000", CWD: t.TempDir()}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() error = %v, want context.Canceled", err)
+	}
+	if probed != 3 {
+		t.Fatalf("probed %d ports, want probing to stop at cancellation", probed)
+	}
+}
+
+func TestApp_ExplainDecisionTrace(t *testing.T) {
+	var stdout bytes.Buffer
+	cfg := &config.Config{
+		Presets: map[string]config.Preset{"web": {IgnorePrefixes: []string{"AWS_"}, ExcludeKeys: []string{"DB_PORT"}}},
+		Origins: map[string]string{"presets.web": "/repo/.autoport.json"},
+	}
+	app := New(
+		WithConfig(cfg),
+		WithStdout(&stdout),
+		WithEnviron([]string{"AWS_PORT=1", "CACHE_PORT=2", "DB_PORT=3", "WEB_PORT=4"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts := Options{
+		Mode:    "explain",
+		Format:  "json",
+		CWD:     t.TempDir(),
+		Presets: []string{"web"},
+		Ignores: []string{"CACHE_"},
+		PortEnv: []string{"EXTRA_PORT"},
+		Origins: map[string]string{"ignores": "flag -i", "keys": "env AUTOPORT_KEYS"},
+	}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload explainPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+
+	got := map[string]selectionRule{}
+	for _, k := range payload.Keys {
+		got[k.Key] = k.Rule
+	}
+	want := map[string]selectionRule{
+		"AWS_PORT":   {Rule: "ignore_prefixes", Value: "AWS_", Origin: "preset web (/repo/.autoport.json)"},
+		"CACHE_PORT": {Rule: "ignore_prefixes", Value: "CACHE_", Origin: "flag -i"},
+		"DB_PORT":    {Rule: "exclude_keys", Value: "DB_PORT", Origin: "preset web (/repo/.autoport.json)"},
+		"WEB_PORT":   {Rule: "discovered", Origin: "env"},
+		"PORT":       {Rule: "discovered", Origin: "default"},
+		"EXTRA_PORT": {Rule: "manual_key", Value: "EXTRA_PORT", Origin: "env AUTOPORT_KEYS"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rules = %v, want %v", got, want)
+	}
+	for _, as := range payload.Assignments {
+		if as.Key == "AWS_PORT" || as.Key == "CACHE_PORT" {
+			t.Fatalf("ignored key %s was assigned", as.Key)
+		}
+	}
+}
+
+func TestApp_ExplainReportsOrigins(t *testing.T) {
+	var stdout bytes.Buffer
+	cfg := &config.Config{
+		Presets:  map[string]config.Preset{"web": {Range: "8000-9000"}},
+		SeedFrom: "path",
+		Origins:  map[string]string{"presets.web": "/home/dev/.autoport.json", "seed_from": "/repo/.autoport.json"},
+	}
+	app := New(
+		WithConfig(cfg),
+		WithStdout(&stdout),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts := Options{
+		Mode:      "explain",
+		Format:    "json",
+		CWD:       "/repo",
+		Presets:   []string{"web"},
+		Namespace: "ci",
+		Origins:   map[string]string{"presets": "flag -p", "format": "flag --format"},
+	}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload explainPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, o := range payload.Origins {
+		got[o.Option] = o.Value + " | " + o.Origin
+	}
+	want := map[string]string{
+		"range":     "8000-9000 | preset web (/home/dev/.autoport.json)",
+		"namespace": "ci | cli",
+		"presets":   "web | flag -p",
+		"format":    "json | flag --format",
+		"seed":      fmt.Sprintf("%d (path:/repo) | config seed_from (/repo/.autoport.json)", payload.Seed),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("origins = %v, want %v", got, want)
+	}
+}
+
+func TestApp_ExplainAttributesLocalOverlay(t *testing.T) {
+	var stdout bytes.Buffer
+	cfg := &config.Config{
+		Presets:   map[string]config.Preset{},
+		Ranges:    map[string]string{"dev": "5000-5999"},
+		Canonical: config.CanonicalConfig{Ports: map[string]int{"API_PORT": 5100, "WEB_PORT": 5200}},
+		Origins: map[string]string{
+			"ranges.dev":               config.LocalFile,
+			"canonical.ports.API_PORT": config.LocalFile,
+			"canonical.ports.WEB_PORT": ".autoport.json",
+		},
+	}
+	app := New(
+		WithConfig(cfg),
+		WithStdout(&stdout),
+		WithEnviron([]string{"API_PORT=1", "WEB_PORT=2"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts := Options{Mode: "explain", Format: "json", CWD: "/repo", Range: "dev", Origins: map[string]string{"range": "flag -r"}}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload explainPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	if o := payload.Origins[0]; o.Option != "range" || o.Origin != "flag -r, named range dev (.autoport.local.json)" {
+		t.Fatalf("range origin = %+v", o)
+	}
+	got := map[string]string{}
+	for _, as := range payload.Assignments {
+		got[as.Key] = as.Origin
+	}
+	if got["API_PORT"] != config.LocalFile || got["WEB_PORT"] != ".autoport.json" {
+		t.Fatalf("assignment origins = %v", got)
+	}
+}
+
+func TestApp_K8sPresetExcludesServiceLinks(t *testing.T) {
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{
+			"API_PORT=1",
+			"REDIS_SERVICE_PORT=6379",
+			"REDIS_PORT_6379_TCP_PORT=6379",
+			"DNS_PORT_53_UDP_PORT=53",
+		}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts := Options{Mode: "explain", Format: "json", CWD: "/repo", Presets: []string{"k8s"}}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload explainPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	var assigned []string
+	for _, as := range payload.Assignments {
+		assigned = append(assigned, as.Key)
+	}
+	if !reflect.DeepEqual(assigned, []string{"API_PORT", "PORT"}) {
+		t.Fatalf("assigned %v, want the service links excluded", assigned)
+	}
+	rules := map[string]selectionRule{}
+	for _, k := range payload.Keys {
+		rules[k.Key] = k.Rule
+	}
+	want := map[string]string{
+		"REDIS_SERVICE_PORT":       "*_SERVICE_PORT",
+		"REDIS_PORT_6379_TCP_PORT": "*_PORT_[0-9]*_TCP*",
+		"DNS_PORT_53_UDP_PORT":     "*_PORT_[0-9]*_UDP*",
+	}
+	for key, pattern := range want {
+		if r := rules[key]; r.Rule != ruleExcludePattern || r.Value != pattern || r.Origin != "preset k8s (built-in)" {
+			t.Errorf("%s rule = %+v, want pattern %s", key, r, pattern)
+		}
+	}
+}
+
+func TestApp_PureSkipsAvailabilityProbing(t *testing.T) {
+	run := func(isFree func(int) bool, pure bool) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithEnviron([]string{"WEB_PORT=3000", "API_PORT=4000"}),
+			WithIsFree(isFree),
+		)
+		opts := Options{Mode: "run", Format: "dotenv", Range: "10000-11000", CWD: "/repo", Pure: pure}
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return stdout.String()
+	}
+	want := run(func(int) bool { return true }, false)
+	if got := run(func(int) bool { return false }, true); got != want {
+		t.Fatalf("--pure output = %q, want the preferred ports %q", got, want)
+	}
+}
+
+func TestApp_Run_QuietKeepsWarningsSilentDropsThem(t *testing.T) {
+	run := func(opts Options) (stdout, stderr string) {
+		var out, errOut bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithExecutor(&MockExecutor{}),
+			WithStdout(&out),
+			WithStderr(&errOut),
+			WithLogger(slog.New(slog.NewTextHandler(&errOut, &slog.HandlerOptions{Level: slog.LevelWarn}))),
+			WithEnviron([]string{}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.CWD = "/test/path"
+		opts.Presets = []string{"missing"}
+		if err := app.Run(context.Background(), opts, []string{"npm", "start"}); err != nil {
+			t.Fatalf("Run() error: %v", err)
+		}
+		return out.String(), errOut.String()
+	}
+
+	stdout, stderr := run(Options{Quiet: true})
+	if stdout != "" || strings.Contains(stderr, "autoport overrides") || !strings.Contains(stderr, "preset not found") {
+		t.Fatalf("-q should keep only warnings: stdout=%q stderr=%q", stdout, stderr)
+	}
+	stdout, stderr = run(Options{Silent: true})
+	if stdout != "" || stderr != "" {
+		t.Fatalf("--silent should write nothing: stdout=%q stderr=%q", stdout, stderr)
+	}
+}
+
+// projectConfigs writes one .autoport.json per project and points the user
+// config at an empty home, so config.LoadFrom reads only the projects'.
+func projectConfigs(t *testing.T, configs map[string]string) map[string]string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	root := t.TempDir()
+	dirs := map[string]string{}
+	for name, cfg := range configs {
+		dir := filepath.Join(root, name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("WEB_PORT=1\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if cfg != "" {
+			if err := os.WriteFile(filepath.Join(dir, ".autoport.json"), []byte(cfg), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dirs[name] = dir
+	}
+	return dirs
+}
+
+func TestApp_WarnsAboutUnmanagedTaskFilePorts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"repo/Makefile": {Data: []byte("WEB_PORT := 3000\nAPI_PORT ?= 4000\n")},
+	}
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}, Scanner: config.ScannerConfig{WarnUnmanaged: true}}),
+		WithStdout(&stdout),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithEnviron(nil),
+		WithFS(fsys),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	if err := app.Run(context.Background(), Options{Mode: "run", Format: "json", Range: "10000-11000", CWD: "/repo"}, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload outputPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Overrides) != 3 {
+		t.Fatalf("expected PORT plus both Makefile keys, got %+v", payload.Overrides)
+	}
+	if len(payload.Warnings) != 1 || payload.Warnings[0].Code != WarnUnmanagedPort || payload.Warnings[0].Context["key"] != "WEB_PORT" {
+		t.Fatalf("warnings = %+v, want one unmanaged-port for WEB_PORT", payload.Warnings)
+	}
+}
+
+func TestApp_RespectExistingKeepsInheritedValues(t *testing.T) {
+	fsys := fstest.MapFS{"repo/.env": {Data: []byte("API_PORT=4000\n")}}
+	run := func(cfg *config.Config, opts Options) outputPayload {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(cfg),
+			WithStdout(&stdout),
+			WithEnviron([]string{"WEB_PORT=3000", "PORT=10000"}),
+			WithFS(fsys),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.Mode, opts.Format, opts.Range, opts.CWD = "run", "json", "10000-10001", "/repo"
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		var payload outputPayload
+		if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+			t.Fatal(err)
+		}
+		return payload
+	}
+	bindings := func(p outputPayload) map[string]string {
+		out := map[string]string{}
+		for _, b := range p.Overrides {
+			out[b.Key] = b.Value + " " + b.Source
+		}
+		return out
+	}
+
+	got := bindings(run(&config.Config{Presets: map[string]config.Preset{}}, Options{RespectExisting: true}))
+	want := map[string]string{"WEB_PORT": "3000 inherited", "PORT": "10000 inherited", "API_PORT": "10001 "}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("overrides = %v, want %v", got, want)
+	}
+	got = bindings(run(&config.Config{Presets: map[string]config.Preset{}, RespectExisting: true}, Options{}))
+	if got["WEB_PORT"] != "3000 inherited" {
+		t.Fatalf("config respect_existing should keep WEB_PORT, got %v", got)
+	}
+	if got = bindings(run(&config.Config{Presets: map[string]config.Preset{}}, Options{})); got["WEB_PORT"] == "3000 inherited" {
+		t.Fatalf("without the flag WEB_PORT should be reassigned, got %v", got)
+	}
+}
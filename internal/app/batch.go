@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+// batchProject is one project's result in `autoport batch` output.
+type batchProject struct {
+	CWD          string          `json:"cwd"`
+	Seed         uint32          `json:"seed"`
+	SeedMaterial string          `json:"seed_material"`
+	Range        string          `json:"range"`
+	Overrides    []outputBinding `json:"overrides"`
+	Warnings     []warning       `json:"warnings,omitempty"`
+}
+
+type batchPayload struct {
+	Mode     string         `json:"mode"`
+	Projects []batchProject `json:"projects"`
+}
+
+// runBatch plans every project in paths against one shared view of the
+// ports handed out so far: a port assigned to an earlier project counts as
+// busy for later ones, so the combined result never collides. Paths are
+// resolved against opts.CWD and processed in the order given.
+func (a *App) runBatch(ctx context.Context, opts Options, paths []string) error {
+	if len(paths) == 0 {
+		return errors.New("batch: no project paths given")
+	}
+	isFree := a.isFree
+	a.distinct = true
+	defer func() { a.isFree, a.distinct = isFree, false }()
+	taken := map[int]string{}
+	a.isFree = func(proto port.Protocol, p int) bool {
+		_, used := taken[p]
+		return !used && isFree(proto, p)
+	}
+
+	payload := batchPayload{Mode: "batch"}
+	for _, path := range paths {
+		popts := opts
+		popts.CWD = path
+		if !filepath.IsAbs(path) {
+			popts.CWD = filepath.Join(opts.CWD, path)
+		}
+		popts.CWD = filepath.Clean(popts.CWD)
+
+		restore, err := a.useProjectConfig(popts, true)
+		if err != nil {
+			return fmt.Errorf("batch %s: %w", path, err)
+		}
+		p, res, err := a.batchPlan(ctx, popts)
+		if err != nil {
+			restore()
+			return fmt.Errorf("batch %s: %w", path, err)
+		}
+		warnings := p.Warnings
+		for _, as := range p.Assignments {
+			if other, ok := taken[as.Assigned]; ok && other != popts.CWD {
+				// Locked, snapshot, and canonical ports are taken as-is and
+				// may still clash with another project.
+				a.metrics.collisions.Inc()
+				w := newWarning(WarnBatchConflict, "port %d for %s in %s is also assigned in %s", as.Assigned, as.Key, popts.CWD, other)
+				warnings = append(warnings, w.with("port", strconv.Itoa(as.Assigned)).with("key", as.Key).with("project", other))
+				continue
+			}
+			taken[as.Assigned] = popts.CWD
+		}
+		err = promoteWarnings(warnings, a.config.WarningsAsErrors)
+		restore()
+		if err != nil {
+			return fmt.Errorf("batch %s: %w", path, err)
+		}
+
+		project := batchProject{
+			CWD:          popts.CWD,
+			Seed:         p.Seed.Value,
+			SeedMaterial: p.Seed.Material,
+			Range:        res.Range,
+			Overrides:    make([]outputBinding, 0, len(p.Overrides)),
+			Warnings:     warnings,
+		}
+		for _, key := range sortedKeys(p.Overrides) {
+			project.Overrides = append(project.Overrides, outputBinding{Key: key, Value: p.Overrides[key]})
+		}
+		payload.Projects = append(payload.Projects, project)
+	}
+
+	if opts.Format == "dotenv" {
+		for i, project := range payload.Projects {
+			if i > 0 {
+				fmt.Fprintln(a.stdout)
+			}
+			fmt.Fprintf(a.stdout, "# %s\n", project.CWD)
+			overrides := make(map[string]string, len(project.Overrides))
+			for _, b := range project.Overrides {
+				overrides[b.Key] = b.Value
+			}
+			a.printDotenv(overrides)
+			for _, w := range project.Warnings {
+				a.logger.Warn(a.warningText(w), slog.String("code", w.Code))
+			}
+		}
+		return nil
+	}
+	return json.NewEncoder(a.stdout).Encode(payload)
+}
+
+// batchPlan plans one project of a batch with the config in effect.
+func (a *App) batchPlan(ctx context.Context, opts Options) (*plan, resolvedOptions, error) {
+	res, err := a.resolveOptions(opts)
+	if err != nil {
+		return nil, res, err
+	}
+	p, err := a.plan(ctx, opts, res)
+	if err != nil {
+		return nil, res, err
+	}
+	return p, res, checkRequiredKeys(opts, p)
+}
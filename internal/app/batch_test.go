@@ -0,0 +1,101 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_Batch_AvoidsCollisionsAcrossProjects(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, ".env"), []byte("WEB_PORT=3000\nAPI_PORT=4000\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout bytes.Buffer
+	seed := uint32(7)
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron(nil),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	// A shared explicit seed makes both projects prefer the same ports.
+	opts := Options{Mode: "batch", Format: "json", Range: "10000-10009", Seed: &seed, CWD: root}
+	if err := app.Run(context.Background(), opts, []string{"a", filepath.Join(root, "b")}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	var payload batchPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	if len(payload.Projects) != 2 || payload.Projects[0].CWD != filepath.Join(root, "a") {
+		t.Fatalf("projects = %+v", payload.Projects)
+	}
+	seen := map[string]string{}
+	for _, project := range payload.Projects {
+		if len(project.Overrides) != 3 {
+			t.Fatalf("%s overrides = %+v, want PORT, API_PORT, WEB_PORT", project.CWD, project.Overrides)
+		}
+		for _, b := range project.Overrides {
+			if other, dup := seen[b.Value]; dup {
+				t.Fatalf("port %s assigned to %s and %s/%s", b.Value, other, project.CWD, b.Key)
+			}
+			seen[b.Value] = project.CWD + "/" + b.Key
+		}
+	}
+
+	stdout.Reset()
+	opts.Format = "dotenv"
+	if err := app.Run(context.Background(), opts, []string{"a", "b"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if out := stdout.String(); !strings.HasPrefix(out, "# "+filepath.Join(root, "a")+"\n") || !strings.Contains(out, "\n\n# "+filepath.Join(root, "b")+"\n") {
+		t.Fatalf("dotenv output = %q", out)
+	}
+}
+
+func TestApp_BatchPlansWithEachProjectsConfig(t *testing.T) {
+	dirs := projectConfigs(t, map[string]string{
+		"a": `{"ports": {"WEB_PORT": 4000}}`,
+		"b": `{"ports": {"WEB_PORT": 3000}, "key_order": ["WEB_PORT"]}`,
+	})
+	var stdout bytes.Buffer
+	seed := uint32(7)
+	app := New(
+		WithConfig(config.LoadFrom(filepath.Dir(dirs["a"]))),
+		WithStdout(&stdout),
+		WithEnviron(nil),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts := Options{Mode: "batch", Format: "json", Range: "10000-10009", Seed: &seed, CWD: filepath.Dir(dirs["a"])}
+	if err := app.Run(context.Background(), opts, []string{"a", "b"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload batchPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	want := []string{"4000", "3000"}
+	for i, project := range payload.Projects {
+		for _, b := range project.Overrides {
+			if b.Key == "WEB_PORT" && b.Value != want[i] {
+				t.Fatalf("%s WEB_PORT = %s, want its own pin %s", project.CWD, b.Value, want[i])
+			}
+		}
+	}
+	if len(payload.Projects) != 2 {
+		t.Fatalf("projects = %+v", payload.Projects)
+	}
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/env"
+	"github.com/gelleson/autoport/internal/lockfile"
+	"github.com/gelleson/autoport/internal/runcache"
+	"github.com/gelleson/autoport/internal/scanner"
+)
+
+// cachedPlan is the part of a plan run/export mode needs, as stored by
+// --cache-ttl.
+type cachedPlan struct {
+	Seed           seedInfo          `json:"seed"`
+	Assignments    []assignedPort    `json:"assignments"`
+	Overrides      map[string]string `json:"overrides"`
+	Warnings       []warning         `json:"warnings,omitempty"`
+	AssignWarnings []warning         `json:"assign_warnings,omitempty"`
+	Alias          string            `json:"alias,omitempty"`
+}
+
+// planCached plans like plan, but in run mode with --cache-ttl it first
+// reuses a result stored by an identical invocation within the TTL, so
+// repeated calls from a script agree even after the first one's ports got
+// busy. Invocations are identical when they share the cwd, branch, flags,
+// config, port variables, and the contents of the project files, lockfile,
+// and snapshot they read; output of discoverer plugins is not compared.
+func (a *App) planCached(ctx context.Context, opts Options, res resolvedOptions) (*plan, error) {
+	if opts.Mode != "run" || opts.CacheTTL <= 0 || a.cacheDir == "" {
+		return a.plan(ctx, opts, res)
+	}
+	branch, _ := a.gitBranch(ctx, opts.CWD)
+	key := runcache.Key(opts.CWD, branch, a.cacheFlags(opts, res), a.cacheFiles(ctx, opts, res))
+	if data, ok := runcache.Get(a.cacheDir, key, opts.CacheTTL, a.now()); ok {
+		var c cachedPlan
+		if err := json.Unmarshal(data, &c); err == nil {
+			return &plan{Seed: c.Seed, Assignments: c.Assignments, Overrides: c.Overrides, Warnings: c.Warnings, AssignWarnings: c.AssignWarnings, Alias: c.Alias}, nil
+		}
+	}
+
+	p, err := a.plan(ctx, opts, res)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(cachedPlan{Seed: p.Seed, Assignments: p.Assignments, Overrides: p.Overrides, Warnings: p.Warnings, AssignWarnings: p.AssignWarnings, Alias: p.Alias})
+	if err == nil {
+		err = runcache.Put(a.cacheDir, key, data, a.now())
+	}
+	if err != nil {
+		a.logger.Warn("could not cache result", slog.String("error", err.Error()))
+	}
+	return p, nil
+}
+
+// cacheFlags describes every input besides cwd and branch that can change
+// a plan. Output-only flags (format, quiet, dry-run, ...) are left out so
+// `autoport -f json` and `autoport -f dotenv` share an entry.
+func (a *App) cacheFlags(opts Options, res resolvedOptions) string {
+	seed := ""
+	if opts.Seed != nil {
+		seed = fmt.Sprint(*opts.Seed)
+	}
+	var portEnv []string
+	for _, kv := range a.environ {
+		if k, _, ok := strings.Cut(kv, "="); ok && env.IsPortKey(k) {
+			portEnv = append(portEnv, kv)
+		}
+	}
+	sort.Strings(portEnv)
+	// Origins only feed explain; the format is one of them.
+	res.Origins, res.ruleOrigins = nil, nil
+	cfg, _ := json.Marshal(a.config)
+	return fmt.Sprintf("%q|%s|%q|%q|%q|%q|%t|%t|%t|%t|%t|%t|%q|%q|%+v|%q|%s",
+		opts.Namespace, seed, opts.SeedString, opts.SeedFrom, opts.SeedRoot, opts.FromSnapshot,
+		opts.UseLock, opts.PreferCurrent, opts.RespectExisting, opts.RequirePreferred, opts.Pure, opts.LoopbackAlias,
+		opts.PortEnv, opts.Probe, res, portEnv, cfg)
+}
+
+// cacheFiles hashes the files a plan reads: the project files the scanner
+// finds port keys in, the lockfile with --use-lock, and the snapshot with
+// --from-snapshot. Files that cannot be read are recorded by their error.
+func (a *App) cacheFiles(ctx context.Context, opts Options, res resolvedOptions) string {
+	var files []provenanceFile
+	if !res.EnvOnly {
+		discoveries, _, err := a.newScanner(opts.CWD, res, scanner.WithEnvironmentScan(false)).ScanDetailed(ctx)
+		if err != nil {
+			files = append(files, provenanceFile{Role: "scan", Error: err.Error()})
+		}
+		seen := map[string]bool{}
+		for _, d := range discoveries {
+			if !seen[d.Source] {
+				seen[d.Source] = true
+				files = append(files, a.provenanceFile(filepath.Join(opts.CWD, d.Source), "", true))
+			}
+		}
+	}
+	if opts.UseLock {
+		files = append(files, a.provenanceFile(lockfile.PathFor(opts.CWD), "lockfile", true))
+	}
+	if opts.FromSnapshot != "" {
+		files = append(files, a.provenanceFile(opts.FromSnapshot, "snapshot", false))
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "%q %s %s %q\n", f.Path, f.Role, f.SHA256, f.Error)
+	}
+	return b.String()
+}
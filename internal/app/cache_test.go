@@ -0,0 +1,95 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_CacheTTLReusesRecentResult(t *testing.T) {
+	cacheDir := t.TempDir()
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	busy := map[int]bool{}
+	run := func(format string) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithEnviron([]string{"WEB_PORT=3000"}),
+			WithCacheDir(cacheDir),
+			WithClock(func() time.Time { return now }),
+			WithIsFree(func(p int) bool { return !busy[p] }),
+		)
+		opts := Options{Mode: "run", Format: format, Range: "10000-11000", CWD: "/repo", Includes: []string{"WEB_PORT"}, CacheTTL: 5 * time.Second}
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return stdout.String()
+	}
+
+	first := run("dotenv")
+	port, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(first, "WEB_PORT=")))
+	if err != nil {
+		t.Fatalf("unexpected output %q", first)
+	}
+	busy[port] = true // the first invocation's service now holds the port
+	now = now.Add(4 * time.Second)
+	if got := run("dotenv"); got != first {
+		t.Fatalf("cached run = %q, want %q", got, first)
+	}
+	if got := run("json"); !strings.Contains(got, strconv.Itoa(port)) {
+		t.Fatalf("json output %q should share the cached port %d", got, port)
+	}
+	now = now.Add(2 * time.Second)
+	if got := run("dotenv"); got == first {
+		t.Fatalf("expired cache still returned %q", got)
+	}
+}
+
+func TestApp_CacheTTLMissesAfterProjectFilesChange(t *testing.T) {
+	cacheDir, dir := t.TempDir(), t.TempDir()
+	envPath := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envPath, []byte("WEB_PORT=1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(probe string) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithEnviron([]string{}),
+			WithCacheDir(cacheDir),
+			WithIsFree(func(int) bool { return true }),
+		)
+		opts := Options{Mode: "run", Format: "dotenv", Range: "10000-11000", CWD: dir, Probe: probe, CacheTTL: time.Minute}
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return stdout.String()
+	}
+
+	if got := run(""); strings.Contains(got, "API_PORT") {
+		t.Fatalf("first run = %q, want only WEB_PORT", got)
+	}
+	if err := os.WriteFile(envPath, []byte("WEB_PORT=1\nAPI_PORT=2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := run(""); !strings.Contains(got, "API_PORT=") {
+		t.Fatalf("run after editing .env = %q, want the new API_PORT", got)
+	}
+	entries, _ := os.ReadDir(cacheDir)
+	before := len(entries)
+	run("udp")
+	if entries, _ = os.ReadDir(cacheDir); len(entries) != before+1 {
+		t.Fatalf("--probe udp reused a tcp cache entry: %d entries, want %d", len(entries), before+1)
+	}
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Built-in key categories, in the order explain lists them; config
+// categories come after them and before categoryOther.
+const (
+	categoryWeb   = "web"
+	categoryDB    = "db"
+	categoryQueue = "queue"
+	categoryDebug = "debug"
+	categoryOther = "other"
+)
+
+var builtinCategories = []string{categoryWeb, categoryDB, categoryQueue, categoryDebug}
+
+// categoryWords are the words of key names that suggest a category. They
+// are tried in this order, so API_DEBUG_PORT is a debug port and
+// REDIS_HTTP_PORT a db one.
+var categoryWords = []struct {
+	category string
+	words    []string
+}{
+	{categoryDebug, []string{"DEBUG", "DEBUGGER", "INSPECT", "INSPECTOR", "PPROF", "DLV", "DELVE", "JDWP", "PROFILER", "DEVTOOLS"}},
+	{categoryDB, []string{"DB", "DATABASE", "SQL", "POSTGRES", "POSTGRESQL", "PG", "MYSQL", "MARIADB", "MONGO", "MONGODB", "REDIS", "MEMCACHED", "CASSANDRA", "CLICKHOUSE", "ELASTIC", "ELASTICSEARCH", "OPENSEARCH", "COUCHDB", "NEO4J", "INFLUXDB", "MINIO"}},
+	{categoryQueue, []string{"QUEUE", "MQ", "AMQP", "RABBIT", "RABBITMQ", "KAFKA", "NATS", "SQS", "PUBSUB", "BROKER", "PULSAR", "ZOOKEEPER"}},
+	{categoryWeb, []string{"WEB", "HTTP", "HTTPS", "API", "APP", "UI", "FRONTEND", "BACKEND", "SERVER", "ADMIN", "GATEWAY", "PROXY", "GRPC", "VITE", "NEXT", "HMR", "LIVERELOAD"}},
+}
+
+// categoryOf returns key's category: the first config category, by name,
+// with a pattern matching it, else a guess from the words of its name.
+// The bare PORT most apps serve HTTP on is a web port.
+func (a *App) categoryOf(key string) string {
+	for _, name := range slices.Sorted(maps.Keys(a.config.Categories)) {
+		if matchPattern(a.config.Categories[name], key) != "" {
+			return name
+		}
+	}
+	if key == "PORT" {
+		return categoryWeb
+	}
+	words := strings.Split(key, "_")
+	for _, c := range categoryWords {
+		for _, w := range words {
+			if slices.Contains(c.words, w) {
+				return c.category
+			}
+		}
+	}
+	return categoryOther
+}
+
+// categories lists every category name in explain order.
+func (a *App) categories() []string {
+	names := slices.Clone(builtinCategories)
+	for _, name := range slices.Sorted(maps.Keys(a.config.Categories)) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return append(names, categoryOther)
+}
+
+// validateCategories rejects category names that no key could have, which
+// would otherwise exclude nothing without a word.
+func (a *App) validateCategories(names []string) error {
+	known := a.categories()
+	for _, name := range names {
+		if !slices.Contains(known, name) {
+			return fmt.Errorf("unknown category %q (want %s)", name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
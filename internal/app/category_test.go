@@ -0,0 +1,71 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_ExplainGroupsKeysByCategory(t *testing.T) {
+	cfg := &config.Config{
+		Categories: map[string][]string{"search": {"MEILI_*"}},
+		Presets:    map[string]config.Preset{"lean": {ExcludeCategories: []string{"debug"}}},
+	}
+	run := func(opts Options) (string, error) {
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(cfg),
+			WithStdout(&stdout),
+			WithEnviron([]string{"API_PORT=1", "POSTGRES_PORT=2", "KAFKA_BROKER_PORT=3", "API_DEBUG_PORT=4", "MEILI_PORT=5", "MISC_PORT=6"}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.Mode, opts.CWD = "explain", t.TempDir()
+		err := app.Run(context.Background(), opts, nil)
+		return stdout.String(), err
+	}
+
+	out, err := run(Options{Format: "json", Presets: []string{"lean"}, ExcludeCategories: []string{"db"}})
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload explainPayload
+	if err := json.Unmarshal([]byte(out), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	got := map[string]string{}
+	for _, k := range payload.Keys {
+		got[k.Key] = k.Category
+		if !k.Included {
+			got[k.Key] += " " + k.Rule.Rule + " " + k.Rule.Origin
+		}
+	}
+	want := map[string]string{
+		"PORT":              "web",
+		"API_PORT":          "web",
+		"POSTGRES_PORT":     "db exclude_categories cli",
+		"KAFKA_BROKER_PORT": "queue",
+		"API_DEBUG_PORT":    "debug exclude_categories preset lean",
+		"MEILI_PORT":        "search",
+		"MISC_PORT":         "other",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("categories = %v, want %v", got, want)
+	}
+
+	out, err = run(Options{})
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "  db:\n    [✓] POSTGRES_PORT (env) - discovered\n  queue:\n") {
+		t.Fatalf("expected keys grouped by category, got:\n%s", out)
+	}
+
+	if _, err := run(Options{ExcludeCategories: []string{"cache"}}); err == nil || !strings.Contains(err.Error(), `unknown category "cache"`) {
+		t.Fatalf("expected an unknown category error, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+// printCompose writes a docker compose override file publishing each
+// assigned port on the service the config's compose block maps its key
+// to. Keys without a mapping are left out and reported, rather than
+// guessing a service from the key name. The ports lists use !override so
+// the base file's host ports are replaced instead of published as well.
+func (a *App) printCompose(overrides map[string]string) {
+	services := map[string][]string{}
+	var unmapped []string
+	for _, key := range sortedKeys(overrides) {
+		if base, ok := strings.CutSuffix(key, hostSuffix); ok && overrides[base] != "" {
+			// A loopback alias is the host side of its key's mapping.
+			continue
+		}
+		svc, ok := a.config.Compose[key]
+		if !ok {
+			unmapped = append(unmapped, key)
+			continue
+		}
+		mapping := composePort(svc, overrides[key])
+		if host := overrides[key+hostSuffix]; host != "" {
+			mapping = host + ":" + mapping
+		}
+		services[svc.Service] = append(services[svc.Service], mapping)
+	}
+
+	fmt.Fprintln(a.stdout, composeGenerated+". Use with: docker compose -f compose.yaml -f <this file> up")
+	if len(services) == 0 {
+		fmt.Fprintln(a.stdout, "services: {}")
+	} else {
+		fmt.Fprintln(a.stdout, "services:")
+		for _, name := range slices.Sorted(maps.Keys(services)) {
+			fmt.Fprintf(a.stdout, "  %s:\n    ports: !override\n", name)
+			for _, mapping := range services[name] {
+				fmt.Fprintf(a.stdout, "      - \"%s\"\n", mapping)
+			}
+		}
+	}
+	if len(unmapped) > 0 {
+		a.logger.Warn("keys without a compose service were left out",
+			slog.String("keys", strings.Join(unmapped, ",")),
+			slog.String("hint", `map them in the config "compose" block`))
+	}
+}
+
+// composePort formats a short-syntax port mapping publishing the assigned
+// host port on the service's container port.
+func composePort(svc config.ComposeService, assigned string) string {
+	container := assigned
+	if svc.ContainerPort > 0 {
+		container = fmt.Sprint(svc.ContainerPort)
+	}
+	return assigned + ":" + container
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_ComposeFormatUsesServiceMapping(t *testing.T) {
+	cfg := &config.Config{
+		Presets: map[string]config.Preset{},
+		Compose: map[string]config.ComposeService{
+			"WEB_PORT": {Service: "web", ContainerPort: 3000},
+			"API_PORT": {Service: "api"},
+		},
+	}
+	run := func(format string) (string, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		app := New(
+			WithConfig(cfg),
+			WithStdout(&stdout),
+			WithLogger(slog.New(slog.NewTextHandler(&stderr, nil))),
+			WithEnviron([]string{"WEB_PORT=1", "API_PORT=1", "DB_PORT=1"}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		seed := uint32(1)
+		opts := Options{CWD: "/test/path", Seed: &seed, Range: "4000-4999", Format: format, Includes: []string{"WEB_PORT", "API_PORT", "DB_PORT"}}
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run(%s) error: %v", format, err)
+		}
+		return stdout.String(), stderr.String()
+	}
+
+	dotenv, _ := run("dotenv")
+	ports := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(dotenv), "\n") {
+		k, v, _ := strings.Cut(line, "=")
+		ports[k] = v
+	}
+	out, stderr := run("compose")
+	want := "services:\n" +
+		"  api:\n    ports: !override\n      - \"" + ports["API_PORT"] + ":" + ports["API_PORT"] + "\"\n" +
+		"  web:\n    ports: !override\n      - \"" + ports["WEB_PORT"] + ":3000\"\n"
+	if !strings.HasSuffix(out, want) {
+		t.Fatalf("compose output:\n%s\nwant suffix:\n%s", out, want)
+	}
+	if strings.Contains(out, ports["DB_PORT"]) || !strings.Contains(stderr, "DB_PORT") {
+		t.Fatalf("unmapped DB_PORT should be reported, not emitted:\nstdout:\n%s\nstderr:\n%s", out, stderr)
+	}
+}
@@ -0,0 +1,569 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/env"
+)
+
+// composeFiles are the files docker compose reads when none is named, in
+// its order of preference.
+var composeFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// composeGenerated starts every file autoport generates for compose; a
+// file without it is never overwritten.
+const composeGenerated = "# Generated by autoport"
+
+// composePortEntry is one entry of a service's ports list.
+type composePortEntry struct {
+	Service string
+	// IP, Published, Target, and Protocol are the entry's parts; Published
+	// is empty when the container port goes to a random host port.
+	IP, Published, Target, Protocol string
+	// Fields keeps a long-syntax entry's fields in file order, so the
+	// override repeats the ones autoport does not change.
+	Fields [][2]string
+	// Key is the env key whose port replaces Published. It is empty for
+	// entries left as they are: port ranges and unpublished ports.
+	Key string
+	// Variable is set when Published substitutes Key from the environment,
+	// as in "${WEB_PORT:-8080}:80".
+	Variable bool
+}
+
+// composeProject is the compose file compose mode reads and the port
+// entries of its services.
+type composeProject struct {
+	Path    string
+	Entries []composePortEntry
+}
+
+// keys returns the env keys of the managed entries, sorted.
+func (p *composeProject) keys() []string {
+	var keys []string
+	for _, e := range p.Entries {
+		if e.Key != "" && !slices.Contains(keys, e.Key) {
+			keys = append(keys, e.Key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// readComposeProject reads the compose file named in args, or the first
+// of composeFiles in cwd.
+func readComposeProject(cwd string, args []string) (*composeProject, error) {
+	var path string
+	switch {
+	case len(args) > 1:
+		return nil, errors.New("compose takes at most one compose file")
+	case len(args) == 1:
+		path = args[0]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cwd, path)
+		}
+	default:
+		for _, name := range composeFiles {
+			if _, err := os.Stat(filepath.Join(cwd, name)); err == nil {
+				path = filepath.Join(cwd, name)
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("no compose file in %s (looked for %s)", cwd, strings.Join(composeFiles, ", "))
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("compose: %w", err)
+	}
+	entries, err := parseComposePorts(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("compose %s: %w", filepath.Base(path), err)
+	}
+	nameComposeKeys(entries)
+	return &composeProject{Path: path, Entries: entries}, nil
+}
+
+// parseComposePorts reads the ports lists of the services in a compose
+// file written as block mappings, the usual layout. Each list may use the
+// short syntax ("8080:80"), the long syntax (target/published fields), or
+// a one-line flow sequence.
+func parseComposePorts(src string) ([]composePortEntry, error) {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	var entries []composePortEntry
+	var service string
+	servicesIndent, serviceIndent, fieldIndent, portsIndent := -1, -1, -1, -1
+	var long *composePortEntry
+	longIndent := -1
+	flush := func() error {
+		if long == nil {
+			return nil
+		}
+		e := *long
+		long = nil
+		if e.Target == "" {
+			return fmt.Errorf("service %s: a ports entry has no target", e.Service)
+		}
+		entries = append(entries, e)
+		return nil
+	}
+	for n, raw := range lines {
+		trimmed := strings.TrimLeft(raw, " ")
+		if trimmed == "" || trimmed[0] == '#' || trimmed == "---" {
+			continue
+		}
+		indent := len(raw) - len(trimmed)
+		if long != nil && indent >= longIndent {
+			key, rest, ok := yamlKey(trimmed)
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected a field of the ports entry", n+1)
+			}
+			if err := long.setField(key, yamlPlain(rest)); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		if portsIndent >= 0 {
+			if indent >= portsIndent && strings.HasPrefix(trimmed, "-") {
+				item := strings.TrimLeft(strings.TrimPrefix(trimmed, "-"), " ")
+				if item == "" {
+					return nil, fmt.Errorf("line %d: start a long-syntax ports entry on the dash line", n+1)
+				}
+				if key, rest, ok := yamlKey(item); ok {
+					long = &composePortEntry{Service: service}
+					longIndent = indent + len(trimmed) - len(item)
+					if err := long.setField(key, yamlPlain(rest)); err != nil {
+						return nil, fmt.Errorf("line %d: %w", n+1, err)
+					}
+					continue
+				}
+				e, err := parseShortPort(service, yamlPlain(item))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", n+1, err)
+				}
+				entries = append(entries, e)
+				continue
+			}
+			portsIndent = -1
+		}
+		switch {
+		case indent == 0:
+			servicesIndent, serviceIndent, service = -1, -1, ""
+			if key, _, ok := yamlKey(trimmed); ok && key == "services" {
+				servicesIndent = 0
+			}
+		case servicesIndent < 0:
+		case serviceIndent < 0 || indent == serviceIndent:
+			key, _, ok := yamlKey(trimmed)
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected a service name", n+1)
+			}
+			serviceIndent, fieldIndent, service = indent, -1, key
+		case fieldIndent < 0 || indent == fieldIndent:
+			fieldIndent = indent
+			key, rest, ok := yamlKey(trimmed)
+			if !ok || key != "ports" {
+				continue
+			}
+			value := yamlPlain(rest)
+			switch {
+			case value == "":
+				portsIndent = indent
+			case strings.HasPrefix(value, "["):
+				items, ok := strings.CutSuffix(value, "]")
+				if !ok {
+					return nil, fmt.Errorf("line %d: ports must be a list on one line or a block sequence", n+1)
+				}
+				for _, item := range strings.Split(items[1:], ",") {
+					if item = yamlPlain(item); item == "" {
+						continue
+					}
+					e, err := parseShortPort(service, item)
+					if err != nil {
+						return nil, fmt.Errorf("line %d: %w", n+1, err)
+					}
+					entries = append(entries, e)
+				}
+			default:
+				return nil, fmt.Errorf("line %d: ports of %s is not a list", n+1, service)
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// yamlPlain returns a scalar's text without surrounding space, quotes, or
+// a trailing comment.
+func yamlPlain(s string) string {
+	s = strings.TrimSpace(s)
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		if end := strings.IndexByte(s[1:], s[0]); end >= 0 {
+			return s[1 : end+1]
+		}
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s
+}
+
+// setField records one field of a long-syntax entry.
+func (e *composePortEntry) setField(name, value string) error {
+	e.Fields = append(e.Fields, [2]string{name, value})
+	switch name {
+	case "target":
+		e.Target = value
+	case "published":
+		e.Published = value
+	case "host_ip":
+		e.IP = value
+	case "protocol":
+		e.Protocol = value
+	case "mode", "name", "app_protocol":
+	default:
+		return fmt.Errorf("service %s: unknown ports field %q", e.Service, name)
+	}
+	return nil
+}
+
+// parseShortPort parses a short-syntax entry: [[IP:]PUBLISHED:]TARGET with
+// an optional /PROTOCOL.
+func parseShortPort(service, entry string) (composePortEntry, error) {
+	e := composePortEntry{Service: service}
+	spec, proto, _ := strings.Cut(entry, "/")
+	e.Protocol = proto
+	if strings.HasPrefix(spec, "[") {
+		end := strings.Index(spec, "]:")
+		if end < 0 {
+			return e, fmt.Errorf("service %s: invalid port %q", service, entry)
+		}
+		e.IP, spec = spec[:end+1], spec[end+2:]
+	}
+	parts := splitPortSpec(spec)
+	switch {
+	case len(parts) == 1:
+		e.Target = parts[0]
+	case len(parts) == 2:
+		e.Published, e.Target = parts[0], parts[1]
+	case len(parts) == 3 && e.IP == "":
+		e.IP, e.Published, e.Target = parts[0], parts[1], parts[2]
+	default:
+		return e, fmt.Errorf("service %s: invalid port %q", service, entry)
+	}
+	if e.Target == "" {
+		return e, fmt.Errorf("service %s: invalid port %q", service, entry)
+	}
+	return e, nil
+}
+
+// splitPortSpec splits on colons outside ${...} substitutions.
+func splitPortSpec(spec string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(spec); i++ {
+		switch spec[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ':':
+			if depth == 0 {
+				parts = append(parts, spec[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, spec[start:])
+}
+
+// substitutedKey returns VAR for a published port written as $VAR,
+// ${VAR}, ${VAR:-default}, or ${VAR-default}.
+func substitutedKey(published string) (string, bool) {
+	rest, ok := strings.CutPrefix(published, "$")
+	if !ok {
+		return "", false
+	}
+	if inner, ok := strings.CutPrefix(rest, "{"); ok {
+		if rest, ok = strings.CutSuffix(inner, "}"); !ok {
+			return "", false
+		}
+		if i := strings.IndexAny(rest, ":-"); i >= 0 {
+			rest = rest[:i]
+		}
+	}
+	return rest, isValidEnvVarName(rest)
+}
+
+// nameComposeKeys gives each entry with a single published port its key:
+// the substituted variable, or <SERVICE>_PORT for a literal port, with the
+// target port added (<SERVICE>_<TARGET>_PORT) when the service publishes
+// more than one literal port.
+func nameComposeKeys(entries []composePortEntry) {
+	literals := map[string]int{}
+	for _, e := range entries {
+		if isDigits(e.Published) {
+			literals[e.Service]++
+		}
+	}
+	for i := range entries {
+		e := &entries[i]
+		if key, ok := substitutedKey(e.Published); ok {
+			e.Key, e.Variable = key, true
+			continue
+		}
+		if !isDigits(e.Published) {
+			continue
+		}
+		name := composeKeyPart(e.Service)
+		if literals[e.Service] > 1 {
+			name += "_" + composeKeyPart(e.Target)
+		}
+		if name[0] >= '0' && name[0] <= '9' {
+			name = "_" + name
+		}
+		e.Key = name + "_PORT"
+	}
+}
+
+// composeKeyPart upper-cases s and replaces characters env keys do not
+// allow with underscores.
+func composeKeyPart(s string) string {
+	b := []byte(strings.ToUpper(s))
+	for i, c := range b {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// composeServices returns the service names in the project's compose
+// file, which resolve only on the compose network; nil without one.
+func composeServices(cwd string) []string {
+	for _, name := range composeFiles {
+		data, err := os.ReadFile(filepath.Join(cwd, name))
+		if err != nil {
+			continue
+		}
+		var services []string
+		inServices, serviceIndent := false, -1
+		for _, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+			trimmed := strings.TrimLeft(raw, " ")
+			if trimmed == "" || trimmed[0] == '#' || trimmed == "---" {
+				continue
+			}
+			indent := len(raw) - len(trimmed)
+			key, _, ok := yamlKey(trimmed)
+			switch {
+			case indent == 0:
+				inServices, serviceIndent = ok && key == "services", -1
+			case !inServices:
+			case serviceIndent < 0 || indent == serviceIndent:
+				serviceIndent = indent
+				if ok {
+					services = append(services, key)
+				}
+			}
+		}
+		return services
+	}
+	return nil
+}
+
+// overridePath is the override file docker compose reads next to the
+// compose file without being told: compose.override.yaml beside
+// compose.yaml, docker-compose.override.yml beside docker-compose.yml.
+func overridePath(composePath string) string {
+	ext := filepath.Ext(composePath)
+	return strings.TrimSuffix(composePath, ext) + ".override" + ext
+}
+
+// renderCompose prints the compose override publishing the assigned
+// ports, or with -f dotenv the substituted variables, and with --write
+// stores it where compose picks it up.
+func (a *App) renderCompose(opts Options, project *composeProject, overrides map[string]string) error {
+	name := filepath.Base(project.Path)
+	if opts.Format == "dotenv" {
+		return a.renderComposeEnv(opts, project, overrides)
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s from %s. Run autoport compose --write to update.\n", composeGenerated, name)
+	a.writeComposeOverride(&out, project, overrides)
+	if !opts.DocsWrite {
+		_, err := io.WriteString(a.stdout, out.String())
+		return err
+	}
+	path := overridePath(project.Path)
+	current, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("compose: %w", err)
+	case !strings.HasPrefix(string(current), composeGenerated):
+		return fmt.Errorf("compose: %s was not generated by autoport; move it aside or merge it by hand", filepath.Base(path))
+	case string(current) == out.String():
+		if !opts.Quiet {
+			fmt.Fprintf(a.stderr, "%s is up to date\n", filepath.Base(path))
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(out.String()), 0o644); err != nil {
+		return fmt.Errorf("compose: %w", err)
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(a.stderr, "wrote %s for %d ports\n", filepath.Base(path), len(project.keys()))
+	}
+	return nil
+}
+
+// writeComposeOverride writes the services section of the override. A
+// service with a managed port gets its whole ports list again under
+// !override, so the base file's host ports are replaced rather than
+// published as well; entries autoport does not manage are repeated as
+// they are.
+func (a *App) writeComposeOverride(w io.Writer, project *composeProject, overrides map[string]string) {
+	managed := map[string]bool{}
+	for _, e := range project.Entries {
+		if e.Key != "" {
+			managed[e.Service] = true
+		}
+	}
+	if len(managed) == 0 {
+		fmt.Fprintln(w, "services: {}")
+		return
+	}
+	fmt.Fprintln(w, "services:")
+	service := ""
+	for _, e := range project.Entries {
+		if !managed[e.Service] {
+			continue
+		}
+		if e.Service != service {
+			service = e.Service
+			fmt.Fprintf(w, "  %s:\n    ports: !override\n", service)
+		}
+		if e.Key != "" {
+			e.Published = overrides[e.Key]
+			if host := overrides[e.Key+hostSuffix]; host != "" {
+				e.IP = host
+			}
+		}
+		if e.Fields == nil {
+			fmt.Fprintf(w, "      - %q\n", e.short())
+			continue
+		}
+		hasIP := false
+		for i, f := range e.Fields {
+			switch f[0] {
+			case "published":
+				f[1] = e.Published
+			case "host_ip":
+				f[1], hasIP = e.IP, true
+			}
+			prefix := "        "
+			if i == 0 {
+				prefix = "      - "
+			}
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, f[0], yamlScalarText(f[1]))
+		}
+		if e.IP != "" && !hasIP {
+			fmt.Fprintf(w, "        host_ip: %s\n", yamlScalarText(e.IP))
+		}
+	}
+}
+
+// yamlScalarText writes numbers and plain words as they are and quotes
+// anything else.
+func yamlScalarText(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// short formats the entry in short syntax.
+func (e composePortEntry) short() string {
+	s := e.Target
+	if e.Published != "" {
+		s = e.Published + ":" + s
+	}
+	if e.IP != "" {
+		s = e.IP + ":" + s
+	}
+	if e.Protocol != "" {
+		s += "/" + e.Protocol
+	}
+	return s
+}
+
+// renderComposeEnv prints the variables the compose file substitutes into
+// published ports as dotenv lines, or with --write sets them in the .env
+// file beside the compose file, which compose reads for substitution.
+func (a *App) renderComposeEnv(opts Options, project *composeProject, overrides map[string]string) error {
+	values := map[string]string{}
+	var literal []string
+	for _, e := range project.Entries {
+		switch {
+		case e.Variable:
+			values[e.Key] = overrides[e.Key]
+		case e.Key != "" && !slices.Contains(literal, e.Key):
+			literal = append(literal, e.Key)
+		}
+	}
+	if len(literal) > 0 {
+		slices.Sort(literal)
+		a.logger.Warn("literal host ports cannot be set from the environment; they were left out",
+			slog.String("keys", strings.Join(literal, ",")),
+			slog.String("hint", "write them as ${KEY:-port} in the compose file, or use the override file"))
+	}
+	if !opts.DocsWrite {
+		for _, key := range sortedKeys(values) {
+			fmt.Fprintf(a.stdout, "%s=%s\n", key, values[key])
+		}
+		return nil
+	}
+	path := filepath.Join(filepath.Dir(project.Path), ".env")
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("compose: %w", err)
+	}
+	merged, edits := env.Merge(string(current), values)
+	if len(edits) == 0 {
+		if !opts.Quiet {
+			fmt.Fprintln(a.stderr, ".env is up to date")
+		}
+		return nil
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(path, []byte(merged), mode); err != nil {
+		return fmt.Errorf("compose: %w", err)
+	}
+	if !opts.Quiet {
+		a.printMergeDiff(a.stderr, ".env", edits)
+	}
+	return nil
+}
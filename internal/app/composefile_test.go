@@ -0,0 +1,122 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestParseComposePorts(t *testing.T) {
+	src := `services:
+  web:
+    image: nginx
+    ports:
+      - "8080:80"
+      - 127.0.0.1:8443:443/tcp
+      - "9000-9005:9000-9005"
+  api:
+    environment:
+      ports: ignored
+    ports: ["${API_PORT:-3000}:3000", "9229"]
+  db:
+    ports:
+    - target: 5432
+      published: 5432
+      host_ip: 127.0.0.1 # local only
+volumes:
+  data:
+    ports: ignored
+`
+	entries, err := parseComposePorts(src)
+	if err != nil {
+		t.Fatalf("parseComposePorts() unexpected error: %v", err)
+	}
+	nameComposeKeys(entries)
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Service+" "+e.short()+" "+e.Key)
+	}
+	want := []string{
+		"web 8080:80 WEB_80_PORT",
+		"web 127.0.0.1:8443:443/tcp WEB_443_PORT",
+		"web 9000-9005:9000-9005 ",
+		"api ${API_PORT:-3000}:3000 API_PORT",
+		"api 9229 ",
+		"db 127.0.0.1:5432:5432 DB_PORT",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("entries = %q, want %q", got, want)
+	}
+	if _, err := parseComposePorts("services:\n  web:\n    ports: 80\n"); err == nil {
+		t.Fatal("expected an error for a ports value that is not a list")
+	}
+}
+
+func TestApp_ComposeWritesOverride(t *testing.T) {
+	cwd := t.TempDir()
+	compose := "services:\n  web:\n    ports:\n      - \"8080:80\"\n      - \"9229\"\n  api:\n    ports:\n      - \"${API_PORT:-3000}:3000\"\n  db:\n    ports:\n      - target: 5432\n        published: 5432\n        mode: host\n  worker:\n    image: busybox\n"
+	if err := os.WriteFile(filepath.Join(cwd, "compose.yaml"), []byte(compose), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(opts Options) (string, string, error) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithStderr(&stderr),
+			WithLogger(slog.New(slog.NewTextHandler(&stderr, nil))),
+			WithEnviron([]string{}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		seed := uint32(0)
+		opts.Mode, opts.CWD, opts.Range, opts.Seed = "compose", cwd, "10000-11000", &seed
+		if opts.Format == "" {
+			opts.Format = "compose"
+		}
+		err := app.Run(context.Background(), opts, nil)
+		return stdout.String(), stderr.String(), err
+	}
+
+	stdout, _, err := run(Options{})
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	want := "# Generated by autoport from compose.yaml. Run autoport compose --write to update.\n" +
+		"services:\n" +
+		"  web:\n    ports: !override\n      - \"10003:80\"\n      - \"9229\"\n" +
+		"  api:\n    ports: !override\n      - \"10000:3000\"\n" +
+		"  db:\n    ports: !override\n      - target: 5432\n        published: 10001\n        mode: host\n"
+	if stdout != want {
+		t.Fatalf("override = %q, want %q", stdout, want)
+	}
+
+	if _, stderr, err := run(Options{DocsWrite: true}); err != nil || stderr != "wrote compose.override.yaml for 3 ports\n" {
+		t.Fatalf("--write: stderr %q, err %v", stderr, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(cwd, "compose.override.yaml")); string(data) != want {
+		t.Fatalf("written override = %q", data)
+	}
+	if _, stderr, _ := run(Options{DocsWrite: true}); stderr != "compose.override.yaml is up to date\n" {
+		t.Fatalf("second --write stderr = %q", stderr)
+	}
+
+	stdout, stderr, err := run(Options{Format: "dotenv"})
+	if err != nil || stdout != "API_PORT=10000\n" || !strings.Contains(stderr, "keys=DB_PORT,WEB_PORT") {
+		t.Fatalf("dotenv: stdout %q, stderr %q, err %v", stdout, stderr, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(cwd, "compose.override.yaml"), []byte("services: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := run(Options{DocsWrite: true}); err == nil || !strings.Contains(err.Error(), "not generated by autoport") {
+		t.Fatalf("expected a refusal to overwrite a hand-written override, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+const (
+	// docsBranch is the branch docs mode plans on, so seed_branch never
+	// makes the committed table depend on the current checkout.
+	docsBranch = "main"
+
+	// docsFile is the file --check and --write use when none is named.
+	docsFile = "README.md"
+
+	docsBegin = "<!-- autoport:docs -->"
+	docsEnd   = "<!-- /autoport:docs -->"
+)
+
+// docsMode makes a plan reproducible on any machine: every port counts as
+// free, the invoking environment is ignored, and the branch is the
+// mainline. It returns a func restoring the App.
+func (a *App) docsMode(opts *Options) func() {
+	opts.Pure = true
+	opts.PreferCurrent = false
+	opts.RespectExisting = false
+	opts.CacheTTL = 0
+	opts.UseLock = false
+	opts.FromSnapshot = ""
+	environ, branch := a.environ, a.branch
+	a.environ = nil
+	a.branch = docsBranch
+	return func() { a.environ, a.branch = environ, branch }
+}
+
+// renderDocs prints the port table, or with --check/--write compares it
+// with or stores it in the marked block of a file (README.md by default).
+func (a *App) renderDocs(opts Options, args []string, p *plan) error {
+	if strings.HasPrefix(p.Seed.Material, "path:") {
+		// A path seed follows the checkout location, so a table committed
+		// from one clone is stale in every other.
+		w := newWarning(WarnPathSeed, "ports are seeded from the project path %s; set seed_from, --seed-string, or --seed so the table holds in other checkouts", strings.TrimPrefix(p.Seed.Material, "path:")).
+			with("seed", p.Seed.Material)
+		if err := promoteWarnings([]warning{w}, a.config.WarningsAsErrors); err != nil {
+			return err
+		}
+		a.logger.Warn(a.warningText(w), slog.String("code", w.Code))
+	}
+	doc := docsTable(p, a.config.Compose, a.config.Groups)
+	if !opts.DocsCheck && !opts.DocsWrite {
+		_, err := io.WriteString(a.stdout, doc)
+		return err
+	}
+	name := docsFile
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if opts.DocsCheck {
+		return checkDocs(docsPath(opts.CWD, name), name, doc)
+	}
+	if err := writeDocs(docsPath(opts.CWD, name), doc); err != nil {
+		return err
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(a.stdout, "wrote port table for %d keys to %s\n", len(p.Assignments), name)
+	}
+	return nil
+}
+
+func docsPath(cwd, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(cwd, name)
+}
+
+// docsTable renders the plan as a Markdown table between the docs markers.
+func docsTable(p *plan, compose map[string]config.ComposeService, groups map[string][]string) string {
+	sources := map[string][]string{}
+	for _, d := range p.Decisions {
+		if d.Included && !slices.Contains(sources[d.Key], d.Source) {
+			sources[d.Key] = append(sources[d.Key], d.Source)
+		}
+	}
+	assignments := slices.Clone(p.Assignments)
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].Key < assignments[j].Key })
+	planned := make(map[string]bool, len(assignments))
+	for _, as := range assignments {
+		planned[as.Key] = true
+	}
+
+	var b strings.Builder
+	b.WriteString(docsBegin + "\n")
+	fmt.Fprintf(&b, "Ports from `autoport docs` (range %s, branch %s, no probing).\n\n", p.Range, docsBranch)
+	b.WriteString("| Key | Port | Source | Links |\n")
+	b.WriteString("| --- | ---: | --- | --- |\n")
+	for _, as := range assignments {
+		var links []string
+		if as.Group != "" {
+			var shared []string
+			for _, key := range groups[as.Group] {
+				if key != as.Key && planned[key] {
+					shared = append(shared, "`"+key+"`")
+				}
+			}
+			sort.Strings(shared)
+			if len(shared) > 0 {
+				links = append(links, fmt.Sprintf("shares port with %s (group %s)", strings.Join(shared, ", "), as.Group))
+			}
+		}
+		if svc, ok := compose[as.Key]; ok {
+			target := svc.ContainerPort
+			if target == 0 {
+				target = as.Assigned
+			}
+			links = append(links, fmt.Sprintf("compose service %s:%d", svc.Service, target))
+		}
+		src := make([]string, 0, len(sources[as.Key]))
+		for _, s := range sources[as.Key] {
+			src = append(src, "`"+s+"`")
+		}
+		fmt.Fprintf(&b, "| `%s` | %d | %s | %s |\n", as.Key, as.Assigned, strings.Join(src, ", "), strings.Join(links, "; "))
+	}
+	b.WriteString(docsEnd + "\n")
+	return b.String()
+}
+
+// docsBlock locates the marked table in content, returning its start and
+// end offsets (end includes the closing marker's line break, if any).
+func docsBlock(content []byte) (int, int, bool) {
+	start := bytes.Index(content, []byte(docsBegin))
+	if start < 0 {
+		return 0, 0, false
+	}
+	rel := bytes.Index(content[start:], []byte(docsEnd))
+	if rel < 0 {
+		return 0, 0, false
+	}
+	end := start + rel + len(docsEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return start, end, true
+}
+
+func checkDocs(path, name, doc string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("docs check: %w", err)
+	}
+	start, end, ok := docsBlock(content)
+	if !ok {
+		return fmt.Errorf("docs check: no %s block in %s", docsBegin, name)
+	}
+	if strings.TrimSpace(string(content[start:end])) != strings.TrimSpace(doc) {
+		return &ExitError{Code: 1, Err: fmt.Errorf("port table in %s is out of date; run autoport docs --write %s", name, name)}
+	}
+	return nil
+}
+
+// writeDocs replaces the marked block in path, creating the file when it
+// does not exist. An existing file without markers is left alone.
+func writeDocs(path, doc string) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.WriteFile(path, []byte(doc), 0o644)
+	}
+	if err != nil {
+		return fmt.Errorf("docs write: %w", err)
+	}
+	start, end, ok := docsBlock(content)
+	if !ok {
+		return fmt.Errorf("docs write: no %s block in %s; add the markers where the table belongs", docsBegin, path)
+	}
+	updated := make([]byte, 0, len(content)+len(doc))
+	updated = append(updated, content[:start]...)
+	updated = append(updated, doc...)
+	updated = append(updated, content[end:]...)
+	if err := os.WriteFile(path, updated, 0o644); err != nil {
+		return fmt.Errorf("docs write: %w", err)
+	}
+	return nil
+}
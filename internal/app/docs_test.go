@@ -0,0 +1,73 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_DocsWritesAndChecksPortTable(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("WEB_PORT=3000\nAPI_PORT=4000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	readme := filepath.Join(dir, "README.md")
+	if err := os.WriteFile(readme, []byte("# Shop\n\n<!-- autoport:docs -->\n<!-- /autoport:docs -->\n\nMore.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Presets: map[string]config.Preset{},
+		Groups:  map[string][]string{"web": {"WEB_PORT", "VITE_PORT"}},
+		Compose: map[string]config.ComposeService{"API_PORT": {Service: "api", ContainerPort: 8080}},
+	}
+	docs := func(env []string, isFree func(int) bool, check, write bool) (string, error) {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(WithConfig(cfg), WithStdout(&stdout), WithEnviron(env), WithIsFree(isFree))
+		opts := Options{Mode: "docs", Range: "10000-10100", CWD: dir, SeedString: "shop", DocsCheck: check, DocsWrite: write, Quiet: true}
+		err := app.Run(context.Background(), opts, nil)
+		return stdout.String(), err
+	}
+
+	table, err := docs(nil, func(int) bool { return true }, false, false)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	for _, want := range []string{"| `API_PORT` |", "compose service api:8080", "| `PORT` |", "`default`", "| `WEB_PORT` |", "`.env`"} {
+		if !strings.Contains(table, want) {
+			t.Fatalf("table missing %q:\n%s", want, table)
+		}
+	}
+
+	// The environment, busy ports, and the checkout's branch must not
+	// change the table.
+	busy := func(int) bool { return false }
+	again, err := docs([]string{"OTHER_PORT=1", "WEB_PORT=9"}, busy, false, false)
+	if err != nil || again != table {
+		t.Fatalf("docs not reproducible (err %v):\n%s\nvs\n%s", err, again, table)
+	}
+
+	var exitErr *ExitError
+	if _, err := docs(nil, busy, true, false); !errors.As(err, &exitErr) || exitErr.Code != 1 {
+		t.Fatalf("--check on an empty block = %v, want exit code 1", err)
+	}
+	if _, err := docs(nil, busy, false, true); err != nil {
+		t.Fatalf("--write unexpected error: %v", err)
+	}
+	if _, err := docs(nil, busy, true, false); err != nil {
+		t.Fatalf("--check after --write unexpected error: %v", err)
+	}
+	content, err := os.ReadFile(readme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "# Shop\n\n"+table) || !strings.HasSuffix(string(content), "\nMore.\n") {
+		t.Fatalf("--write must only replace the marked block, got:\n%s", content)
+	}
+}
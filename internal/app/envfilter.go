@@ -0,0 +1,78 @@
+package app
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// minimalEnv lists the variables the command still inherits under
+// --only-overrides: what programs need to start, plus autoport's session.
+var minimalEnv = []string{"PATH", "HOME", sessionEnv, "SYSTEMROOT", "COMSPEC", "PATHEXT", "TEMP", "TMP", "USERPROFILE"}
+
+// validateEnvFilter checks the --env-filter globs.
+func validateEnvFilter(globs []string) error {
+	for _, g := range globs {
+		if _, err := path.Match(strings.TrimPrefix(g, "!"), ""); err != nil {
+			return fmt.Errorf("invalid --env-filter %q: %w", g, err)
+		}
+	}
+	return nil
+}
+
+// commandEnviron returns the part of the environment the wrapped command
+// inherits. --only-overrides starts from minimalEnv instead of everything;
+// --env-filter globs then add matching variables, or drop them when
+// prefixed with "!". With any plain glob, only matching variables (and
+// minimalEnv under --only-overrides) are inherited.
+func (a *App) commandEnviron(opts Options) []string {
+	if !opts.OnlyOverrides && len(opts.EnvFilter) == 0 {
+		return a.environ
+	}
+	var allow, deny []string
+	for _, g := range opts.EnvFilter {
+		if rest, ok := strings.CutPrefix(g, "!"); ok {
+			deny = append(deny, rest)
+		} else {
+			allow = append(allow, g)
+		}
+	}
+	var out []string
+	for _, kv := range a.environ {
+		key, _, _ := strings.Cut(kv, "=")
+		keep := !opts.OnlyOverrides && len(allow) == 0
+		if opts.OnlyOverrides && slices.Contains(minimalEnv, envName(key)) {
+			keep = true
+		}
+		if matchEnvGlob(allow, key) {
+			keep = true
+		}
+		if matchEnvGlob(deny, key) {
+			keep = false
+		}
+		if keep {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+func matchEnvGlob(globs []string, key string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(envName(g), envName(key)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// envName normalizes a variable name for comparison: Windows names are
+// case-insensitive.
+func envName(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(name)
+	}
+	return name
+}
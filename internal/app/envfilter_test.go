@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_OnlyOverridesAndEnvFilterShapeChildEnv(t *testing.T) {
+	environ := []string{"PATH=/bin", "HOME=/home/dev", "LANG=C.UTF-8", "SECRET_TOKEN=s3cret", "NODE_ENV=test", "WEB_PORT=3000"}
+	run := func(opts Options) []string {
+		t.Helper()
+		mockExec := &MockExecutor{}
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithExecutor(mockExec),
+			WithStdout(io.Discard),
+			WithStderr(io.Discard),
+			WithEnviron(environ),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.Mode, opts.Range, opts.CWD = "run", "10000-11000", "/work/shop"
+		if err := app.Run(context.Background(), opts, []string{"npm", "start"}); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		var keys []string
+		for _, kv := range mockExec.CapturedEnv {
+			key, _, _ := strings.Cut(kv, "=")
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		return keys
+	}
+
+	if got, want := run(Options{OnlyOverrides: true}), []string{"HOME", "PATH", "PORT", "WEB_PORT"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("--only-overrides env = %v, want %v", got, want)
+	}
+	if got, want := run(Options{OnlyOverrides: true, EnvFilter: []string{"LANG", "NODE_*"}}), []string{"HOME", "LANG", "NODE_ENV", "PATH", "PORT", "WEB_PORT"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("--only-overrides with globs env = %v, want %v", got, want)
+	}
+	if got := run(Options{EnvFilter: []string{"!SECRET_*"}}); slices.Contains(got, "SECRET_TOKEN") || !slices.Contains(got, "LANG") {
+		t.Fatalf("a negated glob should only drop matches, got %v", got)
+	}
+	if got, want := run(Options{EnvFilter: []string{"PATH"}}), []string{"PATH", "PORT", "WEB_PORT"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("a plain glob should limit inheritance, got %v, want %v", got, want)
+	}
+
+	app := New(WithConfig(&config.Config{Presets: map[string]config.Preset{}}))
+	if err := app.Run(context.Background(), Options{EnvFilter: []string{"["}}, nil); err == nil || !strings.Contains(err.Error(), "invalid --env-filter") {
+		t.Fatalf("expected a bad glob error, got %v", err)
+	}
+}
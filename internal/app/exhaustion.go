@@ -0,0 +1,213 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/portowner"
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+// maxOccupiers bounds how many occupiers an AllocationError lists.
+const maxOccupiers = 5
+
+// PortOwner identifies the process holding a port.
+type PortOwner struct {
+	PID     int
+	Process string
+	Cmdline string
+}
+
+// PortOwnerFunc resolves the owner of a busy port. It reports false when the
+// owner cannot be determined.
+type PortOwnerFunc func(p int) (PortOwner, bool)
+
+// PortOccupier is a process (or, with PID 0, unresolved owners) holding
+// ports in an exhausted range.
+type PortOccupier struct {
+	PID     int
+	Process string
+	Cmdline string
+	Ports   []int
+	Count   int
+}
+
+// AllocationError explains a range running out of free ports and suggests
+// concrete remedies.
+type AllocationError struct {
+	Key         string
+	KeysNeeded  int
+	Assigned    int
+	Range       string
+	RangeSize   int
+	Occupiers   []PortOccupier
+	Suggestions []string
+	Err         error
+}
+
+func (e *AllocationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "no free ports in range %s for %s\n", e.Range, e.Key)
+	fmt.Fprintf(&b, "  keys needing ports: %d (%d assigned before running out)\n", e.KeysNeeded, e.Assigned)
+	fmt.Fprintf(&b, "  range size: %d\n", e.RangeSize)
+	if len(e.Occupiers) > 0 {
+		fmt.Fprintf(&b, "  occupied by:\n")
+		for _, o := range e.Occupiers {
+			owner := "unknown process"
+			if o.PID > 0 {
+				owner = fmt.Sprintf("pid %d (%s)", o.PID, o.Process)
+			}
+			fmt.Fprintf(&b, "    - %s: %d ports, e.g. %s\n", owner, o.Count, joinInts(o.Ports))
+		}
+	}
+	fmt.Fprintf(&b, "  try:")
+	for _, s := range e.Suggestions {
+		fmt.Fprintf(&b, "\n    - %s", s)
+	}
+	return b.String()
+}
+
+func (e *AllocationError) Unwrap() error {
+	return e.Err
+}
+
+// allocationError builds the exhaustion report for key. Every port of r not
+// handed out by this run is treated as occupied, since the allocator just
+// probed them all.
+func (a *App) allocationError(key string, keysNeeded int, assigned []assignedPort, r port.Range, cause error) *AllocationError {
+	ours := map[int]bool{}
+	for _, as := range assigned {
+		ours[as.Assigned] = true
+	}
+
+	owners := a.portOwners()
+	byPID := map[int]*PortOccupier{}
+	for i := 0; i < r.Size(); i++ {
+		p := r.At(i)
+		if ours[p] {
+			continue
+		}
+		owner, _ := owners(p)
+		occ, ok := byPID[owner.PID]
+		if !ok {
+			occ = &PortOccupier{PID: owner.PID, Process: owner.Process, Cmdline: owner.Cmdline}
+			byPID[owner.PID] = occ
+		}
+		occ.Count++
+		if len(occ.Ports) < maxOccupiers {
+			occ.Ports = append(occ.Ports, p)
+		}
+	}
+	occupiers := make([]PortOccupier, 0, len(byPID))
+	for _, occ := range byPID {
+		occupiers = append(occupiers, *occ)
+	}
+	sort.Slice(occupiers, func(i, j int) bool {
+		if occupiers[i].Count != occupiers[j].Count {
+			return occupiers[i].Count > occupiers[j].Count
+		}
+		return occupiers[i].PID < occupiers[j].PID
+	})
+	if len(occupiers) > maxOccupiers {
+		occupiers = occupiers[:maxOccupiers]
+	}
+
+	return &AllocationError{
+		Key:         key,
+		KeysNeeded:  keysNeeded,
+		Assigned:    len(assigned),
+		Range:       r.String(),
+		RangeSize:   r.Size(),
+		Occupiers:   occupiers,
+		Suggestions: exhaustionSuggestions(keysNeeded, r, occupiers),
+		Err:         cause,
+	}
+}
+
+// portOwners returns the resolver for one report: the one set with
+// WithPortOwner, else a lookup in one snapshot of the system's listening
+// sockets, so a report over a whole range reads them once. Injected port
+// checkers have no sockets to name, so with one of those nothing resolves.
+func (a *App) portOwners() PortOwnerFunc {
+	if a.portOwner != nil {
+		return a.portOwner
+	}
+	none := func(int) (PortOwner, bool) { return PortOwner{}, false }
+	if a.listeners == nil {
+		return none
+	}
+	table, err := a.listeners()
+	if err != nil {
+		a.logger.Debug("cannot name port owners", slog.String("error", err.Error()))
+		return none
+	}
+	return func(p int) (PortOwner, bool) {
+		o, ok := table[p]
+		return PortOwner{PID: o.PID, Process: o.Name, Cmdline: o.Cmdline}, ok
+	}
+}
+
+// portHolder is a busy port and the process holding it, for doctor.
+type portHolder struct {
+	Port    int    `json:"port"`
+	PID     int    `json:"pid"`
+	Process string `json:"process,omitempty"`
+	Cmdline string `json:"cmdline,omitempty"`
+}
+
+// busyPortOwners names the owners of the busy ports that have one.
+func (a *App) busyPortOwners(busy []int) []portHolder {
+	if len(busy) == 0 {
+		return nil
+	}
+	owners := a.portOwners()
+	var holders []portHolder
+	for _, p := range busy {
+		if o, ok := owners(p); ok && o.PID > 0 {
+			holders = append(holders, portHolder{Port: p, PID: o.PID, Process: o.Process, Cmdline: o.Cmdline})
+		}
+	}
+	return holders
+}
+
+// heldBy describes the owner of port p for an error message, such as
+// " by pid 4242 (node)", or returns "" when it is unknown.
+func heldBy(owners PortOwnerFunc, p int) string {
+	o, ok := owners(p)
+	if !ok || o.PID == 0 {
+		return ""
+	}
+	return " by " + portowner.Owner{PID: o.PID, Name: o.Process}.String()
+}
+
+func exhaustionSuggestions(keysNeeded int, r port.Range, occupiers []PortOccupier) []string {
+	want := r.Size() * 2
+	if floor := keysNeeded * 10; want < floor {
+		want = floor
+	}
+	end := r.Start + want - 1
+	if end > 65535 {
+		end = 65535
+	}
+	suggestions := []string{fmt.Sprintf("use a larger range, e.g. -r %d-%d", r.Start, end)}
+	if keysNeeded > 1 {
+		suggestions = append(suggestions, fmt.Sprintf("allocate fewer keys (%d selected): -i <prefix>, --exclude <key>, or a preset such as -p db", keysNeeded))
+	}
+	for _, o := range occupiers {
+		if o.PID > 0 {
+			suggestions = append(suggestions, fmt.Sprintf("stop %s holding %d ports: kill %d", o.Process, o.Count, o.PID))
+		}
+	}
+	return suggestions
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/internal/portowner"
+)
+
+func TestApp_PortOwnersReadListenersOnce(t *testing.T) {
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(io.Discard),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return false }),
+	)
+	if app.listeners != nil {
+		t.Fatal("an injected port checker should not name system processes")
+	}
+	reads := 0
+	app.listeners = func() (portowner.Table, error) {
+		reads++
+		return portowner.Table{10000: {PID: 9, Name: "node", Cmdline: "node server.js"}}, nil
+	}
+	seed := uint32(0)
+	err := app.Run(context.Background(), Options{Mode: "run", Range: "10000-10003", CWD: "/test/path", Seed: &seed}, nil)
+	var allocErr *AllocationError
+	if !errors.As(err, &allocErr) {
+		t.Fatalf("expected AllocationError, got %v", err)
+	}
+	if reads != 1 || allocErr.Occupiers[1].Cmdline != "node server.js" || !strings.Contains(err.Error(), "pid 9 (node): 1 ports") {
+		t.Fatalf("reads = %d, occupiers = %+v", reads, allocErr.Occupiers)
+	}
+}
+
+func TestApp_Run_ExhaustionReportsOccupiersAndRemedies(t *testing.T) {
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(io.Discard),
+		WithEnviron([]string{"API_PORT=1", "WEB_PORT=1"}),
+		WithIsFree(func(p int) bool { return false }),
+		WithPortOwner(func(p int) (PortOwner, bool) {
+			if p <= 10002 {
+				return PortOwner{PID: 4242, Process: "node"}, true
+			}
+			return PortOwner{}, false
+		}),
+	)
+	seed := uint32(0)
+	err := app.Run(context.Background(), Options{CWD: "/test/path", Seed: &seed, Range: "10000-10003"}, nil)
+
+	var allocErr *AllocationError
+	if !errors.As(err, &allocErr) {
+		t.Fatalf("expected AllocationError, got %T %v", err, err)
+	}
+	if allocErr.Key != "API_PORT" || allocErr.KeysNeeded != 3 || allocErr.Assigned != 0 || allocErr.RangeSize != 4 {
+		t.Fatalf("unexpected error fields: %+v", allocErr)
+	}
+	want := []PortOccupier{
+		{PID: 4242, Process: "node", Ports: []int{10000, 10001, 10002}, Count: 3},
+		{Ports: []int{10003}, Count: 1},
+	}
+	if !reflect.DeepEqual(allocErr.Occupiers, want) {
+		t.Fatalf("occupiers = %+v, want %+v", allocErr.Occupiers, want)
+	}
+	msg := err.Error()
+	for _, s := range []string{"-r 10000-10029", "--exclude <key>", "kill 4242"} {
+		if !strings.Contains(msg, s) {
+			t.Fatalf("error missing %q:\n%s", s, msg)
+		}
+	}
+}
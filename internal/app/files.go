@@ -0,0 +1,50 @@
+package app
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/lockfile"
+)
+
+// fsName maps an absolute path to its name in an injected file system.
+func fsName(path string) string {
+	name := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// projectFS returns the injected file system rooted at dir, or nil to use
+// the OS file system.
+func (a *App) projectFS(dir string) fs.FS {
+	if a.fsys == nil {
+		return nil
+	}
+	sub, err := fs.Sub(a.fsys, fsName(dir))
+	if err != nil {
+		return a.fsys
+	}
+	return sub
+}
+
+func (a *App) readLockfile(ctx context.Context, path string) (lockfile.LockFile, error) {
+	if a.fsys != nil {
+		return lockfile.ReadFS(a.fsys, fsName(path))
+	}
+	return lockfile.ReadContext(ctx, path)
+}
+
+func (a *App) statFile(path string) error {
+	var err error
+	if a.fsys != nil {
+		_, err = fs.Stat(a.fsys, fsName(path))
+	} else {
+		_, err = os.Stat(path)
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/internal/lockfile"
+)
+
+func TestApp_InjectedFSAndClock(t *testing.T) {
+	fsys := fstest.MapFS{
+		"repo/.env": {Data: []byte("WEB_PORT=3000\n")},
+		"repo/.autoport.lock.json": {Data: []byte(`{"version":1,"cwd_fingerprint":"` + lockfile.Fingerprint("/repo") +
+			`","range":"10000-11000","assignments":[{"key":"WEB_PORT","value":"10500"}],"created_at":"2020-01-01T00:00:00Z"}`)},
+	}
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron(nil),
+		WithFS(fsys),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts := Options{Mode: "run", Format: "dotenv", Range: "10000-11000", CWD: "/repo", UseLock: true, Includes: []string{"WEB_PORT"}}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if got := stdout.String(); got != "WEB_PORT=10500\n" {
+		t.Fatalf("output = %q, want WEB_PORT from the in-memory lockfile", got)
+	}
+
+	tmp := t.TempDir()
+	fixed := time.Date(2030, 5, 6, 7, 8, 9, 0, time.UTC)
+	app = New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(io.Discard),
+		WithEnviron([]string{"PORT=1"}),
+		WithClock(func() time.Time { return fixed }),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	if err := app.Run(context.Background(), Options{Mode: "lock", Range: "10000-11000", CWD: tmp}, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	lf, err := lockfile.Read(lockfile.PathFor(tmp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lf.CreatedAt != "2030-05-06T07:08:09Z" {
+		t.Fatalf("created_at = %q, want the injected clock", lf.CreatedAt)
+	}
+}
@@ -0,0 +1,68 @@
+package app
+
+import "context"
+
+// explainForecast previews the effect of keys that are not in the project
+// yet (--assume-key): the ports they would get and the existing keys that
+// would move because of them.
+type explainForecast struct {
+	Assumed []explainAssignment `json:"assumed"`
+	Shifts  []portShift         `json:"shifts"`
+}
+
+// portShift is an existing key whose port an assumed key would change.
+type portShift struct {
+	Key  string `json:"key"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+}
+
+// forecast plans again with the assumed keys added as manual keys and
+// compares the result with the current plan.
+func (a *App) forecast(ctx context.Context, opts Options, res resolvedOptions, current *plan) (*explainForecast, error) {
+	if len(opts.AssumeKeys) == 0 {
+		return nil, nil
+	}
+	assumed := opts
+	assumed.PortEnv = dedupeSorted(append(append([]string{}, opts.PortEnv...), opts.AssumeKeys...))
+	next, err := a.plan(ctx, assumed, res)
+	if err != nil {
+		return nil, err
+	}
+	before := map[string]int{}
+	for _, as := range current.Assignments {
+		before[as.Key] = as.Assigned
+	}
+	f := &explainForecast{Assumed: []explainAssignment{}, Shifts: []portShift{}}
+	for _, as := range next.Assignments {
+		from, existed := before[as.Key]
+		switch {
+		case !existed:
+			f.Assumed = append(f.Assumed, explainAssignment{Key: as.Key, Preferred: as.Preferred, Assigned: as.Assigned, Probes: as.Probes, Group: as.Group, Base: as.Base})
+		case from != as.Assigned:
+			f.Shifts = append(f.Shifts, portShift{Key: as.Key, From: from, To: as.Assigned})
+		}
+	}
+	return f, nil
+}
+
+// printForecast renders f for text explain output.
+func (a *App) printForecast(f *explainForecast) {
+	if f == nil {
+		return
+	}
+	a.text.Fprintf(a.stdout, "\nforecast (--assume-key):\n")
+	if len(f.Assumed) == 0 {
+		a.text.Fprintf(a.stdout, "  assumed keys are already assigned\n")
+	}
+	for _, as := range f.Assumed {
+		a.text.Fprintf(a.stdout, "  %s: preferred=%d assigned=%d probes=%d\n", as.Key, as.Preferred, as.Assigned, as.Probes)
+	}
+	if len(f.Shifts) == 0 {
+		a.text.Fprintf(a.stdout, "  no existing key would move\n")
+		return
+	}
+	for _, s := range f.Shifts {
+		a.text.Fprintf(a.stdout, "  %s would move: %d -> %d\n", s.Key, s.From, s.To)
+	}
+}
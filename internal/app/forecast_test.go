@@ -0,0 +1,53 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_ExplainAssumeKeyForecastsShifts(t *testing.T) {
+	explain := func(assume ...string) explainPayload {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithEnviron([]string{"PORT=1", "WEB_PORT=2"}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		seed := uint32(0)
+		opts := Options{Mode: "explain", Format: "json", Range: "10000-10100", CWD: "/work/shop", Seed: &seed, AssumeKeys: assume}
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		var payload explainPayload
+		if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+			t.Fatal(err)
+		}
+		return payload
+	}
+
+	if payload := explain(); payload.Forecast != nil {
+		t.Fatalf("no forecast expected without --assume-key, got %+v", payload.Forecast)
+	}
+	payload := explain("API_PORT")
+	if len(payload.Assignments) != 2 {
+		t.Fatalf("the assumed key must not change the explained assignments, got %+v", payload.Assignments)
+	}
+	f := payload.Forecast
+	if f == nil || len(f.Assumed) != 1 || f.Assumed[0].Key != "API_PORT" || f.Assumed[0].Assigned != 10000 {
+		t.Fatalf("forecast = %+v, want API_PORT on the first slot", f)
+	}
+	want := []portShift{{Key: "PORT", From: 10000, To: 10001}, {Key: "WEB_PORT", From: 10001, To: 10002}}
+	if !reflect.DeepEqual(f.Shifts, want) {
+		t.Fatalf("shifts = %+v, want %+v", f.Shifts, want)
+	}
+	if f := explain("ZZZ_PORT").Forecast; len(f.Assumed) != 1 || len(f.Shifts) != 0 {
+		t.Fatalf("a key sorted last should move nothing, got %+v", f)
+	}
+}
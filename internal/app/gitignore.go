@@ -0,0 +1,119 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/internal/gitinfo"
+)
+
+// applyLockfilePolicy runs after `autoport lock` writes the lockfile. When
+// the config says the lockfile is not committed (lockfile.commit false) and
+// git does not ignore it yet, --manage-gitignore adds it to the project's
+// .gitignore; without the flag the user is told how.
+func (a *App) applyLockfilePolicy(ctx context.Context, opts Options, lockPath string) error {
+	if commit := a.config.Lockfile.Commit; commit == nil || *commit {
+		return nil
+	}
+	if _, err := gitinfo.Toplevel(ctx, opts.CWD); err != nil {
+		return nil
+	}
+	name := filepath.Base(lockPath)
+	if gitinfo.Ignored(ctx, opts.CWD, name) {
+		return nil
+	}
+	if !opts.ManageGitignore {
+		a.logger.Warn("lockfile.commit is false but git does not ignore "+name,
+			slog.String("hint", "rerun with --manage-gitignore or add /"+name+" to .gitignore"))
+		return nil
+	}
+	ignorePath := filepath.Join(opts.CWD, ".gitignore")
+	added, err := ensureIgnoreEntry(ignorePath, "/"+name)
+	if err != nil {
+		return fmt.Errorf("update %s: %w", ignorePath, err)
+	}
+	if added {
+		fmt.Fprintf(a.stdout, "added /%s to .gitignore\n", name)
+	}
+	return nil
+}
+
+// ensureIgnoreEntry appends entry to the ignore file at path unless a line
+// already names it (with or without the leading slash). It reports whether
+// the file changed.
+func ensureIgnoreEntry(path, entry string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	bare := strings.TrimPrefix(entry, "/")
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == entry || line == bare {
+			return false, nil
+		}
+	}
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	data = append(data, entry+"\n"...)
+	return true, os.WriteFile(path, data, mode)
+}
+
+// lockfilePolicyCheck is the doctor check comparing where git keeps the
+// lockfile with the config's lockfile.commit policy.
+func (a *App) lockfilePolicyCheck(ctx context.Context, cwd, lockPath string) (doctorCheck, bool) {
+	commit := a.config.Lockfile.Commit
+	if commit == nil {
+		return doctorCheck{}, false
+	}
+	if _, err := gitinfo.Toplevel(ctx, cwd); err != nil {
+		return doctorCheck{}, false
+	}
+	name := filepath.Base(lockPath)
+	var check doctorCheck
+	switch {
+	case !*commit && gitinfo.Tracked(ctx, cwd, name):
+		check = newCheck("lockfile_policy.tracked", "warn", msgf("%s is committed but lockfile.commit is false; run git rm --cached %s", name, name))
+	case *commit && gitinfo.Ignored(ctx, cwd, name):
+		check = newCheck("lockfile_policy.ignored", "warn", msgf("lockfile.commit is true but git ignores %s", name))
+	case *commit:
+		check = newCheck("lockfile_policy.committable", "ok", msgf("%s may be committed", name))
+	default:
+		check = newCheck("lockfile_policy.kept_out", "ok", msgf("%s is kept out of git", name))
+	}
+	return check.with("file", name).with("commit", *commit), true
+}
+
+// localConfigCheck is the doctor check that the personal overlay config,
+// when present, stays out of git.
+func (a *App) localConfigCheck(ctx context.Context, cwd string) (doctorCheck, bool) {
+	name := config.LocalFile
+	if a.statFile(filepath.Join(cwd, name)) != nil {
+		return doctorCheck{}, false
+	}
+	if _, err := gitinfo.Toplevel(ctx, cwd); err != nil {
+		return doctorCheck{}, false
+	}
+	var check doctorCheck
+	switch {
+	case gitinfo.Tracked(ctx, cwd, name):
+		check = newCheck("local_config.tracked", "warn", msgf("%s holds personal settings but is committed; run git rm --cached %s and add it to .gitignore", name, name))
+	case !gitinfo.Ignored(ctx, cwd, name):
+		check = newCheck("local_config.not_ignored", "warn", msgf("%s is not ignored by git; add /%s to .gitignore", name, name))
+	default:
+		check = newCheck("local_config.ok", "ok", msgf("%s overlays the project config and is kept out of git", name))
+	}
+	return check.with("file", name), true
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_LockfileCommitPolicy(t *testing.T) {
+	dir := initGitRepo(t, "https://github.com/acme/shop")
+	commit := false
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Lockfile: config.LockfileConfig{Commit: &commit}}
+	run := func(opts Options) (string, string, error) {
+		t.Helper()
+		var stdout, logs bytes.Buffer
+		app := New(
+			WithConfig(cfg),
+			WithStdout(&stdout),
+			WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+			WithEnviron([]string{"WEB_PORT=3000"}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.CWD, opts.Range = dir, "10000-11000"
+		err := app.Run(context.Background(), opts, nil)
+		return stdout.String(), logs.String(), err
+	}
+	gitignore := filepath.Join(dir, ".gitignore")
+
+	if _, logs, err := run(Options{Mode: "lock"}); err != nil || !strings.Contains(logs, "--manage-gitignore") {
+		t.Fatalf("lock without --manage-gitignore should only hint: err=%v logs=%s", err, logs)
+	}
+	if _, err := os.Stat(gitignore); !os.IsNotExist(err) {
+		t.Fatalf(".gitignore should not be created without the flag: %v", err)
+	}
+
+	if err := os.WriteFile(gitignore, []byte("node_modules"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := run(Options{Mode: "lock", ManageGitignore: true}); err != nil {
+			t.Fatalf("lock --manage-gitignore: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(gitignore); string(data) != "node_modules\n/.autoport.lock.json\n" {
+		t.Fatalf(".gitignore = %q", data)
+	}
+
+	out, _, err := run(Options{Mode: "doctor"})
+	if err != nil || !strings.Contains(out, "[ok] lockfile_policy") {
+		t.Fatalf("ignored lockfile should satisfy the policy: %v\n%s", err, out)
+	}
+	if out, err := exec.Command("git", "-C", dir, "add", "-f", ".autoport.lock.json").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+	out, _, err = run(Options{Mode: "doctor"})
+	if e, ok := err.(*ExitError); !ok || e.Code != 1 || !strings.Contains(out, "[warn] lockfile_policy: .autoport.lock.json is committed") {
+		t.Fatalf("committed lockfile should be flagged: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+// healthServer reports the wrapped process and its assignments over HTTP on
+// a deterministic port of its own.
+type healthServer struct {
+	port    int
+	srv     *http.Server
+	project string
+	cwd     string
+	now     func() time.Time
+
+	mu        sync.Mutex
+	pid       int
+	startedAt time.Time
+	alive     bool
+	overrides map[string]string
+}
+
+type healthPayload struct {
+	Project       string          `json:"project"`
+	CWD           string          `json:"cwd"`
+	PID           int             `json:"pid,omitempty"`
+	Alive         bool            `json:"alive"`
+	StartedAt     string          `json:"started_at,omitempty"`
+	UptimeSeconds float64         `json:"uptime_seconds"`
+	Overrides     []outputBinding `json:"overrides"`
+}
+
+// healthPortFor picks the next deterministic slot after the assigned keys,
+// skipping every port already handed out.
+func (a *App) healthPortFor(ctx context.Context, rangeSpec string, seed uint32, overrides map[string]string) (int, error) {
+	r, err := port.ParseRange(rangeSpec)
+	if err != nil {
+		return 0, err
+	}
+	used := map[int]bool{}
+	for _, v := range overrides {
+		if p, err := strconv.Atoi(v); err == nil {
+			used[p] = true
+		}
+	}
+	allocator := port.Allocator{
+		Seed:   seed,
+		Range:  r,
+		IsFree: func(p int) bool { return !used[p] && a.isFree("", p) },
+	}
+	p, _, _, err := allocator.PortForContext(ctx, len(overrides))
+	return p, err
+}
+
+// startHealth starts the health endpoint when --health is set. A nil server
+// is valid and all its methods are no-ops.
+func (a *App) startHealth(ctx context.Context, opts Options, rangeSpec string, seed uint32, overrides map[string]string) (*healthServer, error) {
+	if !opts.Health {
+		return nil, nil
+	}
+	p, err := a.healthPortFor(ctx, rangeSpec, seed, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("health port: %w", err)
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", p))
+	if err != nil {
+		return nil, fmt.Errorf("health listen: %w", err)
+	}
+
+	h := &healthServer{port: p, project: filepath.Base(opts.CWD), cwd: opts.CWD, now: a.now, overrides: overrides}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", h.serveHealth)
+	h.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := h.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Warn("health endpoint stopped", slog.String("error", err.Error()))
+		}
+	}()
+	if !opts.Quiet {
+		fmt.Fprintf(a.stderr, "autoport health: http://127.0.0.1:%d/health\n", p)
+	}
+	return h, nil
+}
+
+func (h *healthServer) started(pid int) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pid = pid
+	h.startedAt = h.now()
+	h.alive = true
+}
+
+func (h *healthServer) stop() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.alive = false
+	h.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = h.srv.Shutdown(ctx)
+}
+
+func (h *healthServer) snapshot() healthPayload {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	payload := healthPayload{Project: h.project, CWD: h.cwd, PID: h.pid, Alive: h.alive}
+	if !h.startedAt.IsZero() {
+		payload.StartedAt = h.startedAt.UTC().Format(time.RFC3339)
+		payload.UptimeSeconds = h.now().Sub(h.startedAt).Seconds()
+	}
+	for _, key := range sortedKeys(h.overrides) {
+		payload.Overrides = append(payload.Overrides, outputBinding{Key: key, Value: h.overrides[key]})
+	}
+	return payload
+}
+
+func (h *healthServer) serveHealth(w http.ResponseWriter, _ *http.Request) {
+	payload := h.snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	if !payload.Alive {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+// execute runs the command, reporting the pid to onStart when the executor
+// supports it.
+func (a *App) execute(ctx context.Context, name string, args []string, env []string, onStart func(pid int)) error {
+	if observer, ok := a.executor.(StartObserver); ok {
+		return observer.RunObserved(ctx, name, args, env, a.stdout, a.stderr, onStart)
+	}
+	return a.executor.Run(ctx, name, args, env, a.stdout, a.stderr)
+}
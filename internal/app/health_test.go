@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_Run_HealthEndpoint(t *testing.T) {
+	var payload healthPayload
+	var probeErr error
+	probe := observedExecutor{pid: 4242, executorFunc: func(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+		resp, err := http.Get("http://127.0.0.1:" + envValue(env, "AUTOPORT_HEALTH_PORT") + "/health")
+		if err != nil {
+			probeErr = err
+			return nil
+		}
+		defer resp.Body.Close()
+		probeErr = json.NewDecoder(resp.Body).Decode(&payload)
+		return nil
+	}}
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(probe),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"WEB_PORT=3000"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "run", Range: "40000-41000", CWD: "/work/shop", Health: true}, []string{"npm", "start"})
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if probeErr != nil {
+		t.Skipf("health endpoint unreachable in this environment: %v", probeErr)
+	}
+	if !payload.Alive || payload.PID != 4242 || payload.Project != "shop" {
+		t.Fatalf("unexpected health payload: %+v", payload)
+	}
+	if len(payload.Overrides) != 2 {
+		t.Fatalf("expected assignments in health payload: %+v", payload)
+	}
+}
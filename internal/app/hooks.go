@@ -0,0 +1,143 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/lastrun"
+	"github.com/gelleson/autoport/internal/notify"
+)
+
+// shellCommand returns the program and arguments used to run a hook command
+// line through the platform shell.
+func shellCommand(line string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", []string{"/C", line}
+	}
+	return "sh", []string{"-c", line}
+}
+
+// scriptCommand returns the program and arguments used to run a script
+// command line with extra arguments appended. On Unix the arguments are
+// passed as positional parameters, so they reach the command unquoted and
+// unsplit.
+func scriptCommand(line string, args []string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", append([]string{"/C", line}, args...)
+	}
+	return "sh", append([]string{"-c", line + ` "$@"`, "sh"}, args...)
+}
+
+// runHooks runs each hook command line in order with env. All hooks run even if
+// one fails; the first failure is returned.
+func (a *App) runHooks(ctx context.Context, stage string, hooks []string, env []string) error {
+	var first error
+	for _, line := range hooks {
+		name, args := shellCommand(line)
+		if err := a.executor.Run(ctx, name, args, env, a.stderr, a.stderr); err != nil {
+			a.logger.Warn("hook failed", slog.String("stage", stage), slog.String("command", line), slog.String("error", err.Error()))
+			if first == nil {
+				first = fmt.Errorf("%s hook %q: %w", stage, line, err)
+			}
+		}
+	}
+	return first
+}
+
+// fireOnChange runs the on_change hooks, and shows a desktop notification
+// when configured, for ports that moved since the previous run. Hooks get
+// env plus AUTOPORT_CHANGES ("KEY=old->new ..."). Failures are reported but
+// never stop the run.
+func (a *App) fireOnChange(ctx context.Context, changes []lastrun.Change, env []string) {
+	hooks := a.config.Hooks
+	if len(changes) == 0 || (len(hooks.OnChange) == 0 && !hooks.NotifyOnChange) {
+		return
+	}
+	moved := make([]string, 0, len(changes))
+	for _, c := range changes {
+		moved = append(moved, fmt.Sprintf("%s=%d->%d", c.Key, c.Previous, c.Current))
+	}
+	_ = a.runHooks(ctx, "on_change", hooks.OnChange, append(env, "AUTOPORT_CHANGES="+strings.Join(moved, " ")))
+	if !hooks.NotifyOnChange {
+		return
+	}
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		lines = append(lines, fmt.Sprintf("%s: %d -> %d (%s)", c.Key, c.Previous, c.Current, c.Reason))
+	}
+	a.notify(ctx, "autoport: ports changed", strings.Join(lines, "\n"), env)
+}
+
+// notify shows a desktop notification where the platform has a notifier.
+// Failures are logged only.
+func (a *App) notify(ctx context.Context, title, body string, env []string) {
+	name, args, ok := notify.Local(title, body)
+	if !ok {
+		return
+	}
+	if err := a.executor.Run(ctx, name, args, env, io.Discard, io.Discard); err != nil {
+		a.logger.Warn("desktop notification failed", slog.String("error", err.Error()))
+	}
+}
+
+// notifyFailure reports err as a desktop notification under --notify, for
+// runs in background terminals nobody is watching. It runs even when ctx
+// was canceled.
+func (a *App) notifyFailure(ctx context.Context, opts Options, title string, err error) {
+	if !opts.Notify || err == nil {
+		return
+	}
+	a.notify(context.WithoutCancel(ctx), title, fmt.Sprintf("%s: %v", opts.CWD, err), a.environ)
+}
+
+// exitCodeOf maps a command error to the exit code passed to on_exit hooks.
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	var coded interface{ ExitCode() int }
+	if errors.As(err, &coded) {
+		return coded.ExitCode()
+	}
+	return 1
+}
+
+// resolveBranch runs branch_resolver_cmd with the project path as its
+// argument and returns the first line it prints. Outcomes are kept for the
+// App's lifetime, as a branch lookup happens several times per plan; a
+// failure is logged once and, like git outside a repository, leaves the
+// project without a branch.
+func (a *App) resolveBranch(ctx context.Context, cwd string) (string, error) {
+	if r, ok := a.branches[cwd]; ok {
+		return r.branch, r.err
+	}
+	line := a.config.BranchResolverCmd
+	name, args := scriptCommand(line, []string{cwd})
+	var out strings.Builder
+	var r branchResult
+	if err := a.executor.Run(ctx, name, args, a.environ, &out, a.stderr); err != nil {
+		r.err = fmt.Errorf("branch_resolver_cmd %q: %w", line, err)
+	} else if first, _, _ := strings.Cut(strings.TrimSpace(out.String()), "\n"); strings.TrimSpace(first) == "" {
+		r.err = fmt.Errorf("branch_resolver_cmd %q printed no branch for %s", line, cwd)
+	} else {
+		r.branch = strings.TrimSpace(first)
+	}
+	if r.err != nil {
+		a.logger.Warn("branch resolver failed", slog.String("error", r.err.Error()))
+	}
+	if a.branches == nil {
+		a.branches = map[string]branchResult{}
+	}
+	a.branches[cwd] = r
+	return r.branch, r.err
+}
+
+type branchResult struct {
+	branch string
+	err    error
+}
@@ -0,0 +1,220 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_Run_OnExitHooksRunAfterCommand(t *testing.T) {
+	rec := &RecordingExecutor{FailName: "npm"}
+	app := New(
+		WithConfig(&config.Config{
+			Presets: map[string]config.Preset{},
+			Hooks:   config.HooksConfig{OnExit: []string{"docker compose down"}},
+		}),
+		WithExecutor(rec),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "run", Range: "10000-11000", CWD: "/test/path", Quiet: true}, []string{"npm", "start"})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("expected child exit error to be preserved, got %v", err)
+	}
+	if len(rec.Calls) != 2 {
+		t.Fatalf("expected command plus one hook, got %d calls", len(rec.Calls))
+	}
+	hook := rec.Calls[1]
+	if hook.CapturedArgs[len(hook.CapturedArgs)-1] != "docker compose down" {
+		t.Fatalf("unexpected hook call: %+v", hook)
+	}
+	if envValue(hook.CapturedEnv, "PORT") == "" {
+		t.Fatal("expected assignments in hook env")
+	}
+	if envValue(hook.CapturedEnv, "AUTOPORT_EXIT_CODE") != "3" {
+		t.Fatalf("expected AUTOPORT_EXIT_CODE=3, got %q", envValue(hook.CapturedEnv, "AUTOPORT_EXIT_CODE"))
+	}
+}
+
+func TestApp_Run_PreRunHookFailureSkipsCommand(t *testing.T) {
+	rec := &RecordingExecutor{FailName: "sh"}
+	if runtime.GOOS == "windows" {
+		rec.FailName = "cmd"
+	}
+	app := New(
+		WithConfig(&config.Config{
+			Presets: map[string]config.Preset{},
+			Hooks:   config.HooksConfig{PreRun: []string{"./seed-db.sh"}},
+		}),
+		WithExecutor(rec),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "run", Range: "10000-11000", CWD: "/test/path", Quiet: true}, []string{"npm", "start"})
+	if err == nil || !strings.Contains(err.Error(), "pre_run hook") {
+		t.Fatalf("expected pre_run hook error, got %v", err)
+	}
+	if len(rec.Calls) != 1 {
+		t.Fatalf("expected only the hook to run, got %d calls", len(rec.Calls))
+	}
+	if envValue(rec.Calls[0].CapturedEnv, "PORT") == "" {
+		t.Fatal("expected assignments in pre_run hook env")
+	}
+}
+
+func TestApp_BranchResolverCmdReplacesGit(t *testing.T) {
+	// The resolver prints a branch name like a VCS wrapper would.
+	branch := "feature/x\n"
+	var calls [][]string
+	exec := executorFunc(func(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+		calls = append(calls, append([]string{name}, args...))
+		_, err := fmt.Fprintln(stdout, branch)
+		return err
+	})
+	cfg := &config.Config{Presets: map[string]config.Preset{}, SeedBranch: true, BranchResolverCmd: "sl-branch"}
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(cfg),
+		WithStdout(&stdout),
+		WithStdin(strings.NewReader("")),
+		WithEnviron([]string{}),
+		WithExecutor(exec),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts := Options{Mode: "explain", Format: "json", CWD: "/repo", Yes: true}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload explainPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	if payload.SeedSource != "path:/repo@feature/x" {
+		t.Fatalf("seed material = %q, want the resolved branch", payload.SeedSource)
+	}
+	if len(calls) != 1 || !slices.Contains(calls[0], "/repo") {
+		t.Fatalf("resolver calls = %v, want one call given the project path", calls)
+	}
+
+	branch = ""
+	var logs bytes.Buffer
+	app = New(WithConfig(cfg), WithStdout(io.Discard), WithLogger(slog.New(slog.NewTextHandler(&logs, nil))), WithEnviron([]string{}), WithExecutor(exec), WithIsFree(func(p int) bool { return true }))
+	if err := app.Run(context.Background(), opts, nil); err != nil || !strings.Contains(logs.String(), "printed no branch") {
+		t.Fatalf("empty resolver output should warn and fall back to the path seed, got %v\n%s", err, logs.String())
+	}
+	opts.Yes = false
+	cfg.Origins = map[string]string{"branch_resolver_cmd": "/repo/.autoport.json"}
+	app = New(WithConfig(cfg), WithStdout(io.Discard), WithStderr(io.Discard), WithStdin(strings.NewReader("n\n")), WithEnviron([]string{}), WithExecutor(exec))
+	if err := app.Run(context.Background(), opts, nil); err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Fatalf("an untrusted resolver should need confirmation, got %v", err)
+	}
+}
+
+func TestApp_OnChangeHooksFireWhenPortsMove(t *testing.T) {
+	stateDir := t.TempDir()
+	cwd := t.TempDir()
+	busy := map[int]bool{}
+	cfg := &config.Config{
+		Presets: map[string]config.Preset{},
+		Hooks:   config.HooksConfig{OnChange: []string{"./moved.sh"}, NotifyOnChange: true},
+	}
+	run := func() *RecordingExecutor {
+		rec := &RecordingExecutor{}
+		app := New(
+			WithConfig(cfg),
+			WithExecutor(rec),
+			WithStdout(io.Discard),
+			WithStderr(io.Discard),
+			WithEnviron([]string{"PORT=3000"}),
+			WithIsFree(func(p int) bool { return !busy[p] }),
+			WithStateDir(stateDir),
+		)
+		seed := uint32(0)
+		if err := app.Run(context.Background(), Options{CWD: cwd, Range: "10000-10100", Seed: &seed}, []string{"npm", "start"}); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return rec
+	}
+
+	if calls := run().Calls; len(calls) != 1 || calls[0].CapturedName != "npm" {
+		t.Fatalf("first run should only start the command, got %+v", calls)
+	}
+	busy[10000] = true
+	calls := run().Calls
+	if len(calls) != 3 {
+		t.Fatalf("expected hook, notification, and command, got %+v", calls)
+	}
+	hook := calls[0]
+	if !slices.Contains(hook.CapturedArgs, "./moved.sh") {
+		t.Fatalf("first call should be the on_change hook, got %s %v", hook.CapturedName, hook.CapturedArgs)
+	}
+	if got := envValue(hook.CapturedEnv, "AUTOPORT_CHANGES"); got != "PORT=10000->10001" {
+		t.Fatalf("AUTOPORT_CHANGES = %q", got)
+	}
+	if got := envValue(hook.CapturedEnv, "PORT"); got != "10001" {
+		t.Fatalf("hook PORT = %q", got)
+	}
+	if name := calls[1].CapturedName; runtime.GOOS == "linux" && name != "notify-send" {
+		t.Fatalf("notification command = %q", name)
+	}
+	if calls[2].CapturedName != "npm" {
+		t.Fatalf("command should run last, got %q", calls[2].CapturedName)
+	}
+}
+
+func TestApp_NotifyReportsFailures(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("asserts notify-send arguments")
+	}
+	run := func(opts Options, free bool) []MockExecutor {
+		t.Helper()
+		rec := &RecordingExecutor{FailName: "npm"}
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithExecutor(rec),
+			WithStdout(io.Discard),
+			WithStderr(io.Discard),
+			WithEnviron([]string{"PORT=3000"}),
+			WithIsFree(func(p int) bool { return free }),
+		)
+		seed := uint32(0)
+		opts.CWD, opts.Range, opts.Seed = "/repo", "10000-10001", &seed
+		if err := app.Run(context.Background(), opts, []string{"npm", "start"}); err == nil {
+			t.Fatal("Run() should fail")
+		}
+		return rec.Calls
+	}
+
+	calls := run(Options{Notify: true}, true)
+	if len(calls) != 2 || calls[1].CapturedName != "notify-send" {
+		t.Fatalf("expected the command and a notification, got %+v", calls)
+	}
+	if args := calls[1].CapturedArgs; args[1] != "autoport: npm exited with code 3" || !strings.Contains(args[2], "PORT=10000") {
+		t.Fatalf("notification = %q", args)
+	}
+	calls = run(Options{Notify: true}, false)
+	if len(calls) != 1 || calls[0].CapturedArgs[1] != "autoport: allocation failed" || !strings.HasPrefix(calls[0].CapturedArgs[2], "/repo: ") {
+		t.Fatalf("expected an allocation failure notification, got %+v", calls)
+	}
+	if calls := run(Options{}, false); len(calls) != 0 {
+		t.Fatalf("without --notify nothing should run, got %+v", calls)
+	}
+}
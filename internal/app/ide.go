@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/gelleson/autoport/internal/ide"
+)
+
+// ideMethods lists the methods `autoport ide serve` answers.
+var ideMethods = []string{"initialize", "assignments", "port", "shutdown"}
+
+// ideParams selects the project a query is about: the directory of file
+// (typically an .env file open in the editor) or cwd, relative to the
+// server's working directory.
+type ideParams struct {
+	File string `json:"file,omitempty"`
+	CWD  string `json:"cwd,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+type ideAssignment struct {
+	Key       string `json:"key"`
+	Port      int    `json:"port"`
+	Preferred int    `json:"preferred"`
+	Probes    int    `json:"probes"`
+	Source    string `json:"source,omitempty"`
+}
+
+type ideProject struct {
+	CWD          string          `json:"cwd"`
+	Seed         uint32          `json:"seed"`
+	SeedMaterial string          `json:"seed_material"`
+	Range        string          `json:"range"`
+	Assignments  []ideAssignment `json:"assignments"`
+	Warnings     []warning       `json:"warnings,omitempty"`
+}
+
+type idePort struct {
+	CWD        string `json:"cwd"`
+	Key        string `json:"key"`
+	Port       int    `json:"port"`
+	Preferred  int    `json:"preferred"`
+	Discovered bool   `json:"discovered"`
+}
+
+// serveIDE answers editor queries on stdin/stdout until shutdown or EOF.
+func (a *App) serveIDE(ctx context.Context, opts Options) error {
+	return ide.Serve(ctx, a.stdin, a.stdout, func(ctx context.Context, method string, raw json.RawMessage) (any, error) {
+		var params ideParams
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, ide.Errorf(ide.CodeInvalidParams, "invalid params: %v", err)
+			}
+		}
+		switch method {
+		case "initialize":
+			return map[string]any{"name": "autoport", "methods": ideMethods}, nil
+		case "assignments":
+			return a.ideAssignments(ctx, opts, params)
+		case "port":
+			return a.idePort(ctx, opts, params)
+		case "shutdown":
+			return nil, ide.ErrShutdown
+		default:
+			return nil, ide.Errorf(ide.CodeMethodNotFound, "unknown method %q", method)
+		}
+	})
+}
+
+// ideOptions points opts at the project a query names.
+func ideOptions(opts Options, params ideParams) Options {
+	dir := params.CWD
+	if params.File != "" {
+		dir = filepath.Dir(params.File)
+	}
+	if dir != "" && !filepath.IsAbs(dir) {
+		dir = filepath.Join(opts.CWD, dir)
+	}
+	if dir != "" {
+		opts.CWD = filepath.Clean(dir)
+	}
+	return opts
+}
+
+// idePlan plans the queried project with its own config.
+func (a *App) idePlan(ctx context.Context, opts Options) (*plan, error) {
+	restore, err := a.useProjectConfig(opts, false)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	res, err := a.resolveOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return a.plan(ctx, opts, res)
+}
+
+func (a *App) ideAssignments(ctx context.Context, opts Options, params ideParams) (any, error) {
+	opts = ideOptions(opts, params)
+	p, err := a.idePlan(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	sources := map[string]string{}
+	for _, d := range p.Decisions {
+		sources[d.Key] = d.Source
+	}
+	out := ideProject{CWD: opts.CWD, Seed: p.Seed.Value, SeedMaterial: p.Seed.Material, Range: p.Range.String(), Assignments: []ideAssignment{}, Warnings: p.Warnings}
+	for _, as := range p.Assignments {
+		out.Assignments = append(out.Assignments, ideAssignment{Key: as.Key, Port: as.Assigned, Preferred: as.Preferred, Probes: as.Probes, Source: sources[as.Key]})
+	}
+	return out, nil
+}
+
+// idePort answers "what port will key get". A key the scan does not find is
+// planned as if passed with -k.
+func (a *App) idePort(ctx context.Context, opts Options, params ideParams) (any, error) {
+	if params.Key == "" {
+		return nil, ide.Errorf(ide.CodeInvalidParams, "key is required")
+	}
+	if !isValidEnvVarName(params.Key) {
+		return nil, ide.Errorf(ide.CodeInvalidParams, "invalid key %q", params.Key)
+	}
+	opts = ideOptions(opts, params)
+	for attempt := 0; attempt < 2; attempt++ {
+		p, err := a.idePlan(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, as := range p.Assignments {
+			if as.Key == params.Key {
+				return idePort{CWD: opts.CWD, Key: as.Key, Port: as.Assigned, Preferred: as.Preferred, Discovered: attempt == 0}, nil
+			}
+		}
+		opts.PortEnv = append(append([]string{}, opts.PortEnv...), params.Key)
+	}
+	return nil, ide.Errorf(ide.CodeInvalidParams, "key %s is excluded by the current selection", params.Key)
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_IDEPlansWithEachProjectsConfig(t *testing.T) {
+	dirs := projectConfigs(t, map[string]string{
+		"plain":    "",
+		"pinned":   `{"ports": {"WEB_PORT": 3000}}`,
+		"resolver": `{"branch_resolver_cmd": "echo main"}`,
+	})
+	app := New(
+		WithConfig(config.LoadFrom(dirs["plain"])),
+		WithStdin(strings.NewReader("y\n")),
+		WithStderr(io.Discard),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	seed := uint32(0)
+	opts := Options{Mode: "ide", CWD: dirs["plain"], Seed: &seed, Range: "10000-10100"}
+
+	port := func(dir string) (int, error) {
+		out, err := app.idePort(context.Background(), opts, ideParams{File: filepath.Join(dir, ".env"), Key: "WEB_PORT"})
+		if err != nil {
+			return 0, err
+		}
+		return out.(idePort).Port, nil
+	}
+	if p, err := port(dirs["pinned"]); err != nil || p != 3000 {
+		t.Fatalf("pinned WEB_PORT = %d, %v; want the project's pin 3000", p, err)
+	}
+	if p, err := port(dirs["plain"]); err != nil || p == 3000 {
+		t.Fatalf("plain WEB_PORT = %d, %v; the other project's pin leaked", p, err)
+	}
+	// Nobody can confirm an untrusted command mid-query.
+	if _, err := port(dirs["resolver"]); err == nil || !strings.Contains(err.Error(), "refusing to run commands from untrusted config") {
+		t.Fatalf("untrusted branch resolver: %v, want a refusal without a prompt", err)
+	}
+	if len(app.config.Ports) != 0 || app.config.BranchResolverCmd != "" {
+		t.Fatalf("the server's config was not restored: %+v", app.config)
+	}
+}
+
+func TestApp_IDEServe(t *testing.T) {
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, ".env"), []byte("WEB_PORT=3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	requests := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"assignments","params":{"file":"` + filepath.Join(project, ".env") + `"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"port","params":{"cwd":"` + project + `","key":"ADMIN_PORT"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"port","params":{"key":"bad key"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`,
+	}, "\n")
+
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdin(strings.NewReader(requests)),
+		WithStdout(&stdout),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	seed := uint32(0)
+	if err := app.Run(context.Background(), Options{Mode: "ide", CWD: "/elsewhere", Seed: &seed, Range: "10000-10100"}, nil); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	type response struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	var responses []response
+	dec := json.NewDecoder(&stdout)
+	for dec.More() {
+		var r response
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		responses = append(responses, r)
+	}
+	if len(responses) != 4 {
+		t.Fatalf("expected 4 responses, got %d", len(responses))
+	}
+
+	var project1 ideProject
+	if err := json.Unmarshal(responses[0].Result, &project1); err != nil {
+		t.Fatalf("assignments result: %v", err)
+	}
+	if project1.CWD != project || len(project1.Assignments) != 2 || project1.Assignments[1].Key != "WEB_PORT" || project1.Assignments[1].Source != ".env" {
+		t.Fatalf("unexpected assignments: %+v", project1)
+	}
+
+	var p idePort
+	if err := json.Unmarshal(responses[1].Result, &p); err != nil {
+		t.Fatalf("port result: %v", err)
+	}
+	if p.Key != "ADMIN_PORT" || p.Discovered || p.Port != 10000 {
+		t.Fatalf("unexpected port result: %+v", p)
+	}
+	if responses[2].Error == nil || responses[2].Error.Code != -32602 {
+		t.Fatalf("expected invalid params error, got %+v", responses[2])
+	}
+}
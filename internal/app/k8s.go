@@ -0,0 +1,144 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+// k8sForward is one kubectl port-forward: a resource and the local:remote
+// port pairs forwarded from it.
+type k8sForward struct {
+	namespace string
+	resource  string
+	address   string
+	ports     []string
+}
+
+// k8sForwards collects the assigned ports the config's k8s block maps to
+// a resource, one forward per resource and address. Keys without a
+// mapping are returned separately, rather than guessing a resource from
+// the key name.
+func (a *App) k8sForwards(overrides map[string]string) ([]k8sForward, []string) {
+	var forwards []k8sForward
+	index := map[[3]string]int{}
+	var unmapped []string
+	for _, key := range sortedKeys(overrides) {
+		if base, ok := strings.CutSuffix(key, hostSuffix); ok && overrides[base] != "" {
+			// A loopback alias is the address its key is forwarded on.
+			continue
+		}
+		fwd, ok := a.config.K8s[key]
+		if !ok {
+			unmapped = append(unmapped, key)
+			continue
+		}
+		id := [3]string{fwd.Namespace, fwd.Resource, overrides[key+hostSuffix]}
+		i, ok := index[id]
+		if !ok {
+			i = len(forwards)
+			index[id] = i
+			forwards = append(forwards, k8sForward{namespace: id[0], resource: id[1], address: id[2]})
+		}
+		forwards[i].ports = append(forwards[i].ports, overrides[key]+":"+k8sRemotePort(fwd, overrides[key]))
+	}
+	return forwards, unmapped
+}
+
+// k8sRemotePort is the resource port a key forwards to.
+func k8sRemotePort(fwd config.K8sForward, assigned string) string {
+	if fwd.Port > 0 {
+		return strconv.Itoa(fwd.Port)
+	}
+	return assigned
+}
+
+// printK8s writes a shell script running one kubectl port-forward per
+// mapped resource in the background until it is interrupted.
+func (a *App) printK8s(overrides map[string]string) {
+	forwards, unmapped := a.k8sForwards(overrides)
+	fmt.Fprintln(a.stdout, "#!/bin/sh")
+	fmt.Fprintln(a.stdout, composeGenerated+". Forwards the assigned ports until Ctrl-C.")
+	fmt.Fprintln(a.stdout, "trap 'kill 0' INT TERM")
+	for _, f := range forwards {
+		args := []string{"kubectl", "port-forward"}
+		if f.namespace != "" {
+			args = append(args, "--namespace", shellWord(f.namespace))
+		}
+		if f.address != "" {
+			args = append(args, "--address", shellWord(f.address))
+		}
+		args = append(args, shellWord(f.resource))
+		args = append(args, f.ports...)
+		fmt.Fprintln(a.stdout, strings.Join(args, " ")+" &")
+	}
+	fmt.Fprintln(a.stdout, "wait")
+	a.warnUnmappedK8s(unmapped)
+}
+
+// printSkaffold writes a skaffold.yaml portForward stanza with one entry
+// per mapped key.
+func (a *App) printSkaffold(overrides map[string]string) {
+	forwards, unmapped := a.k8sForwards(overrides)
+	fmt.Fprintln(a.stdout, composeGenerated+". Merge into skaffold.yaml.")
+	if len(forwards) == 0 {
+		fmt.Fprintln(a.stdout, "portForward: []")
+	} else {
+		fmt.Fprintln(a.stdout, "portForward:")
+	}
+	for _, f := range forwards {
+		kind, name, _ := strings.Cut(f.resource, "/")
+		for _, pair := range f.ports {
+			local, remote, _ := strings.Cut(pair, ":")
+			fmt.Fprintf(a.stdout, "  - resourceType: %s\n    resourceName: %q\n", skaffoldResourceType(kind), name)
+			if f.namespace != "" {
+				fmt.Fprintf(a.stdout, "    namespace: %q\n", f.namespace)
+			}
+			fmt.Fprintf(a.stdout, "    port: %s\n    localPort: %s\n", remote, local)
+			if f.address != "" {
+				fmt.Fprintf(a.stdout, "    address: %q\n", f.address)
+			}
+		}
+	}
+	a.warnUnmappedK8s(unmapped)
+}
+
+func (a *App) warnUnmappedK8s(unmapped []string) {
+	if len(unmapped) > 0 {
+		a.logger.Warn("keys without a k8s resource were left out",
+			slog.String("keys", strings.Join(unmapped, ",")),
+			slog.String("hint", `map them in the config "k8s" block`))
+	}
+}
+
+// skaffoldResourceType spells a kubectl resource type the way skaffold's
+// resourceType expects it: full, singular, and without an API group.
+func skaffoldResourceType(kind string) string {
+	kind, _, _ = strings.Cut(strings.ToLower(kind), ".")
+	switch kind {
+	case "svc", "services":
+		return "service"
+	case "po", "pods":
+		return "pod"
+	case "deploy", "deployments":
+		return "deployment"
+	case "rs", "replicasets":
+		return "replicaset"
+	case "sts", "statefulsets":
+		return "statefulset"
+	}
+	return kind
+}
+
+// shellWord quotes s for POSIX shells unless it is plainly one word.
+func shellWord(s string) string {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./:@", c)) {
+			return shellQuote(s)
+		}
+	}
+	return s
+}
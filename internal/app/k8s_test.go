@@ -0,0 +1,58 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_K8sFormatsForwardMappedKeys(t *testing.T) {
+	cfg := &config.Config{
+		Ports: map[string]config.PortSpec{"WEB_PORT": {Port: 4100}, "METRICS_PORT": {Port: 4101}, "API_PORT": {Port: 4200}, "DB_PORT": {Port: 4300}},
+		K8s: map[string]config.K8sForward{
+			"WEB_PORT":     {Resource: "svc/web", Port: 80},
+			"METRICS_PORT": {Resource: "svc/web", Port: 9090},
+			"API_PORT":     {Resource: "deployment/api", Namespace: "dev"},
+		},
+	}
+	run := func(format string) (string, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		app := New(
+			WithConfig(cfg),
+			WithStdout(&stdout),
+			WithLogger(slog.New(slog.NewTextHandler(&stderr, nil))),
+			WithEnviron([]string{"WEB_PORT=1", "METRICS_PORT=1", "API_PORT=1", "DB_PORT=1"}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts := Options{CWD: "/test/path", Range: "4000-4999", Format: format, Includes: []string{"WEB_PORT", "METRICS_PORT", "API_PORT", "DB_PORT"}}
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run(%s) error: %v", format, err)
+		}
+		return stdout.String(), stderr.String()
+	}
+
+	out, stderr := run("k8s")
+	want := "kubectl port-forward --namespace dev deployment/api 4200:4200 &\n" +
+		"kubectl port-forward svc/web 4101:9090 4100:80 &\n" +
+		"wait\n"
+	if !strings.HasPrefix(out, "#!/bin/sh\n") || !strings.HasSuffix(out, want) {
+		t.Fatalf("k8s output:\n%s\nwant suffix:\n%s", out, want)
+	}
+	if strings.Contains(out, "4300") || !strings.Contains(stderr, "DB_PORT") {
+		t.Fatalf("unmapped DB_PORT should be reported, not forwarded:\nstdout:\n%s\nstderr:\n%s", out, stderr)
+	}
+
+	out, _ = run("skaffold")
+	want = "portForward:\n" +
+		"  - resourceType: deployment\n    resourceName: \"api\"\n    namespace: \"dev\"\n    port: 4200\n    localPort: 4200\n" +
+		"  - resourceType: service\n    resourceName: \"web\"\n    port: 9090\n    localPort: 4101\n" +
+		"  - resourceType: service\n    resourceName: \"web\"\n    port: 80\n    localPort: 4100\n"
+	if !strings.HasSuffix(out, want) {
+		t.Fatalf("skaffold output:\n%s\nwant suffix:\n%s", out, want)
+	}
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gelleson/autoport/internal/lastrun"
+	"github.com/gelleson/autoport/internal/lockfile"
+)
+
+// trackLastRun compares assignments with the project's previous run and, for
+// real runs, records them for next time. When the git branch changed since
+// that run it also returns a branch-changed warning. previous holds that
+// run's ports by key, or is nil when there was none. It is a no-op without a
+// state dir.
+func (a *App) trackLastRun(ctx context.Context, opts Options, rangeSpec string, seed uint32, assignments []assignedPort) (changes []lastrun.Change, previous map[string]int, warnings []warning) {
+	if a.stateDir == "" {
+		return nil, nil, nil
+	}
+	branch, _ := a.gitBranch(ctx, opts.CWD)
+	cur := lastrun.Record{
+		CWD:        opts.CWD,
+		Branch:     branch,
+		Seed:       seed,
+		Range:      rangeSpec,
+		RecordedAt: a.now().UTC().Format(time.RFC3339),
+	}
+	for _, as := range assignments {
+		cur.Assignments = append(cur.Assignments, lastrun.Entry{Key: as.Key, Port: as.Assigned, Probes: as.Probes})
+	}
+
+	path := lastrun.PathFor(a.stateDir, opts.CWD)
+	var prev lastrun.Record
+	var err error
+	if opts.DryRun {
+		prev, err = lastrun.Read(path)
+	} else {
+		// Concurrent runs of the project each compare with the run
+		// before them.
+		var ok bool
+		prev, ok, err = lastrun.Swap(path, cur)
+		if err == nil && !ok {
+			err = os.ErrNotExist
+		}
+	}
+	switch {
+	case err == nil:
+		changes = lastrun.Diff(prev, cur)
+		previous = make(map[string]int, len(prev.Assignments))
+		for _, e := range prev.Assignments {
+			previous[e.Key] = e.Port
+		}
+		if prev.Branch != "" && branch != "" && prev.Branch != branch {
+			warnings = append(warnings, a.branchChangedWarning(prev, cur))
+		}
+	case errors.Is(err, os.ErrNotExist):
+	case opts.DryRun:
+		a.logger.Warn("ignoring last run state", slog.String("path", path), slog.String("error", err.Error()))
+	default:
+		a.logger.Warn("could not record last run", slog.String("error", err.Error()))
+	}
+	return changes, previous, warnings
+}
+
+// unchangedKeys returns the keys whose port equals the one --changed-only
+// compares with: the lockfile's under --use-lock, else the previous run's.
+// Without either, every key counts as changed.
+func (a *App) unchangedKeys(ctx context.Context, opts Options, previous map[string]int, assignments []assignedPort) map[string]bool {
+	if opts.UseLock {
+		lf, err := a.readLockfile(ctx, lockfile.PathFor(opts.CWD))
+		if err != nil {
+			return nil
+		}
+		previous = map[string]int{}
+		for key, value := range lockfile.ToMap(lf.Assignments) {
+			if p, err := strconv.Atoi(value); err == nil {
+				previous[key] = p
+			}
+		}
+	}
+	unchanged := map[string]bool{}
+	for _, as := range assignments {
+		if p, ok := previous[as.Key]; ok && p == as.Assigned {
+			// A loopback alias is derived from the path, so the
+			// key's host is as unchanged as its port.
+			unchanged[as.Key] = true
+			unchanged[as.Key+hostSuffix] = true
+		}
+	}
+	return unchanged
+}
+
+// branchChangedWarning tells the user that ports exported into the shell on
+// the previous branch may be stale, naming keys whose environment value is
+// still the previous run's port, and lists the refreshed values.
+func (a *App) branchChangedWarning(prev, cur lastrun.Record) warning {
+	before := make(map[string]int, len(prev.Assignments))
+	for _, e := range prev.Assignments {
+		before[e.Key] = e.Port
+	}
+	environ := map[string]string{}
+	for _, kv := range a.environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			environ[k] = v
+		}
+	}
+	var stale, refreshed []string
+	for _, e := range cur.Assignments {
+		refreshed = append(refreshed, fmt.Sprintf("%s=%d", e.Key, e.Port))
+		if old, ok := before[e.Key]; ok && old != e.Port && environ[e.Key] == strconv.Itoa(old) {
+			stale = append(stale, e.Key)
+		}
+	}
+	msg := fmt.Sprintf("branch changed from %s to %s since the last run; ports exported in this shell may be stale", prev.Branch, cur.Branch)
+	if len(stale) > 0 {
+		msg = fmt.Sprintf("branch changed from %s to %s since the last run; this shell still has the old %s", prev.Branch, cur.Branch, strings.Join(stale, ", "))
+	}
+	msg += " (refreshed: " + strings.Join(refreshed, " ") + "; re-run eval \"$(autoport)\" or reload direnv)"
+	w := newWarning(WarnBranchChanged, "%s", msg)
+	w = w.with("previous_branch", prev.Branch).with("branch", cur.Branch).with("refreshed", strings.Join(refreshed, " "))
+	if len(stale) > 0 {
+		w = w.with("stale_keys", strings.Join(stale, ","))
+	}
+	return w
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/internal/lastrun"
+)
+
+func TestApp_RunSummaryReportsChangesSinceLastRun(t *testing.T) {
+	stateDir := t.TempDir()
+	cwd := t.TempDir()
+	busy := map[int]bool{}
+	run := func() string {
+		var stderr bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithExecutor(&MockExecutor{}),
+			WithStdout(io.Discard),
+			WithStderr(&stderr),
+			WithEnviron([]string{"PORT=3000"}),
+			WithIsFree(func(p int) bool { return !busy[p] }),
+			WithStateDir(stateDir),
+		)
+		seed := uint32(0)
+		if err := app.Run(context.Background(), Options{CWD: cwd, Range: "10000-10100", Seed: &seed}, []string{"npm", "start"}); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return stderr.String()
+	}
+
+	if out := run(); strings.Contains(out, "changed since last run") {
+		t.Fatalf("first run should report no changes:\n%s", out)
+	}
+	busy[10000] = true
+	out := run()
+	if !strings.Contains(out, "PORT: 10000 -> 10001 (occupied)") {
+		t.Fatalf("expected occupied change in summary:\n%s", out)
+	}
+}
+
+func TestApp_ChangedOnlyListsMovedKeys(t *testing.T) {
+	stateDir := t.TempDir()
+	cwd := t.TempDir()
+	busy := map[int]bool{}
+	run := func() string {
+		var stderr bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithExecutor(&MockExecutor{}),
+			WithStdout(io.Discard),
+			WithStderr(&stderr),
+			WithEnviron([]string{"PORT=3000", "API_PORT=4000", "WEB_PORT=5000"}),
+			WithIsFree(func(p int) bool { return !busy[p] }),
+			WithStateDir(stateDir),
+		)
+		seed := uint32(0)
+		if err := app.Run(context.Background(), Options{CWD: cwd, Range: "10000-10100", Seed: &seed, ChangedOnly: true}, []string{"npm", "start"}); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return stderr.String()
+	}
+
+	out := run()
+	for _, key := range []string{"API_PORT", "WEB_PORT", "PORT"} {
+		if !strings.Contains(out, key) {
+			t.Fatalf("first run has nothing to compare with and should list %s:\n%s", key, out)
+		}
+	}
+	if out := run(); strings.Contains(out, "API_PORT") || !strings.Contains(out, "autoport overrides (3)") || !strings.Contains(out, "3 unchanged not shown") {
+		t.Fatalf("an unchanged plan should collapse to a count:\n%s", out)
+	}
+
+	rec, err := lastrun.Read(lastrun.PathFor(stateDir, cwd))
+	if err != nil {
+		t.Fatalf("lastrun.Read() unexpected error: %v", err)
+	}
+	for _, e := range rec.Assignments {
+		if e.Key == "API_PORT" {
+			busy[e.Port] = true
+		}
+	}
+	out = run()
+	if !strings.Contains(out, "API_PORT") || strings.Contains(out, "WEB_PORT") || !strings.Contains(out, "2 unchanged not shown") {
+		t.Fatalf("only the moved key should be listed:\n%s", out)
+	}
+}
+
+func TestApp_WarnsWhenBranchChangedSinceLastRun(t *testing.T) {
+	dir := initGitRepo(t, "https://github.com/acme/shop")
+	stateDir := t.TempDir()
+	run := func(environ []string) outputPayload {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}, SeedBranch: true}),
+			WithStdout(&stdout),
+			WithEnviron(environ),
+			WithIsFree(func(p int) bool { return true }),
+			WithStateDir(stateDir),
+		)
+		opts := Options{Mode: "run", Format: "json", CWD: dir, Range: "10000-11000", Includes: []string{"WEB_PORT"}}
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		var payload outputPayload
+		if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+			t.Fatalf("json parse: %v", err)
+		}
+		return payload
+	}
+
+	first := run([]string{"WEB_PORT=3000"})
+	if len(first.Warnings) != 0 {
+		t.Fatalf("first run warnings = %+v", first.Warnings)
+	}
+	old := first.Overrides[0].Value
+	if out, err := exec.Command("git", "-C", dir, "checkout", "-q", "-b", "feature").CombinedOutput(); err != nil {
+		t.Fatalf("git checkout: %v\n%s", err, out)
+	}
+	second := run([]string{"WEB_PORT=" + old})
+	if len(second.Warnings) != 1 || second.Warnings[0].Code != WarnBranchChanged {
+		t.Fatalf("warnings = %+v, want one %s", second.Warnings, WarnBranchChanged)
+	}
+	w := second.Warnings[0]
+	if w.Context["previous_branch"] != "main" || w.Context["branch"] != "feature" || w.Context["stale_keys"] != "WEB_PORT" {
+		t.Fatalf("warning context = %v", w.Context)
+	}
+	if want := "WEB_PORT=" + second.Overrides[0].Value; w.Context["refreshed"] != want {
+		t.Fatalf("refreshed = %q, want %q", w.Context["refreshed"], want)
+	}
+}
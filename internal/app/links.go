@@ -0,0 +1,431 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+// linkEdit is one link value rewritten to a key's assigned port.
+type linkEdit struct {
+	link     config.Link
+	from, to string
+	// skipped says why the value was left alone, when its host is a
+	// container network name.
+	skipped string
+}
+
+// applyLinks rewrites the port in each linked JSON or YAML value to its
+// key's assigned port. Only the value's bytes change, so comments and
+// formatting survive, and a file whose values already match is not
+// written. Values whose host is a compose service or matches the link's
+// skip_hosts address a container, not this machine, and are kept. With
+// preview set it reports the edits without writing them.
+func (a *App) applyLinks(cwd string, overrides map[string]string, preview, quiet bool) error {
+	var services []string
+	if len(a.config.Links) > 0 {
+		services = composeServices(cwd)
+	}
+	for _, link := range a.config.Links {
+		p, ok := overrides[link.Key]
+		if !ok {
+			return fmt.Errorf("link %s: no port assigned to %s", link.TargetFile, link.Key)
+		}
+		path := link.TargetFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cwd, path)
+		}
+		edit, err := relinkFile(path, link, p, services, preview)
+		if err != nil {
+			return fmt.Errorf("link %s %s: %w", link.TargetFile, link.TargetPath, err)
+		}
+		switch {
+		case edit == nil:
+		case edit.skipped != "" && preview:
+			fmt.Fprintf(a.stderr, "would keep %s %s: %s (%s)\n", link.TargetFile, link.TargetPath, edit.from, edit.skipped)
+		case edit.skipped != "":
+			a.logger.Debug("link kept", slog.String("file", link.TargetFile), slog.String("path", link.TargetPath), slog.String("reason", edit.skipped))
+		case preview:
+			fmt.Fprintf(a.stderr, "would rewrite %s %s: %s -> %s\n", link.TargetFile, link.TargetPath, edit.from, edit.to)
+		case !quiet:
+			fmt.Fprintf(a.stderr, "rewrote %s %s: %s -> %s\n", link.TargetFile, link.TargetPath, edit.from, edit.to)
+		}
+	}
+	return nil
+}
+
+// relinkFile rewrites the linked value in the file at path, returning nil
+// when it already carries port p.
+func relinkFile(path string, link config.Link, p string, services []string, preview bool) (*linkEdit, error) {
+	data, span, value, err := readLink(path, link)
+	if err != nil {
+		return nil, err
+	}
+	from := string(data[span.start:span.end])
+	if reason := skipLinkHost(linkHost(value), link.SkipHosts, services); reason != "" {
+		return &linkEdit{link: link, from: from, to: from, skipped: reason}, nil
+	}
+	to, err := relinkPort(value, p)
+	if err != nil {
+		return nil, err
+	}
+	if to == value {
+		return nil, nil
+	}
+	if span.jsonString {
+		to, err = jsonStringContent(to)
+		if err != nil {
+			return nil, err
+		}
+	}
+	edit := &linkEdit{link: link, from: from, to: to}
+	if preview {
+		return edit, nil
+	}
+	out := slices.Concat(data[:span.start], []byte(to), data[span.end:])
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return edit, os.WriteFile(path, out, info.Mode().Perm())
+}
+
+// readLink finds the linked value in the file at path, returning the
+// file, the value's span in it, and the value with JSON escapes decoded.
+func readLink(path string, link config.Link) ([]byte, valueSpan, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, valueSpan{}, "", err
+	}
+	segments := strings.Split(link.TargetPath, ".")
+	var span valueSpan
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		span, err = jsonValueSpan(data, segments)
+	} else {
+		span, err = yamlValueSpan(data, segments)
+	}
+	if err != nil {
+		return nil, valueSpan{}, "", err
+	}
+	value := string(data[span.start:span.end])
+	if span.jsonString {
+		if err := json.Unmarshal(data[span.start-1:span.end+1], &value); err != nil {
+			return nil, valueSpan{}, "", err
+		}
+	}
+	return data, span, value, nil
+}
+
+// linksCheck is the doctor check that every config link can be applied:
+// its target value exists and holds a port, and its key is one the project
+// gets a port for (not checked when keys is nil).
+func (a *App) linksCheck(cwd string, keys map[string]struct{}) (doctorCheck, bool) {
+	if len(a.config.Links) == 0 {
+		return doctorCheck{}, false
+	}
+	services := composeServices(cwd)
+	var broken []message
+	var failures []string
+	for _, link := range a.config.Links {
+		path := link.TargetFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cwd, path)
+		}
+		_, _, value, err := readLink(path, link)
+		if err == nil && skipLinkHost(linkHost(value), link.SkipHosts, services) == "" {
+			_, err = relinkPort(value, "1")
+		}
+		if _, ok := keys[link.Key]; err == nil && keys != nil && !ok {
+			err = fmt.Errorf("%s is not one of the project's keys", link.Key)
+		}
+		if err != nil {
+			broken = append(broken, msgf("link %s %s: %s", link.TargetFile, link.TargetPath, err))
+			failures = append(failures, fmt.Sprintf("%s %s", link.TargetFile, link.TargetPath))
+		}
+	}
+	if len(broken) > 0 {
+		return newCheck("links.broken", "warn", broken...).with("links", len(a.config.Links)).with("broken", failures), true
+	}
+	return newCheck("links.ok", "ok", msgf("%d links resolve", len(a.config.Links))).with("links", len(a.config.Links)), true
+}
+
+// valueSpan is the byte range of a scalar value in a file. For a JSON
+// string it excludes the quotes.
+type valueSpan struct {
+	start, end int
+	jsonString bool
+}
+
+// jsonStringContent encodes s as JSON string content, without quotes and
+// without escaping HTML characters.
+func jsonStringContent(s string) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return "", err
+	}
+	out := strings.TrimSuffix(buf.String(), "\n")
+	return out[1 : len(out)-1], nil
+}
+
+// jsonValueSpan finds the value at path in a JSON document. Object members
+// are matched by name and array elements by index.
+func jsonValueSpan(data []byte, path []string) (valueSpan, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	for i, seg := range path {
+		tok, err := dec.Token()
+		if err != nil {
+			return valueSpan{}, err
+		}
+		found := false
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return valueSpan{}, err
+				}
+				if key == seg {
+					found = true
+					break
+				}
+				if err := skipJSONValue(dec); err != nil {
+					return valueSpan{}, err
+				}
+			}
+		case json.Delim('['):
+			index, err := strconv.Atoi(seg)
+			if err != nil {
+				return valueSpan{}, fmt.Errorf("%s is an array; use an index", strings.Join(path[:i], "."))
+			}
+			for n := 0; dec.More(); n++ {
+				if n == index {
+					found = true
+					break
+				}
+				if err := skipJSONValue(dec); err != nil {
+					return valueSpan{}, err
+				}
+			}
+		default:
+			return valueSpan{}, fmt.Errorf("%s is not an object or array", strings.Join(path[:i], "."))
+		}
+		if !found {
+			return valueSpan{}, fmt.Errorf("%s not found", strings.Join(path[:i+1], "."))
+		}
+	}
+	// The value follows the member name or the previous element.
+	start := int(dec.InputOffset())
+	for start < len(data) && strings.IndexByte(" \t\r\n:,", data[start]) >= 0 {
+		start++
+	}
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return valueSpan{}, err
+	}
+	end := int(dec.InputOffset())
+	switch {
+	case len(raw) > 0 && raw[0] == '"':
+		return valueSpan{start: start + 1, end: end - 1, jsonString: true}, nil
+	case len(raw) > 0 && (raw[0] == '-' || raw[0] >= '0' && raw[0] <= '9'):
+		return valueSpan{start: start, end: end}, nil
+	}
+	return valueSpan{}, fmt.Errorf("%s is not a string or number", strings.Join(path, "."))
+}
+
+func skipJSONValue(dec *json.Decoder) error {
+	var raw json.RawMessage
+	return dec.Decode(&raw)
+}
+
+// yamlValueSpan finds the scalar at path in a YAML document made of block
+// mappings, the layout of typical dev config files. Flow collections,
+// sequences, and multi-line scalars are not supported.
+func yamlValueSpan(data []byte, path []string) (valueSpan, error) {
+	offset := 0
+	var lines []string
+	var starts []int
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		lines = append(lines, line)
+		starts = append(starts, offset)
+		offset += len(line)
+	}
+
+	parentIndent, from := -1, 0
+	for depth, seg := range path {
+		childIndent, found := -1, -1
+		var rest string
+		for i := from; i < len(lines); i++ {
+			line := strings.TrimRight(lines[i], "\r\n")
+			trimmed := strings.TrimLeft(line, " ")
+			if trimmed == "" || trimmed[0] == '#' || trimmed == "---" {
+				continue
+			}
+			indent := len(line) - len(trimmed)
+			if indent <= parentIndent {
+				break
+			}
+			if childIndent < 0 {
+				childIndent = indent
+			}
+			if indent != childIndent {
+				continue
+			}
+			if key, after, ok := yamlKey(trimmed); ok && key == seg {
+				found, rest = i, after
+				break
+			}
+		}
+		if found < 0 {
+			return valueSpan{}, fmt.Errorf("%s not found", strings.Join(path[:depth+1], "."))
+		}
+		if depth < len(path)-1 {
+			parentIndent, from = childIndent, found+1
+			continue
+		}
+		line := strings.TrimRight(lines[found], "\r\n")
+		start, end, err := yamlScalar(rest)
+		if err != nil {
+			return valueSpan{}, fmt.Errorf("%s %w", strings.Join(path, "."), err)
+		}
+		base := starts[found] + len(line) - len(rest)
+		return valueSpan{start: base + start, end: base + end}, nil
+	}
+	return valueSpan{}, errors.New("empty path")
+}
+
+// yamlKey splits a mapping entry "key: value" into its key and the text
+// after the colon.
+func yamlKey(entry string) (key, rest string, ok bool) {
+	if entry[0] == '"' || entry[0] == '\'' {
+		end := strings.IndexByte(entry[1:], entry[0])
+		if end < 0 || !strings.HasPrefix(entry[end+2:], ":") {
+			return "", "", false
+		}
+		return entry[1 : end+1], entry[end+3:], true
+	}
+	for i := 0; i < len(entry); i++ {
+		if entry[i] == ':' && (i == len(entry)-1 || entry[i+1] == ' ' || entry[i+1] == '\t') {
+			return entry[:i], entry[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// yamlScalar returns the byte range of the plain or quoted scalar in rest,
+// excluding quotes and a trailing comment.
+func yamlScalar(rest string) (start, end int, err error) {
+	start = len(rest) - len(strings.TrimLeft(rest, " \t"))
+	value := rest[start:]
+	if value == "" || value[0] == '#' {
+		return 0, 0, errors.New("is not a scalar")
+	}
+	if q := value[0]; q == '"' || q == '\'' {
+		n := strings.IndexByte(value[1:], q)
+		if n < 0 {
+			return 0, 0, errors.New("has an unterminated quote")
+		}
+		return start + 1, start + 1 + n, nil
+	}
+	if value[0] == '{' || value[0] == '[' || value[0] == '|' || value[0] == '>' {
+		return 0, 0, errors.New("is not a plain scalar")
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = value[:i]
+	}
+	return start, start + len(strings.TrimRight(value, " \t")), nil
+}
+
+// skipLinkHost says why a value with host must not be rewritten, or ""
+// when it may be.
+func skipLinkHost(host string, patterns, services []string) string {
+	if host == "" {
+		return ""
+	}
+	if slices.Contains(services, host) {
+		return fmt.Sprintf("host %s is a compose service", host)
+	}
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, host); ok {
+			return fmt.Sprintf("host %s matches skip_hosts %q", host, pattern)
+		}
+	}
+	return ""
+}
+
+// linkHost returns the host of a URL or host:port value, or "" for a bare
+// port.
+func linkHost(value string) string {
+	if isDigits(value) {
+		return ""
+	}
+	authority := value
+	if _, after, ok := strings.Cut(value, "://"); ok {
+		authority = after
+		if i := strings.IndexAny(authority, "/?#"); i >= 0 {
+			authority = authority[:i]
+		}
+		if i := strings.LastIndexByte(authority, '@'); i >= 0 {
+			authority = authority[i+1:]
+		}
+	}
+	if host, _, err := net.SplitHostPort(authority); err == nil {
+		return host
+	}
+	return strings.Trim(authority, "[]")
+}
+
+// relinkPort replaces the port in value with p: the whole value when it
+// is a bare port, else the port after the host in a URL or host:port. A
+// URL without a port gets one.
+func relinkPort(value, p string) (string, error) {
+	if isDigits(value) {
+		return p, nil
+	}
+	authority, offset := value, 0
+	if _, after, ok := strings.Cut(value, "://"); ok {
+		offset = len(value) - len(after)
+		authority = after
+		if i := strings.IndexAny(authority, "/?#"); i >= 0 {
+			authority = authority[:i]
+		}
+		if i := strings.LastIndexByte(authority, '@'); i >= 0 {
+			offset += i + 1
+			authority = authority[i+1:]
+		}
+	}
+	colon := strings.LastIndexByte(authority, ':')
+	if colon >= 0 && isDigits(authority[colon+1:]) && !strings.Contains(authority[colon:], "]") {
+		at := offset + colon + 1
+		return value[:at] + p + value[at+len(authority)-colon-1:], nil
+	}
+	if offset == 0 {
+		return "", fmt.Errorf("no port in %q", value)
+	}
+	at := offset + len(authority)
+	return value[:at] + ":" + p + value[at:], nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
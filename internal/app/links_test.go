@@ -0,0 +1,199 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_Doctor_ChecksLinksOfAnotherProject(t *testing.T) {
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, "dev.yaml"), []byte("web:\n  url: http://localhost:3000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".env"), []byte("WEB_PORT=3000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Links: []config.Link{
+		{Key: "WEB_PORT", TargetFile: "dev.yaml", TargetPath: "web.url"},
+		{Key: "WEB_PORT", TargetFile: "dev.yaml", TargetPath: "api.url"},
+		{Key: "BILLING_PORT", TargetFile: "dev.yaml", TargetPath: "web.url"},
+	}}
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(cfg),
+		WithStdout(&stdout),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "doctor", Format: "json", CWD: t.TempDir(), Workdir: project}, nil)
+	if e, ok := err.(*ExitError); !ok || e.Code != 1 {
+		t.Fatalf("expected warning exit, got %v", err)
+	}
+	type check struct {
+		ID      string         `json:"id"`
+		Message string         `json:"message"`
+		Details map[string]any `json:"details"`
+	}
+	var payload struct {
+		Project string  `json:"project"`
+		Checks  []check `json:"checks"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	if payload.Project != project {
+		t.Fatalf("project = %q, want %q", payload.Project, project)
+	}
+	i := slices.IndexFunc(payload.Checks, func(c check) bool { return c.ID == "links.broken" })
+	if i < 0 {
+		t.Fatalf("links.broken missing: %s", stdout.String())
+	}
+	c := payload.Checks[i]
+	if !strings.Contains(c.Message, "link dev.yaml api.url: api not found") || !strings.Contains(c.Message, "link dev.yaml web.url: BILLING_PORT is not one of the project's keys") {
+		t.Fatalf("unexpected links check: %+v", c)
+	}
+	if broken, _ := c.Details["broken"].([]any); len(broken) != 2 {
+		t.Fatalf("broken = %v, want the two bad links", c.Details["broken"])
+	}
+}
+
+func TestApp_LinksRewritePortsInConfigFiles(t *testing.T) {
+	cwd := t.TempDir()
+	yamlDoc := "# dev services\nservices:\n  billing:\n    url: \"http://localhost:3000/api\" # billing\n    port: 3000\n  web:\n    url: http://localhost:3000\n"
+	jsonDoc := "{\n  \"upstreams\": [{\"url\": \"http://user@127.0.0.1:3000/x\"}],\n  \"port\": 3000\n}\n"
+	if err := os.WriteFile(filepath.Join(cwd, "dev.yaml"), []byte(yamlDoc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cwd, "dev.json"), []byte(jsonDoc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Links: []config.Link{
+		{Key: "WEB_PORT", TargetFile: "dev.yaml", TargetPath: "services.billing.url"},
+		{Key: "WEB_PORT", TargetFile: "dev.yaml", TargetPath: "services.billing.port"},
+		{Key: "WEB_PORT", TargetFile: "dev.json", TargetPath: "upstreams.0.url"},
+		{Key: "WEB_PORT", TargetFile: "dev.json", TargetPath: "port"},
+	}}
+	var stderr bytes.Buffer
+	app := New(
+		WithConfig(cfg),
+		WithStdout(io.Discard),
+		WithStderr(&stderr),
+		WithEnviron([]string{"WEB_PORT=3000"}),
+		WithExecutor(&MockExecutor{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	seed := uint32(0)
+	opts := Options{Mode: "run", Quiet: true, DryRun: true, Range: "10000-11000", CWD: cwd, Seed: &seed, Includes: []string{"WEB_PORT"}}
+	if err := app.Run(context.Background(), opts, []string{"svc"}); err != nil {
+		t.Fatalf("preview error: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "would rewrite dev.yaml services.billing.url: http://localhost:3000/api -> http://localhost:10000/api") {
+		t.Fatalf("preview output:\n%s", stderr.String())
+	}
+	if got, _ := os.ReadFile(filepath.Join(cwd, "dev.yaml")); string(got) != yamlDoc {
+		t.Fatalf("preview must not write, got %q", got)
+	}
+
+	opts.DryRun = false
+	if err := app.Run(context.Background(), opts, []string{"svc"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(cwd, "dev.yaml"))
+	if want := strings.Replace(strings.Replace(yamlDoc, "3000/api", "10000/api", 1), "port: 3000", "port: 10000", 1); string(got) != want {
+		t.Fatalf("dev.yaml = %q, want %q", got, want)
+	}
+	got, _ = os.ReadFile(filepath.Join(cwd, "dev.json"))
+	if want := strings.ReplaceAll(jsonDoc, "3000", "10000"); string(got) != want {
+		t.Fatalf("dev.json = %q, want %q", got, want)
+	}
+	if info, _ := os.Stat(filepath.Join(cwd, "dev.json")); info.Mode().Perm() != 0o600 {
+		t.Fatalf("rewriting changed the file mode to %v", info.Mode().Perm())
+	}
+
+	cfg.Links = []config.Link{{Key: "WEB_PORT", TargetFile: "dev.yaml", TargetPath: "services.api.url"}}
+	if err := app.Run(context.Background(), opts, []string{"svc"}); err == nil || !strings.Contains(err.Error(), "services.api not found") {
+		t.Fatalf("expected a missing path error, got %v", err)
+	}
+}
+
+func TestApp_LinksKeepContainerHosts(t *testing.T) {
+	cwd := t.TempDir()
+	yamlDoc := "upstreams:\n  api: http://api:8080\n  billing: http://billing.dev.svc.cluster.local:9000\n  web: http://localhost:3000\n"
+	files := map[string]string{
+		"dev.yaml":     yamlDoc,
+		"compose.yaml": "services:\n  api:\n    image: api\n    ports:\n      - \"8080\"\n  db:\n    image: postgres\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(cwd, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	skip := []string{"*.svc.cluster.local"}
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Links: []config.Link{
+		{Key: "WEB_PORT", TargetFile: "dev.yaml", TargetPath: "upstreams.api"},
+		{Key: "WEB_PORT", TargetFile: "dev.yaml", TargetPath: "upstreams.billing", SkipHosts: skip},
+		{Key: "WEB_PORT", TargetFile: "dev.yaml", TargetPath: "upstreams.web", SkipHosts: skip},
+	}}
+	var stderr bytes.Buffer
+	app := New(
+		WithConfig(cfg),
+		WithStdout(io.Discard),
+		WithStderr(&stderr),
+		WithEnviron([]string{"WEB_PORT=3000"}),
+		WithExecutor(&MockExecutor{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	seed := uint32(0)
+	opts := Options{Mode: "run", Quiet: true, DryRun: true, Range: "10000-11000", CWD: cwd, Seed: &seed, Includes: []string{"WEB_PORT"}}
+	if err := app.Run(context.Background(), opts, []string{"svc"}); err != nil {
+		t.Fatalf("preview error: %v", err)
+	}
+	for _, want := range []string{
+		"would keep dev.yaml upstreams.api: http://api:8080 (host api is a compose service)",
+		`would keep dev.yaml upstreams.billing: http://billing.dev.svc.cluster.local:9000 (host billing.dev.svc.cluster.local matches skip_hosts "*.svc.cluster.local")`,
+		"would rewrite dev.yaml upstreams.web: http://localhost:3000 -> http://localhost:10000",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Fatalf("preview output missing %q:\n%s", want, stderr.String())
+		}
+	}
+
+	opts.DryRun = false
+	if err := app.Run(context.Background(), opts, []string{"svc"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(cwd, "dev.yaml"))
+	if want := strings.Replace(yamlDoc, "localhost:3000", "localhost:10000", 1); string(got) != want {
+		t.Fatalf("dev.yaml = %q, want %q", got, want)
+	}
+}
+
+func TestRelinkPort(t *testing.T) {
+	cases := map[string]string{
+		"3000":                        "4000",
+		"localhost:3000":              "localhost:4000",
+		"http://localhost:3000/x?y=1": "http://localhost:4000/x?y=1",
+		"http://localhost/x":          "http://localhost:4000/x",
+		"postgres://u:p@db:5432/app":  "postgres://u:p@db:4000/app",
+		"http://[::1]:3000":           "http://[::1]:4000",
+		"http://[::1]/":               "http://[::1]:4000/",
+	}
+	for in, want := range cases {
+		if got, err := relinkPort(in, "4000"); err != nil || got != want {
+			t.Errorf("relinkPort(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := relinkPort("localhost", "4000"); err == nil {
+		t.Error("expected an error for a value without a port or scheme")
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gelleson/autoport/internal/env"
+)
+
+// mergeEnvFile sets the assigned ports in the existing env file named by
+// --merge-with, leaving every other byte of it as is. The merged file goes
+// to stdout, or replaces the file under --write; either way the changed
+// lines are previewed on stderr. With -n only the preview is printed.
+func (a *App) mergeEnvFile(opts Options, args []string, overrides map[string]string) error {
+	if len(args) > 0 {
+		return errors.New("--merge-with exports into a file; it does not run a command")
+	}
+	path := opts.MergeWith
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(opts.CWD, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("merge: %w", err)
+	}
+	merged, edits := env.Merge(string(data), overrides)
+	if opts.DryRun {
+		a.printMergeDiff(a.stdout, opts.MergeWith, edits)
+		return nil
+	}
+	if !opts.Quiet {
+		a.printMergeDiff(a.stderr, opts.MergeWith, edits)
+	}
+	if !opts.DocsWrite {
+		_, err := io.WriteString(a.stdout, merged)
+		return err
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("merge: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(merged), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("merge: %w", err)
+	}
+	return nil
+}
+
+// printMergeDiff prints the lines a merge changes in unified diff style,
+// one hunk per line; appended keys come last.
+func (a *App) printMergeDiff(w io.Writer, name string, edits []env.Edit) {
+	if len(edits) == 0 {
+		fmt.Fprintf(w, "%s is up to date\n", name)
+		return
+	}
+	fmt.Fprintf(w, "--- %s\n+++ %s (merged)\n", name, name)
+	appended := false
+	for _, e := range edits {
+		switch {
+		case e.Line > 0:
+			fmt.Fprintf(w, "@@ line %d @@\n-%s\n", e.Line, e.Old)
+		case !appended:
+			fmt.Fprintln(w, "@@ end @@")
+			appended = true
+		}
+		fmt.Fprintf(w, "+%s\n", e.New)
+	}
+}
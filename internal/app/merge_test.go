@@ -0,0 +1,68 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_MergeWithUpdatesEnvFile(t *testing.T) {
+	cwd := t.TempDir()
+	path := filepath.Join(cwd, ".env")
+	orig := "# local settings\nWEB_PORT=3000 # web\nSECRET='keep me'\n"
+	if err := os.WriteFile(path, []byte(orig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	run := func(opts Options) (string, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithStderr(&stderr),
+			WithEnviron([]string{}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		seed := uint32(0)
+		opts.Mode, opts.CWD, opts.Range, opts.Seed, opts.MergeWith = "run", cwd, "10000-11000", &seed, ".env"
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return stdout.String(), stderr.String()
+	}
+
+	stdout, stderr := run(Options{})
+	merged := "# local settings\nWEB_PORT=10001 # web\nSECRET='keep me'\nPORT=10000\n"
+	if stdout != merged {
+		t.Fatalf("merged output = %q, want %q", stdout, merged)
+	}
+	if !strings.Contains(stderr, "@@ line 2 @@\n-WEB_PORT=3000 # web\n+WEB_PORT=10001 # web\n") || !strings.Contains(stderr, "@@ end @@\n+PORT=10000\n") {
+		t.Fatalf("diff preview = %q", stderr)
+	}
+	if stdout, _ := run(Options{DryRun: true}); !strings.HasPrefix(stdout, "--- .env\n+++ .env (merged)\n") {
+		t.Fatalf("-n should print only the diff, got %q", stdout)
+	}
+	if data, _ := os.ReadFile(path); string(data) != orig {
+		t.Fatalf("file changed without --write: %q", data)
+	}
+
+	run(Options{DocsWrite: true, Quiet: true})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != merged {
+		t.Fatalf("written file = %q, want %q", data, merged)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Fatalf("file mode = %v, want 0600 kept", info.Mode().Perm())
+	}
+	if _, stderr := run(Options{DocsWrite: true}); stderr != ".env is up to date\n" {
+		t.Fatalf("second merge stderr = %q", stderr)
+	}
+}
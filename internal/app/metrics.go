@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/gelleson/autoport/internal/metrics"
+)
+
+// appMetrics are the counters served by --metrics.
+type appMetrics struct {
+	registry    *metrics.Registry
+	allocations *metrics.Counter
+	probes      *metrics.Counter
+	collisions  *metrics.Counter
+	leases      *metrics.Gauge
+	restarts    *metrics.Counter
+}
+
+func newAppMetrics() *appMetrics {
+	r := &metrics.Registry{}
+	return &appMetrics{
+		registry:    r,
+		allocations: r.NewCounter("autoport_allocations_total", "Ports allocated from the range."),
+		probes:      r.NewCounter("autoport_probes_total", "Busy ports skipped while allocating."),
+		collisions:  r.NewCounter("autoport_collisions_total", "Allocations whose preferred port was busy."),
+		leases:      r.NewGauge("autoport_active_leases", "Assigned ports held by a running command or proxy."),
+		restarts:    r.NewCounter("autoport_child_restarts_total", "Times the wrapped command was restarted."),
+	}
+}
+
+// recordAllocation counts one port allocated after probes busy ports.
+func (m *appMetrics) recordAllocation(probes int) {
+	m.allocations.Inc()
+	m.probes.Add(int64(probes))
+	if probes > 0 {
+		m.collisions.Inc()
+	}
+}
+
+// serveMetrics serves Prometheus metrics on addr until the returned func is
+// called.
+func (a *App) serveMetrics(addr string) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics listen: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", a.metrics.registry.Handler())
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Warn("metrics server stopped", slog.String("error", err.Error()))
+		}
+	}()
+	a.logger.Debug("serving metrics", slog.String("addr", "http://"+ln.Addr().String()+"/metrics"))
+	return func() { _ = srv.Shutdown(context.Background()) }, nil
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_MetricsEndpoint(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	// The command scrapes the metrics endpoint while it runs.
+	url, body := "http://"+addr+"/metrics", ""
+	probe := executorFunc(func(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+		resp, err := http.Get(url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		body = string(data)
+		return err
+	})
+	seed := uint32(0)
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"WEB_PORT=3000", "API_PORT=4000"}),
+		WithExecutor(probe),
+		WithIsFree(func(p int) bool { return p != 10000 }),
+	)
+	opts := Options{Mode: "run", Quiet: true, Range: "10000-11000", CWD: "/repo", Seed: &seed, Metrics: addr, Includes: []string{"API_PORT", "WEB_PORT"}}
+	if err := app.Run(context.Background(), opts, []string{"serve"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"autoport_allocations_total 2\n",
+		"autoport_probes_total 1\n",
+		"autoport_collisions_total 1\n",
+		"autoport_active_leases 2\n",
+		"# TYPE autoport_child_restarts_total counter\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("metrics lack %q:\n%s", want, body)
+		}
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Fatal("metrics server still running after Run returned")
+	}
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// Proquint letters: a 16-bit value spells as consonant, vowel, consonant,
+// vowel, consonant, so every port has exactly one pronounceable word.
+const (
+	proquintConsonants = "bdfghjklmnprstvz"
+	proquintVowels     = "aiou"
+)
+
+// proquint spells the 16-bit value v, e.g. 10000 as "fisib".
+func proquint(v uint16) string {
+	return string([]byte{
+		proquintConsonants[v>>12&0xf],
+		proquintVowels[v>>10&0x3],
+		proquintConsonants[v>>6&0xf],
+		proquintVowels[v>>4&0x3],
+		proquintConsonants[v&0xf],
+	})
+}
+
+// portMnemonics maps each override holding a port to its proquint
+// (--mnemonics). Values that are not ports, such as <KEY>_HOST addresses,
+// get none.
+func portMnemonics(overrides map[string]string) map[string]string {
+	out := map[string]string{}
+	for key, value := range overrides {
+		if p, err := strconv.Atoi(value); err == nil && p > 0 && p <= 65535 {
+			out[key] = proquint(uint16(p))
+		}
+	}
+	return out
+}
+
+// planMnemonic names a whole set of assignments with two proquints of a
+// hash of its ports: it stays the same as long as every key keeps its
+// port, so one word confirms the environment matches yesterday's.
+func planMnemonic(overrides map[string]string) string {
+	h := fnv.New32a()
+	ports := portMnemonics(overrides)
+	for _, key := range sortedKeys(ports) {
+		h.Write([]byte(key + "=" + overrides[key] + "\n"))
+	}
+	sum := h.Sum32()
+	return proquint(uint16(sum>>16)) + "-" + proquint(uint16(sum))
+}
+
+// assignedPorts maps each assignment's key to its port.
+func assignedPorts(assignments []assignedPort) map[string]string {
+	out := make(map[string]string, len(assignments))
+	for _, as := range assignments {
+		out[as.Key] = strconv.Itoa(as.Assigned)
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_MnemonicsInSummaryAndJSON(t *testing.T) {
+	run := func(opts Options, args []string) (string, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithExecutor(&MockExecutor{}),
+			WithStdout(&stdout),
+			WithStderr(&stderr),
+			WithEnviron([]string{"WEB_PORT=1", "DB_PORT=2"}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		seed := uint32(0)
+		opts.CWD, opts.Seed, opts.Range, opts.Mnemonics = "/test/path", &seed, "10000-10100", true
+		if err := app.Run(context.Background(), opts, args); err != nil {
+			t.Fatalf("Run() error: %v", err)
+		}
+		return stdout.String(), stderr.String()
+	}
+
+	_, summary := run(Options{}, []string{"npm", "start"})
+	if !strings.Contains(summary, "| WEB_PORT | 10002 | fisif    |") || !strings.Contains(summary, "| DB_PORT  | 10000 | fisib    |") {
+		t.Fatalf("missing mnemonic column:\n%s", summary)
+	}
+	stdout, _ := run(Options{Format: "json"}, nil)
+	var payload outputPayload
+	if err := json.Unmarshal([]byte(stdout), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	if payload.Mnemonic == "" || !strings.Contains(summary, "-> npm start ["+payload.Mnemonic+"]") {
+		t.Fatalf("set mnemonic = %q, summary:\n%s", payload.Mnemonic, summary)
+	}
+	if payload.Overrides[0].Key != "DB_PORT" || payload.Overrides[0].Mnemonic != "fisib" {
+		t.Fatalf("overrides = %+v", payload.Overrides)
+	}
+	stdout, _ = run(Options{Mode: "explain", Format: "json"}, nil)
+	var explained explainPayload
+	if err := json.Unmarshal([]byte(stdout), &explained); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	if explained.Mnemonic != payload.Mnemonic {
+		t.Fatalf("explain mnemonic = %q, want %q as in run output", explained.Mnemonic, payload.Mnemonic)
+	}
+}
+
+func TestProquint(t *testing.T) {
+	for v, want := range map[uint16]string{0: "babab", 10000: "fisib", 65535: "zuzuz"} {
+		if got := proquint(v); got != want {
+			t.Errorf("proquint(%d) = %q, want %q", v, got, want)
+		}
+	}
+}
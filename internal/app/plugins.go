@@ -0,0 +1,226 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/scanner"
+)
+
+// kindPlugin classifies keys reported by a Discoverer.
+const kindPlugin = "plugin"
+
+// pluginFormatPrefix selects a Formatter as the output format:
+// -f plugin:<name>.
+const pluginFormatPrefix = "plugin:"
+
+// PluginKey is a port key a Discoverer found.
+type PluginKey struct {
+	Key string `json:"key"`
+	// Value is the key's current value, if the source sets one.
+	Value string `json:"value,omitempty"`
+	// Source names where the key was found, such as a manifest path;
+	// explain shows it. It defaults to the discoverer's name.
+	Source string `json:"source,omitempty"`
+}
+
+// Discoverer is an extension that finds port keys where the scanner does
+// not look, such as a proprietary service manifest. Its keys join the
+// scanned ones and go through the same selection rules.
+type Discoverer interface {
+	Discover(ctx context.Context, cwd string) ([]PluginKey, error)
+}
+
+// FormatInput is what a Formatter renders.
+type FormatInput struct {
+	CWD       string            `json:"cwd"`
+	Range     string            `json:"range"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+// Formatter is an extension rendering the assignments in an output format
+// of its own, selected with -f plugin:<name>.
+type Formatter interface {
+	Format(ctx context.Context, w io.Writer, in FormatInput) error
+}
+
+// WithDiscoverer registers d under name. It takes precedence over a
+// config plugin of the same name.
+func WithDiscoverer(name string, d Discoverer) AppOption {
+	return func(a *App) {
+		if a.discoverers == nil {
+			a.discoverers = map[string]Discoverer{}
+		}
+		a.discoverers[name] = d
+	}
+}
+
+// WithFormatter registers f as the output format plugin:<name>. It takes
+// precedence over a config plugin of the same name.
+func WithFormatter(name string, f Formatter) AppOption {
+	return func(a *App) {
+		if a.formatters == nil {
+			a.formatters = map[string]Formatter{}
+		}
+		a.formatters[name] = f
+	}
+}
+
+// execPlugin is a config plugin: a command line run through the platform
+// shell with one argument, a JSON request, that answers on stdout.
+type execPlugin struct {
+	app  *App
+	line string
+}
+
+// pluginRequest is the argument an executable plugin receives.
+type pluginRequest struct {
+	// Kind is "discover" or "format".
+	Kind string `json:"kind"`
+	FormatInput
+}
+
+func (p execPlugin) call(ctx context.Context, req pluginRequest, stdout io.Writer) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	name, args := scriptCommand(p.line, []string{string(data)})
+	if err := p.app.executor.Run(ctx, name, args, p.app.environ, stdout, p.app.stderr); err != nil {
+		return fmt.Errorf("%q: %w", p.line, err)
+	}
+	return nil
+}
+
+// Discover expects {"keys": [{"key": ..., "value": ..., "source": ...}]}.
+func (p execPlugin) Discover(ctx context.Context, cwd string) ([]PluginKey, error) {
+	var out bytes.Buffer
+	if err := p.call(ctx, pluginRequest{Kind: "discover", FormatInput: FormatInput{CWD: cwd}}, &out); err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Keys []PluginKey `json:"keys"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("%q: invalid response: %w", p.line, err)
+	}
+	return resp.Keys, nil
+}
+
+// Format copies whatever the command prints.
+func (p execPlugin) Format(ctx context.Context, w io.Writer, in FormatInput) error {
+	return p.call(ctx, pluginRequest{Kind: "format", FormatInput: in}, w)
+}
+
+// discovererNames lists registered and config discoverers, sorted.
+func (a *App) discovererNames() []string {
+	names := make([]string, 0, len(a.discoverers)+len(a.config.Plugins.Discoverers))
+	for name := range a.discoverers {
+		names = append(names, name)
+	}
+	for name := range a.config.Plugins.Discoverers {
+		if _, ok := a.discoverers[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (a *App) discoverer(name string) Discoverer {
+	if d, ok := a.discoverers[name]; ok {
+		return d
+	}
+	return execPlugin{app: a, line: a.config.Plugins.Discoverers[name]}
+}
+
+// formatter returns the format plugin selected by format, if any.
+func (a *App) formatter(format string) (Formatter, bool, error) {
+	name, ok := strings.CutPrefix(format, pluginFormatPrefix)
+	if !ok {
+		return nil, false, nil
+	}
+	if f, ok := a.formatters[name]; ok {
+		return f, true, nil
+	}
+	if line, ok := a.config.Plugins.Formats[name]; ok {
+		return execPlugin{app: a, line: line}, true, nil
+	}
+	return nil, false, fmt.Errorf("unknown output format %q: no format plugin named %q", format, name)
+}
+
+// checkPlugins fails early on an unknown format plugin and asks before
+// running plugin commands from untrusted config files.
+func (a *App) checkPlugins(opts Options) error {
+	if _, _, err := a.formatter(opts.Format); err != nil {
+		return err
+	}
+	if a.replaying == nil {
+		for _, name := range a.discovererNames() {
+			if _, ok := a.discoverers[name]; ok {
+				continue
+			}
+			if err := a.confirmCommands(opts, a.config.Origin("plugins.discoverers."+name), []string{a.config.Plugins.Discoverers[name]}); err != nil {
+				return err
+			}
+		}
+	}
+	name, ok := strings.CutPrefix(opts.Format, pluginFormatPrefix)
+	if _, registered := a.formatters[name]; ok && !registered {
+		return a.confirmCommands(opts, a.config.Origin("plugins.formats."+name), []string{a.config.Plugins.Formats[name]})
+	}
+	return nil
+}
+
+// discoverPlugins adds the keys each discoverer reports to discoveries.
+// A key the scanner already found keeps its discovery, unless that is
+// only the default PORT.
+func (a *App) discoverPlugins(ctx context.Context, cwd string, res resolvedOptions, discoveries []scanner.Discovery) ([]scanner.Discovery, error) {
+	names := a.discovererNames()
+	if len(names) == 0 {
+		return discoveries, nil
+	}
+	found := make(map[string]int, len(discoveries))
+	for i, d := range discoveries {
+		found[d.Key] = i
+	}
+	for _, name := range names {
+		keys, err := a.discoverer(name).Discover(ctx, cwd)
+		if err != nil {
+			return nil, fmt.Errorf("discoverer %s: %w", name, err)
+		}
+		for _, k := range keys {
+			if !isValidEnvVarName(k.Key) {
+				return nil, fmt.Errorf("discoverer %s: invalid env key %q", name, k.Key)
+			}
+			d := scanner.Discovery{Key: k.Key, Source: k.Source, Kind: kindPlugin, Value: k.Value}
+			if d.Source == "" {
+				d.Source = name
+			}
+			for _, prefix := range res.Ignores {
+				if strings.HasPrefix(d.Key, prefix) {
+					d.IgnoredBy = prefix
+					break
+				}
+			}
+			if d.IgnoredBy != "" && !res.KeepIgnored {
+				continue
+			}
+			i, ok := found[d.Key]
+			switch {
+			case !ok:
+				found[d.Key] = len(discoveries)
+				discoveries = append(discoveries, d)
+			case discoveries[i].Kind == scanner.KindDefault:
+				discoveries[i] = d
+			}
+		}
+	}
+	slices.SortFunc(discoveries, func(x, y scanner.Discovery) int { return strings.Compare(x.Key, y.Key) })
+	return discoveries, nil
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+// manifestDiscoverer reports fixed keys, as a manifest reader would.
+type manifestDiscoverer []PluginKey
+
+func (m manifestDiscoverer) Discover(ctx context.Context, cwd string) ([]PluginKey, error) {
+	return m, nil
+}
+
+// helmFormatter renders overrides as Helm values lines.
+type helmFormatter struct{}
+
+func (helmFormatter) Format(ctx context.Context, w io.Writer, in FormatInput) error {
+	for _, key := range sortedKeys(in.Overrides) {
+		fmt.Fprintf(w, "%s: %s\n", strings.ToLower(key), in.Overrides[key])
+	}
+	return nil
+}
+
+func TestApp_PluginsDiscoverKeysAndFormatOutput(t *testing.T) {
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+		WithDiscoverer("manifest", manifestDiscoverer{{Key: "BILLING_GRPC", Source: "services.toml"}, {Key: "PORT", Value: "8080"}}),
+		WithFormatter("helm", helmFormatter{}),
+	)
+	seed := uint32(0)
+	opts := Options{Mode: "run", CWD: "/repo", Range: "10000-10100", Seed: &seed, Format: "plugin:helm"}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if stdout.String() != "billing_grpc: 10000\nport: 10001\n" {
+		t.Fatalf("helm output = %q", stdout.String())
+	}
+
+	stdout.Reset()
+	opts.Mode, opts.Format = "explain", "json"
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload explainPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	if len(payload.Keys) != 2 || payload.Keys[0].Source != "services.toml" || payload.Keys[1].Source != "manifest" || payload.Keys[1].Kind != kindPlugin {
+		t.Fatalf("keys = %+v, want the manifest keys with PORT replacing the default", payload.Keys)
+	}
+
+	opts.Mode, opts.Format = "run", "plugin:xml"
+	if err := app.Run(context.Background(), opts, nil); err == nil || !strings.Contains(err.Error(), "no format plugin") {
+		t.Fatalf("expected an unknown format plugin error, got %v", err)
+	}
+}
+
+func TestApp_ExecutablePlugins(t *testing.T) {
+	// The plugins answer requests with canned stdout.
+	responses := map[string]string{
+		"discover": `{"keys": [{"key": "ADMIN_PORT", "source": "catalog"}]}`,
+		"format":   "custom output\n",
+	}
+	var requests []string
+	exec := executorFunc(func(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+		req := args[len(args)-1]
+		requests = append(requests, req)
+		var r pluginRequest
+		if err := json.Unmarshal([]byte(req), &r); err != nil {
+			return err
+		}
+		_, err := io.WriteString(stdout, responses[r.Kind])
+		return err
+	})
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Plugins: config.PluginsConfig{
+		Discoverers: map[string]string{"catalog": "catalog-ports"},
+		Formats:     map[string]string{"custom": "render-ports --flag"},
+	}}
+	var stdout bytes.Buffer
+	app := New(WithConfig(cfg), WithExecutor(exec), WithStdout(&stdout), WithEnviron([]string{}), WithIsFree(func(p int) bool { return true }))
+	seed := uint32(0)
+	opts := Options{Mode: "run", CWD: "/repo", Range: "10000-10100", Seed: &seed, Format: "plugin:custom"}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if stdout.String() != "custom output\n" {
+		t.Fatalf("stdout = %q", stdout.String())
+	}
+	if len(requests) != 2 || requests[0] != `{"kind":"discover","cwd":"/repo","range":"","overrides":null}` {
+		t.Fatalf("requests = %q", requests)
+	}
+	var req pluginRequest
+	if err := json.Unmarshal([]byte(requests[1]), &req); err != nil || req.Kind != "format" || req.Overrides["ADMIN_PORT"] == "" || req.Range != "10000-10100" {
+		t.Fatalf("format request = %q (%v)", requests[1], err)
+	}
+
+	cfg.Origins = map[string]string{"plugins.discoverers.catalog": "/repo/.autoport.json"}
+	app = New(WithConfig(cfg), WithExecutor(exec), WithStdout(io.Discard), WithStderr(io.Discard), WithStdin(strings.NewReader("n\n")), WithEnviron([]string{}))
+	if err := app.Run(context.Background(), opts, nil); err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Fatalf("an untrusted plugin should need confirmation, got %v", err)
+	}
+}
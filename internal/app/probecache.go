@@ -0,0 +1,63 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+// DefaultProbeTTL is how long long-running modes reuse a port check
+// outcome by default (--probe-ttl).
+const DefaultProbeTTL = 5 * time.Second
+
+// probeCache remembers port check outcomes for ttl. Long-running modes
+// recompute plans on every query; without it each recomputation binds
+// every candidate port again, and a server restarting on one of them can
+// find its port briefly held by autoport's probe. Outcomes are refreshed
+// lazily: an expired entry is checked again the next time it is needed.
+type probeCache struct {
+	ttl   time.Duration
+	now   func() time.Time
+	check checkFunc
+
+	mu   sync.Mutex
+	seen map[probeKey]probeOutcome
+}
+
+// probeKey is one check: a port for a protocol.
+type probeKey struct {
+	proto port.Protocol
+	port  int
+}
+
+type probeOutcome struct {
+	free bool
+	at   time.Time
+}
+
+func (c *probeCache) isFree(proto port.Protocol, p int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	key := probeKey{proto, p}
+	if o, ok := c.seen[key]; ok && now.Sub(o.at) < c.ttl {
+		return o.free
+	}
+	free := c.check(proto, p)
+	c.seen[key] = probeOutcome{free: free, at: now}
+	return free
+}
+
+// cacheProbes routes port checks through a probeCache with ttl until the
+// returned func restores the previous checker. A ttl of zero or less
+// leaves every check live.
+func (a *App) cacheProbes(ttl time.Duration) func() {
+	if ttl <= 0 {
+		return func() {}
+	}
+	isFree := a.isFree
+	c := &probeCache{ttl: ttl, now: a.now, check: isFree, seen: map[probeKey]probeOutcome{}}
+	a.isFree = c.isFree
+	return func() { a.isFree = isFree }
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+func TestApp_IDEServeCachesProbes(t *testing.T) {
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, ".env"), []byte("WEB_PORT=3000\nAPI_PORT=4000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	query := `{"jsonrpc":"2.0","id":1,"method":"assignments","params":{"cwd":"` + project + `"}}`
+	probes := map[int]int{}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdin(strings.NewReader(query+"\n"+query+"\n")),
+		WithStdout(io.Discard),
+		WithEnviron([]string{}),
+		WithClock(func() time.Time { return now }),
+		WithIsFree(func(p int) bool { probes[p]++; return p%2 == 0 }),
+	)
+	if err := app.Run(context.Background(), Options{Mode: "ide", CWD: project, Range: "10000-10100", ProbeTTL: time.Minute}, nil); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(probes) == 0 {
+		t.Fatal("no ports were probed")
+	}
+	for p, n := range probes {
+		if n != 1 {
+			t.Fatalf("port %d probed %d times across two queries, want once", p, n)
+		}
+	}
+
+	// Expired outcomes are checked again, and restoring drops the cache.
+	calls := 0
+	app.isFree = func(port.Protocol, int) bool { calls++; return true }
+	restore := app.cacheProbes(time.Second)
+	app.isFree("", 10000)
+	app.isFree("", 10000)
+	app.isFree(port.UDP, 10000)
+	now = now.Add(2 * time.Second)
+	app.isFree("", 10000)
+	restore()
+	app.isFree("", 10000)
+	if calls != 4 {
+		t.Fatalf("checks = %d, want 4: protocols are cached apart", calls)
+	}
+}
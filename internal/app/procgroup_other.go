@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package app
+
+import "os/exec"
+
+// startGroup is not implemented on this platform; only the command itself
+// is stopped.
+func startGroup(cmd *exec.Cmd) (started, done func()) {
+	return func() {}, func() {}
+}
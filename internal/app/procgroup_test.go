@@ -0,0 +1,53 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultExecutor_StopsDescendants(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads process state from /proc")
+	}
+	alive := func(pid string) bool {
+		stat, err := os.ReadFile("/proc/" + pid + "/stat")
+		if err != nil {
+			return false
+		}
+		_, rest, _ := strings.Cut(string(stat), ") ")
+		return !strings.HasPrefix(rest, "Z")
+	}
+	spawn := func(executor DefaultExecutor) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		if err := executor.Run(context.Background(), "sh", []string{"-c", "sleep 30 >/dev/null 2>&1 & echo $!"}, os.Environ(), &stdout, io.Discard); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return strings.TrimSpace(stdout.String())
+	}
+
+	pid := spawn(DefaultExecutor{})
+	deadline := time.Now().Add(2 * time.Second)
+	for alive(pid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if alive(pid) {
+		t.Fatalf("background process %s outlived the command", pid)
+	}
+
+	pid = spawn(DefaultExecutor{NoProcessGroup: true})
+	if !alive(pid) {
+		t.Fatalf("with NoProcessGroup the background process %s should be left alone", pid)
+	}
+	n, _ := strconv.Atoi(pid)
+	if p, err := os.FindProcess(n); err == nil {
+		p.Kill()
+	}
+}
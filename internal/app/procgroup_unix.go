@@ -0,0 +1,65 @@
+//go:build linux || darwin
+
+package app
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// groupStopDelay is how long a stopped command's process group gets to
+// exit after SIGTERM before the command is killed.
+const groupStopDelay = 5 * time.Second
+
+// startGroup runs cmd in a process group of its own, so stopping it and
+// the cleanup after it reach every descendant. When autoport owns the
+// terminal, the group takes it over for the command's lifetime so Ctrl-C
+// and terminal input go to the command as before. It must be called
+// before cmd starts; the returned function is called after it exits.
+func startGroup(cmd *exec.Cmd) (started, done func()) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	tty := os.Stdin.Fd()
+	foreground := ttyForeground(tty) == int32(syscall.Getpgrp())
+	if foreground {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = int(tty)
+	}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = groupStopDelay
+	started = func() {}
+	done = func() {
+		if cmd.Process == nil {
+			return
+		}
+		// Descendants that outlived the command would keep its ports busy.
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+		if foreground {
+			setTTYForeground(tty, int32(syscall.Getpgrp()))
+		}
+	}
+	return started, done
+}
+
+// ttyForeground returns the foreground process group of the terminal
+// behind fd, or -1 when fd is not a terminal.
+func ttyForeground(fd uintptr) int32 {
+	pgrp := int32(-1)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgrp))); errno != 0 {
+		return -1
+	}
+	return pgrp
+}
+
+// setTTYForeground hands the terminal behind fd back to pgrp. autoport is a
+// background process at that point, so SIGTTOU is ignored for the call.
+func setTTYForeground(fd uintptr, pgrp int32) {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&pgrp)))
+}
@@ -0,0 +1,79 @@
+//go:build windows
+
+package app
+
+import (
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObject          = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+)
+
+const (
+	jobObjectExtendedLimitInformation = 9
+	jobObjectLimitKillOnJobClose      = 0x2000
+	processSetQuota                   = 0x0100
+	processTerminate                  = 0x0001
+)
+
+type jobBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type jobExtendedLimitInformation struct {
+	BasicLimitInformation jobBasicLimitInformation
+	IoInfo                [6]uint64
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// startGroup places the command in a Job Object that kills every process
+// in it when closed, so descendants do not outlive the command. It must be
+// called before cmd starts; started is called right after, and done after
+// the command exits. Processes the command starts before it joins the job
+// are not covered.
+func startGroup(cmd *exec.Cmd) (started, done func()) {
+	var job syscall.Handle
+	started = func() {
+		// Best effort: without a job the command still runs, and only it is
+		// stopped.
+		h, _, _ := procCreateJobObject.Call(0, 0)
+		if h == 0 {
+			return
+		}
+		job = syscall.Handle(h)
+		info := jobExtendedLimitInformation{}
+		info.BasicLimitInformation.LimitFlags = jobObjectLimitKillOnJobClose
+		if ok, _, _ := procSetInformationJobObject.Call(h, jobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info)); ok == 0 {
+			return
+		}
+		process, err := syscall.OpenProcess(processSetQuota|processTerminate, false, uint32(cmd.Process.Pid))
+		if err != nil {
+			return
+		}
+		defer syscall.CloseHandle(process)
+		procAssignProcessToJobObject.Call(h, uintptr(process))
+	}
+	done = func() {
+		if job != 0 {
+			syscall.CloseHandle(job)
+		}
+	}
+	return started, done
+}
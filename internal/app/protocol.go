@@ -0,0 +1,33 @@
+package app
+
+import "github.com/gelleson/autoport/pkg/port"
+
+// protocolFor returns the protocol key's port is checked for: its entry
+// in the config's protocols, else --probe's. Empty means the default
+// check, one TCP bind.
+func (a *App) protocolFor(key string) port.Protocol {
+	if proto, ok := a.config.Protocols[key]; ok {
+		return port.Protocol(proto)
+	}
+	return a.protocol
+}
+
+// checkFunc reports whether port p is free for proto. The empty protocol
+// is the default check, one TCP bind; any explicit protocol binds the IPv4
+// and IPv6 wildcard and loopback addresses (or the loopback alias) one by
+// one. The App's checker is one, so --pure, reservations, the probe cache,
+// and --record/--replay apply to every protocol alike.
+type checkFunc func(proto port.Protocol, p int) bool
+
+// checkFor returns the port check for proto.
+func (a *App) checkFor(proto port.Protocol) port.IsFreeFunc {
+	return func(p int) bool { return a.isFree(proto, p) }
+}
+
+// defaultCheck binds on the probe host for proto.
+func (a *App) defaultCheck(proto port.Protocol, p int) bool {
+	if proto == "" {
+		return port.IsFreeOn(a.probeHost, p)
+	}
+	return port.IsFreeFor(proto, a.probeHost, p)
+}
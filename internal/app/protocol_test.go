@@ -0,0 +1,59 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+func TestApp_ProtocolsCheckUDPPerKey(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer udp.Close()
+	held := udp.LocalAddr().(*net.UDPAddr).Port
+	if !port.IsFreeFor(port.TCP, "", held) || held > 65000 {
+		t.Skipf("TCP port %d is busy", held)
+	}
+	run := func(protocols map[string]string, probe string, flags ...string) (int, error) {
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}, Protocols: protocols}),
+			WithStdout(&stdout),
+			WithStderr(io.Discard),
+			WithEnviron([]string{"DNS_PORT=53"}),
+		)
+		seed := uint32(0)
+		opts := Options{Mode: "run", Range: fmt.Sprintf("%d-%d", held, held+20), Seed: &seed, CWD: "/work/resolver", Format: "dotenv", Probe: probe, Pure: slices.Contains(flags, "--pure")}
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(envValue(strings.Split(strings.TrimSpace(stdout.String()), "\n"), "DNS_PORT"))
+	}
+
+	if p, err := run(nil, ""); err != nil || p != held {
+		t.Fatalf("DNS_PORT = %d, %v; the default TCP check should take %d", p, err, held)
+	}
+	if p, err := run(map[string]string{"DNS_PORT": "udp"}, ""); err != nil || p == held {
+		t.Fatalf("DNS_PORT = %d, %v; a udp key should skip %d", p, err, held)
+	}
+	if p, err := run(nil, "both"); err != nil || p == held {
+		t.Fatalf("DNS_PORT = %d, %v; --probe both should skip %d", p, err, held)
+	}
+	if p, err := run(nil, "udp", "--pure"); err != nil || p != held {
+		t.Fatalf("DNS_PORT = %d, %v; --pure --probe udp should keep %d", p, err, held)
+	}
+	if _, err := run(nil, "sctp"); err == nil || !strings.Contains(err.Error(), "--probe: unknown protocol") {
+		t.Fatalf("--probe sctp = %v, want an error", err)
+	}
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gelleson/autoport/internal/lockfile"
+	"github.com/gelleson/autoport/internal/scanner"
+)
+
+// provenanceVersion is the schema version of --provenance files.
+const provenanceVersion = 1
+
+// provenance lists every file and environment variable autoport read to
+// reach a plan, written before any command runs so it can be audited.
+type provenance struct {
+	Version     int              `json:"version"`
+	GeneratedAt string           `json:"generated_at"`
+	CWD         string           `json:"cwd"`
+	Files       []provenanceFile `json:"files"`
+	Env         []provenanceEnv  `json:"env"`
+	Assignments map[string]int   `json:"assignments"`
+}
+
+// provenanceFile is a file read while planning, with the SHA-256 of its
+// contents at the time of the run.
+type provenanceFile struct {
+	Path string `json:"path"`
+	// Role is config, env_file, compose_env, task_file, lockfile,
+	// snapshot, or reservations.
+	Role   string   `json:"role"`
+	SHA256 string   `json:"sha256,omitempty"`
+	Keys   []string `json:"keys,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// provenanceEnv is an environment variable read while planning: a port
+// key's current value (role port_key) or an AUTOPORT_* variable standing
+// in for a flag (role option).
+type provenanceEnv struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Option string `json:"option,omitempty"`
+}
+
+// fileRoles names the provenance role of each scanner discovery kind that
+// comes from a file.
+var fileRoles = map[string]string{
+	scanner.KindApp:     "env_file",
+	scanner.KindCompose: "compose_env",
+	scanner.KindTask:    "task_file",
+}
+
+// writeProvenance stores the provenance of p at path.
+func (a *App) writeProvenance(path string, opts Options, p *plan) error {
+	pv := provenance{
+		Version:     provenanceVersion,
+		GeneratedAt: a.now().UTC().Format(time.RFC3339),
+		CWD:         opts.CWD,
+		Files:       []provenanceFile{},
+		Env:         []provenanceEnv{},
+		Assignments: make(map[string]int, len(p.Assignments)),
+	}
+	for _, as := range p.Assignments {
+		pv.Assignments[as.Key] = as.Assigned
+	}
+
+	for _, file := range a.config.Files {
+		pv.Files = append(pv.Files, a.provenanceFile(file, "config", false))
+	}
+	scanned := map[string]*provenanceFile{}
+	for _, d := range p.Decisions {
+		if d.Kind == scanner.KindEnvironment {
+			pv.Env = append(pv.Env, provenanceEnv{Name: d.Key, Role: "port_key"})
+			continue
+		}
+		role, ok := fileRoles[d.Kind]
+		if !ok {
+			continue
+		}
+		f, ok := scanned[d.Source]
+		if !ok {
+			pf := a.provenanceFile(filepath.Join(opts.CWD, d.Source), role, true)
+			f = &pf
+			scanned[d.Source] = f
+		}
+		f.Keys = append(f.Keys, d.Key)
+	}
+	for _, f := range scanned {
+		sort.Strings(f.Keys)
+		pv.Files = append(pv.Files, *f)
+	}
+	if opts.UseLock {
+		pv.Files = append(pv.Files, a.provenanceFile(lockfile.PathFor(opts.CWD), "lockfile", true))
+	}
+	if opts.FromSnapshot != "" {
+		pv.Files = append(pv.Files, a.provenanceFile(opts.FromSnapshot, "snapshot", false))
+	}
+	if path := a.reservationsPath(); path != "" && !opts.Pure {
+		pv.Files = append(pv.Files, a.provenanceFile(path, "reservations", false))
+	}
+	sort.SliceStable(pv.Files, func(i, j int) bool { return pv.Files[i].Path < pv.Files[j].Path })
+
+	for option, origin := range opts.Origins {
+		if name, ok := strings.CutPrefix(origin, "env "); ok {
+			pv.Env = append(pv.Env, provenanceEnv{Name: name, Role: "option", Option: option})
+		}
+	}
+	sort.Slice(pv.Env, func(i, j int) bool { return pv.Env[i].Name < pv.Env[j].Name })
+
+	data, err := json.MarshalIndent(pv, "", "  ")
+	if err != nil {
+		return fmt.Errorf("provenance: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("provenance: %w", err)
+	}
+	return nil
+}
+
+// provenanceFile hashes the file at path. Project files are read through
+// the App's file system, the others from the OS.
+func (a *App) provenanceFile(path, role string, project bool) provenanceFile {
+	f := provenanceFile{Path: path, Role: role}
+	var data []byte
+	var err error
+	if project && a.fsys != nil {
+		data, err = fs.ReadFile(a.fsys, fsName(path))
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		f.Error = err.Error()
+		return f
+	}
+	sum := sha256.Sum256(data)
+	f.SHA256 = hex.EncodeToString(sum[:])
+	return f
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_ProvenanceListsFilesAndEnvBeforeRunning(t *testing.T) {
+	dir := t.TempDir()
+	envFile := []byte("WEB_PORT=3000\nAPI_PORT=4000\n")
+	if err := os.WriteFile(filepath.Join(dir, ".env"), envFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfgPath := filepath.Join(dir, ".autoport.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"key_order": ["WEB_PORT"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "provenance.json")
+	var sawProvenance bool
+	app := New(
+		WithConfig(config.Load([]string{cfgPath})),
+		WithExecutor(executorFunc(func(context.Context, string, []string, []string, io.Writer, io.Writer) error {
+			_, err := os.Stat(out)
+			sawProvenance = err == nil
+			return nil
+		})),
+		WithStdout(io.Discard),
+		WithEnviron([]string{"PORT=1", "SECRET=hunter2"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts := Options{Mode: "run", Range: "10000-10100", CWD: dir, Provenance: out, Quiet: true, Origins: map[string]string{"range": "env AUTOPORT_RANGE"}}
+	if err := app.Run(context.Background(), opts, []string{"true"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if !sawProvenance {
+		t.Fatal("provenance was not written before the command started")
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pv provenance
+	if err := json.Unmarshal(data, &pv); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(envFile)
+	wantFiles := []provenanceFile{
+		{Path: cfgPath, Role: "config", SHA256: pv.Files[0].SHA256},
+		{Path: filepath.Join(dir, ".env"), Role: "env_file", SHA256: hex.EncodeToString(sum[:]), Keys: []string{"API_PORT", "WEB_PORT"}},
+	}
+	if !reflect.DeepEqual(pv.Files, wantFiles) || pv.Files[0].SHA256 == "" {
+		t.Fatalf("files = %+v, want %+v", pv.Files, wantFiles)
+	}
+	wantEnv := []provenanceEnv{{Name: "AUTOPORT_RANGE", Role: "option", Option: "range"}, {Name: "PORT", Role: "port_key"}}
+	if !reflect.DeepEqual(pv.Env, wantEnv) {
+		t.Fatalf("env = %+v, want %+v", pv.Env, wantEnv)
+	}
+	if len(pv.Assignments) != 3 || bytes.Contains(data, []byte("hunter2")) {
+		t.Fatalf("unexpected provenance:\n%s", data)
+	}
+}
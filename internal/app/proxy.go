@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/gelleson/autoport/internal/proxy"
+)
+
+// DefaultProxyListen is the address `autoport proxy` listens on by default.
+const DefaultProxyListen = "127.0.0.1:8080"
+
+// runProxy serves stable "<key>.<project>.localhost" host names for the
+// assigned ports until ctx is cancelled.
+func (a *App) runProxy(ctx context.Context, opts Options, assignments []assignedPort) error {
+	ports := make(map[string]int, len(assignments))
+	for _, as := range assignments {
+		ports[as.Key] = as.Assigned
+	}
+	routes := proxy.Routes(filepath.Base(opts.CWD), ports)
+
+	listen := opts.Listen
+	if listen == "" {
+		listen = DefaultProxyListen
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(a.stderr, "autoport proxy listening on http://%s\n", listen)
+		for _, r := range routes {
+			fmt.Fprintf(a.stderr, "  http://%s -> 127.0.0.1:%d (%s)\n", r.Host, r.Port, r.Key)
+		}
+	}
+	a.metrics.leases.Set(int64(len(routes)))
+	defer a.metrics.leases.Set(0)
+	return proxy.Serve(ctx, listen, routes)
+}
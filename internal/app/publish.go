@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gelleson/autoport/internal/mdns"
+)
+
+// mdnsServiceType is the DNS-SD service type used for advertised keys.
+const mdnsServiceType = "_autoport._tcp"
+
+// mdnsServices maps each override to a "<project>-<key>" service instance.
+func mdnsServices(cwd string, overrides map[string]string) []mdns.Service {
+	project := filepath.Base(cwd)
+	services := make([]mdns.Service, 0, len(overrides))
+	for _, key := range sortedKeys(overrides) {
+		p, err := strconv.Atoi(overrides[key])
+		if err != nil {
+			continue
+		}
+		services = append(services, mdns.Service{
+			Instance: mdns.Label(project + "-" + key),
+			Type:     mdnsServiceType,
+			Port:     p,
+			Text:     []string{"project=" + project, "key=" + key},
+		})
+	}
+	return services
+}
+
+// startPublishing advertises assignments while the command runs when --mdns
+// is set. The returned function withdraws them and waits for the goodbye.
+func (a *App) startPublishing(ctx context.Context, opts Options, overrides map[string]string) func() {
+	if !opts.MDNS || a.publish == nil {
+		return func() {}
+	}
+	services := mdnsServices(opts.CWD, overrides)
+	pubCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := a.publish(pubCtx, services); err != nil {
+			a.logger.Warn("mdns publication failed", slog.String("error", err.Error()))
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
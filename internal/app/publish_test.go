@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/internal/mdns"
+)
+
+func TestApp_Run_MDNSPublishesWhileCommandRuns(t *testing.T) {
+	var published []mdns.Service
+	stopped := false
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(&MockExecutor{}),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"WEB_PORT=3000"}),
+		WithIsFree(func(p int) bool { return true }),
+		WithPublisher(func(ctx context.Context, services []mdns.Service) error {
+			published = services
+			<-ctx.Done()
+			stopped = true
+			return nil
+		}),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "run", Range: "10000-11000", CWD: "/work/shop", Quiet: true, MDNS: true}, []string{"npm", "start"})
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if !stopped {
+		t.Fatal("expected publisher to be stopped after the command exits")
+	}
+	if len(published) != 2 || published[1].Instance != "shop-web-port" || published[1].Type != "_autoport._tcp" {
+		t.Fatalf("unexpected services: %+v", published)
+	}
+}
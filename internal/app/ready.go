@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// DefaultHealthyTimeout bounds how long a wrapped command may take to pass
+// its configured health checks when --healthy-timeout is not set.
+const DefaultHealthyTimeout = time.Minute
+
+// healthPollInterval is the delay between readiness probes.
+const healthPollInterval = 100 * time.Millisecond
+
+// healthTarget is one configured health check URL for an assigned key.
+type healthTarget struct {
+	key string
+	url string
+}
+
+// healthTargets lists the config's health checks for keys that have an
+// assignment, sorted by key.
+func (a *App) healthTargets(overrides map[string]string) []healthTarget {
+	var targets []healthTarget
+	for key, path := range a.config.Health {
+		if p, ok := overrides[key]; ok {
+			host := "localhost"
+			if h := overrides[key+hostSuffix]; h != "" {
+				host = h
+			}
+			targets = append(targets, healthTarget{key: key, url: "http://" + net.JoinHostPort(host, p) + path})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].key < targets[j].key })
+	return targets
+}
+
+// startReadiness begins polling the config's health URLs for the command
+// about to run. The returned context stops the command when a key is not
+// ready in time; stop ends the polling and returns that readiness error, if
+// it is what stopped the command.
+func (a *App) startReadiness(ctx context.Context, opts Options, overrides map[string]string) (context.Context, func() error) {
+	targets := a.healthTargets(overrides)
+	if len(targets) == 0 {
+		return ctx, func() error { return nil }
+	}
+	runCtx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.watchReadiness(runCtx, opts, targets, cancel)
+	}()
+	return runCtx, func() error {
+		var err error
+		if runCtx.Err() != nil && ctx.Err() == nil {
+			err = context.Cause(runCtx)
+		}
+		cancel(nil)
+		<-done
+		return err
+	}
+}
+
+// watchReadiness polls the configured health URLs while the command runs,
+// reporting each key as it answers with a non-error status. When a key is
+// not ready within the timeout, cancel is called with the error, which
+// stops the command. It returns when every key is ready, the timeout hits,
+// or ctx is done.
+func (a *App) watchReadiness(ctx context.Context, opts Options, targets []healthTarget, cancel context.CancelCauseFunc) {
+	timeout := opts.HealthyTimeout
+	if timeout <= 0 {
+		timeout = DefaultHealthyTimeout
+	}
+	start := a.now()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+	client := &http.Client{Timeout: healthPollInterval * 10}
+
+	pending := targets
+	for {
+		next := pending[:0:0]
+		for _, t := range pending {
+			if !probeHealthy(ctx, client, t.url) {
+				next = append(next, t)
+				continue
+			}
+			if !opts.Quiet {
+				fmt.Fprintf(a.stderr, "autoport: %s ready at %s (%s)\n", t.key, t.url, a.now().Sub(start).Round(10*time.Millisecond))
+			}
+		}
+		pending = next
+		if len(pending) == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline.C:
+			t := pending[0]
+			cancel(fmt.Errorf("%s not healthy at %s after %s (--healthy-timeout)", t.key, t.url, timeout))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeHealthy reports whether url answers with a status below 400.
+func probeHealthy(ctx context.Context, client *http.Client, url string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 400
+}
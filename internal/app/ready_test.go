@@ -0,0 +1,63 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_HealthPathsReportReadiness(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+	port := srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+
+	run := func(opts Options, hold time.Duration) (string, error) {
+		var stderr bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}, Health: map[string]string{"API_PORT": "/healthz", "WORKER_PORT": "/"}}),
+			WithExecutor(blockingExecutor(hold)),
+			WithStdout(io.Discard),
+			WithStderr(&stderr),
+			WithEnviron([]string{"API_PORT=3000"}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.Mode = "run"
+		opts.Range = port + "-" + port
+		opts.CWD = "/work/shop"
+		err := app.Run(context.Background(), opts, []string{"npm", "start"})
+		return stderr.String(), err
+	}
+
+	out, err := run(Options{}, 500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "API_PORT ready at http://localhost:"+port+"/healthz") {
+		t.Fatalf("expected readiness report, got %q", out)
+	}
+	if strings.Contains(out, "WORKER_PORT") {
+		t.Fatalf("keys without an assignment should not be polled, got %q", out)
+	}
+
+	status.Store(http.StatusServiceUnavailable)
+	_, err = run(Options{HealthyTimeout: 300 * time.Millisecond}, time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "API_PORT not healthy at http://localhost:"+port+"/healthz after 300ms") {
+		t.Fatalf("expected readiness failure, got %v", err)
+	}
+}
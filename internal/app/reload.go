@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+// On-HUP actions for --on-hup.
+const (
+	// onHUPReload replans and rewrites templates and links; the running
+	// command keeps its environment.
+	onHUPReload = "reload"
+	// onHUPRestart also restarts the command with the new ports.
+	onHUPRestart = "restart"
+)
+
+func validateOnHUP(action string) error {
+	switch action {
+	case "", onHUPReload, onHUPRestart:
+		return nil
+	}
+	return fmt.Errorf("--on-hup must be %s or %s, got %q", onHUPReload, onHUPRestart, action)
+}
+
+// runFunc runs the wrapped command once with the given assignments and
+// command environment.
+type runFunc func(ctx context.Context, overrides map[string]string, cmdEnv []string) error
+
+// runReloading runs the command and plans the project again on every
+// SIGHUP (--on-hup) and every change to a watched file (--watch),
+// rewriting its templates and links. A file change, or SIGHUP under
+// --on-hup restart, restarts the command with the new ports. It returns
+// the assignments in effect when the command exits.
+func (a *App) runReloading(ctx context.Context, opts Options, overrides map[string]string, extraEnv []string, run runFunc) (map[string]string, error) {
+	var hups <-chan os.Signal
+	if opts.OnHUP != "" {
+		ch, stop, err := a.reloadSignals()
+		if err != nil {
+			return overrides, err
+		}
+		defer stop()
+		hups = ch
+		a.logger.Info("send SIGHUP to reload ports", slog.Int("pid", os.Getpid()), slog.String("on_hup", opts.OnHUP))
+	}
+	var changes <-chan string
+	if opts.Watch {
+		watchCtx, stopWatching := context.WithCancel(ctx)
+		defer stopWatching()
+		changes = a.watchFiles(watchCtx, opts.CWD)
+	}
+
+	cmdEnv := append(a.buildExecEnv(a.commandEnviron(opts), overrides), extraEnv...)
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() { done <- run(runCtx, overrides, cmdEnv) }()
+		restart := false
+		for !restart {
+			var next map[string]string
+			var err error
+			restartOnChange := opts.OnHUP == onHUPRestart
+			select {
+			case err := <-done:
+				cancel()
+				return overrides, err
+			case <-hups:
+				next, err = a.reload(ctx, opts, overrides)
+			case file := <-changes:
+				next, err = a.reloadChanged(ctx, opts, overrides, file)
+				restartOnChange = true
+			}
+			if err == nil && next != nil {
+				err = a.rewriteFiles(opts, next)
+			}
+			if err != nil {
+				a.logger.Warn("reload failed; keeping current ports", slog.String("error", err.Error()))
+				continue
+			}
+			if next == nil {
+				continue
+			}
+			overrides = next
+			if !restartOnChange {
+				a.logger.Warn("the running command keeps its old ports; restart it or use --on-hup restart")
+				continue
+			}
+			restart = true
+		}
+		// The command was stopped on purpose; its exit status is not the
+		// run's.
+		cancel()
+		<-done
+		a.metrics.restarts.Inc()
+		a.metrics.leases.Set(int64(len(overrides)))
+		cmdEnv = append(a.buildExecEnv(a.commandEnviron(opts), overrides), extraEnv...)
+	}
+}
+
+// reload plans the project again. The running command's ports count as
+// free, so a key moves only when its plan changed: an edited env file or
+// config, or a port another process took while the command was down. It
+// prints the changes and returns nil when no port changed.
+func (a *App) reload(ctx context.Context, opts Options, current map[string]string) (map[string]string, error) {
+	owned := map[int]bool{}
+	for _, v := range current {
+		if p, err := strconv.Atoi(v); err == nil {
+			owned[p] = true
+		}
+	}
+	isFree := a.isFree
+	a.isFree = func(proto port.Protocol, p int) bool { return owned[p] || isFree(proto, p) }
+	next, err := a.replan(ctx)
+	a.isFree = isFree
+	if err != nil {
+		return nil, err
+	}
+	if maps.Equal(next, current) {
+		a.logger.Info("reload: ports unchanged")
+		return nil, nil
+	}
+	if !opts.Quiet {
+		a.printReloadChanges(current, next)
+	}
+	return next, nil
+}
+
+// rewriteFiles renders the templates and links for reloaded assignments.
+func (a *App) rewriteFiles(opts Options, overrides map[string]string) error {
+	env := a.buildExecEnv(a.environ, overrides)
+	if err := a.renderTemplates(opts.CWD, overrides, env); err != nil {
+		return err
+	}
+	return a.applyLinks(opts.CWD, overrides, false, opts.Quiet)
+}
+
+// printReloadChanges lists the keys whose value a reload added, changed,
+// or dropped.
+func (a *App) printReloadChanges(current, next map[string]string) {
+	fmt.Fprintln(a.stderr, "autoport reloaded:")
+	keys := slices.Sorted(maps.Keys(current))
+	for key := range next {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		before, hadBefore := current[key]
+		after, hasAfter := next[key]
+		switch {
+		case !hadBefore:
+			fmt.Fprintf(a.stderr, "  %s: %s (new)\n", key, after)
+		case !hasAfter:
+			fmt.Fprintf(a.stderr, "  %s: %s (dropped)\n", key, before)
+		case before != after:
+			fmt.Fprintf(a.stderr, "  %s: %s -> %s\n", key, before, after)
+		}
+	}
+}
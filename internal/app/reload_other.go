@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package app
+
+import (
+	"errors"
+	"os"
+)
+
+// notifyReload is not implemented on this platform.
+func notifyReload() (<-chan os.Signal, func(), error) {
+	return nil, nil, errors.New("--on-hup is not supported on this platform")
+}
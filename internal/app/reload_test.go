@@ -0,0 +1,92 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+// reloadExecutor reports each start's environment on started and runs
+// until its context is done or finish is closed.
+func reloadExecutor(started chan<- []string, finish <-chan struct{}) executorFunc {
+	return func(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+		started <- env
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-finish:
+			return nil
+		}
+	}
+}
+
+func TestApp_OnHUPRestartsWithNewPorts(t *testing.T) {
+	cwd := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(cwd, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".env", "WEB_PORT=3000\n")
+	write("proxy.conf.tmpl", "web {{.WEB_PORT}}\n")
+	started, finish := make(chan []string), make(chan struct{})
+	exec := reloadExecutor(started, finish)
+	hups := make(chan os.Signal, 1)
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Templates: map[string]string{"proxy.conf.tmpl": "proxy.conf"}}
+	var stderr bytes.Buffer
+	app := New(
+		WithConfig(cfg),
+		WithStdout(io.Discard),
+		WithStderr(&stderr),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithEnviron([]string{}),
+		WithExecutor(exec),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	app.reloadSignals = func() (<-chan os.Signal, func(), error) { return hups, func() {}, nil }
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run(context.Background(), Options{Mode: "run", CWD: cwd, OnHUP: "restart"}, []string{"server"})
+	}()
+	first := <-started
+	if envValue(first, "API_PORT") != "" {
+		t.Fatalf("first start env = %v, want no API_PORT", first)
+	}
+
+	write(".env", "WEB_PORT=3000\nAPI_PORT=3001\n")
+	write("proxy.conf.tmpl", "web {{.WEB_PORT}}\napi {{.API_PORT}}\n")
+	hups <- os.Interrupt
+	second := <-started
+	web, api := envValue(second, "WEB_PORT"), envValue(second, "API_PORT")
+	if web == "" || api == "" {
+		t.Fatalf("restarted env = %v, want API_PORT added", second)
+	}
+	close(finish)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(cwd, "proxy.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "web "+web+"\napi "+api+"\n" {
+		t.Fatalf("rendered %q after reload", got)
+	}
+	if !strings.Contains(stderr.String(), "API_PORT: "+api+" (new)") {
+		t.Fatalf("stderr = %q, want the reloaded keys", stderr.String())
+	}
+
+	err = New(WithConfig(cfg), WithEnviron([]string{})).Run(context.Background(), Options{Mode: "run", CWD: cwd, OnHUP: "exit"}, []string{"server"})
+	if err == nil || !strings.Contains(err.Error(), "--on-hup") {
+		t.Fatalf("expected an invalid --on-hup error, got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin
+
+package app
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReload delivers SIGHUP, which then no longer stops autoport, until
+// stop is called.
+func notifyReload() (<-chan os.Signal, func(), error) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	return ch, func() { signal.Stop(ch) }, nil
+}
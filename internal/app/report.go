@@ -0,0 +1,186 @@
+package app
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+)
+
+// explainLink ties an assigned key to what it shares or feeds: an
+// assignment group whose keys share one port, or the compose service
+// publishing it.
+type explainLink struct {
+	Key    string
+	Target string
+}
+
+// explainReport is the data of the HTML explain report: the JSON payload
+// plus the link graph laid out as two columns, keys on the left and the
+// groups and services they link to on the right.
+type explainReport struct {
+	explainPayload
+	Links  []explainLink
+	Graph  reportGraph
+	Styles template.CSS
+}
+
+type reportGraph struct {
+	Width, Height int
+	Keys, Targets []graphNode
+	Edges         []graphEdge
+}
+
+type graphNode struct {
+	Label string
+	X, Y  int
+}
+
+type graphEdge struct {
+	X1, Y1, X2, Y2 int
+}
+
+const (
+	graphRow    = 28
+	graphWidth  = 640
+	graphKeyX   = 10
+	graphLinkX  = 380
+	graphEdgeX1 = 250
+	graphEdgeX2 = 370
+)
+
+// renderExplainHTML writes explain output as a standalone HTML page, for
+// onboarding docs and bug reports. It has no scripts or external assets.
+func (a *App) renderExplainHTML(payload explainPayload) error {
+	links := a.explainLinks(payload.Assignments)
+	report := explainReport{explainPayload: payload, Links: links, Graph: layoutGraph(links), Styles: reportStyles}
+	return explainHTML.Execute(a.stdout, report)
+}
+
+// explainLinks lists the group and compose links of the assigned keys,
+// sorted by key.
+func (a *App) explainLinks(assignments []explainAssignment) []explainLink {
+	var links []explainLink
+	for _, as := range assignments {
+		if as.Group != "" {
+			links = append(links, explainLink{Key: as.Key, Target: "group " + as.Group})
+		}
+		if svc, ok := a.config.Compose[as.Key]; ok {
+			links = append(links, explainLink{Key: as.Key, Target: fmt.Sprintf("compose %s:%s", svc.Service, composePort(svc, fmt.Sprint(as.Assigned)))})
+		}
+	}
+	slices.SortFunc(links, func(x, y explainLink) int {
+		return cmp.Or(strings.Compare(x.Key, y.Key), strings.Compare(x.Target, y.Target))
+	})
+	return links
+}
+
+// layoutGraph places each linked key and each target once, in order of
+// first appearance, and connects them.
+func layoutGraph(links []explainLink) reportGraph {
+	g := reportGraph{Width: graphWidth}
+	keyRow := map[string]int{}
+	targetRow := map[string]int{}
+	for _, l := range links {
+		if _, ok := keyRow[l.Key]; !ok {
+			keyRow[l.Key] = len(g.Keys)
+			g.Keys = append(g.Keys, graphNode{Label: l.Key, X: graphKeyX, Y: graphRow * (len(g.Keys) + 1)})
+		}
+		if _, ok := targetRow[l.Target]; !ok {
+			targetRow[l.Target] = len(g.Targets)
+			g.Targets = append(g.Targets, graphNode{Label: l.Target, X: graphLinkX, Y: graphRow * (len(g.Targets) + 1)})
+		}
+		g.Edges = append(g.Edges, graphEdge{
+			X1: graphEdgeX1, Y1: g.Keys[keyRow[l.Key]].Y - 5,
+			X2: graphEdgeX2, Y2: g.Targets[targetRow[l.Target]].Y - 5,
+		})
+	}
+	g.Height = graphRow * (max(len(g.Keys), len(g.Targets)) + 1)
+	return g
+}
+
+const reportStyles = `body{font-family:system-ui,sans-serif;margin:2rem;color:#222}
+table{border-collapse:collapse;margin-bottom:1.5rem}
+th,td{border:1px solid #ccc;padding:.25rem .6rem;text-align:left}
+td.num{text-align:right}
+tr.excluded{color:#888}
+code,svg text{font-family:ui-monospace,monospace;font-size:13px}
+svg line{stroke:#888}`
+
+var explainHTML = template.Must(template.New("explain").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>autoport explain: {{.CWD}}</title>
+<style>{{.Styles}}</style>
+</head>
+<body>
+<h1>autoport explain</h1>
+<table>
+<tr><th>cwd</th><td><code>{{.CWD}}</code></td></tr>
+<tr><th>seed</th><td>{{.Seed}} ({{.SeedSource}})</td></tr>
+<tr><th>range</th><td><code>{{.Range.Spec}}</code> ({{.Range.Size}} ports)</td></tr>
+</table>
+
+<h2>Origins</h2>
+<table>
+<tr><th>Option</th><th>Value</th><th>Origin</th></tr>
+{{- range .Origins}}
+<tr><td>{{.Option}}</td><td><code>{{.Value}}</code></td><td>{{.Origin}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Keys</h2>
+<table>
+<tr><th>Key</th><th>Category</th><th>Source</th><th>Included</th><th>Reason</th><th>Rule origin</th></tr>
+{{- range .Keys}}
+<tr{{if not .Included}} class="excluded"{{end}}><td><code>{{.Key}}</code></td><td>{{.Category}}</td><td>{{.Source}}{{if .Kind}} ({{.Kind}}){{end}}</td><td>{{if .Included}}yes{{else}}no{{end}}</td><td>{{.Reason}}</td><td>{{.Rule.Origin}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Assignments</h2>
+<table>
+<tr><th>Key</th><th>Assigned</th><th>Preferred</th><th>Probes</th><th>Group</th><th>Base</th><th>Source</th><th>Origin</th></tr>
+{{- range .Assignments}}
+<tr><td><code>{{.Key}}</code></td><td class="num">{{.Assigned}}</td><td class="num">{{.Preferred}}</td><td class="num">{{.Probes}}</td><td>{{.Group}}</td><td class="num">{{if .Base}}{{.Base}}{{end}}</td><td>{{.Source}}{{if .Current}} current{{end}}{{if .Snapshot}} snapshot{{end}}</td><td>{{.Origin}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Links</h2>
+{{- if .Links}}
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Graph.Width}}" height="{{.Graph.Height}}" role="img" aria-label="key links">
+{{- range .Graph.Edges}}
+<line x1="{{.X1}}" y1="{{.Y1}}" x2="{{.X2}}" y2="{{.Y2}}"/>
+{{- end}}
+{{- range .Graph.Keys}}
+<text x="{{.X}}" y="{{.Y}}">{{.Label}}</text>
+{{- end}}
+{{- range .Graph.Targets}}
+<text x="{{.X}}" y="{{.Y}}">{{.Label}}</text>
+{{- end}}
+</svg>
+<ul>
+{{- range .Links}}
+<li><code>{{.Key}}</code> → {{.Target}}</li>
+{{- end}}
+</ul>
+{{- else}}
+<p>No keys share a group or feed a compose service.</p>
+{{- end}}
+
+<h2>Warnings</h2>
+{{- if .Warnings}}
+<ul>
+{{- range .Warnings}}
+<li><code>{{.Code}}</code>: {{.Message}}</li>
+{{- end}}
+</ul>
+{{- else}}
+<p>None.</p>
+{{- end}}
+
+<p>Scanned {{.Stats.FilesVisited}} files ({{.Stats.EnvFilesParsed}} env files).</p>
+</body>
+</html>
+`))
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_ExplainHTMLReport(t *testing.T) {
+	var stdout bytes.Buffer
+	cfg := &config.Config{
+		Presets: map[string]config.Preset{},
+		Groups:  map[string][]string{"web": {"PORT", "HTTP_PORT"}},
+		Compose: map[string]config.ComposeService{"DB_PORT": {Service: "db", ContainerPort: 5432}},
+	}
+	app := New(
+		WithConfig(cfg),
+		WithStdout(&stdout),
+		WithEnviron([]string{"PORT=1", "HTTP_PORT=2", "DB_PORT=3"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts := Options{Mode: "explain", Format: "html", Range: "10000-10100", CWD: "/work/<shop>"}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		"<code>/work/&lt;shop&gt;</code>",
+		"<code>HTTP_PORT</code> → group web",
+		"<code>PORT</code> → group web",
+		"<code>DB_PORT</code> → compose db:",
+		"<svg",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("report missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "<shop>") {
+		t.Fatal("cwd was not escaped")
+	}
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// missingKeys lists the --require-keys keys the plan left without a port,
+// and describes each with the selection decision that dropped it.
+func missingKeys(required []string, p *plan) (keys, missing []string) {
+	for _, key := range required {
+		if _, ok := p.Overrides[key]; ok {
+			continue
+		}
+		reason := "not discovered"
+		for _, d := range p.Decisions {
+			if d.Key == key && !d.Included {
+				reason = d.Reason
+				if d.Rule.Origin != "" && d.Rule.Rule != ruleDiscovered {
+					reason += " [" + d.Rule.Origin + "]"
+				}
+			}
+		}
+		keys = append(keys, key)
+		missing = append(missing, fmt.Sprintf("%s (%s)", key, reason))
+	}
+	return keys, missing
+}
+
+// checkRequiredKeys fails a plan missing a --require-keys key before
+// anything runs. explain reports it as a warning instead, so the decisions
+// that dropped the key can still be inspected.
+func checkRequiredKeys(opts Options, p *plan) error {
+	keys, missing := missingKeys(opts.RequireKeys, p)
+	if len(keys) == 0 {
+		return nil
+	}
+	if opts.Mode == "explain" {
+		w := newWarning(WarnRequiredKeyMissing, "required keys missing: %s", strings.Join(missing, ", "))
+		p.Warnings = append(p.Warnings, w.with("keys", strings.Join(keys, ",")))
+		return nil
+	}
+	return fmt.Errorf("required keys missing: %s (--require-keys)", strings.Join(missing, ", "))
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_RequireKeysFailsBeforeRunning(t *testing.T) {
+	executor := &MockExecutor{}
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{"lean": {ExcludeKeys: []string{"API_PORT"}}}}),
+		WithStdout(&stdout),
+		WithEnviron([]string{"API_PORT=1", "WEB_PORT=1"}),
+		WithIsFree(func(p int) bool { return true }),
+		WithExecutor(executor),
+	)
+	opts := Options{Mode: "run", CWD: t.TempDir(), Presets: []string{"lean"}, RequireKeys: []string{"WEB_PORT", "API_PORT", "WORKER_PORT"}}
+	err := app.Run(context.Background(), opts, []string{"npm", "start"})
+	if err == nil || !strings.Contains(err.Error(), "required keys missing: API_PORT (excluded by exact key [preset lean]), WORKER_PORT (not discovered)") {
+		t.Fatalf("expected a missing keys error, got %v", err)
+	}
+	if executor.CapturedName != "" {
+		t.Fatalf("command %s ran despite missing keys", executor.CapturedName)
+	}
+
+	stdout.Reset()
+	opts.Mode, opts.Format = "explain", "json"
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("explain should report missing keys as a warning, got %v", err)
+	}
+	var payload explainPayload
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	if len(payload.Warnings) != 1 || payload.Warnings[0].Code != WarnRequiredKeyMissing || payload.Warnings[0].Context["keys"] != "API_PORT,WORKER_PORT" {
+		t.Fatalf("warnings = %+v", payload.Warnings)
+	}
+}
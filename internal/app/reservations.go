@@ -0,0 +1,130 @@
+package app
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/reservation"
+	"github.com/gelleson/autoport/internal/state"
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+// reservationStore returns the shared reservations file, or nil when none
+// is configured.
+func (a *App) reservationStore() (reservation.Store, error) {
+	if a.reservations != nil {
+		return a.reservations, nil
+	}
+	path := a.reservationsPath()
+	if path == "" {
+		return nil, nil
+	}
+	return reservation.Open(a.config.Reservations.Format, path)
+}
+
+// reservationsPath is the configured reservations file with ~/ expanded,
+// or "" when none is configured.
+func (a *App) reservationsPath() string {
+	path := a.config.Reservations.Path
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// avoidReservations makes ports reserved in the shared reservations file by
+// other tools, or by other projects, count as busy. The returned func
+// restores the previous port checker. An unreadable file is reported and
+// otherwise ignored, so a broken file from another tool never blocks a run.
+func (a *App) avoidReservations(cwd string) func() {
+	store, err := a.reservationStore()
+	if err == nil && store == nil {
+		return func() {}
+	}
+	var rs []reservation.Reservation
+	if err == nil {
+		rs, err = store.Load()
+	}
+	if err != nil {
+		a.logger.Warn("ignoring port reservations", slog.String("error", err.Error()))
+		return func() {}
+	}
+	owner := reservation.Owner(cwd)
+	reserved := map[int]bool{}
+	for _, r := range rs {
+		if !strings.HasPrefix(r.Name, owner) {
+			reserved[r.Port] = true
+		}
+	}
+	if len(reserved) == 0 {
+		return func() {}
+	}
+	isFree := a.isFree
+	a.isFree = func(proto port.Protocol, p int) bool { return !reserved[p] && isFree(proto, p) }
+	return func() { a.isFree = isFree }
+}
+
+// publishReservations replaces this project's entries in the shared
+// reservations file with the ports in overrides when the config asks for
+// it. It is called as the command starts and paired with
+// releaseReservations, so no entry outlives its command.
+func (a *App) publishReservations(cwd string, overrides map[string]string) {
+	a.writeReservations("publish", cwd, overrides)
+}
+
+// releaseReservations removes this project's entries from the shared
+// reservations file once its command has exited, so other projects stop
+// avoiding the ports.
+func (a *App) releaseReservations(cwd string) {
+	a.writeReservations("release", cwd, nil)
+}
+
+// writeReservations replaces this project's entries in the shared
+// reservations file with the ports in overrides when the config asks for
+// it. The file
+// is read and written under its lock, so concurrent runs of other projects
+// do not drop each other's entries.
+func (a *App) writeReservations(action, cwd string, overrides map[string]string) {
+	if !a.config.Reservations.Write {
+		return
+	}
+	store, err := a.reservationStore()
+	if store == nil && err == nil {
+		return
+	}
+	update := func() error {
+		rs, err := store.Load()
+		if err != nil {
+			return err
+		}
+		owner := reservation.Owner(cwd)
+		kept := rs[:0:0]
+		for _, r := range rs {
+			if !strings.HasPrefix(r.Name, owner) {
+				kept = append(kept, r)
+			}
+		}
+		for _, key := range sortedKeys(overrides) {
+			// Loopback aliases are hosts, not ports.
+			if p, err := strconv.Atoi(overrides[key]); err == nil {
+				kept = append(kept, reservation.Reservation{Port: p, Name: owner + key})
+			}
+		}
+		return store.Save(kept)
+	}
+	if err == nil {
+		if path := a.reservationsPath(); path != "" {
+			err = state.WithLock(path, update)
+		} else {
+			err = update()
+		}
+	}
+	if err != nil {
+		a.logger.Warn("could not "+action+" port reservations", slog.String("error", err.Error()))
+	}
+}
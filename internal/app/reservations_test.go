@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/internal/reservation"
+)
+
+func TestApp_SharedReservations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ports")
+	seed := uint32(7)
+	// during is the reservations file as the command saw it.
+	var during string
+	run := func(cfg *config.Config) map[string]string {
+		t.Helper()
+		env := map[string]string{}
+		app := New(
+			WithConfig(cfg),
+			WithStdout(io.Discard),
+			WithStderr(io.Discard),
+			WithEnviron([]string{"WEB_PORT=3000"}),
+			WithExecutor(executorFunc(func(ctx context.Context, name string, args []string, environ []string, stdout, stderr io.Writer) error {
+				for _, kv := range environ {
+					k, v, _ := strings.Cut(kv, "=")
+					env[k] = v
+				}
+				data, _ := os.ReadFile(path)
+				during = string(data)
+				return nil
+			})),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts := Options{Mode: "run", Quiet: true, Range: "10000-11000", CWD: "/repo", Seed: &seed, Includes: []string{"WEB_PORT"}}
+		if err := app.Run(context.Background(), opts, []string{"true"}); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return env
+	}
+
+	preferred := run(&config.Config{Presets: map[string]config.Preset{}})["WEB_PORT"]
+	if err := os.WriteFile(path, []byte(preferred+" grafana\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Reservations: config.ReservationsConfig{Path: path, Write: true}}
+	got := run(cfg)["WEB_PORT"]
+	if got == preferred {
+		t.Fatalf("WEB_PORT = %s, reserved by another tool", got)
+	}
+	if !strings.Contains(during, got+" autoport:/repo:WEB_PORT\n") || !strings.Contains(during, preferred+" grafana\n") {
+		t.Fatalf("reservations file while running = %q", during)
+	}
+	if again := run(cfg)["WEB_PORT"]; again != got {
+		t.Fatalf("second run WEB_PORT = %s, want %s (own reservation is not busy)", again, got)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != preferred+" grafana\n" {
+		t.Fatalf("reservations file after the command exited = %q, want only other owners' entries", data)
+	}
+}
+
+func TestApp_PublishesReservationsOnlyWhileACommandRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ports")
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Reservations: config.ReservationsConfig{Path: path, Write: true}, Hooks: config.HooksConfig{PreRun: []string{"migrate"}}}
+	run := func(args []string) {
+		t.Helper()
+		app := New(
+			WithConfig(cfg),
+			WithExecutor(&RecordingExecutor{FailName: "sh"}),
+			WithStdout(io.Discard),
+			WithStderr(io.Discard),
+			WithEnviron([]string{"WEB_PORT=3000"}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		_ = app.Run(context.Background(), Options{Mode: "run", Quiet: true, Yes: true, Range: "10000-11000", CWD: "/repo"}, args)
+	}
+
+	// An export has no command whose exit would withdraw the entries, and
+	// a failed pre_run hook stops the command from starting.
+	run(nil)
+	run([]string{"serve"})
+	if data, err := os.ReadFile(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("reservations file = %q (%v), want none written", data, err)
+	}
+}
+
+func TestApp_UpReleasesReservationsOnExit(t *testing.T) {
+	cwd := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cwd, "Procfile"), []byte("web: serve\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ports")
+	if err := os.WriteFile(path, []byte("8080 grafana\n10001 autoport:"+cwd+":WEB_PORT\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Reservations: config.ReservationsConfig{Path: path, Write: true}}
+	app := New(
+		WithConfig(cfg),
+		WithExecutor(&MockExecutor{}),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	if err := app.Run(context.Background(), Options{Mode: "up", Quiet: true, CWD: cwd, Range: "10000-10100"}, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "8080 grafana\n" {
+		t.Fatalf("reservations file after up = %q, want the project's entries removed", data)
+	}
+}
+
+func TestApp_PublishReservationsConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ports")
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Reservations: config.ReservationsConfig{Path: path, Write: true}}
+	const projects = 8
+	var wg sync.WaitGroup
+	for i := range projects {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app := New(WithConfig(cfg), WithStderr(io.Discard))
+			app.publishReservations(fmt.Sprintf("/repo%d", i), map[string]string{"WEB_PORT": strconv.Itoa(10000 + i)})
+		}()
+	}
+	wg.Wait()
+	rs, err := reservation.Lines{Path: path}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != projects {
+		t.Fatalf("reservations = %+v, want one per project", rs)
+	}
+}
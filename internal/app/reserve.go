@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// passFDsSupported reports whether listeners can be handed to the command;
+// Windows has no inheritable descriptors beyond stdio.
+const passFDsSupported = runtime.GOOS != "windows"
+
+// reservedPort is a listener autoport holds on an assigned port.
+type reservedPort struct {
+	key string
+	ln  *net.TCPListener
+}
+
+func validateReserve(opts Options, args []string, executor Executor) error {
+	if !opts.Reserve && !opts.PassFDs {
+		return nil
+	}
+	flag := "--reserve"
+	if opts.PassFDs {
+		flag = "--pass-fds"
+	}
+	switch {
+	case opts.Mode != "run" || len(args) == 0 || opts.MergeWith != "":
+		return fmt.Errorf("%s applies only when running a command", flag)
+	case opts.DryRun:
+		return fmt.Errorf("%s cannot be combined with -n", flag)
+	case !opts.PassFDs:
+		return nil
+	case !passFDsSupported:
+		return errors.New("--pass-fds is not supported on this platform")
+	case opts.OnHUP != "" || opts.Watch:
+		// A restarted command would need listeners for the new plan.
+		return errors.New("--pass-fds cannot be combined with --on-hup or --watch")
+	}
+	if _, ok := executor.(DefaultExecutor); !ok {
+		return errors.New("--pass-fds needs the default executor")
+	}
+	return nil
+}
+
+// reservePorts binds the plan's ports so that nothing else takes them
+// between planning and the command's start (--reserve). Values kept from
+// the environment are left to whoever holds them, and keys sharing a port
+// share its listener, held for the first of them.
+func (a *App) reservePorts(overrides map[string]string) ([]reservedPort, error) {
+	var reserved []reservedPort
+	held := map[int]bool{}
+	for _, key := range sortedKeys(overrides) {
+		p, err := strconv.Atoi(overrides[key])
+		if err != nil || a.inherited[key] || held[p] {
+			continue
+		}
+		ln, err := net.Listen("tcp", net.JoinHostPort(overrides[key+hostSuffix], strconv.Itoa(p)))
+		if err != nil {
+			releasePorts(reserved)
+			return nil, fmt.Errorf("reserve %s: port %d was taken after it was assigned; run again for a new plan: %w", key, p, err)
+		}
+		held[p] = true
+		reserved = append(reserved, reservedPort{key: key, ln: ln.(*net.TCPListener)})
+	}
+	return reserved, nil
+}
+
+// releasePorts closes the reserved listeners. Closing twice is harmless.
+func releasePorts(reserved []reservedPort) {
+	for _, r := range reserved {
+		r.ln.Close()
+	}
+}
+
+// executeReserved starts the command with the reserved ports. Without
+// --pass-fds they are released just before it starts, since the command
+// cannot bind a port autoport still listens on. With it, the listeners are
+// handed over as descriptors 3 and up with LISTEN_FDS and LISTEN_FDNAMES
+// (one key per descriptor), the layout systemd socket activation uses, and
+// autoport's copies close once the command has started.
+func (a *App) executeReserved(ctx context.Context, opts Options, reserved []reservedPort, name string, args []string, env []string, onStart func(pid int)) error {
+	if len(reserved) == 0 || !opts.PassFDs {
+		releasePorts(reserved)
+		return a.execute(ctx, name, args, env, onStart)
+	}
+	defer releasePorts(reserved)
+	files := make([]*os.File, 0, len(reserved))
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	defer closeFiles()
+	names := make([]string, 0, len(reserved))
+	for _, r := range reserved {
+		f, err := r.ln.File()
+		if err != nil {
+			return fmt.Errorf("pass %s listener: %w", r.key, err)
+		}
+		files = append(files, f)
+		names = append(names, r.key)
+	}
+	env = append(env, fmt.Sprintf("LISTEN_FDS=%d", len(files)), "LISTEN_FDNAMES="+strings.Join(names, ":"))
+	d := a.executor.(DefaultExecutor)
+	d.Files = files
+	return d.RunObserved(ctx, name, args, env, a.stdout, a.stderr, func(pid int) {
+		closeFiles()
+		releasePorts(reserved)
+		if onStart != nil {
+			onStart(pid)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+func TestApp_ReserveHoldsPortsUntilCommandStarts(t *testing.T) {
+	// held records, for each command run, whether API_PORT was still
+	// bound by autoport.
+	held := map[string]bool{}
+	hold := executorFunc(func(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+		p, err := strconv.Atoi(envValue(env, "API_PORT"))
+		if err != nil {
+			return err
+		}
+		held[name] = !port.IsFreeOn("", p)
+		return nil
+	})
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}, Hooks: config.HooksConfig{PreRun: []string{"migrate"}}}),
+		WithExecutor(hold),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"API_PORT=3000"}),
+	)
+	seed := uint32(7)
+	opts := Options{Mode: "run", Range: "20000-29999", Seed: &seed, Quiet: true, Reserve: true, CWD: t.TempDir()}
+	if err := app.Run(context.Background(), opts, []string{"serve"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	// Hooks run through the shell.
+	if !held["sh"] || held["serve"] {
+		t.Fatalf("held = %v, want the port held through pre_run and released for the command", held)
+	}
+
+	for _, tc := range []struct {
+		opts Options
+		args []string
+		want string
+	}{
+		{Options{Mode: "run", Reserve: true}, nil, "--reserve applies only when running a command"},
+		{Options{Mode: "run", Reserve: true, DryRun: true}, []string{"serve"}, "--reserve cannot be combined with -n"},
+		{Options{Mode: "run", PassFDs: true, Watch: true}, []string{"serve"}, "--pass-fds cannot be combined with --on-hup or --watch"},
+	} {
+		if err := app.Run(context.Background(), tc.opts, tc.args); err == nil || err.Error() != tc.want {
+			t.Errorf("Run(%+v) error = %v, want %q", tc.opts, err, tc.want)
+		}
+	}
+}
+
+func TestApp_PassFDsHandsListenersToCommand(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("descriptor passing is POSIX-only")
+	}
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(DefaultExecutor{}),
+		WithStdout(&stdout),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"PATH=" + os.Getenv("PATH"), "API_PORT=3000", "WEB_PORT=4000"}),
+	)
+	seed := uint32(7)
+	opts := Options{Mode: "run", Range: "20000-29999", Seed: &seed, Quiet: true, PassFDs: true, CWD: t.TempDir()}
+	script := `echo "$LISTEN_FDS $LISTEN_FDNAMES"; test "$LISTEN_PID" = "$$" && echo own-pid; test -e /dev/fd/5 && echo fd5`
+	if err := app.Run(context.Background(), opts, []string{"sh", "-c", script}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if got, want := stdout.String(), "3 API_PORT:PORT:WEB_PORT\nown-pid\nfd5\n"; got != want {
+		t.Fatalf("child saw %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// revertVar carries the statements that undo a shell export. It is set by
+// the export itself so the prior environment survives in the shell.
+const revertVar = "AUTOPORT_REVERT"
+
+// revertScript returns the statements restoring each key to its value in
+// the base environment, unsetting keys it did not have, followed by
+// unsetting revertVar.
+func (a *App) revertScript(overrides map[string]string) string {
+	current := map[string]string{}
+	for _, kv := range a.environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			current[k] = v
+		}
+	}
+	var stmts []string
+	for _, key := range sortedKeys(overrides) {
+		if old, ok := current[key]; ok {
+			stmts = append(stmts, a.shell.restore(key, old))
+		} else {
+			stmts = append(stmts, a.shell.unset(key))
+		}
+	}
+	return strings.Join(append(stmts, a.shell.unset(revertVar)), a.shell.sep)
+}
+
+// printRevert prints the revert statements recorded by an earlier export,
+// one per line, for `eval "$(autoport --revert)"`.
+func (a *App) printRevert(opts Options, args []string) error {
+	if len(args) > 0 {
+		return errors.New("--revert does not take a command")
+	}
+	if opts.Format != "" && opts.Format != "shell" {
+		return fmt.Errorf("--revert only supports -f shell, got %q", opts.Format)
+	}
+	if a.shell.sep == "" {
+		return fmt.Errorf("--revert is not supported for --shell %s", opts.Shell)
+	}
+	script := ""
+	for _, kv := range a.environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == revertVar {
+			script = v
+		}
+	}
+	if script == "" {
+		a.logger.Warn(revertVar + " is not set; nothing to revert")
+		return nil
+	}
+	for _, stmt := range strings.Split(script, a.shell.sep) {
+		fmt.Fprintln(a.stdout, stmt)
+	}
+	return nil
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_ShellExportRecordsRevert(t *testing.T) {
+	export := func(environ []string, opts Options) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithStderr(io.Discard),
+			WithEnviron(environ),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.Mode = "run"
+		opts.Range = "10000-10100"
+		opts.CWD = "/work/shop"
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		return stdout.String()
+	}
+
+	out := export([]string{"PORT=it's 3000"}, Options{PortEnv: []string{"WEB_PORT"}})
+	want := `export AUTOPORT_REVERT='export PORT='\''it'\''\'\'''\''s 3000'\''; unset WEB_PORT; unset AUTOPORT_REVERT'`
+	if !strings.Contains(out, want+"\n") {
+		t.Fatalf("expected revert line %s, got:\n%s", want, out)
+	}
+	if nested := export([]string{"PORT=10000", "AUTOPORT_REVERT=unset PORT"}, Options{}); strings.Contains(nested, "AUTOPORT_REVERT") {
+		t.Fatalf("a nested export should keep the outer revert, got:\n%s", nested)
+	}
+
+	reverted := export([]string{"PORT=10000", "AUTOPORT_REVERT=export PORT='3000'; unset AUTOPORT_REVERT"}, Options{Revert: true})
+	if reverted != "export PORT='3000'\nunset AUTOPORT_REVERT\n" {
+		t.Fatalf("unexpected revert output:\n%s", reverted)
+	}
+}
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"log/slog"
+	"net"
+)
+
+// canBind reports whether this process may bind TCP sockets at all. Some
+// CI sandboxes forbid it, and then every probe would report a busy port.
+func canBind() error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	return ln.Close()
+}
+
+// checkSandbox falls back to pure assignment when the default port check
+// cannot work because binding is not permitted. It is skipped for injected
+// checkers and when no probing happens anyway.
+func (a *App) checkSandbox(opts Options) Options {
+	a.bindErr = nil
+	if a.probeCheck == nil || opts.Pure || a.replaying != nil {
+		return opts
+	}
+	if err := a.probeCheck(); err != nil {
+		a.bindErr = err
+		a.logger.Warn(a.warningText(a.bindWarning()), slog.String("code", WarnBindUnavailable))
+		opts.Pure = true
+	}
+	return opts
+}
+
+func (a *App) bindWarning() warning {
+	return newWarning(WarnBindUnavailable, "cannot bind sockets (%s); assigning preferred ports without checking availability", a.bindErr).
+		with("error", a.bindErr.Error())
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+func TestApp_BindUnavailableFallsBackToPure(t *testing.T) {
+	var stdout, logs bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		WithEnviron([]string{"PORT=1", "API_PORT=2"}),
+	)
+	app.probeCheck = func() error { return errors.New("listen tcp 127.0.0.1:0: socket: operation not permitted") }
+	app.isFree = func(port.Protocol, int) bool { return false }
+	seed := uint32(0)
+	opts := Options{Mode: "run", Format: "json", Range: "10000-10100", CWD: "/work/shop", Seed: &seed}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	var payload struct {
+		Overrides []struct{ Key, Value string }
+		Warnings  []warning
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Overrides) != 2 || payload.Overrides[0].Value != "10000" || payload.Overrides[1].Value != "10001" {
+		t.Fatalf("overrides = %+v, want the preferred ports", payload.Overrides)
+	}
+	if len(payload.Warnings) != 1 || payload.Warnings[0].Code != WarnBindUnavailable {
+		t.Fatalf("warnings = %+v, want one %s", payload.Warnings, WarnBindUnavailable)
+	}
+	if !strings.Contains(logs.String(), "code="+WarnBindUnavailable) {
+		t.Fatalf("warning not logged: %s", logs.String())
+	}
+
+	stdout.Reset()
+	opts.Mode, opts.Format = "doctor", "text"
+	var exitErr *ExitError
+	if err := app.Run(context.Background(), opts, nil); !errors.As(err, &exitErr) || exitErr.Code != 1 {
+		t.Fatalf("doctor = %v, want warnings exit", err)
+	}
+	if !strings.Contains(stdout.String(), "[warn] port_availability: cannot bind sockets") {
+		t.Fatalf("doctor output:\n%s", stdout.String())
+	}
+}
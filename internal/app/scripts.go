@@ -0,0 +1,57 @@
+package app
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+)
+
+// applyScript resolves `autoport run <name>` against the config's scripts:
+// the script's presets are applied before any given on the command line,
+// its namespace is used unless --namespace is set, and args are appended to
+// its command line.
+func (a *App) applyScript(opts Options, args []string) (Options, []string, error) {
+	if opts.Script == "" {
+		return opts, args, nil
+	}
+	script, ok := a.config.Scripts[opts.Script]
+	if !ok {
+		names := make([]string, 0, len(a.config.Scripts))
+		for name := range a.config.Scripts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return opts, nil, fmt.Errorf("unknown script %q: no scripts configured in .autoport.json", opts.Script)
+		}
+		return opts, nil, fmt.Errorf("unknown script %q (available: %s)", opts.Script, strings.Join(names, ", "))
+	}
+
+	source := a.config.Origin("scripts." + opts.Script)
+	if !opts.DryRun {
+		if err := a.confirmCommands(opts, source, []string{script.Command}); err != nil {
+			return opts, nil, err
+		}
+	}
+	origin := "config scripts." + opts.Script
+	if source != "" {
+		origin += " (" + source + ")"
+	}
+	opts.Origins = maps.Clone(opts.Origins)
+	if opts.Origins == nil {
+		opts.Origins = map[string]string{}
+	}
+	if len(script.Presets) > 0 {
+		if len(opts.Presets) == 0 {
+			opts.Origins["presets"] = origin
+		}
+		opts.Presets = append(append([]string{}, script.Presets...), opts.Presets...)
+	}
+	if opts.Namespace == "" && script.Namespace != "" {
+		opts.Namespace = script.Namespace
+		opts.Origins["namespace"] = origin
+	}
+	name, cmdArgs := scriptCommand(script.Command, args)
+	return opts, append([]string{name}, cmdArgs...), nil
+}
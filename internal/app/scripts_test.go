@@ -0,0 +1,64 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_RunScript(t *testing.T) {
+	mockExec := &MockExecutor{}
+	cfg := &config.Config{
+		Presets: map[string]config.Preset{},
+		Scripts: map[string]config.Script{"api": {Command: "go run ./cmd/api", Presets: []string{"db"}, Namespace: "api"}},
+	}
+	app := New(
+		WithConfig(cfg),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"WEB_PORT=3000", "DB_PORT=5432"}),
+		WithExecutor(mockExec),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	opts := Options{Mode: "run", Quiet: true, Range: "10000-11000", CWD: "/repo", Script: "api"}
+	if err := app.Run(context.Background(), opts, []string{"--inspect"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		wantArgs := []string{"-c", `go run ./cmd/api "$@"`, "sh", "--inspect"}
+		if mockExec.CapturedName != "sh" || !reflect.DeepEqual(mockExec.CapturedArgs, wantArgs) {
+			t.Fatalf("executed %s %q, want sh %q", mockExec.CapturedName, mockExec.CapturedArgs, wantArgs)
+		}
+	}
+	env := strings.Join(mockExec.CapturedEnv, "\n")
+	if strings.Contains(env, "DB_PORT=1") || !strings.Contains(env, "DB_PORT=5432") {
+		t.Fatalf("db preset not applied: %v", mockExec.CapturedEnv)
+	}
+	var stdout bytes.Buffer
+	export := New(
+		WithConfig(cfg),
+		WithStdout(&stdout),
+		WithEnviron([]string{"WEB_PORT=3000", "DB_PORT=5432"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	if err := export.Run(context.Background(), Options{Mode: "run", Format: "dotenv", Range: "10000-11000", CWD: "/repo", Namespace: "api", Presets: []string{"db"}}, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	for _, want := range strings.Fields(stdout.String()) {
+		if !slices.Contains(mockExec.CapturedEnv, want) {
+			t.Fatalf("script env %v lacks %s from the script namespace", mockExec.CapturedEnv, want)
+		}
+	}
+
+	err := app.Run(context.Background(), Options{Mode: "run", CWD: "/repo", Script: "web"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "available: api") {
+		t.Fatalf("expected unknown script error listing api, got %v", err)
+	}
+}
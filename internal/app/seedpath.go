@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/gelleson/autoport/internal/gitinfo"
+)
+
+// seedPath returns the project path hashed into path seeds, after the
+// config's seed_path_normalization steps, so different spellings of one
+// directory (a symlink, other letter case, a subdirectory of the repo) get
+// one seed. gitRoot forces the git step (--seed-root git). A step that
+// cannot apply (not a git work tree, a missing path) leaves the path as it
+// is; inRepo reports whether the git step found a toplevel.
+func (a *App) seedPath(ctx context.Context, cwd string, gitRoot bool) (path string, inRepo bool) {
+	path = cwd
+	if gitRoot || a.config.NormalizesSeedPath("git") {
+		if top, err := gitinfo.Toplevel(ctx, path); err == nil && top != "" {
+			path, inRepo = filepath.Clean(top), true
+		}
+	}
+	if a.config.NormalizesSeedPath("symlinks") {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+	}
+	if a.config.NormalizesSeedPath("lowercase") {
+		path = strings.ToLower(path)
+	}
+	return path, inRepo
+}
+
+// seedRoot resolves --seed-root and the config's seed_root to "cwd" or
+// "git", with where the value came from.
+func (a *App) seedRoot(opts Options) (string, string, error) {
+	root, origin := opts.SeedRoot, opts.originOf("seed-root", opts.SeedRoot != "")
+	if root == "" && a.config.SeedRoot != "" {
+		root, origin = a.config.SeedRoot, "config seed_root"
+		if path := a.config.Origin("seed_root"); path != "" {
+			origin += " (" + path + ")"
+		}
+	}
+	switch root {
+	case "", "cwd":
+		return "cwd", origin, nil
+	case "git":
+		return root, origin, nil
+	default:
+		return "", "", fmt.Errorf("unknown seed root %q (want cwd or git)", root)
+	}
+}
+
+// seedPathCheck is the doctor check for path spellings that would change
+// the path seed of this directory: a case-insensitive filesystem, where
+// ~/Code/App and ~/code/app are the same project, and symlinks. Findings
+// already covered by seed_path_normalization are reported as handled.
+func (a *App) seedPathCheck(cwd string) (doctorCheck, bool) {
+	info, err := os.Stat(cwd)
+	if err != nil {
+		return doctorCheck{}, false
+	}
+	var parts []message
+	details := map[string]any{}
+	if other := swapCase(cwd); other != cwd {
+		if o, err := os.Stat(other); err == nil && os.SameFile(info, o) && !a.config.NormalizesSeedPath("lowercase") {
+			parts = append(parts, msgf("case-insensitive filesystem: %s is the same directory with a different seed; add \"lowercase\" to seed_path_normalization", other))
+			details["case_variant"] = other
+		}
+	}
+	if resolved, err := filepath.EvalSymlinks(cwd); err == nil && resolved != filepath.Clean(cwd) && !a.config.NormalizesSeedPath("symlinks") {
+		parts = append(parts, msgf("path goes through a symlink to %s, which has a different seed; add \"symlinks\" to seed_path_normalization", resolved))
+		details["symlink_target"] = resolved
+	}
+	if len(parts) > 0 {
+		check := newCheck("seed_path.unstable", "warn", parts...)
+		check.Details = details
+		return check, true
+	}
+	if len(a.config.SeedPathNormalization) > 0 {
+		check := newCheck("seed_path.normalized", "ok", msgf("seed path normalized (%s)", strings.Join(a.config.SeedPathNormalization, ", ")))
+		return check.with("normalization", a.config.SeedPathNormalization), true
+	}
+	return newCheck("seed_path.ok", "ok", msgf("seed path is stable under case and symlinks")), true
+}
+
+// swapCase flips the case of every letter in s.
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// seedPathOrigin describes the normalization applied to path seeds, for
+// the seed origin in explain output; "" when there is none.
+func (a *App) seedPathOrigin() string {
+	if len(a.config.SeedPathNormalization) == 0 {
+		return ""
+	}
+	origin := fmt.Sprintf("seed_path_normalization %s", strings.Join(a.config.SeedPathNormalization, ","))
+	if path := a.config.Origin("seed_path_normalization"); path != "" {
+		origin += " (" + path + ")"
+	}
+	return origin
+}
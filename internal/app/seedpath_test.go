@@ -0,0 +1,110 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_SeedPathNormalization(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	real := filepath.Join(root, "Code", "App")
+	if err := os.MkdirAll(real, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "app-link")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	run := func(cfg *config.Config, opts Options) (string, error) {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(cfg),
+			WithStdout(&stdout),
+			WithEnviron([]string{}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.Format = "json"
+		err := app.Run(context.Background(), opts, nil)
+		return stdout.String(), err
+	}
+	seedOf := func(cfg *config.Config, cwd string) explainPayload {
+		t.Helper()
+		out, err := run(cfg, Options{Mode: "explain", CWD: cwd})
+		if err != nil {
+			t.Fatalf("explain %s: %v", cwd, err)
+		}
+		var payload explainPayload
+		if err := json.Unmarshal([]byte(out), &payload); err != nil {
+			t.Fatalf("json parse: %v", err)
+		}
+		return payload
+	}
+
+	plain := &config.Config{Presets: map[string]config.Preset{}}
+	if seedOf(plain, link).Seed == seedOf(plain, real).Seed {
+		t.Fatal("without normalization the symlink should hash differently")
+	}
+	out, err := run(plain, Options{Mode: "doctor", CWD: link})
+	if e, ok := err.(*ExitError); !ok || e.Code != 1 || !strings.Contains(out, "goes through a symlink to "+real) {
+		t.Fatalf("doctor should warn about the symlink: %v\n%s", err, out)
+	}
+
+	normalized := &config.Config{Presets: map[string]config.Preset{}, SeedPathNormalization: []string{"symlinks", "lowercase"}}
+	want := seedOf(normalized, real)
+	if want.SeedSource != "path:"+strings.ToLower(real) {
+		t.Fatalf("seed material = %q", want.SeedSource)
+	}
+	for _, cwd := range []string{link, filepath.Join(root, "code", "app")} {
+		if got := seedOf(normalized, cwd); got.Seed != want.Seed {
+			t.Fatalf("seed for %s = %d (%s), want %d", cwd, got.Seed, got.SeedSource, want.Seed)
+		}
+	}
+	if out, err := run(normalized, Options{Mode: "doctor", CWD: link}); err != nil || !strings.Contains(out, "seed path normalized") {
+		t.Fatalf("doctor should report the normalization as handled: %v\n%s", err, out)
+	}
+}
+
+func TestApp_SeedRootGitSharesRepoSeed(t *testing.T) {
+	repo := initGitRepo(t, "https://github.com/acme/shop")
+	sub := filepath.Join(repo, "apps", "web")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	seedOrigin := func(p explainPayload) string {
+		for _, o := range p.Origins {
+			if o.Option == "seed" {
+				return o.Origin
+			}
+		}
+		return ""
+	}
+
+	fromRoot := explainSeed(t, Options{CWD: repo})
+	if explainSeed(t, Options{CWD: sub}).Seed == fromRoot.Seed {
+		t.Fatal("by default a subdirectory should hash its own path")
+	}
+	fromSub := explainSeed(t, Options{CWD: sub, SeedRoot: "git"})
+	if fromSub.Seed != explainSeed(t, Options{CWD: repo, SeedRoot: "git"}).Seed {
+		t.Fatalf("--seed-root git should give the repo root and %s one seed", sub)
+	}
+	if !strings.HasSuffix(fromSub.SeedSource, filepath.Base(repo)) || !strings.Contains(seedOrigin(fromSub), "seed root git") {
+		t.Fatalf("explain should show the toplevel and the seed root: %q from %q", fromSub.SeedSource, seedOrigin(fromSub))
+	}
+
+	outside := t.TempDir()
+	p := explainSeed(t, Options{CWD: outside, SeedRoot: "git"})
+	if p.SeedSource != "path:"+outside || !strings.Contains(seedOrigin(p), "not in a git work tree") {
+		t.Fatalf("outside git the cwd should be used: %q from %q", p.SeedSource, seedOrigin(p))
+	}
+}
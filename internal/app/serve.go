@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gelleson/autoport/internal/ide"
+	"github.com/gelleson/autoport/internal/state"
+)
+
+// DefaultServeListen is the address `autoport serve` listens on by default.
+const DefaultServeListen = "127.0.0.1:7180"
+
+// serveTokenFile is the token file `autoport serve` uses without
+// --token-file, in the state dir.
+const serveTokenFile = "serve.token"
+
+// serveToken returns the bearer token clients of `autoport serve` must
+// send, creating path with a random one, readable only by the user, when it
+// does not exist yet. Clients read the same file.
+func serveToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", path)
+		}
+		return token, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("read token file: %w", err)
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+	if err := state.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("token file: %w", err)
+	}
+	return token, nil
+}
+
+// runServe answers GET /v1/assign over HTTP until ctx is cancelled, so
+// scripts in other languages can ask for deterministic ports without
+// running autoport. Queries are planned as `autoport ide serve` plans
+// them, one at a time.
+func (a *App) runServe(ctx context.Context, opts Options) error {
+	path := opts.TokenFile
+	if path == "" {
+		dir := state.Dir()
+		if dir == "" {
+			return errors.New("serve: no state dir for the token file; pass --token-file")
+		}
+		path = filepath.Join(dir, serveTokenFile)
+	}
+	token, err := serveToken(path)
+	if err != nil {
+		return fmt.Errorf("serve: %w", err)
+	}
+	listen := opts.Listen
+	if listen == "" {
+		listen = DefaultServeListen
+	}
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("serve listen %s: %w", listen, err)
+	}
+	srv := &http.Server{Handler: a.serveHandler(opts, token), ReadHeaderTimeout: 10 * time.Second}
+	if !opts.Quiet {
+		fmt.Fprintf(a.stderr, "autoport serve listening on http://%s (token in %s)\n", ln.Addr(), path)
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(ln) }()
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("serve: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// serveHandler routes the assignment API. GET /v1/assign takes the project
+// directory as path and optionally a key: with a key it answers like the
+// ide "port" method, without one like "assignments".
+func (a *App) serveHandler(opts Options, token string) http.Handler {
+	var mu sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/assign", func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			a.writeServeError(w, http.StatusUnauthorized, "missing or wrong bearer token")
+			return
+		}
+		params := ideParams{CWD: r.URL.Query().Get("path"), Key: r.URL.Query().Get("key")}
+		if params.CWD == "" {
+			a.writeServeError(w, http.StatusBadRequest, "path is required")
+			return
+		}
+
+		// Plans share the App's state, as in ide serve.
+		mu.Lock()
+		defer mu.Unlock()
+		var out any
+		var err error
+		if params.Key == "" {
+			out, err = a.ideAssignments(r.Context(), opts, params)
+		} else {
+			out, err = a.idePort(r.Context(), opts, params)
+		}
+		if err != nil {
+			status, message := http.StatusInternalServerError, err.Error()
+			var ideErr *ide.Error
+			if errors.As(err, &ideErr) && ideErr.Code == ide.CodeInvalidParams {
+				status, message = http.StatusBadRequest, ideErr.Message
+			}
+			a.writeServeError(w, status, message)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(out); err != nil {
+			a.logger.Warn("failed to write serve response", slog.String("error", err.Error()))
+		}
+	})
+	return mux
+}
+
+func (a *App) writeServeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": message}); err != nil {
+		a.logger.Warn("failed to write serve response", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_ServeAssignsOverHTTP(t *testing.T) {
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, ".env"), []byte("WEB_PORT=3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	seed := uint32(0)
+	srv := httptest.NewServer(app.serveHandler(Options{Mode: "serve", CWD: "/elsewhere", Seed: &seed, Range: "10000-10100"}, "secret"))
+	defer srv.Close()
+
+	get := func(query, token string, v any) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/assign?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decode %s: %v", query, err)
+		}
+		return resp.StatusCode
+	}
+
+	var p idePort
+	if code := get("path="+project+"&key=ADMIN_PORT", "secret", &p); code != http.StatusOK || p.Key != "ADMIN_PORT" || p.Discovered || p.Port != 10000 {
+		t.Fatalf("port = %d %+v", code, p)
+	}
+	var all ideProject
+	if code := get("path="+project, "secret", &all); code != http.StatusOK || all.CWD != project || len(all.Assignments) != 2 || all.Assignments[1].Key != "WEB_PORT" {
+		t.Fatalf("assignments = %d %+v", code, all)
+	}
+	var errBody map[string]string
+	if code := get("path="+project, "wrong", &errBody); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: %d %v", code, errBody)
+	}
+	if code := get("path="+project, "", &errBody); code != http.StatusUnauthorized {
+		t.Fatalf("no token: %d %v", code, errBody)
+	}
+	if code := get("path="+project+"&key=bad+key", "secret", &errBody); code != http.StatusBadRequest || errBody["error"] != `invalid key "bad key"` {
+		t.Fatalf("bad key: %d %v", code, errBody)
+	}
+	if code := get("key=WEB_PORT", "secret", &errBody); code != http.StatusBadRequest {
+		t.Fatalf("missing path: %d %v", code, errBody)
+	}
+}
+
+func TestApp_ServePlansWithEachProjectsConfig(t *testing.T) {
+	dirs := projectConfigs(t, map[string]string{"plain": "", "pinned": `{"ports": {"WEB_PORT": 3000}}`})
+	app := New(
+		WithConfig(config.LoadFrom(dirs["plain"])),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	seed := uint32(0)
+	srv := httptest.NewServer(app.serveHandler(Options{Mode: "serve", CWD: dirs["plain"], Seed: &seed, Range: "10000-10100"}, "secret"))
+	defer srv.Close()
+
+	for name, want := range map[string]bool{"pinned": true, "plain": false} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/assign?key=WEB_PORT&path="+url.QueryEscape(dirs[name]), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p idePort
+		err = json.NewDecoder(resp.Body).Decode(&p)
+		resp.Body.Close()
+		if err != nil || (p.Port == 3000) != want {
+			t.Fatalf("%s WEB_PORT = %+v, %v; pinned to 3000: %v", name, p, err, want)
+		}
+	}
+}
+
+func TestServeTokenIsCreatedOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", serveTokenFile)
+	token, err := serveToken(path)
+	if err != nil || len(token) != 64 {
+		t.Fatalf("serveToken() = %q, %v", token, err)
+	}
+	if info, err := os.Stat(path); err != nil || runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Fatalf("token file: %v, %v", info, err)
+	}
+	if again, err := serveToken(path); err != nil || again != token {
+		t.Fatalf("second serveToken() = %q, %v; want the stored token", again, err)
+	}
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/gitinfo"
+)
+
+// sessionEnv is the variable holding an explicit or generated session token.
+const sessionEnv = "AUTOPORT_SESSION"
+
+// sessionSources are the variables identifying the current terminal
+// session, most specific first: an explicit token, then multiplexer
+// sessions (tmux, GNU screen), then terminal emulator windows or tabs.
+var sessionSources = []string{
+	sessionEnv,
+	"TMUX",            // tmux: socket,server pid,session
+	"STY",             // GNU screen
+	"TERM_SESSION_ID", // macOS Terminal, iTerm2
+	"WT_SESSION",      // Windows Terminal
+	"KITTY_WINDOW_ID",
+	"WEZTERM_PANE",
+}
+
+// applyNamespaceFrom mixes the source named by --namespace-from (or the
+// config's namespace_from) into the namespace: "session" so the same
+// project run from two terminals can get disjoint ports when asked to, and
+// "subdir" so monorepo packages get stable per-package offsets.
+func (a *App) applyNamespaceFrom(ctx context.Context, opts Options) (Options, error) {
+	from, origin := opts.NamespaceFrom, opts.originOf("namespace-from", true)
+	if from == "" && a.config.NamespaceFrom != "" {
+		from, origin = a.config.NamespaceFrom, "config namespace_from"
+		if path := a.config.Origin("namespace_from"); path != "" {
+			origin += " (" + path + ")"
+		}
+	}
+	var part, source string
+	switch from {
+	case "":
+		return opts, nil
+	case "session":
+		id, src, err := a.sessionNamespace()
+		if err != nil {
+			return opts, err
+		}
+		part, source = "session:"+id, src
+	case "subdir":
+		rel, err := a.subdirNamespace(ctx, opts.CWD)
+		if err != nil {
+			return opts, err
+		}
+		opts, source = a.impliedGitRoot(opts, origin), "git toplevel"
+		if rel == "" {
+			// The repo root keeps the plain namespace.
+			return opts, nil
+		}
+		part = "subdir:" + rel
+	default:
+		return opts, fmt.Errorf("unknown --namespace-from %q (want session or subdir)", from)
+	}
+
+	if opts.Namespace != "" {
+		part = opts.Namespace + "/" + part
+	}
+	opts.Namespace = part
+	opts.Origins = maps.Clone(opts.Origins)
+	if opts.Origins == nil {
+		opts.Origins = map[string]string{}
+	}
+	opts.Origins["namespace"] = fmt.Sprintf("%s (%s)", origin, source)
+	return opts, nil
+}
+
+// sessionNamespace returns the terminal session id and the variable it
+// came from. Without one it generates a token, passes it on to the wrapped
+// command, and warns with the export line that pins it to the shell.
+func (a *App) sessionNamespace() (string, string, error) {
+	id, source := a.sessionID()
+	if id != "" {
+		return id, source, nil
+	}
+	token, err := newSessionToken()
+	if err != nil {
+		return "", "", fmt.Errorf("generate session token: %w", err)
+	}
+	// The wrapped command, and any autoport it starts, reuse the token.
+	a.environ = append(a.environ, sessionEnv+"="+token)
+	a.logger.Warn("no terminal session found; using a generated session token",
+		slog.String("hint", "export "+sessionEnv+"="+token+" to keep these ports in this shell"))
+	return token, "generated", nil
+}
+
+// subdirNamespace returns cwd relative to its git toplevel in slash form,
+// or "" at the toplevel itself.
+func (a *App) subdirNamespace(ctx context.Context, cwd string) (string, error) {
+	top, err := gitinfo.Toplevel(ctx, cwd)
+	if err != nil {
+		return "", fmt.Errorf("--namespace-from subdir: %w", err)
+	}
+	// Compare resolved paths: git reports the toplevel with symlinks
+	// resolved.
+	dir := cwd
+	if resolved, err := filepath.EvalSymlinks(cwd); err == nil {
+		dir = resolved
+	}
+	rel, err := filepath.Rel(filepath.Clean(top), dir)
+	if err != nil {
+		return "", fmt.Errorf("--namespace-from subdir: %w", err)
+	}
+	if rel == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// impliedGitRoot makes the seed root git when neither --seed-root nor the
+// config chose one, so every package hashes the repository root and only
+// the namespace tells them apart.
+func (a *App) impliedGitRoot(opts Options, origin string) Options {
+	if opts.SeedRoot != "" || a.config.SeedRoot != "" {
+		return opts
+	}
+	opts.SeedRoot = "git"
+	opts.Origins = maps.Clone(opts.Origins)
+	if opts.Origins == nil {
+		opts.Origins = map[string]string{}
+	}
+	opts.Origins["seed-root"] = origin + " (subdir)"
+	return opts
+}
+
+// sessionID returns the first non-empty session identifier in the
+// environment and the variable it came from.
+func (a *App) sessionID() (string, string) {
+	values := map[string]string{}
+	for _, kv := range a.environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			values[k] = v
+		}
+	}
+	for _, key := range sessionSources {
+		if v := values[key]; v != "" {
+			return v, key
+		}
+	}
+	return "", ""
+}
+
+func newSessionToken() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_NamespaceFromSubdir(t *testing.T) {
+	repo := initGitRepo(t, "https://github.com/acme/shop")
+	for _, dir := range []string{"apps/web", "apps/api"} {
+		if err := os.MkdirAll(filepath.Join(repo, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	origin := func(p explainPayload, option string) optionOrigin {
+		for _, o := range p.Origins {
+			if o.Option == option {
+				return o
+			}
+		}
+		return optionOrigin{}
+	}
+
+	web := explainSeed(t, Options{CWD: filepath.Join(repo, "apps", "web"), NamespaceFrom: "subdir"})
+	api := explainSeed(t, Options{CWD: filepath.Join(repo, "apps", "api"), NamespaceFrom: "subdir"})
+	root := explainSeed(t, Options{CWD: repo, NamespaceFrom: "subdir"})
+	if web.SeedSource != root.SeedSource || api.SeedSource != root.SeedSource {
+		t.Fatalf("packages should hash the repo root: web=%q api=%q root=%q", web.SeedSource, api.SeedSource, root.SeedSource)
+	}
+	if web.Seed == api.Seed || web.Seed == root.Seed {
+		t.Fatalf("packages should get their own seeds: web=%d api=%d root=%d", web.Seed, api.Seed, root.Seed)
+	}
+	if ns := origin(web, "namespace"); ns.Value != "subdir:apps/web" || ns.Origin != "cli (git toplevel)" {
+		t.Fatalf("namespace origin = %+v", ns)
+	}
+	if root.Seed != explainSeed(t, Options{CWD: repo, SeedRoot: "git"}).Seed {
+		t.Fatal("the repo root should keep the plain git-root seed")
+	}
+	if got := explainSeed(t, Options{CWD: filepath.Join(repo, "apps", "web"), NamespaceFrom: "subdir", Namespace: "ci"}); origin(got, "namespace").Value != "ci/subdir:apps/web" {
+		t.Fatalf("explicit namespace should prefix the subdir: %+v", origin(got, "namespace"))
+	}
+}
+
+func TestApp_NamespaceFromSession(t *testing.T) {
+	explain := func(environ []string) explainPayload {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithStderr(io.Discard),
+			WithEnviron(environ),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts := Options{Mode: "explain", Format: "json", CWD: "/repo", Namespace: "ci", NamespaceFrom: "session"}
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("Run() unexpected error: %v", err)
+		}
+		var payload explainPayload
+		if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+			t.Fatalf("json parse: %v", err)
+		}
+		return payload
+	}
+
+	first := explain([]string{"TMUX=/tmp/tmux-1000/default,42,0", "TERM_SESSION_ID=w0t0"})
+	again := explain([]string{"TMUX=/tmp/tmux-1000/default,42,0"})
+	other := explain([]string{"TMUX=/tmp/tmux-1000/default,42,1"})
+	if first.Seed != again.Seed {
+		t.Fatalf("same tmux session gave seeds %d and %d", first.Seed, again.Seed)
+	}
+	if first.Seed == other.Seed {
+		t.Fatalf("different tmux sessions share seed %d", first.Seed)
+	}
+	for _, o := range first.Origins {
+		if o.Option == "namespace" && (o.Value != "ci/session:/tmp/tmux-1000/default,42,0" || o.Origin != "cli (TMUX)") {
+			t.Fatalf("namespace origin = %+v", o)
+		}
+	}
+
+	var stdout bytes.Buffer
+	mockExec := &MockExecutor{}
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"PORT=1"}),
+		WithExecutor(mockExec),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	if err := app.Run(context.Background(), Options{Mode: "run", Quiet: true, CWD: "/repo", NamespaceFrom: "session"}, []string{"true"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if !slices.ContainsFunc(mockExec.CapturedEnv, func(kv string) bool { return strings.HasPrefix(kv, "AUTOPORT_SESSION=") }) {
+		t.Fatalf("child env %v lacks the generated AUTOPORT_SESSION", mockExec.CapturedEnv)
+	}
+
+	if err := app.Run(context.Background(), Options{CWD: "/repo", NamespaceFrom: "pane"}, nil); err == nil {
+		t.Fatal("expected an unknown --namespace-from source to fail")
+	}
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+// shellSyntax spells environment changes for one shell.
+type shellSyntax struct {
+	// export sets key to a port or address, which need no quoting.
+	export func(key, value string) string
+	// restore sets key to any value.
+	restore func(key, value string) string
+	unset   func(key string) string
+	// sep joins statements on one line, as AUTOPORT_REVERT keeps them; a
+	// shell without one cannot revert.
+	sep string
+}
+
+var posixShell = shellSyntax{
+	export:  func(key, value string) string { return fmt.Sprintf("export %s=%s", key, value) },
+	restore: func(key, value string) string { return fmt.Sprintf("export %s=%s", key, shellQuote(value)) },
+	unset:   func(key string) string { return "unset " + key },
+	sep:     "; ",
+}
+
+// shells are the --shell names. bash and zsh take the POSIX syntax.
+var shells = map[string]shellSyntax{
+	"posix": posixShell,
+	"bash":  posixShell,
+	"zsh":   posixShell,
+	"fish": {
+		export:  func(key, value string) string { return fmt.Sprintf("set -gx %s %s", key, value) },
+		restore: func(key, value string) string { return fmt.Sprintf("set -gx %s %s", key, fishQuote(value)) },
+		unset:   func(key string) string { return "set -e " + key },
+		sep:     "; ",
+	},
+	"powershell": {
+		export:  func(key, value string) string { return fmt.Sprintf("$env:%s = '%s'", key, value) },
+		restore: func(key, value string) string { return fmt.Sprintf("$env:%s = %s", key, powershellQuote(value)) },
+		unset:   func(key string) string { return fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue", key) },
+		sep:     "; ",
+	},
+	// cmd has no quoting that survives nesting a script in a variable, so
+	// it gets no revert.
+	"cmd": {
+		export: func(key, value string) string { return fmt.Sprintf(`set "%s=%s"`, key, value) },
+	},
+}
+
+// shellFor returns the syntax of --shell name, POSIX when it is empty.
+func shellFor(name string) (shellSyntax, error) {
+	if name == "" {
+		return posixShell, nil
+	}
+	sh, ok := shells[name]
+	if !ok {
+		return shellSyntax{}, fmt.Errorf("--shell must be bash, zsh, fish, powershell, cmd, or posix, got %q", name)
+	}
+	return sh, nil
+}
+
+// fishQuote quotes s for fish, where only \ and ' are special inside
+// single quotes.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// powershellQuote quotes s as a PowerShell verbatim string.
+func powershellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// hookShells are the shells `autoport hook` supports; each snippet reverts
+// the previous directory's exports and asks `autoport hook <shell> export`
+// for the new directory's whenever the working directory changes.
+var hookShells = map[string]string{
+	"bash": `_autoport_hook() {
+  local status=$?
+  if [[ "${_AUTOPORT_PWD-}" != "$PWD" ]]; then
+    _AUTOPORT_PWD=$PWD
+    if [[ -n "${AUTOPORT_REVERT-}" ]]; then eval "$AUTOPORT_REVERT"; fi
+    eval "$(%[1]s hook bash export)"
+  fi
+  return $status
+}
+if [[ ";${PROMPT_COMMAND-};" != *";_autoport_hook;"* ]]; then
+  PROMPT_COMMAND="_autoport_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`,
+	"zsh": `_autoport_hook() {
+  if [[ -n "${AUTOPORT_REVERT-}" ]]; then eval "$AUTOPORT_REVERT"; fi
+  eval "$(%[1]s hook zsh export)"
+}
+typeset -ag chpwd_functions
+if (( ! ${chpwd_functions[(I)_autoport_hook]} )); then
+  chpwd_functions+=(_autoport_hook)
+fi
+_autoport_hook
+`,
+	"fish": `function __autoport_hook --on-variable PWD
+    if set -q AUTOPORT_REVERT
+        eval $AUTOPORT_REVERT
+    end
+    %[1]s hook fish export | source
+end
+__autoport_hook
+`,
+}
+
+// applyHook handles `autoport hook <shell>`, which prints the shell's
+// snippet, and the snippet's `autoport hook <shell> export`, which becomes
+// an export in that shell's syntax for the project holding the working
+// directory. done reports that nothing is left to do: the snippet was
+// printed, or the directory is in no project.
+func (a *App) applyHook(opts Options, args []string) (Options, []string, bool, error) {
+	names := slices.Sorted(maps.Keys(hookShells))
+	if len(args) == 0 || len(args) > 2 || len(args) == 2 && args[1] != "export" {
+		return opts, args, false, fmt.Errorf("usage: autoport hook <%s>", strings.Join(names, "|"))
+	}
+	snippet, ok := hookShells[args[0]]
+	if !ok {
+		return opts, args, false, fmt.Errorf("hook: unsupported shell %q (use %s)", args[0], strings.Join(names, ", "))
+	}
+	if len(args) == 1 {
+		self, err := os.Executable()
+		if err != nil {
+			self = "autoport"
+		}
+		quote := shellQuote
+		if args[0] == "fish" {
+			quote = fishQuote
+		}
+		fmt.Fprintf(a.stdout, snippet, quote(self))
+		return opts, nil, true, nil
+	}
+	root := hookProject(opts.CWD)
+	if root == "" {
+		return opts, nil, true, nil
+	}
+	if root != opts.CWD && len(a.config.Paths()) > 0 {
+		// The config was read for the directory autoport started in.
+		a.config = config.LoadFrom(root)
+	}
+	opts.Mode, opts.Format, opts.Shell, opts.CWD, opts.Quiet = "run", "shell", args[0], root, true
+	return opts, nil, false, nil
+}
+
+// hookProject returns the nearest directory from dir up that has a project
+// config, or "" when there is none. The home directory does not count: its
+// .autoport.json is the user config.
+func hookProject(dir string) string {
+	home, _ := os.UserHomeDir()
+	for dir = filepath.Clean(dir); ; {
+		if dir != home {
+			for _, name := range []string{".autoport.json", config.LocalFile} {
+				if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+					return dir
+				}
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
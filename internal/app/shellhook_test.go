@@ -0,0 +1,99 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_ExportsForOtherShells(t *testing.T) {
+	export := func(opts Options) (string, error) {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithStderr(io.Discard),
+			WithEnviron([]string{"PORT=it's 3000"}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.Mode, opts.Range, opts.CWD = "run", "10000-10100", "/work/shop"
+		err := app.Run(context.Background(), opts, nil)
+		return stdout.String(), err
+	}
+
+	cases := map[string][]string{
+		"fish":       {`^set -gx PORT 100\d\d$`, `^set -gx AUTOPORT_REVERT 'set -gx PORT \\'it\\\\\\'s 3000\\'; set -e AUTOPORT_REVERT'$`},
+		"powershell": {`^\$env:PORT = '100\d\d'$`, `^\$env:AUTOPORT_REVERT = '\$env:PORT = ''it''''s 3000''; Remove-Item Env:AUTOPORT_REVERT -ErrorAction SilentlyContinue'$`},
+		"cmd":        {`^set "PORT=100\d\d"$`},
+	}
+	for shell, patterns := range cases {
+		out, err := export(Options{Shell: shell})
+		if err != nil {
+			t.Fatalf("%s: Run() unexpected error: %v", shell, err)
+		}
+		lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+		if len(lines) != len(patterns) {
+			t.Fatalf("%s: got %q, want %d lines", shell, out, len(patterns))
+		}
+		for i, pattern := range patterns {
+			if !regexp.MustCompile(pattern).MatchString(lines[i]) {
+				t.Errorf("%s: line %q does not match %s", shell, lines[i], pattern)
+			}
+		}
+	}
+	if _, err := export(Options{Shell: "cmd", Revert: true}); err == nil || !strings.Contains(err.Error(), "--revert is not supported") {
+		t.Fatalf("expected cmd reverts to be refused, got %v", err)
+	}
+	if _, err := export(Options{Shell: "tcsh"}); err == nil || !strings.Contains(err.Error(), "--shell must be") {
+		t.Fatalf("expected an unknown shell error, got %v", err)
+	}
+}
+
+func TestApp_HookExportsTheEnclosingProject(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "web", "src")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".autoport.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hook := func(cwd string, args ...string) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithStderr(io.Discard),
+			WithEnviron([]string{}),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		if err := app.Run(context.Background(), Options{Mode: "hook", CWD: cwd}, args); err != nil {
+			t.Fatalf("hook %v: unexpected error: %v", args, err)
+		}
+		return stdout.String()
+	}
+
+	if snippet := hook(sub, "zsh"); !strings.Contains(snippet, "hook zsh export)") || !strings.Contains(snippet, "chpwd_functions") {
+		t.Fatalf("unexpected zsh snippet:\n%s", snippet)
+	}
+	fromSub, fromRoot := hook(sub, "fish", "export"), hook(root, "fish", "export")
+	if !strings.HasPrefix(fromSub, "set -gx PORT ") || fromSub != fromRoot {
+		t.Fatalf("a subdirectory should export its project's ports:\n%s\nvs\n%s", fromSub, fromRoot)
+	}
+	if out := hook(t.TempDir(), "bash", "export"); out != "" {
+		t.Fatalf("a directory outside any project should export nothing, got %q", out)
+	}
+	app := New(WithConfig(&config.Config{Presets: map[string]config.Preset{}}), WithStdout(io.Discard))
+	if err := app.Run(context.Background(), Options{Mode: "hook", CWD: root}, []string{"powershell"}); err == nil || !strings.Contains(err.Error(), "unsupported shell") {
+		t.Fatalf("expected an unsupported shell error, got %v", err)
+	}
+}
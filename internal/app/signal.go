@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// SignalError is the cancellation cause main gives the context when
+// autoport is asked to stop by a signal.
+type SignalError struct {
+	Signal os.Signal
+}
+
+func (e *SignalError) Error() string {
+	return "received " + e.Signal.String()
+}
+
+// signalStatus is the shell's status for a process ended by sig, 128+sig.
+func signalStatus(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// exitPayload closes an execute payload under -f json with how the
+// command ended.
+type exitPayload struct {
+	Mode     string   `json:"mode"`
+	Command  []string `json:"command"`
+	ExitCode int      `json:"exit_code"`
+	Signal   string   `json:"signal,omitempty"`
+}
+
+// commandExit turns how a command ended into the error autoport exits
+// with. A command stopped because autoport got a signal gets the
+// conventional 128+signal status for that signal, even if it then exited
+// cleanly, and one killed by a signal gets it for its own; a status the
+// command chose itself is kept. The signal, if any, is returned for
+// reporting.
+func commandExit(ctx context.Context, name string, err error) (os.Signal, error) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return nil, err
+	}
+	var sigErr *SignalError
+	if ctx.Err() != nil && errors.As(context.Cause(ctx), &sigErr) {
+		// The command was stopped with SIGTERM whatever autoport got.
+		return sigErr.Signal, &ExitError{Code: signalStatus(sigErr.Signal), Err: fmt.Errorf("%s stopped: %w", name, sigErr)}
+	}
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return ws.Signal(), &ExitError{Code: signalStatus(ws.Signal()), Err: fmt.Errorf("%s: %w", name, err)}
+		}
+	}
+	return nil, err
+}
+
+// printExitPayload reports on stderr, after the execute payload, how the
+// command ended.
+func (a *App) printExitPayload(command []string, err error, sig os.Signal) {
+	payload := exitPayload{Mode: "exit", Command: command, ExitCode: exitCodeOf(err)}
+	if sig != nil {
+		payload.Signal = sig.String()
+	}
+	if err := json.NewEncoder(a.stderr).Encode(payload); err != nil {
+		a.logger.Error("failed to encode JSON output", slog.String("error", err.Error()))
+	}
+}
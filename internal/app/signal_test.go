@@ -0,0 +1,53 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_SignalStopExitsWith128PlusSignal(t *testing.T) {
+	var stderr bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(blockingExecutor(time.Minute)),
+		WithStdout(io.Discard),
+		WithStderr(&stderr),
+		WithEnviron([]string{"PORT=3000"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(50*time.Millisecond, func() { cancel(&SignalError{Signal: syscall.SIGINT}) })
+	err := app.Run(ctx, Options{Mode: "run", Range: "10000-10100", CWD: "/work/shop", Format: "json"}, []string{"npm", "start"})
+	if code := exitCodeOf(err); code != 130 {
+		t.Fatalf("Run() = %v (exit code %d), want exit code 130", err, code)
+	}
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if got, want := lines[len(lines)-1], `{"mode":"exit","command":["npm","start"],"exit_code":130,"signal":"interrupt"}`; got != want {
+		t.Fatalf("last JSON line = %s, want %s", got, want)
+	}
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return
+	}
+	app = New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(DefaultExecutor{}),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"PATH=" + os.Getenv("PATH")}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	err = app.Run(context.Background(), Options{Mode: "run", Range: "10000-10100", CWD: t.TempDir(), Quiet: true}, []string{"sh", "-c", "kill -KILL $$"})
+	if code := exitCodeOf(err); code != 137 {
+		t.Fatalf("Run() = %v (exit code %d), want 137 for a killed command", err, code)
+	}
+}
@@ -0,0 +1,246 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+// DefaultSimTrials is how many random org layouts `autoport simulate`
+// draws by default (--trials).
+const DefaultSimTrials = 1000
+
+// simShiftTarget is the share of projects allowed to get a probed port
+// before simulate recommends a wider range.
+const simShiftTarget = 0.05
+
+// simulation estimates how a range policy behaves when many projects run
+// side by side on one machine. Each trial gives every project a random
+// seed, as distinct checkouts get from their paths, and allocates its keys
+// with the running projects' ports busy.
+type simulation struct {
+	Range          string `json:"range"`
+	RangeSize      int    `json:"range_size"`
+	Projects       int    `json:"projects"`
+	KeysPerProject int    `json:"keys_per_project"`
+	Trials         int    `json:"trials"`
+	Seed           uint64 `json:"seed"`
+	// Utilization is the share of the range all keys occupy at once.
+	Utilization float64 `json:"utilization"`
+	// CollisionRate is the share of keys whose preferred port was taken.
+	CollisionRate float64 `json:"collision_rate"`
+	// ShiftedProjectRate is the share of projects with at least one key
+	// moved off its preferred port.
+	ShiftedProjectRate float64 `json:"shifted_project_rate"`
+	MeanProbes         float64 `json:"mean_probes"`
+	MaxProbes          int     `json:"max_probes"`
+	// ExhaustedRate is the share of trials in which the range ran out.
+	ExhaustedRate float64 `json:"exhausted_rate"`
+	// RecommendedSize is the smallest range starting at the same port that
+	// keeps ShiftedProjectRate under 5%, when the proposed one does not.
+	RecommendedSize int      `json:"recommended_size,omitempty"`
+	Recommendations []string `json:"recommendations"`
+
+	start int
+}
+
+// simOutcome tallies one range size over all trials.
+type simOutcome struct {
+	keys, collisions, probes, maxProbes int
+	projects, shifted                   int
+	trials, exhausted                   int
+}
+
+func (o simOutcome) shiftedRate() float64 {
+	return ratio(o.shifted, o.projects)
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// runSimulate Monte-Carlo estimates collision and probe rates for
+// --projects projects of --keys-per-project keys in the range.
+func (a *App) runSimulate(ctx context.Context, opts Options) error {
+	if opts.Projects <= 0 || opts.KeysPerProject <= 0 {
+		return errors.New("simulate needs --projects and --keys-per-project greater than zero")
+	}
+	trials := opts.Trials
+	if trials == 0 {
+		trials = DefaultSimTrials
+	}
+	if trials < 0 {
+		return fmt.Errorf("--trials must be positive, got %d", trials)
+	}
+	spec := port.DefaultRange
+	if opts.Range != "" {
+		spec = opts.Range
+	}
+	spec, err := a.config.ExpandRange(spec)
+	if err != nil {
+		return fmt.Errorf("range: %w", err)
+	}
+	r, err := port.ParseRange(spec)
+	if err != nil {
+		return fmt.Errorf("range: %w", err)
+	}
+	// A fixed default seed keeps reports reproducible; --seed draws
+	// another sample.
+	seed := uint64(1)
+	if opts.Seed != nil {
+		seed = uint64(*opts.Seed)
+	}
+
+	out, err := simulateRange(ctx, r, opts.Projects, opts.KeysPerProject, trials, seed)
+	if err != nil {
+		return err
+	}
+	sim := simulation{
+		Range:              r.String(),
+		RangeSize:          r.Size(),
+		Projects:           opts.Projects,
+		KeysPerProject:     opts.KeysPerProject,
+		Trials:             trials,
+		Seed:               seed,
+		Utilization:        ratio(opts.Projects*opts.KeysPerProject, r.Size()),
+		CollisionRate:      ratio(out.collisions, out.keys),
+		ShiftedProjectRate: out.shiftedRate(),
+		MeanProbes:         ratio(out.probes, out.keys),
+		MaxProbes:          out.maxProbes,
+		ExhaustedRate:      ratio(out.exhausted, out.trials),
+		start:              r.Start,
+	}
+	if sim.ShiftedProjectRate > simShiftTarget {
+		sim.RecommendedSize, err = recommendSize(ctx, r, opts.Projects, opts.KeysPerProject, min(trials, 200), seed)
+		if err != nil {
+			return err
+		}
+	}
+	sim.Recommendations = sim.recommend()
+
+	if opts.Format == "json" {
+		data, err := json.MarshalIndent(sim, "", "  ")
+		if err != nil {
+			return fmt.Errorf("simulate: %w", err)
+		}
+		_, err = fmt.Fprintln(a.stdout, string(data))
+		return err
+	}
+	a.text.Fprintf(a.stdout, "autoport simulate\n")
+	a.text.Fprintf(a.stdout, "range: %s (%d ports)\n", sim.Range, sim.RangeSize)
+	a.text.Fprintf(a.stdout, "projects: %d x %d keys, %d trials (seed %d)\n", sim.Projects, sim.KeysPerProject, sim.Trials, sim.Seed)
+	a.text.Fprintf(a.stdout, "utilization: %.1f%%\n", 100*sim.Utilization)
+	a.text.Fprintf(a.stdout, "keys with a taken preferred port: %.2f%%\n", 100*sim.CollisionRate)
+	a.text.Fprintf(a.stdout, "projects with a moved key: %.2f%%\n", 100*sim.ShiftedProjectRate)
+	a.text.Fprintf(a.stdout, "probes per key: mean %.3f, max %d\n", sim.MeanProbes, sim.MaxProbes)
+	a.text.Fprintf(a.stdout, "trials exhausting the range: %.2f%%\n", 100*sim.ExhaustedRate)
+	a.text.Fprintf(a.stdout, "\nrecommendations:\n")
+	for _, rec := range sim.Recommendations {
+		a.text.Fprintf(a.stdout, "  - %s\n", rec)
+	}
+	return nil
+}
+
+// simulateRange runs trials of projects allocating keys in r, in order,
+// with every port handed out before busy.
+func simulateRange(ctx context.Context, r port.Range, projects, keys, trials int, seed uint64) (simOutcome, error) {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	var out simOutcome
+	for range trials {
+		busy := make(map[int]bool, projects*keys)
+		exhausted := false
+		for range projects {
+			alloc := port.Allocator{Seed: rng.Uint32(), Range: r, IsFree: func(p int) bool { return !busy[p] }}
+			shifted := false
+			for i := range keys {
+				assigned, _, probes, err := alloc.PortForContext(ctx, i)
+				var ex *port.ExhaustedError
+				if errors.As(err, &ex) {
+					exhausted = true
+					break
+				}
+				if err != nil {
+					return simOutcome{}, err
+				}
+				busy[assigned] = true
+				out.keys++
+				out.probes += probes
+				out.maxProbes = max(out.maxProbes, probes)
+				if probes > 0 {
+					out.collisions++
+					shifted = true
+				}
+			}
+			out.projects++
+			if shifted {
+				out.shifted++
+			}
+			if exhausted {
+				break
+			}
+		}
+		out.trials++
+		if exhausted {
+			out.exhausted++
+		}
+	}
+	return out, nil
+}
+
+// recommendSize binary searches the smallest contiguous range starting at
+// r's first port that keeps the shifted project rate under the target, or
+// returns 0 when no range up to port 65535 does.
+func recommendSize(ctx context.Context, r port.Range, projects, keys, trials int, seed uint64) (int, error) {
+	start := r.Start
+	meets := func(size int) (bool, error) {
+		out, err := simulateRange(ctx, port.Range{Start: start, End: start + size - 1}, projects, keys, trials, seed)
+		return out.exhausted == 0 && out.shiftedRate() <= simShiftTarget, err
+	}
+	lo, hi := projects*keys, 65535-start+1
+	if ok, err := meets(hi); err != nil || !ok {
+		return 0, err
+	}
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		ok, err := meets(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+// recommend turns the estimates into advice for a range policy.
+func (s simulation) recommend() []string {
+	var recs []string
+	total := s.Projects * s.KeysPerProject
+	if total > s.RangeSize {
+		recs = append(recs, fmt.Sprintf("the range is too small: %d keys need at least %d ports", total, total))
+	} else if s.ExhaustedRate > 0 {
+		recs = append(recs, fmt.Sprintf("the range ran out in %.2f%% of trials; widen it", 100*s.ExhaustedRate))
+	}
+	switch {
+	case s.ShiftedProjectRate <= simShiftTarget:
+		recs = append(recs, fmt.Sprintf("the range is adequate: %.2f%% of projects get a moved port (target %.0f%%)", 100*s.ShiftedProjectRate, 100*simShiftTarget))
+	case s.RecommendedSize > 0:
+		recs = append(recs, fmt.Sprintf("use about %d ports (%d-%d) to keep moved ports under %.0f%% of projects", s.RecommendedSize, s.start, s.start+s.RecommendedSize-1, 100*simShiftTarget))
+	default:
+		recs = append(recs, fmt.Sprintf("no range below 65536 keeps moved ports under %.0f%% of projects; share ports with groups or split projects across ranges", 100*simShiftTarget))
+	}
+	if s.Utilization > 0.5 && total <= s.RangeSize {
+		recs = append(recs, "over half the range is in use at once; probes grow quickly as it fills")
+	}
+	return recs
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_SimulateEstimatesCollisions(t *testing.T) {
+	run := func(opts Options) simulation {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(WithConfig(&config.Config{Presets: map[string]config.Preset{}}), WithStdout(&stdout))
+		opts.Mode, opts.Format, opts.Trials = "simulate", "json", 200
+		if err := app.Run(context.Background(), opts, nil); err != nil {
+			t.Fatalf("simulate error: %v", err)
+		}
+		var sim simulation
+		if err := json.Unmarshal(stdout.Bytes(), &sim); err != nil {
+			t.Fatalf("json parse: %v", err)
+		}
+		return sim
+	}
+
+	crowded := run(Options{Projects: 50, KeysPerProject: 6, Range: "3000-3999"})
+	if crowded.CollisionRate == 0 || crowded.ShiftedProjectRate <= simShiftTarget || crowded.RecommendedSize <= 1000 {
+		t.Fatalf("a crowded range should collide and recommend a wider one: %+v", crowded)
+	}
+	if again := run(Options{Projects: 50, KeysPerProject: 6, Range: "3000-3999"}); !reflect.DeepEqual(again, crowded) {
+		t.Fatalf("simulate should be reproducible: %+v vs %+v", again, crowded)
+	}
+	roomy := run(Options{Projects: 50, KeysPerProject: 6, Range: fmt.Sprintf("3000-%d", 3000+crowded.RecommendedSize-1)})
+	if roomy.ShiftedProjectRate > simShiftTarget || roomy.RecommendedSize != 0 {
+		t.Fatalf("the recommended range should meet the target: %+v", roomy)
+	}
+	if tiny := run(Options{Projects: 10, KeysPerProject: 5, Range: "3000-3009"}); tiny.ExhaustedRate != 1 || !strings.Contains(tiny.Recommendations[0], "too small") {
+		t.Fatalf("a range smaller than the key count should exhaust: %+v", tiny)
+	}
+
+	app := New(WithConfig(&config.Config{}), WithStdout(io.Discard))
+	if err := app.Run(context.Background(), Options{Mode: "simulate", Projects: 5}, nil); err == nil {
+		t.Fatal("expected an error without --keys-per-project")
+	}
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gelleson/autoport/internal/portowner"
+)
+
+// keyStatus is one key of `autoport status`: its port, whether something
+// is bound to it, and who.
+type keyStatus struct {
+	Key     string `json:"key"`
+	Port    int    `json:"port"`
+	InUse   bool   `json:"in_use"`
+	PID     int    `json:"pid,omitempty"`
+	Process string `json:"process,omitempty"`
+	Cmdline string `json:"cmdline,omitempty"`
+	// Expected is the command the key's port should be held by: its
+	// process for up, else the command given to status.
+	Expected string `json:"expected,omitempty"`
+	// Matches tells whether the holder runs Expected; unset when either
+	// is unknown.
+	Matches *bool `json:"matches,omitempty"`
+}
+
+type statusPayload struct {
+	Mode    string      `json:"mode"`
+	Project string      `json:"project,omitempty"`
+	Keys    []keyStatus `json:"keys"`
+}
+
+// statusProcesses returns the processes `autoport up` would run, when the
+// project has any, so status knows the command each of their keys belongs
+// to.
+func (a *App) statusProcesses(opts Options) ([]process, error) {
+	if len(a.config.Processes) == 0 {
+		if _, err := os.Stat(filepath.Join(opts.CWD, procfile)); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	return a.readProcesses(opts, nil)
+}
+
+// renderStatus reports for every assigned port whether it is bound right
+// now and by which process. isFree is the real port check; the plan itself
+// is made without one, so a running server does not push its own key to
+// another port.
+func (a *App) renderStatus(opts Options, args []string, procs []process, p *plan, isFree checkFunc) error {
+	expected := map[string]string{}
+	for _, proc := range procs {
+		expected[proc.Key] = proc.Command
+	}
+	owners := a.portOwners()
+	statuses := make([]keyStatus, 0, len(p.Overrides))
+	for _, key := range sortedKeys(p.Overrides) {
+		n, err := strconv.Atoi(p.Overrides[key])
+		if err != nil {
+			// Loopback aliases and other non-port values.
+			continue
+		}
+		s := keyStatus{Key: key, Port: n, Expected: expected[key]}
+		if s.Expected == "" {
+			s.Expected = strings.Join(args, " ")
+		}
+		o, owned := owners(n)
+		s.InUse = owned || !isFree(a.protocolFor(key), n)
+		if owned && o.PID > 0 {
+			s.PID, s.Process, s.Cmdline = o.PID, o.Process, o.Cmdline
+			if s.Expected != "" {
+				matches := commandMatches(s.Expected, o)
+				s.Matches = &matches
+			}
+		}
+		statuses = append(statuses, s)
+	}
+
+	if opts.Format == "json" {
+		payload := statusPayload{Mode: "status", Keys: statuses}
+		if opts.Workdir != "" {
+			payload.Project = opts.CWD
+		}
+		return json.NewEncoder(a.stdout).Encode(payload)
+	}
+	if opts.Workdir != "" {
+		a.text.Fprintf(a.stdout, "autoport status %s\n", opts.CWD)
+	} else {
+		a.text.Fprintf(a.stdout, "autoport status\n")
+	}
+	if len(statuses) == 0 {
+		fmt.Fprintln(a.stdout, "no keys")
+		return nil
+	}
+	rows := make([][]string, 0, len(statuses))
+	for _, s := range statuses {
+		state, holder := "free", ""
+		if s.InUse {
+			state, holder = "in use", "unknown"
+			if s.PID > 0 {
+				holder = portowner.Owner{PID: s.PID, Name: s.Process}.String()
+			}
+			if s.Matches != nil && *s.Matches {
+				state = "in use (expected)"
+			} else if s.Matches != nil {
+				state = "in use (unexpected)"
+			}
+		}
+		rows = append(rows, []string{s.Key, strconv.Itoa(s.Port), state, holder, s.Expected})
+	}
+	printTable(a.stdout, []string{"KEY", "PORT", "STATE", "HELD BY", "EXPECTED"}, rows, tableLayout{Width: terminalWidth(a.stdout, a.environ), NoTruncate: opts.NoTruncate})
+	return nil
+}
+
+// commandMatches reports whether the process o runs the command line
+// expected: its command line contains it, or its program is the one
+// expected starts with. Commands that start the server through a wrapper,
+// such as npm starting node, do not match.
+func commandMatches(expected string, o PortOwner) bool {
+	if o.Cmdline != "" && strings.Contains(o.Cmdline, expected) {
+		return true
+	}
+	fields := strings.Fields(expected)
+	if len(fields) == 0 {
+		return false
+	}
+	program := programName(fields[0])
+	if cmd := strings.Fields(o.Cmdline); len(cmd) > 0 && programName(cmd[0]) == program {
+		return true
+	}
+	// Linux truncates process names to 15 bytes.
+	name := programName(o.Process)
+	return name != "" && (name == program || len(name) == 15 && strings.HasPrefix(program, name))
+}
+
+// programName is the name of a program path without a .exe extension.
+func programName(path string) string {
+	if path == "" {
+		return ""
+	}
+	return strings.TrimSuffix(filepath.Base(path), ".exe")
+}
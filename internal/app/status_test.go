@@ -0,0 +1,96 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_StatusReportsPortHolders(t *testing.T) {
+	cwd := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cwd, "Procfile"), []byte("web: ./bin/server --port $PORT\nworker: worker\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	status := func(owners map[int]PortOwner, format string, args ...string) string {
+		t.Helper()
+		var stdout bytes.Buffer
+		app := New(
+			WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+			WithStdout(&stdout),
+			WithEnviron([]string{}),
+			// Every port is busy; status must still report the preferred ones.
+			WithIsFree(func(p int) bool { return false }),
+			WithPortOwner(func(p int) (PortOwner, bool) { o, ok := owners[p]; return o, ok }),
+		)
+		seed := uint32(0)
+		opts := Options{Mode: "status", CWD: cwd, Range: "10000-10100", Seed: &seed, PortEnv: []string{"ADMIN_PORT"}, Format: format}
+		if err := app.Run(context.Background(), opts, args); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return stdout.String()
+	}
+	decode := func(out string) map[string]keyStatus {
+		t.Helper()
+		var payload statusPayload
+		if err := json.Unmarshal([]byte(out), &payload); err != nil {
+			t.Fatalf("decode %q: %v", out, err)
+		}
+		keys := map[string]keyStatus{}
+		for _, k := range payload.Keys {
+			keys[k.Key] = k
+		}
+		return keys
+	}
+
+	ports := decode(status(nil, "json", "node", "admin.js"))
+	if len(ports) != 4 {
+		t.Fatalf("keys = %+v, want PORT, ADMIN_PORT, and the process keys", ports)
+	}
+	owners := map[int]PortOwner{
+		ports["WEB_PORT"].Port:    {PID: 7, Process: "server", Cmdline: "/srv/bin/server --port 10001"},
+		ports["WORKER_PORT"].Port: {PID: 9, Process: "python3", Cmdline: "python3 other.py"},
+	}
+	got := decode(status(owners, "json", "node", "admin.js"))
+	web, worker, admin := got["WEB_PORT"], got["WORKER_PORT"], got["ADMIN_PORT"]
+	if !web.InUse || web.PID != 7 || web.Expected != "./bin/server --port $PORT" || web.Matches == nil || !*web.Matches {
+		t.Fatalf("WEB_PORT = %+v, want held by its process", web)
+	}
+	if !worker.InUse || worker.PID != 9 || worker.Expected != "worker" || worker.Matches == nil || *worker.Matches {
+		t.Fatalf("WORKER_PORT = %+v, want held by another process", worker)
+	}
+	if !admin.InUse || admin.PID != 0 || admin.Expected != "node admin.js" || admin.Matches != nil {
+		t.Fatalf("ADMIN_PORT = %+v, want busy with an unknown holder", admin)
+	}
+
+	text := status(owners, "text")
+	for _, want := range []string{"| WEB_PORT ", "in use (expected)", "pid 7 (server)", "in use (unexpected)", "pid 9 (python3)", "| unknown "} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("text output missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestCommandMatches(t *testing.T) {
+	for _, tc := range []struct {
+		expected string
+		owner    PortOwner
+		want     bool
+	}{
+		{"vite --port 3000", PortOwner{Process: "node", Cmdline: "node /app/node_modules/.bin/vite --port 3000"}, true},
+		{"/usr/bin/python3 -m http.server", PortOwner{Process: "python3", Cmdline: "python3 -m http.server 8000"}, true},
+		{"postgres-exporter-daemon", PortOwner{Process: "postgres-export"}, true},
+		{"server.exe", PortOwner{Process: "server.exe"}, true},
+		{"npm start", PortOwner{Process: "node", Cmdline: "node server.js"}, false},
+		{"post", PortOwner{Process: "postgres"}, false},
+	} {
+		if got := commandMatches(tc.expected, tc.owner); got != tc.want {
+			t.Errorf("commandMatches(%q, %+v) = %v, want %v", tc.expected, tc.owner, got, tc.want)
+		}
+	}
+}
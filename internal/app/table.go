@@ -0,0 +1,200 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxCellWidth caps cells when the terminal width is unknown.
+	maxCellWidth = 48
+	// minCellWidth is the narrowest a truncated column may become.
+	minCellWidth = 10
+)
+
+// tableLayout controls how printTable fits rows to the terminal.
+type tableLayout struct {
+	Width      int // terminal columns; 0 when unknown
+	NoTruncate bool
+}
+
+// printTable renders rows as a bordered table sized by display width, so
+// wide and combining characters stay aligned. Long cells are truncated with
+// an ellipsis unless NoTruncate is set; when the table still cannot fit the
+// terminal, each row is printed as a stacked block instead.
+func printTable(w io.Writer, headers []string, rows [][]string, layout tableLayout) {
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = displayWidth(h)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if cw := displayWidth(cell); cw > widths[i] {
+				widths[i] = cw
+			}
+		}
+	}
+
+	if !layout.NoTruncate {
+		for i := range widths {
+			if widths[i] > maxCellWidth {
+				widths[i] = maxCellWidth
+			}
+		}
+		for layout.Width > 0 && tableWidth(widths) > layout.Width {
+			widest := 0
+			for i := range widths {
+				if widths[i] > widths[widest] {
+					widest = i
+				}
+			}
+			if widths[widest] <= minCellWidth {
+				break
+			}
+			widths[widest] -= min(tableWidth(widths)-layout.Width, widths[widest]-minCellWidth)
+		}
+	}
+	if layout.Width > 0 && tableWidth(widths) > layout.Width {
+		printStacked(w, headers, rows, layout)
+		return
+	}
+
+	var border strings.Builder
+	for _, width := range widths {
+		border.WriteString("+-" + strings.Repeat("-", width) + "-")
+	}
+	border.WriteString("+\n")
+
+	printRow := func(cells []string) {
+		for i, cell := range cells {
+			fmt.Fprintf(w, "| %s ", pad(truncate(cell, widths[i]), widths[i]))
+		}
+		fmt.Fprint(w, "|\n")
+	}
+	fmt.Fprint(w, border.String())
+	printRow(headers)
+	fmt.Fprint(w, border.String())
+	for _, row := range rows {
+		printRow(row)
+	}
+	fmt.Fprint(w, border.String())
+}
+
+// printStacked prints one "HEADER: value" block per row for narrow terminals.
+func printStacked(w io.Writer, headers []string, rows [][]string, layout tableLayout) {
+	labelWidth := 0
+	for _, h := range headers {
+		labelWidth = max(labelWidth, displayWidth(h))
+	}
+	valueWidth := layout.Width - labelWidth - 2
+	for r, row := range rows {
+		if r > 0 {
+			fmt.Fprintln(w)
+		}
+		for i, cell := range row {
+			if !layout.NoTruncate && valueWidth >= 1 {
+				cell = truncate(cell, valueWidth)
+			}
+			fmt.Fprintf(w, "%s %s\n", pad(headers[i]+":", labelWidth+1), cell)
+		}
+	}
+}
+
+func tableWidth(widths []int) int {
+	total := 1
+	for _, width := range widths {
+		total += width + 3
+	}
+	return total
+}
+
+// displayWidth returns the number of terminal columns s occupies.
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) || r == 0x200B:
+		return 0
+	case isWide(r):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// wideRanges are East Asian wide/fullwidth and emoji blocks.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F}, {0x2E80, 0x303E}, {0x3041, 0x33FF}, {0x3400, 0x4DBF},
+	{0x4E00, 0x9FFF}, {0xA000, 0xA4CF}, {0xAC00, 0xD7A3}, {0xF900, 0xFAFF},
+	{0xFE30, 0xFE4F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x1F300, 0x1F64F},
+	{0x1F900, 0x1F9FF}, {0x20000, 0x3FFFD},
+}
+
+func isWide(r rune) bool {
+	for _, rg := range wideRanges {
+		if r >= rg[0] && r <= rg[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate shortens s to at most width columns, ending with an ellipsis.
+func truncate(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		rw := runeWidth(r)
+		if used+rw > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		used += rw
+	}
+	return b.String() + "…"
+}
+
+// pad right-pads s with spaces to width columns.
+func pad(s string, width int) string {
+	if n := width - displayWidth(s); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
+
+// terminalWidth reports the column count of w when it is a terminal,
+// falling back to $COLUMNS from environ, or 0 when unknown.
+func terminalWidth(w io.Writer, environ []string) int {
+	if f, ok := w.(*os.File); ok {
+		if n := ttyColumns(f.Fd()); n > 0 {
+			return n
+		}
+	}
+	if n, err := strconv.Atoi(envValueOf(environ, "COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+func envValueOf(environ []string, key string) string {
+	value := ""
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			value = v
+		}
+	}
+	return value
+}
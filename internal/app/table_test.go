@@ -0,0 +1,51 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDisplayWidthAndTruncate(t *testing.T) {
+	if got := displayWidth("日本"); got != 4 {
+		t.Fatalf("displayWidth(wide) = %d, want 4", got)
+	}
+	if got := displayWidth("é"); got != 1 {
+		t.Fatalf("displayWidth(combining) = %d, want 1", got)
+	}
+	if got := truncate("http://localhost:10000/very/long", 10); got != "http://lo…" {
+		t.Fatalf("truncate() = %q", got)
+	}
+	if got := truncate("日本語", 4); got != "日…" {
+		t.Fatalf("truncate(wide) = %q", got)
+	}
+}
+
+func TestPrintTable_Layouts(t *testing.T) {
+	headers := []string{"ENV", "URL"}
+	rows := [][]string{{"名前_PORT", "http://localhost:10000/" + strings.Repeat("x", 60)}}
+
+	var buf bytes.Buffer
+	printTable(&buf, headers, rows, tableLayout{})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for _, line := range lines[1:] {
+		if displayWidth(line) != displayWidth(lines[0]) {
+			t.Fatalf("misaligned table:\n%s", buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), "…") {
+		t.Fatalf("expected truncated URL:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	printTable(&buf, headers, rows, tableLayout{NoTruncate: true})
+	if !strings.Contains(buf.String(), strings.Repeat("x", 60)) {
+		t.Fatalf("--no-truncate should keep the full value:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	printTable(&buf, headers, rows, tableLayout{Width: 20})
+	if !strings.HasPrefix(buf.String(), "ENV: 名前_PORT\nURL: ") || strings.Contains(buf.String(), "+-") {
+		t.Fatalf("expected stacked layout:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// renderTemplates renders each configured template file with the assigned
+// ports, so servers configured through files (nginx, envoy, prometheus) can
+// use them. Paths are relative to cwd. Templates see the overrides as
+// fields ({{.WEB_PORT}}) and may read other variables with {{env "NAME"}};
+// referring to a key without an assignment is an error.
+func (a *App) renderTemplates(cwd string, overrides map[string]string, env []string) error {
+	if len(a.config.Templates) == 0 {
+		return nil
+	}
+	lookup := map[string]string{}
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			lookup[k] = v
+		}
+	}
+	funcs := template.FuncMap{"env": func(name string) string { return lookup[name] }}
+
+	sources := make([]string, 0, len(a.config.Templates))
+	for src := range a.config.Templates {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+	for _, src := range sources {
+		dst := a.config.Templates[src]
+		if !filepath.IsAbs(src) {
+			src = filepath.Join(cwd, src)
+		}
+		if !filepath.IsAbs(dst) {
+			dst = filepath.Join(cwd, dst)
+		}
+		text, err := os.ReadFile(src)
+		if err != nil {
+			return fmt.Errorf("template %s: %w", src, err)
+		}
+		tmpl, err := template.New(filepath.Base(src)).Funcs(funcs).Option("missingkey=error").Parse(string(text))
+		if err != nil {
+			return fmt.Errorf("template %s: %w", src, err)
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, overrides); err != nil {
+			return fmt.Errorf("template %s: %w", src, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return fmt.Errorf("template %s: %w", src, err)
+		}
+		if err := os.WriteFile(dst, out.Bytes(), 0o644); err != nil {
+			return fmt.Errorf("template %s: %w", src, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_RendersTemplatesBeforeCommand(t *testing.T) {
+	cwd := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cwd, "nginx.conf.tmpl"), []byte("listen {{.WEB_PORT}};\nroot {{env \"HOME\"}};\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Presets: map[string]config.Preset{}, Templates: map[string]string{"nginx.conf.tmpl": ".autoport/nginx.conf"}}
+	app := New(
+		WithConfig(cfg),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"WEB_PORT=3000", "HOME=/home/dev"}),
+		WithExecutor(&MockExecutor{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	seed := uint32(0)
+	opts := Options{Mode: "run", Quiet: true, Range: "10000-11000", CWD: cwd, Seed: &seed, Includes: []string{"WEB_PORT"}}
+	if err := app.Run(context.Background(), opts, []string{"nginx"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(cwd, ".autoport", "nginx.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "listen 10000;\nroot /home/dev;\n" {
+		t.Fatalf("rendered %q", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(cwd, "nginx.conf.tmpl"), []byte("{{.API_PORT}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run(context.Background(), opts, []string{"nginx"}); err == nil || !strings.Contains(err.Error(), "API_PORT") {
+		t.Fatalf("expected an error for a key without an assignment, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// pipelineContext bounds autoport's own work (scanning, allocation, and
+// everything derived from it) by --timeout. The returned context is for
+// that work only; the wrapped command, hooks, and servers keep the
+// caller's context.
+func pipelineContext(ctx context.Context, opts Options) (context.Context, context.CancelFunc, error) {
+	if opts.Timeout < 0 {
+		return nil, nil, fmt.Errorf("--timeout must be positive, got %s", opts.Timeout)
+	}
+	if opts.Timeout == 0 {
+		return ctx, func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	return ctx, cancel, nil
+}
+
+// bounded runs fn and returns when it does or when ctx's deadline passes,
+// whichever comes first. fn runs on its own goroutine because a read on a
+// hung network filesystem cannot be interrupted; autoport exits with the
+// timeout error instead of waiting for it.
+func (a *App) bounded(ctx context.Context, opts Options, fn func(context.Context) error) error {
+	if opts.Timeout <= 0 {
+		return fn(ctx)
+	}
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return timeoutError(opts)
+	}
+	return err
+}
+
+// timeoutError reports a --timeout that expired before the command
+// started, naming what usually makes the scan slow.
+func timeoutError(opts Options) error {
+	return fmt.Errorf("timed out after %s scanning and allocating ports in %s (slow or hung filesystem, or a large tree?); raise --timeout or narrow the scan with max_depth or -i: %w",
+		opts.Timeout, opts.CWD, context.DeadlineExceeded)
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_TimeoutBoundsPlanningButNotTheCommand(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	// The command records whether its context had a deadline.
+	var ran, hasDeadline bool
+	exec := executorFunc(func(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+		_, hasDeadline = ctx.Deadline()
+		ran = true
+		return nil
+	})
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(exec),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"PORT=1"}),
+		// A probe stuck like a read on a hung network mount.
+		WithIsFree(func(int) bool { <-release; return true }),
+	)
+	opts := Options{Mode: "run", Range: "10000-10100", CWD: "/work/shop", Timeout: 20 * time.Millisecond}
+	err := app.Run(context.Background(), opts, []string{"npm", "start"})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Fatalf("Run() = %v, want timeout error", err)
+	}
+	if ran {
+		t.Fatal("command ran after the timeout")
+	}
+
+	app = New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(exec),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"PORT=1"}),
+		WithIsFree(func(int) bool { return true }),
+	)
+	opts.Timeout = time.Minute
+	if err := app.Run(context.Background(), opts, []string{"npm", "start"}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if !ran || hasDeadline {
+		t.Fatalf("command ran=%v with deadline=%v, want it run without the pipeline deadline", ran, hasDeadline)
+	}
+}
@@ -0,0 +1,263 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/internal/scanner"
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+// traceVersion is the schema version of --record files.
+const traceVersion = 1
+
+// allocTrace holds every input an allocation depends on, so --replay can
+// reproduce it on another machine without the project, its environment, or
+// its port usage.
+type allocTrace struct {
+	Version     int    `json:"version"`
+	RecordedAt  string `json:"recorded_at"`
+	CWD         string `json:"cwd"`
+	Mode        string `json:"mode"`
+	EnvironHash string `json:"environ_sha256"`
+	Range       string `json:"range"`
+	Seed        struct {
+		Value    uint32 `json:"value"`
+		Material string `json:"material"`
+		Origin   string `json:"origin"`
+	} `json:"seed"`
+	Includes        []string `json:"includes,omitempty"`
+	Excludes        []string `json:"excludes,omitempty"`
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+	// ExcludeCategories, like ExcludePatterns, may come from presets.
+	ExcludeCategories []string `json:"exclude_categories,omitempty"`
+	Keys              []string `json:"keys,omitempty"`
+	PreferCurrent     bool     `json:"prefer_current,omitempty"`
+	RequirePreferred  bool     `json:"require_preferred,omitempty"`
+	// Config is the effective config without the commands, templates, and
+	// files it names, which replay never uses.
+	Config      *config.Config    `json:"config"`
+	Files       []string          `json:"files"`
+	Discoveries []traceDiscovery  `json:"discoveries"`
+	Locked      map[string]string `json:"locked,omitempty"`
+	Inherited   map[string]string `json:"inherited,omitempty"`
+	Probes      []traceProbe      `json:"probes"`
+	Assignments map[string]int    `json:"assignments"`
+}
+
+type traceDiscovery struct {
+	Key       string `json:"key"`
+	Source    string `json:"source"`
+	Kind      string `json:"kind"`
+	Value     string `json:"value,omitempty"`
+	IgnoredBy string `json:"ignored_by,omitempty"`
+	Unmanaged bool   `json:"unmanaged,omitempty"`
+}
+
+// traceProbe is the outcome of the first availability check of a port
+// for a protocol; an empty protocol is the default TCP check.
+type traceProbe struct {
+	Port     int           `json:"port"`
+	Protocol port.Protocol `json:"protocol,omitempty"`
+	Free     bool          `json:"free"`
+}
+
+// startRecording wraps the port checker so the first outcome for every
+// port lands in the trace. It returns a func restoring the checker.
+func (a *App) startRecording(opts Options) func() {
+	t := &allocTrace{
+		Version:     traceVersion,
+		RecordedAt:  a.now().UTC().Format(time.RFC3339),
+		CWD:         opts.CWD,
+		Mode:        opts.Mode,
+		EnvironHash: environHash(a.environ),
+	}
+	seen := map[probeKey]bool{}
+	isFree := a.isFree
+	a.isFree = func(proto port.Protocol, p int) bool {
+		free := isFree(proto, p)
+		if key := (probeKey{proto, p}); !seen[key] {
+			seen[key] = true
+			t.Probes = append(t.Probes, traceProbe{Port: p, Protocol: proto, Free: free})
+		}
+		return free
+	}
+	a.recording = t
+	return func() { a.isFree, a.recording = isFree, nil }
+}
+
+// recordPlanInputs notes the resolved inputs and discoveries of a plan.
+func (t *allocTrace) recordPlanInputs(opts Options, res resolvedOptions, cfg *config.Config, si seedInfo, discoveries []scanner.Discovery) {
+	t.Range = res.Range
+	t.Seed.Value, t.Seed.Material, t.Seed.Origin = si.Value, si.Material, si.Origin
+	t.Includes, t.Excludes, t.Keys = res.Includes, res.Excludes, opts.PortEnv
+	t.ExcludePatterns, t.ExcludeCategories = res.ExcludePatterns, res.ExcludeCategories
+	t.PreferCurrent, t.RequirePreferred = opts.PreferCurrent, opts.RequirePreferred
+	t.Config = replayableConfig(cfg)
+	files := map[string]string{}
+	t.Discoveries = make([]traceDiscovery, 0, len(discoveries))
+	for _, d := range discoveries {
+		t.Discoveries = append(t.Discoveries, traceDiscovery{Key: d.Key, Source: d.Source, Kind: d.Kind, Value: d.Value, IgnoredBy: d.IgnoredBy, Unmanaged: d.Unmanaged})
+		if d.Kind != scanner.KindEnvironment && d.Kind != scanner.KindDefault {
+			files[d.Source] = d.Kind
+		}
+	}
+	t.Files = sortedKeys(files)
+}
+
+// writeTrace completes the trace with the plan's result and stores it.
+func (a *App) writeTrace(path string, p *plan) error {
+	t := a.recording
+	t.Assignments = make(map[string]int, len(p.Assignments))
+	for _, as := range p.Assignments {
+		t.Assignments[as.Key] = as.Assigned
+	}
+	sort.Slice(t.Probes, func(i, j int) bool {
+		if t.Probes[i].Port != t.Probes[j].Port {
+			return t.Probes[i].Port < t.Probes[j].Port
+		}
+		return t.Probes[i].Protocol < t.Probes[j].Protocol
+	})
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("record trace: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("record trace: %w", err)
+	}
+	return nil
+}
+
+// startReplay loads a trace and points opts and the App at its inputs:
+// recorded discoveries replace the scan, recorded probe outcomes the port
+// checker. Replay only plans; it runs no command and writes no state.
+func (a *App) startReplay(opts *Options, args []string) (func(), error) {
+	if opts.Mode != "explain" && (opts.Mode != "run" || len(args) > 0 || opts.Script != "") {
+		return nil, errors.New("--replay reproduces a plan; use it with explain or without a command")
+	}
+	data, err := os.ReadFile(opts.Replay)
+	if err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	var t allocTrace
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("replay %s: %w", opts.Replay, err)
+	}
+	if t.Version != traceVersion {
+		return nil, fmt.Errorf("replay %s: unsupported trace version %d", opts.Replay, t.Version)
+	}
+	if t.Config == nil {
+		t.Config = &config.Config{}
+	}
+	if t.Config.Presets == nil {
+		t.Config.Presets = map[string]config.Preset{}
+	}
+
+	// The namespace is part of the recorded seed.
+	t.Config.NamespaceFrom = ""
+	opts.CWD = t.CWD
+	opts.Namespace, opts.NamespaceFrom = "", ""
+	opts.Range = t.Range
+	opts.Origins = map[string]string{"range": "replay " + opts.Replay}
+	opts.Includes, opts.Excludes, opts.PortEnv = t.Includes, t.Excludes, t.Keys
+	opts.ExcludeCategories = t.ExcludeCategories
+	opts.Ignores, opts.Presets = nil, nil
+	opts.PreferCurrent, opts.RequirePreferred = t.PreferCurrent, t.RequirePreferred
+	opts.RespectExisting, opts.UseLock, opts.FromSnapshot, opts.Pure = false, false, "", false
+	opts.CacheTTL = 0
+	if opts.Mode == "run" {
+		opts.DryRun = true
+	}
+
+	free := make(map[probeKey]bool, len(t.Probes))
+	for _, pr := range t.Probes {
+		free[probeKey{pr.Protocol, pr.Port}] = pr.Free
+	}
+	cfg, isFree, stateDir := a.config, a.isFree, a.stateDir
+	a.config = t.Config
+	a.isFree = func(proto port.Protocol, p int) bool {
+		v, ok := free[probeKey{proto, p}]
+		return !ok || v
+	}
+	a.stateDir = ""
+	a.replaying = &t
+	return func() { a.config, a.isFree, a.stateDir, a.replaying = cfg, isFree, stateDir, nil }, nil
+}
+
+// replaySeed reports the recorded seed, naming the trace it came from.
+func (t *allocTrace) replaySeed(path string) seedInfo {
+	return seedInfo{Value: t.Seed.Value, Material: t.Seed.Material, Origin: "replay " + path + " (" + t.Seed.Origin + ")"}
+}
+
+func (t *allocTrace) discoveries() []scanner.Discovery {
+	out := make([]scanner.Discovery, 0, len(t.Discoveries))
+	for _, d := range t.Discoveries {
+		out = append(out, scanner.Discovery{Key: d.Key, Source: d.Source, Kind: d.Kind, Value: d.Value, IgnoredBy: d.IgnoredBy, Unmanaged: d.Unmanaged})
+	}
+	return out
+}
+
+// checkReplay warns about keys whose replayed port differs from the one
+// recorded, which points at a behavior change between versions.
+func (a *App) checkReplay(p *plan) {
+	got := make(map[string]int, len(p.Assignments))
+	for _, as := range p.Assignments {
+		got[as.Key] = as.Assigned
+	}
+	keys := maps.Clone(got)
+	maps.Copy(keys, a.replaying.Assignments)
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		want, recorded := a.replaying.Assignments[key]
+		have, replayed := got[key]
+		if recorded && replayed && want == have {
+			continue
+		}
+		w := newWarning(WarnReplayMismatch, "replayed %s is %s, the trace recorded %s", key, traceValue(have, replayed), traceValue(want, recorded)).
+			with("key", key)
+		a.logger.Warn(a.warningText(w), slog.String("code", w.Code))
+	}
+}
+
+func traceValue(port int, ok bool) string {
+	if !ok {
+		return "unassigned"
+	}
+	return strconv.Itoa(port)
+}
+
+// replayableConfig copies cfg without the settings replay never uses:
+// commands, templates, trust, health paths, and reservations files.
+func replayableConfig(cfg *config.Config) *config.Config {
+	out := *cfg
+	out.Hooks = config.HooksConfig{}
+	out.Scripts = nil
+	out.BranchResolverCmd = ""
+	out.Templates = nil
+	out.Links = nil
+	out.Plugins = config.PluginsConfig{}
+	out.Processes = nil
+	out.TrustedSources = nil
+	out.Health = nil
+	out.Reservations = config.ReservationsConfig{}
+	return &out
+}
+
+// environHash fingerprints the environment without recording its values.
+func environHash(environ []string) string {
+	sorted := slices.Clone(environ)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:])
+}
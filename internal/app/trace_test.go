@@ -0,0 +1,75 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_RecordAndReplayReproduceAllocation(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("WEB_PORT=3000\nAPI_PORT=4000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	trace := filepath.Join(t.TempDir(), "trace.json")
+	seed := uint32(0)
+	var recorded bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}, KeyOrder: []string{"WEB_PORT"}}),
+		WithStdout(&recorded),
+		WithEnviron([]string{"PORT=1", "SECRET=hunter2"}),
+		WithIsFree(func(p int) bool { return p != 10000 && p != 10002 }),
+	)
+	opts := Options{Mode: "run", Format: "dotenv", Range: "10000-10100", CWD: dir, Seed: &seed, Record: trace}
+	if err := app.Run(context.Background(), opts, nil); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("hunter2")) {
+		t.Fatalf("trace must not contain environment values other than port keys:\n%s", data)
+	}
+	var saved allocTrace
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved.Files, []string{".env"}) || !slices.Contains(saved.Probes, traceProbe{Port: 10000, Free: false}) {
+		t.Fatalf("trace files = %v, probes = %v", saved.Files, saved.Probes)
+	}
+
+	// Another machine: no project files, every port free, different
+	// environment and config.
+	var replayed, logs bytes.Buffer
+	other := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&replayed),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		WithEnviron([]string{"HOME=/home/maintainer"}),
+		WithIsFree(func(int) bool { return true }),
+	)
+	replay := Options{Mode: "run", Format: "dotenv", CWD: t.TempDir(), Replay: trace}
+	if err := other.Run(context.Background(), replay, nil); err != nil {
+		t.Fatalf("Run(--replay) unexpected error: %v", err)
+	}
+	if replayed.String() != recorded.String() {
+		t.Fatalf("replay = %q, recorded %q", replayed.String(), recorded.String())
+	}
+	if strings.Contains(logs.String(), WarnReplayMismatch) {
+		t.Fatalf("unexpected mismatch warnings: %s", logs.String())
+	}
+
+	if err := other.Run(context.Background(), replay, []string{"echo"}); err == nil || !strings.Contains(err.Error(), "--replay") {
+		t.Fatalf("replay with a command = %v, want refusal", err)
+	}
+}
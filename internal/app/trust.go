@@ -0,0 +1,75 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// confirmCommands makes sure the command lines a config file contributes
+// (scripts, hooks) may run. They may when the file is trusted (the user
+// config, or a trusted_sources entry), when --yes is set, or when the user
+// agrees at a prompt. Without a terminal to ask on, or while a query is
+// being answered, they are refused. Each file is asked about at most once
+// per App.
+func (a *App) confirmCommands(opts Options, source string, commands []string) error {
+	if len(commands) == 0 || opts.Yes || a.config.Trusted(source) || a.approved[source] {
+		return nil
+	}
+	refused := fmt.Errorf("refusing to run commands from untrusted config %s (%s): pass --yes, or add it to trusted_sources in ~/.autoport.json", source, strings.Join(commands, "; "))
+	if f, ok := a.stdin.(*os.File); ok && ttyColumns(f.Fd()) == 0 || a.noPrompt {
+		return refused
+	}
+
+	fmt.Fprintf(a.stderr, "autoport: %s is not a trusted config source and wants to run:\n", source)
+	for _, c := range commands {
+		fmt.Fprintf(a.stderr, "  %s\n", c)
+	}
+	fmt.Fprint(a.stderr, "Run these commands? [y/N] ")
+	answer, _ := bufio.NewReader(a.stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+	default:
+		return refused
+	}
+	if a.approved == nil {
+		a.approved = map[string]bool{}
+	}
+	a.approved[source] = true
+	return nil
+}
+
+// confirmHooks confirms the hooks that can run for this invocation:
+// on_change always, pre_run and on_exit only around a wrapped command.
+// Hooks are grouped by the file they came from so each file is asked
+// about once, listing everything it would run.
+func (a *App) confirmHooks(opts Options, withCommand bool) error {
+	type stage struct {
+		name  string
+		hooks []string
+	}
+	stages := []stage{{"on_change", a.config.Hooks.OnChange}}
+	if withCommand {
+		stages = append(stages, stage{"pre_run", a.config.Hooks.PreRun}, stage{"on_exit", a.config.Hooks.OnExit})
+	}
+
+	var sources []string
+	bySource := map[string][]string{}
+	for _, st := range stages {
+		if len(st.hooks) == 0 {
+			continue
+		}
+		source := a.config.Origin("hooks." + st.name)
+		if _, seen := bySource[source]; !seen {
+			sources = append(sources, source)
+		}
+		bySource[source] = append(bySource[source], st.hooks...)
+	}
+	for _, source := range sources {
+		if err := a.confirmCommands(opts, source, bySource[source]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_UntrustedConfigCommandsNeedConsent(t *testing.T) {
+	cfg := &config.Config{
+		Presets: map[string]config.Preset{},
+		Scripts: map[string]config.Script{"dev": {Command: "npm run dev"}},
+		Hooks:   config.HooksConfig{PreRun: []string{"./seed.sh"}, OnExit: []string{"./down.sh"}},
+		Origins: map[string]string{
+			"scripts.dev":   "/clone/.autoport.json",
+			"hooks.pre_run": "/clone/.autoport.json",
+			"hooks.on_exit": "/clone/.autoport.json",
+		},
+	}
+	run := func(stdin string, opts Options) (*RecordingExecutor, string, error) {
+		t.Helper()
+		rec := &RecordingExecutor{}
+		var stderr bytes.Buffer
+		app := New(
+			WithConfig(cfg),
+			WithStdin(strings.NewReader(stdin)),
+			WithStdout(io.Discard),
+			WithStderr(&stderr),
+			WithEnviron([]string{"PORT=3000"}),
+			WithExecutor(rec),
+			WithIsFree(func(p int) bool { return true }),
+		)
+		opts.Mode, opts.Quiet, opts.Range, opts.CWD = "run", true, "10000-11000", "/clone"
+		err := app.Run(context.Background(), opts, nil)
+		return rec, stderr.String(), err
+	}
+
+	rec, prompt, err := run("n\n", Options{Script: "dev"})
+	if err == nil || !strings.Contains(err.Error(), "untrusted config /clone/.autoport.json") || len(rec.Calls) != 0 {
+		t.Fatalf("declined prompt should refuse to run anything: err=%v calls=%+v", err, rec.Calls)
+	}
+	if !strings.Contains(prompt, "  npm run dev\n") {
+		t.Fatalf("prompt should list the script command:\n%s", prompt)
+	}
+
+	// One answer covers the file: the hooks are listed together and not
+	// asked about again.
+	rec, prompt, err = run("y\ny\n", Options{Script: "dev"})
+	if err != nil || len(rec.Calls) != 3 {
+		t.Fatalf("accepted prompt should run hooks and script: err=%v calls=%+v", err, rec.Calls)
+	}
+	if strings.Count(prompt, "Run these commands?") != 1 {
+		t.Fatalf("expected a single prompt per file:\n%s", prompt)
+	}
+
+	if rec, _, err = run("", Options{Script: "dev", Yes: true}); err != nil || len(rec.Calls) != 3 {
+		t.Fatalf("--yes should skip the prompt: err=%v calls=%+v", err, rec.Calls)
+	}
+
+	cfg.TrustedSources = []string{"/clone"}
+	if rec, _, err = run("", Options{Script: "dev"}); err != nil || len(rec.Calls) != 3 {
+		t.Fatalf("trusted source should run without asking: err=%v calls=%+v", err, rec.Calls)
+	}
+}
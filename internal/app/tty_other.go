@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package app
+
+// ttyColumns is not implemented on this platform; $COLUMNS is used instead.
+func ttyColumns(fd uintptr) int {
+	return 0
+}
@@ -0,0 +1,20 @@
+//go:build linux || darwin
+
+package app
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// ttyColumns returns the width of the terminal behind fd, or 0.
+func ttyColumns(fd uintptr) int {
+	var ws struct {
+		Row, Col, X, Y uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0
+	}
+	return int(ws.Col)
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package app
+
+const umaskSupported = false
+
+func withUmask(_ int, fn func() error) error { return fn() }
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package app
+
+import "syscall"
+
+const umaskSupported = true
+
+// withUmask runs fn with the process umask set to mask. Children started
+// by fn inherit it; autoport's own umask is restored afterwards.
+func withUmask(mask int, fn func() error) error {
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	return fn()
+}
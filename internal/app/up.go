@@ -0,0 +1,271 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// procfile is the file `autoport up` reads when the config has no
+// processes.
+const procfile = "Procfile"
+
+// process is one command `autoport up` runs.
+type process struct {
+	Name    string
+	Command string
+	// Key is the port key the process gets as PORT, <NAME>_PORT, so the
+	// other processes can reach it.
+	Key string
+}
+
+// readProcesses returns the processes named in args, or all of them, from
+// the config's processes section or else the project's Procfile.
+func (a *App) readProcesses(opts Options, args []string) ([]process, error) {
+	var procs []process
+	source := "config processes"
+	if len(a.config.Processes) > 0 {
+		for _, name := range slices.Sorted(maps.Keys(a.config.Processes)) {
+			procs = append(procs, process{Name: name, Command: a.config.Processes[name]})
+		}
+	} else {
+		source = procfile
+		data, err := os.ReadFile(filepath.Join(opts.CWD, procfile))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no %s in %s and no processes in the config", procfile, opts.CWD)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("up: %w", err)
+		}
+		if procs, err = parseProcfile(string(data)); err != nil {
+			return nil, fmt.Errorf("%s: %w", procfile, err)
+		}
+	}
+	if len(procs) == 0 {
+		return nil, fmt.Errorf("%s lists no processes", source)
+	}
+	keys := map[string]string{}
+	for i := range procs {
+		if !isProcessName(procs[i].Name) {
+			return nil, fmt.Errorf("%s: invalid process name %q (use letters, digits, '-', and '_')", source, procs[i].Name)
+		}
+		procs[i].Key = composeKeyPart(procs[i].Name) + "_PORT"
+		if other, ok := keys[procs[i].Key]; ok {
+			return nil, fmt.Errorf("%s: processes %s and %s would share %s", source, other, procs[i].Name, procs[i].Key)
+		}
+		keys[procs[i].Key] = procs[i].Name
+	}
+	if len(args) == 0 {
+		return procs, nil
+	}
+	var selected []process
+	for _, name := range args {
+		i := slices.IndexFunc(procs, func(p process) bool { return p.Name == name })
+		if i < 0 {
+			names := make([]string, len(procs))
+			for j, p := range procs {
+				names[j] = p.Name
+			}
+			return nil, fmt.Errorf("unknown process %q (available: %s)", name, strings.Join(names, ", "))
+		}
+		if !slices.ContainsFunc(selected, func(p process) bool { return p.Name == name }) {
+			selected = append(selected, procs[i])
+		}
+	}
+	return selected, nil
+}
+
+// parseProcfile reads "name: command" lines, skipping blank lines and
+// # comments, in file order.
+func parseProcfile(src string) ([]process, error) {
+	var procs []process
+	for n, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name, command, ok := strings.Cut(line, ":")
+		command = strings.TrimSpace(command)
+		if !ok || command == "" {
+			return nil, fmt.Errorf("line %d: expected \"name: command\"", n+1)
+		}
+		name = strings.TrimSpace(name)
+		if slices.ContainsFunc(procs, func(p process) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("line %d: duplicate process %q", n+1, name)
+		}
+		procs = append(procs, process{Name: name, Command: command})
+	}
+	return procs, nil
+}
+
+func isProcessName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// confirmProcesses asks before running processes from untrusted config
+// files; a Procfile is run as foreman would run it.
+func (a *App) confirmProcesses(opts Options, procs []process) error {
+	for _, p := range procs {
+		if _, ok := a.config.Processes[p.Name]; !ok {
+			continue
+		}
+		if err := a.confirmCommands(opts, a.config.Origin("processes."+p.Name), []string{p.Command}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processKeys returns the port keys of procs.
+func processKeys(procs []process) []string {
+	keys := make([]string, len(procs))
+	for i, p := range procs {
+		keys[i] = p.Key
+	}
+	return keys
+}
+
+// runUp runs procs side by side with the project's assignments, each with
+// its own port as PORT, and prefixes their output lines with the process
+// name. When one process exits, or autoport is interrupted, the others are
+// stopped; the first process to exit decides the result.
+func (a *App) runUp(ctx context.Context, opts Options, procs []process, overrides map[string]string) error {
+	if !opts.Quiet || opts.DryRun {
+		a.printOverrideSummary("up", processNames(procs), overrides, nil, nil, nil, opts.NoTruncate)
+	}
+	if opts.DryRun {
+		return nil
+	}
+	env := a.buildExecEnv(a.environ, overrides)
+	if err := a.renderTemplates(opts.CWD, overrides, env); err != nil {
+		return err
+	}
+	if err := a.applyLinks(opts.CWD, overrides, false, opts.Quiet); err != nil {
+		return err
+	}
+	if err := a.runHooks(ctx, "pre_run", a.config.Hooks.PreRun, env); err != nil {
+		return err
+	}
+	a.publishReservations(opts.CWD, overrides)
+
+	width := 0
+	for _, p := range procs {
+		width = max(width, len(p.Name))
+	}
+	var mu sync.Mutex
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	type exit struct {
+		name string
+		err  error
+	}
+	exits := make(chan exit, len(procs))
+	a.metrics.leases.Set(int64(len(overrides)))
+	for _, p := range procs {
+		own := maps.Clone(overrides)
+		own["PORT"] = overrides[p.Key]
+		cmdEnv := a.buildExecEnv(a.commandEnviron(opts), own)
+		prefix := fmt.Sprintf("%-*s | ", width, p.Name)
+		stdout := &prefixWriter{w: a.stdout, mu: &mu, prefix: prefix}
+		stderr := &prefixWriter{w: a.stderr, mu: &mu, prefix: prefix}
+		name, args := shellCommand(p.Command)
+		go func() {
+			err := a.executor.Run(runCtx, name, args, cmdEnv, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+			exits <- exit{name: p.Name, err: err}
+		}()
+	}
+
+	var first exit
+	for i := range procs {
+		e := <-exits
+		if i > 0 {
+			continue
+		}
+		first = e
+		if ctx.Err() == nil {
+			// The exit status is returned as is, so name the process here.
+			a.logger.Info("process exited; stopping the others", slog.String("process", e.name), slog.Int("exit_code", exitCodeOf(e.err)))
+		}
+		stop()
+	}
+	a.metrics.leases.Set(0)
+	a.releaseReservations(opts.CWD)
+	_, first.err = commandExit(ctx, first.name, first.err)
+	if len(a.config.Hooks.OnExit) == 0 {
+		return first.err
+	}
+	exitEnv := append(env, fmt.Sprintf("AUTOPORT_EXIT_CODE=%d", exitCodeOf(first.err)))
+	hookErr := a.runHooks(context.WithoutCancel(ctx), "on_exit", a.config.Hooks.OnExit, exitEnv)
+	if first.err != nil {
+		return first.err
+	}
+	return hookErr
+}
+
+func processNames(procs []process) []string {
+	names := make([]string, len(procs))
+	for i, p := range procs {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// prefixWriter writes whole lines to w, each after prefix, holding mu so
+// lines from concurrent processes never interleave. A partial line waits
+// for its newline or Flush.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    bytes.Buffer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf.Write(b)
+	for {
+		i := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if err := p.writeLine(p.buf.Next(i + 1)); err != nil {
+			return len(b), err
+		}
+	}
+}
+
+// Flush writes a trailing partial line.
+func (p *prefixWriter) Flush() {
+	if p.buf.Len() > 0 {
+		p.writeLine(append(p.buf.Bytes(), '\n'))
+		p.buf.Reset()
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w := bufio.NewWriter(p.w)
+	w.WriteString(p.prefix)
+	w.Write(line)
+	return w.Flush()
+}
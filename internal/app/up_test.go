@@ -0,0 +1,97 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestParseProcfile(t *testing.T) {
+	procs, err := parseProcfile("# dev processes\nweb: serve --port $PORT\n\nworker:bundle exec sidekiq\n")
+	if err != nil {
+		t.Fatalf("parseProcfile() unexpected error: %v", err)
+	}
+	want := []process{{Name: "web", Command: "serve --port $PORT"}, {Name: "worker", Command: "bundle exec sidekiq"}}
+	if !reflect.DeepEqual(procs, want) {
+		t.Fatalf("procs = %+v, want %+v", procs, want)
+	}
+	for _, src := range []string{"web\n", "web: a\nweb: b\n"} {
+		if _, err := parseProcfile(src); err == nil {
+			t.Fatalf("expected an error for %q", src)
+		}
+	}
+}
+
+func TestApp_UpRunsProcessesWithOwnPorts(t *testing.T) {
+	cwd := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cwd, "Procfile"), []byte("web: serve\nmigrate: migrate\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// "serve" reports its port and runs until stopped, "migrate" prints a
+	// partial line and fails.
+	var mu sync.Mutex
+	envs := map[string][]string{}
+	exec := executorFunc(func(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+		line := args[len(args)-1]
+		mu.Lock()
+		envs[line] = env
+		mu.Unlock()
+		switch line {
+		case "serve":
+			fmt.Fprintf(stdout, "listening on %s\nready\n", envValue(env, "PORT"))
+			<-ctx.Done()
+			return ctx.Err()
+		default:
+			fmt.Fprint(stderr, "migration failed")
+			return &ExitError{Code: 3}
+		}
+	})
+	var stdout, stderr bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(exec),
+		WithStdout(&stdout),
+		WithStderr(&stderr),
+		WithLogger(slog.New(slog.NewTextHandler(&stderr, nil))),
+		WithEnviron([]string{"API_PORT=1"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	seed := uint32(0)
+	err := app.Run(context.Background(), Options{Mode: "up", CWD: cwd, Range: "10000-10100", Seed: &seed}, nil)
+	if exitCodeOf(err) != 3 {
+		t.Fatalf("Run() = %v, want the failing process's exit code 3", err)
+	}
+	web, migrate := envs["serve"], envs["migrate"]
+	if envValue(web, "PORT") == "" || envValue(web, "PORT") != envValue(web, "WEB_PORT") || envValue(migrate, "PORT") != envValue(migrate, "MIGRATE_PORT") {
+		t.Fatalf("each process should get its own key as PORT: web %q, migrate %q", web, migrate)
+	}
+	if envValue(web, "PORT") == envValue(migrate, "PORT") || envValue(web, "API_PORT") != envValue(migrate, "API_PORT") {
+		t.Fatal("processes should share the project keys but not PORT")
+	}
+	if want := "web     | listening on " + envValue(web, "PORT") + "\nweb     | ready\n"; stdout.String() != want {
+		t.Fatalf("stdout = %q, want %q", stdout.String(), want)
+	}
+	for _, s := range []string{"autoport overrides (4) -> up web migrate", "migrate | migration failed\n", "process=migrate exit_code=3"} {
+		if !strings.Contains(stderr.String(), s) {
+			t.Fatalf("stderr missing %q:\n%s", s, stderr.String())
+		}
+	}
+
+	stdout.Reset()
+	if err := app.Run(context.Background(), Options{Mode: "up", CWD: cwd, Seed: &seed, DryRun: true}, []string{"web"}); err != nil || stdout.Len() != 0 {
+		t.Fatalf("-n should only print the summary: %v %q", err, stdout.String())
+	}
+	if err := app.Run(context.Background(), Options{Mode: "up", CWD: cwd, Seed: &seed}, []string{"db"}); err == nil || !strings.Contains(err.Error(), "available: web, migrate") {
+		t.Fatalf("expected an unknown process error, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package app
+
+import "strings"
+
+// httpKeyHints are key name tokens that suggest an HTTP service.
+var httpKeyHints = map[string]bool{
+	"HTTP": true, "HTTPS": true, "WEB": true, "API": true, "APP": true,
+	"FRONTEND": true, "UI": true, "SERVER": true, "DEV": true, "VITE": true, "NEXT": true,
+}
+
+// keyURL returns a localhost URL for keys that plausibly serve HTTP, such as
+// PORT, WEB_PORT, or API_HTTP_PORT.
+func keyURL(key, value string) (string, bool) {
+	tokens := strings.Split(strings.ToUpper(key), "_")
+	http := key == "PORT"
+	for _, t := range tokens {
+		if httpKeyHints[t] {
+			http = true
+			break
+		}
+	}
+	if !http {
+		return "", false
+	}
+	scheme := "http"
+	for _, t := range tokens {
+		if t == "HTTPS" || t == "TLS" || t == "SSL" {
+			scheme = "https"
+		}
+	}
+	return scheme + "://localhost:" + value, true
+}
+
+// overrideURLs maps HTTP-looking keys to their localhost URLs for --urls.
+func overrideURLs(overrides map[string]string) map[string]string {
+	urls := map[string]string{}
+	for key, value := range overrides {
+		if u, ok := keyURL(key, value); ok {
+			urls[key] = u
+		}
+	}
+	return urls
+}
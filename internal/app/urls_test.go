@@ -0,0 +1,53 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_Run_URLColumn(t *testing.T) {
+	var stderr bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(&MockExecutor{}),
+		WithStdout(io.Discard),
+		WithStderr(&stderr),
+		WithEnviron([]string{"WEB_PORT=1", "DB_PORT=2"}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	seed := uint32(0)
+	if err := app.Run(context.Background(), Options{CWD: "/test/path", Seed: &seed, Range: "10000-10100", URLs: true}, []string{"npm", "start"}); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	out := stderr.String()
+	if !strings.Contains(out, "| ENV      | PORT  | URL                    |") {
+		t.Fatalf("missing URL header:\n%s", out)
+	}
+	if !strings.Contains(out, "| WEB_PORT | 10002 | http://localhost:10002 |") || !strings.Contains(out, "| DB_PORT  | 10000 |                        |") {
+		t.Fatalf("unexpected URL column:\n%s", out)
+	}
+}
+
+func TestKeyURL(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"PORT", "http://localhost:3000"},
+		{"WEB_PORT", "http://localhost:3000"},
+		{"API_HTTPS_PORT", "https://localhost:3000"},
+		{"DB_PORT", ""},
+		{"RAPID_PORT", ""},
+	}
+	for _, tt := range tests {
+		got, ok := keyURL(tt.key, "3000")
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("keyURL(%q) = %q, %v; want %q", tt.key, got, ok, tt.want)
+		}
+	}
+}
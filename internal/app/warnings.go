@@ -0,0 +1,103 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Warning codes are stable identifiers for warning categories. They are used
+// by the warnings_as_errors config policy.
+const (
+	WarnConfigDeprecated   = "config-deprecated"
+	WarnPresetMissing      = "preset-missing"
+	WarnLockfileRangeDrift = "lockfile-range-drift"
+	WarnLockFingerprint    = "lock-fingerprint-mismatch"
+	WarnUnknownCode        = "unknown-warning-code"
+	WarnBatchConflict      = "batch-port-conflict"
+	WarnBranchChanged      = "branch-changed"
+	WarnUnmanagedPort      = "unmanaged-port"
+	WarnPathSeed           = "path-seed"
+	WarnReplayMismatch     = "replay-mismatch"
+	WarnBindUnavailable    = "bind-unavailable"
+	WarnRequiredKeyMissing = "required-key-missing"
+)
+
+var knownWarningCodes = map[string]bool{
+	WarnConfigDeprecated:   true,
+	WarnPresetMissing:      true,
+	WarnLockfileRangeDrift: true,
+	WarnLockFingerprint:    true,
+	WarnUnknownCode:        true,
+	WarnBatchConflict:      true,
+	WarnBranchChanged:      true,
+	WarnUnmanagedPort:      true,
+	WarnPathSeed:           true,
+	WarnReplayMismatch:     true,
+	WarnBindUnavailable:    true,
+	WarnRequiredKeyMissing: true,
+}
+
+// warning is a structured, machine-readable warning. Context carries the
+// values the message was built from so scripts need not parse Message.
+type warning struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Context map[string]string `json:"context,omitempty"`
+
+	// format and args rebuild Message through the message catalog for
+	// text output; JSON keeps the English Message.
+	format string
+	args   []any
+}
+
+func newWarning(code, format string, args ...any) warning {
+	return warning{Code: code, Message: fmt.Sprintf(format, args...), format: format, args: args}
+}
+
+// warningText returns w's message in the user's language.
+func (a *App) warningText(w warning) string {
+	if w.format == "" {
+		return w.Message
+	}
+	return a.text.Sprintf(w.format, w.args...)
+}
+
+// with returns a copy of w with key=value added to its context.
+func (w warning) with(key, value string) warning {
+	ctx := make(map[string]string, len(w.Context)+1)
+	for k, v := range w.Context {
+		ctx[k] = v
+	}
+	ctx[key] = value
+	w.Context = ctx
+	return w
+}
+
+// validateWarningPolicy reports unknown codes listed in warnings_as_errors.
+func validateWarningPolicy(codes []string) []warning {
+	var out []warning
+	for _, code := range dedupeSorted(codes) {
+		if !knownWarningCodes[code] {
+			out = append(out, newWarning(WarnUnknownCode, "warnings_as_errors: unknown warning code %q", code).with("value", code))
+		}
+	}
+	return out
+}
+
+// promoteWarnings returns an error listing every warning whose code is
+// promoted to an error by policy.
+func promoteWarnings(warnings []warning, promoted []string) error {
+	set := makeSet(promoted)
+	var hits []string
+	for _, w := range warnings {
+		if _, ok := set[w.Code]; ok {
+			hits = append(hits, fmt.Sprintf("[%s] %s", w.Code, w.Message))
+		}
+	}
+	if len(hits) == 0 {
+		return nil
+	}
+	sort.Strings(hits)
+	return fmt.Errorf("warnings promoted to errors: %s", strings.Join(hits, "; "))
+}
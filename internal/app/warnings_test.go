@@ -0,0 +1,80 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_Run_WarningsAsErrors(t *testing.T) {
+	app := New(
+		WithConfig(&config.Config{
+			Presets:          map[string]config.Preset{},
+			WarningsAsErrors: []string{WarnPresetMissing},
+		}),
+		WithStdout(io.Discard),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "run", Presets: []string{"missing"}, CWD: "/test/path"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "[preset-missing]") {
+		t.Fatalf("expected promoted preset-missing error, got %v", err)
+	}
+
+	var stdout bytes.Buffer
+	app = New(
+		WithConfig(&config.Config{
+			Presets:          map[string]config.Preset{},
+			WarningsAsErrors: []string{"no-such-code"},
+		}),
+		WithStdout(&stdout),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	err = app.Run(context.Background(), Options{Mode: "run", Format: "json", CWD: "/test/path"}, nil)
+	if err != nil {
+		t.Fatalf("unknown code should only warn, got %v", err)
+	}
+	if !strings.Contains(stdout.String(), "unknown warning code") {
+		t.Fatalf("expected unknown code warning, got %s", stdout.String())
+	}
+}
+
+func TestApp_Run_JSONWarningsAreStructured(t *testing.T) {
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(&stdout),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithIsFree(func(p int) bool { return true }),
+	)
+
+	err := app.Run(context.Background(), Options{Mode: "explain", Format: "json", Presets: []string{"missing"}, CWD: "/test/path"}, nil)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	var payload struct {
+		Warnings []struct {
+			Code    string            `json:"code"`
+			Message string            `json:"message"`
+			Context map[string]string `json:"context"`
+		} `json:"warnings"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &payload); err != nil {
+		t.Fatalf("json parse: %v", err)
+	}
+	if len(payload.Warnings) != 1 {
+		t.Fatalf("expected one warning, got %+v", payload.Warnings)
+	}
+	w := payload.Warnings[0]
+	if w.Code != WarnPresetMissing || w.Context["preset"] != "missing" || w.Message == "" {
+		t.Fatalf("unexpected warning: %+v", w)
+	}
+}
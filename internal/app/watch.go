@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// defaultWatchInterval is how often --watch looks at the watched files.
+// The standard library has no file notifications, and a few stats per
+// interval cost nothing next to a dev server.
+const defaultWatchInterval = 500 * time.Millisecond
+
+func validateWatch(opts Options) error {
+	switch {
+	case !opts.Watch:
+		return nil
+	case opts.Mode != "run":
+		return errors.New("--watch applies to run and export only")
+	case opts.DryRun:
+		return errors.New("--watch cannot be combined with -n")
+	case opts.Replay != "":
+		return errors.New("--watch and --replay are mutually exclusive")
+	}
+	return nil
+}
+
+// fileStamp tells a watched file's versions apart.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchFiles reports each change to the project's .env* files and the
+// config files, created and deleted files included, until ctx is done. A
+// burst of changes within one interval is reported once.
+func (a *App) watchFiles(ctx context.Context, cwd string) <-chan string {
+	a.logger.Info("watching env files and config for changes", slog.String("dir", cwd))
+	// The config may be swapped while the watch runs; its paths stay.
+	configPaths := a.config.Paths()
+	ch := make(chan string)
+	prev := watchedFiles(cwd, configPaths)
+	go func() {
+		ticker := time.NewTicker(a.watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			next := watchedFiles(cwd, configPaths)
+			file := changedFile(prev, next)
+			if file == "" {
+				continue
+			}
+			prev = next
+			select {
+			case ch <- file:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// watchedFiles stamps the .env* files in cwd and the config files that
+// exist.
+func watchedFiles(cwd string, configPaths []string) map[string]fileStamp {
+	paths, _ := filepath.Glob(filepath.Join(cwd, ".env*"))
+	stamps := map[string]fileStamp{}
+	for _, path := range append(paths, configPaths...) {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+// changedFile returns the first file, by name, that was created, modified,
+// or deleted between two stampings, or "" when none was.
+func changedFile(prev, next map[string]fileStamp) string {
+	var changed []string
+	for path, stamp := range next {
+		if old, ok := prev[path]; !ok || !old.modTime.Equal(stamp.modTime) || old.size != stamp.size {
+			changed = append(changed, path)
+		}
+	}
+	for path := range prev {
+		if _, ok := next[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+	return slices.Min(changed)
+}
+
+// reloadChanged is reload for a change to file, reading the config again
+// first when file is one of its files.
+func (a *App) reloadChanged(ctx context.Context, opts Options, current map[string]string, file string) (map[string]string, error) {
+	a.logger.Info("file changed; replanning", slog.String("file", file))
+	if slices.Contains(a.config.Paths(), file) {
+		if err := a.reloadConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return a.reload(ctx, opts, current)
+}
+
+// reloadConfig replaces the config with its files' current contents. A
+// config with errors is refused, and so is one changing the hooks,
+// plugins, or branch resolver: those were confirmed at start, and a
+// prompt cannot share the terminal with the running command.
+func (a *App) reloadConfig() error {
+	next := a.config.Reload()
+	if next.HasErrors() {
+		return joinErrors("config", next.Errors)
+	}
+	if !reflect.DeepEqual(next.Hooks, a.config.Hooks) || !reflect.DeepEqual(next.Plugins, a.config.Plugins) || next.BranchResolverCmd != a.config.BranchResolverCmd {
+		return errors.New("the config changes hooks, plugins, or branch_resolver_cmd; restart autoport to apply it")
+	}
+	a.config = next
+	return nil
+}
+
+// watchExports prints the exports and, whenever a watched file change
+// moves a port, prints them again, until ctx is done.
+func (a *App) watchExports(ctx context.Context, opts Options, overrides map[string]string, export func(map[string]string) error) error {
+	if err := export(overrides); err != nil {
+		return err
+	}
+	changes := a.watchFiles(ctx, opts.CWD)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case file := <-changes:
+			next, err := a.reloadChanged(ctx, opts, overrides, file)
+			if err != nil {
+				a.logger.Warn("reload failed; keeping current ports", slog.String("error", err.Error()))
+				continue
+			}
+			if next == nil {
+				continue
+			}
+			overrides = next
+			if err := export(overrides); err != nil {
+				return fmt.Errorf("watch: %w", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_WatchRestartsOnEnvChange(t *testing.T) {
+	cwd := t.TempDir()
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(cwd, ".env"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("WEB_PORT=3000\n")
+	started, finish := make(chan []string), make(chan struct{})
+	exec := reloadExecutor(started, finish)
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithEnviron([]string{}),
+		WithExecutor(exec),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	app.watchInterval = 5 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run(context.Background(), Options{Mode: "run", CWD: cwd, Watch: true}, []string{"server"})
+	}()
+	if first := <-started; envValue(first, "API_PORT") != "" {
+		t.Fatalf("first start env = %v, want no API_PORT", first)
+	}
+	write("WEB_PORT=3000\nAPI_PORT=3001\n")
+	if second := <-started; envValue(second, "API_PORT") == "" || envValue(second, "WEB_PORT") == "" {
+		t.Fatalf("restarted env = %v, want API_PORT added", second)
+	}
+	close(finish)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	err := app.Run(context.Background(), Options{Mode: "run", CWD: cwd, Watch: true, DryRun: true}, nil)
+	if err == nil || !strings.Contains(err.Error(), "--watch cannot be combined with -n") {
+		t.Fatalf("expected a -n conflict, got %v", err)
+	}
+}
+
+// captureFormatter hands every export to the test.
+type captureFormatter chan map[string]string
+
+func (c captureFormatter) Format(ctx context.Context, w io.Writer, in FormatInput) error {
+	c <- maps.Clone(in.Overrides)
+	return nil
+}
+
+func TestApp_WatchReprintsExportsAndReloadsConfig(t *testing.T) {
+	cwd := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(cwd, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".env", "WEB_PORT=3000\n")
+	write(".autoport.json", "{}")
+	exports := make(captureFormatter)
+	app := New(
+		WithConfig(config.Load([]string{filepath.Join(cwd, ".autoport.json")})),
+		WithFormatter("capture", exports),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithEnviron([]string{}),
+		WithIsFree(func(p int) bool { return true }),
+	)
+	app.watchInterval = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run(ctx, Options{Mode: "run", Format: "plugin:capture", CWD: cwd, Watch: true}, nil)
+	}()
+	if first := <-exports; first["API_PORT"] != "" {
+		t.Fatalf("first export = %v, want no API_PORT", first)
+	}
+	write(".env", "WEB_PORT=3000\nAPI_PORT=3001\n")
+	if second := <-exports; second["API_PORT"] == "" {
+		t.Fatalf("second export = %v, want API_PORT added", second)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	write(".autoport.json", `{"hooks": {"pre_run": ["make db"]}}`)
+	if err := app.reloadConfig(); err == nil || !strings.Contains(err.Error(), "restart autoport") {
+		t.Fatalf("expected a config with new hooks to be refused, got %v", err)
+	}
+	write(".autoport.json", `{"key_order": ["API_PORT"]}`)
+	if err := app.reloadConfig(); err != nil || !slices.Equal(app.config.KeyOrder, []string{"API_PORT"}) {
+		t.Fatalf("reloadConfig() = %v, key_order %v", err, app.config.KeyOrder)
+	}
+}
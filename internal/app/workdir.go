@@ -0,0 +1,78 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+// applyWorkdir makes --workdir the project directory: autoport plans for
+// it as if started there, and the command runs in it. A relative workdir
+// is resolved against opts.CWD.
+func (a *App) applyWorkdir(opts Options) (Options, error) {
+	if opts.Umask != nil {
+		if !umaskSupported {
+			return opts, errors.New("--umask is not supported on this platform")
+		}
+		if *opts.Umask < 0 || *opts.Umask > 0o777 {
+			return opts, fmt.Errorf("invalid --umask %#o: must be between 0 and 0777", *opts.Umask)
+		}
+	}
+	if opts.Workdir == "" {
+		return opts, nil
+	}
+	dir := opts.Workdir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(opts.CWD, dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return opts, fmt.Errorf("workdir: %w", err)
+	}
+	if !info.IsDir() {
+		return opts, fmt.Errorf("workdir %s is not a directory", dir)
+	}
+	opts.CWD = filepath.Clean(dir)
+	return opts, nil
+}
+
+// useProjectConfig switches to the config of the project opts.CWD names,
+// as if autoport had started there, for modes planning several projects
+// (batch, ide serve, serve). It returns a func restoring the previous
+// config. A config not read from files, such as one set with WithConfig,
+// applies to every project. The commands the project's config runs while
+// planning must be trusted; with prompt false nobody is asked.
+func (a *App) useProjectConfig(opts Options, prompt bool) (func(), error) {
+	cfg := a.config
+	if len(cfg.Paths()) == 0 {
+		return func() {}, nil
+	}
+	next := config.LoadFrom(opts.CWD)
+	if next.HasErrors() {
+		return nil, joinErrors("config", next.Errors)
+	}
+	noPrompt := a.noPrompt
+	a.config, a.noPrompt = next, !prompt
+	err := a.confirmPlanCommands(opts)
+	a.noPrompt = noPrompt
+	if err != nil {
+		a.config = cfg
+		return nil, err
+	}
+	return func() { a.config = cfg }, nil
+}
+
+// confirmPlanCommands confirms the commands the config runs while
+// planning: the branch resolver and discoverer plugins, and the format
+// plugin.
+func (a *App) confirmPlanCommands(opts Options) error {
+	if a.config.BranchResolverCmd != "" && a.branch == "" {
+		if err := a.confirmCommands(opts, a.config.Origin("branch_resolver_cmd"), []string{a.config.BranchResolverCmd}); err != nil {
+			return err
+		}
+	}
+	return a.checkPlugins(opts)
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gelleson/autoport/internal/config"
+)
+
+func TestApp_WorkdirAndUmaskApplyToCommand(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("umask is POSIX-only")
+	}
+	root := t.TempDir()
+	project := filepath.Join(root, "svc")
+	if err := os.Mkdir(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".env"), []byte("API_PORT=1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	app := New(
+		WithConfig(&config.Config{Presets: map[string]config.Preset{}}),
+		WithExecutor(DefaultExecutor{}),
+		WithStdout(&stdout),
+		WithStderr(io.Discard),
+		WithEnviron([]string{"PATH=" + os.Getenv("PATH")}),
+		WithIsFree(func(int) bool { return true }),
+	)
+	mask := 0o027
+	opts := Options{Mode: "run", Range: "10000-10100", CWD: root, Workdir: "svc", Umask: &mask, Quiet: true}
+	if err := app.Run(context.Background(), opts, []string{"sh", "-c", `pwd; umask; echo "${API_PORT:+api}"`}); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	resolved, err := filepath.EvalSymlinks(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Fields(stdout.String())
+	if len(lines) != 3 || (lines[0] != project && lines[0] != resolved) || lines[1] != "0027" || lines[2] != "api" {
+		t.Fatalf("child saw %q, want the workdir, umask 0027, and the workdir's keys", lines)
+	}
+
+	opts.Workdir = "missing"
+	if err := app.Run(context.Background(), opts, []string{"true"}); err == nil || !strings.Contains(err.Error(), "workdir") {
+		t.Fatalf("missing workdir = %v, want an error", err)
+	}
+}
@@ -4,8 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gelleson/autoport/pkg/port"
 )
 
 // Preset represents configuration overrides.
@@ -14,25 +20,290 @@ type Preset struct {
 	IgnorePrefixes []string `json:"ignore_prefixes,omitempty"`
 	IncludeKeys    []string `json:"include_keys,omitempty"`
 	ExcludeKeys    []string `json:"exclude_keys,omitempty"`
+	// ExcludePatterns are filepath.Match globs over key names, for key
+	// families that no prefix or exact key covers.
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+	// ExcludeCategories drop keys by category (web, db, queue, debug,
+	// other, or a name from the config's categories).
+	ExcludeCategories []string `json:"exclude_categories,omitempty"`
 
 	// Legacy v1 field, mapped to IgnorePrefixes with warnings.
 	Ignore []string `json:"ignore,omitempty"`
+
+	// Append fields extend the lists of the same preset from a built-in or
+	// an earlier config file instead of replacing them.
+	AppendIgnorePrefixes    []string `json:"append_ignore_prefixes,omitempty"`
+	AppendIncludeKeys       []string `json:"append_include_keys,omitempty"`
+	AppendExcludeKeys       []string `json:"append_exclude_keys,omitempty"`
+	AppendExcludePatterns   []string `json:"append_exclude_patterns,omitempty"`
+	AppendExcludeCategories []string `json:"append_exclude_categories,omitempty"`
+}
+
+// Extend layers p over base: Range and the list fields replace base's when
+// set, and the append fields are added to the resulting lists.
+func (p Preset) Extend(base Preset) Preset {
+	out := base
+	if p.Range != "" {
+		out.Range = p.Range
+	}
+	out.IgnorePrefixes = extendList(base.IgnorePrefixes, p.IgnorePrefixes, p.AppendIgnorePrefixes)
+	out.IncludeKeys = extendList(base.IncludeKeys, p.IncludeKeys, p.AppendIncludeKeys)
+	out.ExcludeKeys = extendList(base.ExcludeKeys, p.ExcludeKeys, p.AppendExcludeKeys)
+	out.ExcludePatterns = extendList(base.ExcludePatterns, p.ExcludePatterns, p.AppendExcludePatterns)
+	out.ExcludeCategories = extendList(base.ExcludeCategories, p.ExcludeCategories, p.AppendExcludeCategories)
+	out.Ignore = nil
+	out.AppendIgnorePrefixes = nil
+	out.AppendIncludeKeys = nil
+	out.AppendExcludeKeys = nil
+	out.AppendExcludePatterns = nil
+	out.AppendExcludeCategories = nil
+	return out
+}
+
+func (p Preset) appends() bool {
+	return len(p.AppendIgnorePrefixes) > 0 || len(p.AppendIncludeKeys) > 0 || len(p.AppendExcludeKeys) > 0 || len(p.AppendExcludePatterns) > 0 || len(p.AppendExcludeCategories) > 0
+}
+
+func extendList(base, replace, add []string) []string {
+	list := base
+	if len(replace) > 0 {
+		list = replace
+	}
+	if len(add) == 0 {
+		return list
+	}
+	return append(slices.Clone(list), add...)
 }
 
 // ScannerConfig controls repository scanning behavior.
 type ScannerConfig struct {
 	IgnoreDirs []string `json:"ignore_dirs,omitempty"`
 	MaxDepth   int      `json:"max_depth,omitempty"`
+	// ExcludeComposeEnv drops keys found only in a docker compose project
+	// .env from discovery.
+	ExcludeComposeEnv bool `json:"exclude_compose_env,omitempty"`
+	// WarnUnmanaged warns about selected keys whose Makefile, Taskfile, or
+	// justfile value overrides the environment.
+	WarnUnmanaged bool `json:"warn_unmanaged,omitempty"`
+}
+
+// CanonicalConfig declares legacy base ports that are shifted by one shared
+// deterministic offset instead of being allocated from the range.
+type CanonicalConfig struct {
+	Ports map[string]int `json:"ports,omitempty"`
+	Span  int            `json:"span,omitempty"`
+}
+
+// PortSpec is a key's entry in Config.Ports: a JSON number pins the key to
+// that port, and a JSON string is a range spec, numeric or named, that the
+// key is allocated from instead of the global range.
+type PortSpec struct {
+	Port  int
+	Range string
+}
+
+func (s *PortSpec) UnmarshalJSON(data []byte) error {
+	*s = PortSpec{}
+	if err := json.Unmarshal(data, &s.Port); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &s.Range); err == nil {
+		return nil
+	}
+	return fmt.Errorf("want a port number or a range string, got %s", data)
+}
+
+func (s PortSpec) MarshalJSON() ([]byte, error) {
+	if s.Range != "" {
+		return json.Marshal(s.Range)
+	}
+	return json.Marshal(s.Port)
+}
+
+// HooksConfig declares shell command lines run around the wrapped command.
+type HooksConfig struct {
+	PreRun []string `json:"pre_run,omitempty"`
+	OnExit []string `json:"on_exit,omitempty"`
+	// OnChange runs when a key's port differs from the project's previous
+	// run; NotifyOnChange also shows a desktop notification.
+	OnChange       []string `json:"on_change,omitempty"`
+	NotifyOnChange bool     `json:"notify_on_change,omitempty"`
+}
+
+// Script is a named command runnable as `autoport run <name>`. In JSON it is
+// either a command line string or an object with presets and a namespace
+// applied when the script runs.
+type Script struct {
+	Command   string   `json:"command"`
+	Presets   []string `json:"presets,omitempty"`
+	Namespace string   `json:"namespace,omitempty"`
+}
+
+// UnmarshalJSON accepts the short string form as well as the object form.
+func (s *Script) UnmarshalJSON(data []byte) error {
+	var line string
+	if err := json.Unmarshal(data, &line); err == nil {
+		*s = Script{Command: line}
+		return nil
+	}
+	type plain Script
+	return json.Unmarshal(data, (*plain)(s))
 }
 
 // Config stores global and preset configurations.
 type Config struct {
-	Version  int               `json:"version,omitempty"`
-	Strict   bool              `json:"strict,omitempty"`
-	Scanner  ScannerConfig     `json:"scanner,omitempty"`
-	Presets  map[string]Preset `json:"presets"`
-	Warnings []string          `json:"-"`
-	Errors   []error           `json:"-"`
+	Version          int                 `json:"version,omitempty"`
+	Strict           bool                `json:"strict,omitempty"`
+	Scanner          ScannerConfig       `json:"scanner,omitempty"`
+	Presets          map[string]Preset   `json:"presets"`
+	Groups           map[string][]string `json:"groups,omitempty"`
+	Canonical        CanonicalConfig     `json:"canonical,omitempty"`
+	WarningsAsErrors []string            `json:"warnings_as_errors,omitempty"`
+	Hooks            HooksConfig         `json:"hooks,omitempty"`
+	SeedFrom         string              `json:"seed_from,omitempty"`
+	Ranges           map[string]string   `json:"ranges,omitempty"`
+	Scripts          map[string]Script   `json:"scripts,omitempty"`
+	Origins          map[string]string   `json:"-"`
+	Warnings         []string            `json:"-"`
+	Errors           []error             `json:"-"`
+	// Files lists the config files that were read, in merge order.
+	Files []string `json:"-"`
+
+	// SeedBranch mixes the current git branch into path seeds, except on
+	// the branches in SeedBranchExclude (default main and master).
+	SeedBranch        bool     `json:"seed_branch,omitempty"`
+	SeedBranchExclude []string `json:"seed_branch_exclude,omitempty"`
+	// SeedPathNormalization rewrites the project path before it is hashed
+	// into a seed; see SeedPathSteps.
+	SeedPathNormalization []string `json:"seed_path_normalization,omitempty"`
+	// SeedRoot is "git" to hash the repository toplevel instead of the
+	// invocation directory ("cwd", the default).
+	SeedRoot string `json:"seed_root,omitempty"`
+	// NamespaceFrom is the --namespace-from source used when the flag is
+	// not given: "session" or "subdir".
+	NamespaceFrom string `json:"namespace_from,omitempty"`
+	// RespectExisting keeps the value of a key the invoking environment
+	// already sets instead of assigning one (--respect-existing).
+	RespectExisting bool `json:"respect_existing,omitempty"`
+	// LoopbackAlias gives the project its own 127.0.0.x address, exported
+	// as <KEY>_HOST next to each key (--loopback-alias).
+	LoopbackAlias bool `json:"loopback_alias,omitempty"`
+
+	Reservations ReservationsConfig `json:"reservations,omitempty"`
+	// Templates maps template files to the files rendered from them with
+	// the assigned ports before the wrapped command runs.
+	Templates map[string]string `json:"templates,omitempty"`
+	// Compose maps env keys to the compose services publishing them, for
+	// the compose output format.
+	Compose map[string]ComposeService `json:"compose,omitempty"`
+	// K8s maps keys to the cluster resources -f k8s and -f skaffold
+	// forward their assigned ports to.
+	K8s map[string]K8sForward `json:"k8s,omitempty"`
+	// TrustedSources lists config files, or directories holding them, whose
+	// scripts and hooks run without confirmation. Only the user config
+	// (~/.autoport.json) may set it, and that file is always trusted.
+	TrustedSources []string `json:"trusted_sources,omitempty"`
+
+	Lockfile LockfileConfig `json:"lockfile,omitempty"`
+
+	// Health maps keys to HTTP paths polled on the assigned port after the
+	// wrapped command starts, e.g. {"API_PORT": "/healthz"}.
+	Health map[string]string `json:"health,omitempty"`
+	// Ports pins keys to a port or confines them to their own range, e.g.
+	// {"WEB_PORT": 3000, "GRPC_PORT": "50000-51000"}.
+	Ports map[string]PortSpec `json:"ports,omitempty"`
+	// Protocols maps keys to the sockets their port must be free for,
+	// "tcp", "udp", or "both", e.g. {"DNS_PORT": "udp"}.
+	Protocols map[string]string `json:"protocols,omitempty"`
+	// KeyOrder fixes the order keys take allocation slots in: listed keys
+	// first, in list order, then the rest alphabetically.
+	KeyOrder []string `json:"key_order,omitempty"`
+	// BranchResolverCmd is a command line printing the branch of the
+	// project path passed as its argument, for version control systems
+	// other than git. It replaces git for every branch lookup.
+	BranchResolverCmd string `json:"branch_resolver_cmd,omitempty"`
+	// Links rewrite the port inside values of JSON and YAML config files
+	// before the wrapped command runs.
+	Links []Link `json:"links,omitempty"`
+	// Categories map a category name to globs over key names, e.g.
+	// {"db": ["*_STORE_PORT"]}. They take precedence over the built-in
+	// guesses from key names, and may name new categories.
+	Categories map[string][]string `json:"categories,omitempty"`
+	// Plugins are executables extending discovery and output.
+	Plugins PluginsConfig `json:"plugins,omitempty"`
+	// Processes maps names to the command lines `autoport up` runs side by
+	// side; without it, up reads the project's Procfile.
+	Processes map[string]string `json:"processes,omitempty"`
+
+	trustedBy map[string][]string
+	// paths are the files Load was given, read or not; user is the one
+	// TrustUserConfig marked.
+	paths []string
+	user  string
+}
+
+// PluginsConfig maps plugin names to command lines. Each command gets a
+// JSON request as its argument and answers on stdout; like hooks, plugins
+// from untrusted config files need confirmation.
+type PluginsConfig struct {
+	// Discoverers report port keys from sources the scanner does not read.
+	Discoverers map[string]string `json:"discoverers,omitempty"`
+	// Formats render the assignments as the output format plugin:<name>.
+	Formats map[string]string `json:"formats,omitempty"`
+}
+
+// LockfileConfig sets the project's policy for .autoport.lock.json.
+type LockfileConfig struct {
+	// Commit says whether the lockfile belongs in version control; nil
+	// means no policy.
+	Commit *bool `json:"commit,omitempty"`
+}
+
+// Link ties a key to a value in a project JSON or YAML file whose port is
+// rewritten to the key's assigned port, for cross-service URLs that do not
+// live in env vars.
+type Link struct {
+	Key string `json:"key"`
+	// TargetFile is relative to the project; its extension (.json, .yaml,
+	// or .yml) selects the format.
+	TargetFile string `json:"target_file"`
+	// TargetPath is the dot-separated path of the value, such as
+	// "services.billing.url"; JSON paths may index arrays ("hosts.0").
+	TargetPath string `json:"target_path"`
+	// SkipHosts are glob patterns for hosts whose values are left alone,
+	// such as container network names ("*.svc.cluster.local"). Hosts
+	// named after a service of the project's compose file are always
+	// skipped.
+	SkipHosts []string `json:"skip_hosts,omitempty"`
+}
+
+// ComposeService ties an env key to the compose service that publishes it.
+type ComposeService struct {
+	Service string `json:"service"`
+	// ContainerPort is the port the service listens on inside the
+	// container; zero means the assigned port itself.
+	ContainerPort int `json:"container_port,omitempty"`
+}
+
+// K8sForward ties an env key to the Kubernetes resource whose port is
+// forwarded to the key's assigned local port.
+type K8sForward struct {
+	// Resource is kubectl's TYPE/NAME, e.g. "service/api" or "svc/api".
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	// Port is the resource's port; zero means the assigned port itself.
+	Port int `json:"port,omitempty"`
+}
+
+// ReservationsConfig points at a port reservations file shared with other
+// port-management tools.
+type ReservationsConfig struct {
+	Path string `json:"path,omitempty"`
+	// Format names the file format adapter; "lines" ("<port> <name>" per
+	// line) by default.
+	Format string `json:"format,omitempty"`
+	// Write publishes this project's assignments to the file after a run.
+	Write bool `json:"write,omitempty"`
 }
 
 // BuiltInPresets are predefined, hardcoded configurations.
@@ -55,17 +326,29 @@ var BuiltInPresets = map[string]Preset{
 			"BEANSTALKD_PORT",
 		},
 	},
+	// k8s drops the variables Kubernetes injects for every service in the
+	// namespace (NAME_SERVICE_PORT, NAME_PORT_80_TCP_PORT, ...), which flood
+	// discovery inside dev pods.
+	"k8s": {
+		ExcludePatterns: []string{
+			"*_SERVICE_PORT",
+			"*_PORT_[0-9]*_TCP*",
+			"*_PORT_[0-9]*_UDP*",
+			"*_PORT_[0-9]*_SCTP*",
+		},
+	},
 }
 
 // Load reads configuration from the provided file paths, merging them in order.
 func Load(paths []string) *Config {
-	cfg := &Config{Presets: make(map[string]Preset)}
+	cfg := &Config{Presets: make(map[string]Preset), Origins: make(map[string]string), paths: slices.Clone(paths)}
 
 	for _, path := range paths {
 		localConfig, ok := loadFile(path)
 		if !ok {
 			continue
 		}
+		cfg.Files = append(cfg.Files, path)
 		cfg.Strict = cfg.Strict || localConfig.Strict
 		if localConfig.Version > 0 {
 			cfg.Version = localConfig.Version
@@ -76,21 +359,270 @@ func Load(paths []string) *Config {
 		if localConfig.Scanner.MaxDepth > 0 {
 			cfg.Scanner.MaxDepth = localConfig.Scanner.MaxDepth
 		}
+		cfg.Scanner.ExcludeComposeEnv = cfg.Scanner.ExcludeComposeEnv || localConfig.Scanner.ExcludeComposeEnv
+		cfg.Scanner.WarnUnmanaged = cfg.Scanner.WarnUnmanaged || localConfig.Scanner.WarnUnmanaged
 		cfg.Warnings = append(cfg.Warnings, localConfig.Warnings...)
 		cfg.Errors = append(cfg.Errors, localConfig.Errors...)
 		mergePresets(cfg.Presets, localConfig.Presets)
+		for name := range localConfig.Presets {
+			cfg.Origins["presets."+name] = path
+		}
+		if localConfig.Scanner.ExcludeComposeEnv {
+			cfg.Origins["scanner.exclude_compose_env"] = path
+		}
+		mergeGroups(cfg, localConfig.Groups)
+		for name := range localConfig.Groups {
+			cfg.Origins["groups."+name] = path
+		}
+		mergeCanonical(&cfg.Canonical, localConfig.Canonical)
+		for key := range localConfig.Canonical.Ports {
+			cfg.Origins["canonical.ports."+key] = path
+		}
+		mergeRanges(cfg, localConfig.Ranges)
+		for name := range localConfig.Ranges {
+			cfg.Origins["ranges."+name] = path
+		}
+		mergeScripts(cfg, localConfig.Scripts)
+		for name := range localConfig.Scripts {
+			cfg.Origins["scripts."+name] = path
+		}
+		cfg.WarningsAsErrors = append(cfg.WarningsAsErrors, localConfig.WarningsAsErrors...)
+		if localConfig.SeedFrom != "" {
+			cfg.SeedFrom = localConfig.SeedFrom
+			cfg.Origins["seed_from"] = path
+		}
+		if localConfig.SeedBranch {
+			cfg.SeedBranch = true
+			cfg.Origins["seed_branch"] = path
+		}
+		if localConfig.RespectExisting {
+			cfg.RespectExisting = true
+			cfg.Origins["respect_existing"] = path
+		}
+		if localConfig.LoopbackAlias {
+			cfg.LoopbackAlias = true
+			cfg.Origins["loopback_alias"] = path
+		}
+		if len(localConfig.SeedBranchExclude) > 0 {
+			cfg.SeedBranchExclude = append([]string{}, localConfig.SeedBranchExclude...)
+		}
+		if localConfig.NamespaceFrom != "" {
+			cfg.NamespaceFrom = localConfig.NamespaceFrom
+			cfg.Origins["namespace_from"] = path
+		}
+		if localConfig.BranchResolverCmd != "" {
+			cfg.BranchResolverCmd = localConfig.BranchResolverCmd
+			cfg.Origins["branch_resolver_cmd"] = path
+		}
+		if localConfig.SeedRoot != "" {
+			cfg.SeedRoot = localConfig.SeedRoot
+			cfg.Origins["seed_root"] = path
+		}
+		if len(localConfig.SeedPathNormalization) > 0 {
+			cfg.SeedPathNormalization = append([]string{}, localConfig.SeedPathNormalization...)
+			cfg.Origins["seed_path_normalization"] = path
+		}
+		if localConfig.Reservations.Path != "" {
+			cfg.Reservations = localConfig.Reservations
+			cfg.Origins["reservations"] = path
+		}
+		for src, dst := range localConfig.Templates {
+			if cfg.Templates == nil {
+				cfg.Templates = make(map[string]string, len(localConfig.Templates))
+			}
+			cfg.Templates[src] = dst
+			cfg.Origins["templates."+src] = path
+		}
+		for key, hp := range localConfig.Health {
+			if cfg.Health == nil {
+				cfg.Health = make(map[string]string, len(localConfig.Health))
+			}
+			cfg.Health[key] = hp
+			cfg.Origins["health."+key] = path
+		}
+		for name, patterns := range localConfig.Categories {
+			if cfg.Categories == nil {
+				cfg.Categories = make(map[string][]string, len(localConfig.Categories))
+			}
+			cfg.Categories[name] = append([]string{}, patterns...)
+			cfg.Origins["categories."+name] = path
+		}
+		for key, spec := range localConfig.Ports {
+			if cfg.Ports == nil {
+				cfg.Ports = make(map[string]PortSpec, len(localConfig.Ports))
+			}
+			cfg.Ports[key] = spec
+			cfg.Origins["ports."+key] = path
+		}
+		for key, proto := range localConfig.Protocols {
+			if cfg.Protocols == nil {
+				cfg.Protocols = make(map[string]string, len(localConfig.Protocols))
+			}
+			cfg.Protocols[key] = proto
+			cfg.Origins["protocols."+key] = path
+		}
+		if localConfig.Lockfile.Commit != nil {
+			commit := *localConfig.Lockfile.Commit
+			cfg.Lockfile.Commit = &commit
+			cfg.Origins["lockfile.commit"] = path
+		}
+		if len(localConfig.KeyOrder) > 0 {
+			cfg.KeyOrder = append([]string{}, localConfig.KeyOrder...)
+			cfg.Origins["key_order"] = path
+		}
+		for key, svc := range localConfig.Compose {
+			if cfg.Compose == nil {
+				cfg.Compose = make(map[string]ComposeService, len(localConfig.Compose))
+			}
+			cfg.Compose[key] = svc
+			cfg.Origins["compose."+key] = path
+		}
+		for key, fwd := range localConfig.K8s {
+			if cfg.K8s == nil {
+				cfg.K8s = make(map[string]K8sForward, len(localConfig.K8s))
+			}
+			cfg.K8s[key] = fwd
+			cfg.Origins["k8s."+key] = path
+		}
+		if len(localConfig.Hooks.PreRun) > 0 {
+			cfg.Hooks.PreRun = append([]string{}, localConfig.Hooks.PreRun...)
+			cfg.Origins["hooks.pre_run"] = path
+		}
+		if len(localConfig.Hooks.OnExit) > 0 {
+			cfg.Hooks.OnExit = append([]string{}, localConfig.Hooks.OnExit...)
+			cfg.Origins["hooks.on_exit"] = path
+		}
+		if len(localConfig.Hooks.OnChange) > 0 {
+			cfg.Hooks.OnChange = append([]string{}, localConfig.Hooks.OnChange...)
+			cfg.Origins["hooks.on_change"] = path
+		}
+		for name, line := range localConfig.Plugins.Discoverers {
+			if cfg.Plugins.Discoverers == nil {
+				cfg.Plugins.Discoverers = make(map[string]string, len(localConfig.Plugins.Discoverers))
+			}
+			cfg.Plugins.Discoverers[name] = line
+			cfg.Origins["plugins.discoverers."+name] = path
+		}
+		for name, line := range localConfig.Plugins.Formats {
+			if cfg.Plugins.Formats == nil {
+				cfg.Plugins.Formats = make(map[string]string, len(localConfig.Plugins.Formats))
+			}
+			cfg.Plugins.Formats[name] = line
+			cfg.Origins["plugins.formats."+name] = path
+		}
+		for name, line := range localConfig.Processes {
+			if cfg.Processes == nil {
+				cfg.Processes = make(map[string]string, len(localConfig.Processes))
+			}
+			cfg.Processes[name] = line
+			cfg.Origins["processes."+name] = path
+		}
+		if len(localConfig.Links) > 0 {
+			cfg.Links = append([]Link{}, localConfig.Links...)
+			cfg.Origins["links"] = path
+		}
+		if len(localConfig.TrustedSources) > 0 {
+			if cfg.trustedBy == nil {
+				cfg.trustedBy = map[string][]string{}
+			}
+			cfg.trustedBy[path] = localConfig.TrustedSources
+		}
+		cfg.Hooks.NotifyOnChange = cfg.Hooks.NotifyOnChange || localConfig.Hooks.NotifyOnChange
 	}
+	cfg.Errors = append(cfg.Errors, validateGroups(cfg.Groups)...)
+	cfg.Errors = append(cfg.Errors, cfg.validatePorts()...)
 	return cfg
 }
 
-// LoadDefault loads configurations from default locations: home dir and current dir.
+// LoadDefault loads configurations from default locations: home dir, then
+// the current dir's .autoport.json and its LocalFile overlay.
 func LoadDefault() *Config {
+	return LoadFrom("")
+}
+
+// LocalFile is the project's personal overlay config, kept out of version
+// control and merged over the shared .autoport.json.
+const LocalFile = ".autoport.local.json"
+
+// LoadFrom is LoadDefault for the project in dir instead of the working
+// directory.
+func LoadFrom(dir string) *Config {
 	home, _ := os.UserHomeDir()
+	user := filepath.Join(home, ".autoport.json")
 	paths := []string{
-		filepath.Join(home, ".autoport.json"),
-		".autoport.json",
+		user,
+		filepath.Join(dir, ".autoport.json"),
+		filepath.Join(dir, LocalFile),
+	}
+	cfg := Load(paths)
+	cfg.TrustUserConfig(user)
+	return cfg
+}
+
+// TrustUserConfig marks user as the user's own config file: it is trusted,
+// and its trusted_sources are the only ones honored. trusted_sources set in
+// any other file is ignored with a warning, so a project cannot vouch for
+// itself.
+func (c *Config) TrustUserConfig(user string) {
+	c.user = user
+	c.TrustedSources = append([]string{user}, c.trustedBy[user]...)
+	paths := make([]string, 0, len(c.trustedBy))
+	for path := range c.trustedBy {
+		if path != user {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("%s: trusted_sources is only honored in %s", path, user))
+	}
+}
+
+// Paths returns the files Load was given, including ones that did not
+// exist, in merge order.
+func (c *Config) Paths() []string {
+	return c.paths
+}
+
+// Reload reads c's files again, picking up files created since, and keeps
+// the user config's trust. A config not loaded from files is returned as
+// is.
+func (c *Config) Reload() *Config {
+	if len(c.paths) == 0 {
+		return c
+	}
+	cfg := Load(c.paths)
+	if c.user != "" {
+		cfg.TrustUserConfig(c.user)
+	}
+	return cfg
+}
+
+// Trusted reports whether scripts and hooks from the config file at path
+// may run without confirmation. Commands that did not come from a file
+// (path "") are trusted.
+func (c *Config) Trusted(path string) bool {
+	if path == "" {
+		return true
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	home, _ := os.UserHomeDir()
+	for _, src := range c.TrustedSources {
+		if rest, ok := strings.CutPrefix(src, "~/"); ok && home != "" {
+			src = filepath.Join(home, rest)
+		}
+		src, err := filepath.Abs(src)
+		if err != nil {
+			continue
+		}
+		if abs == src || strings.HasPrefix(abs, src+string(filepath.Separator)) {
+			return true
+		}
 	}
-	return Load(paths)
+	return false
 }
 
 func loadFile(path string) (Config, bool) {
@@ -113,7 +645,106 @@ func loadFile(path string) (Config, bool) {
 	if cfg.Presets == nil {
 		cfg.Presets = make(map[string]Preset)
 	}
+	for key, p := range cfg.Canonical.Ports {
+		if p < 1 || p > 65535 {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("canonical port %d for %s must be within 1-65535 in %s", p, key, path))
+		}
+	}
+	for name, spec := range cfg.Ranges {
+		if !isRangeName(name) {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("range name %q must start with a letter in %s", name, path))
+			continue
+		}
+		if _, err := port.ParseRange(spec); err != nil {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("range %q in %s: %w", name, path, err))
+		}
+	}
+	for name, script := range cfg.Scripts {
+		if strings.TrimSpace(script.Command) == "" {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("script %q has no command in %s", name, path))
+		}
+	}
+	for src, dst := range cfg.Templates {
+		if strings.TrimSpace(dst) == "" {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("template %q has no output path in %s", src, path))
+		}
+	}
+	if cfg.NamespaceFrom != "" && cfg.NamespaceFrom != "session" && cfg.NamespaceFrom != "subdir" {
+		cfg.Errors = append(cfg.Errors, fmt.Errorf("unknown namespace_from %q in %s (want session or subdir)", cfg.NamespaceFrom, path))
+	}
+	if cfg.SeedRoot != "" && cfg.SeedRoot != "cwd" && cfg.SeedRoot != "git" {
+		cfg.Errors = append(cfg.Errors, fmt.Errorf("unknown seed_root %q in %s (want cwd or git)", cfg.SeedRoot, path))
+	}
+	for _, step := range cfg.SeedPathNormalization {
+		if !slices.Contains(SeedPathSteps, step) {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("unknown seed_path_normalization step %q in %s (want %s)", step, path, strings.Join(SeedPathSteps, ", ")))
+		}
+	}
+	for key, hp := range cfg.Health {
+		if !strings.HasPrefix(hp, "/") {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("health path %q for %s must start with / in %s", hp, key, path))
+		}
+	}
+	for key, proto := range cfg.Protocols {
+		if _, err := port.ParseProtocol(proto); err != nil {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("protocol for %s in %s: %w", key, path, err))
+		}
+	}
+	seenOrder := map[string]bool{}
+	for _, key := range cfg.KeyOrder {
+		if seenOrder[key] {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("key_order lists %s more than once in %s", key, path))
+		}
+		seenOrder[key] = true
+	}
+	for key, svc := range cfg.Compose {
+		if strings.TrimSpace(svc.Service) == "" {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("compose mapping for %s has no service in %s", key, path))
+		}
+		if svc.ContainerPort < 0 || svc.ContainerPort > 65535 {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("compose container port %d for %s must be within 1-65535 in %s", svc.ContainerPort, key, path))
+		}
+	}
+	for key, fwd := range cfg.K8s {
+		if kind, name, ok := strings.Cut(fwd.Resource, "/"); !ok || kind == "" || name == "" {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("k8s resource %q for %s must be TYPE/NAME, e.g. service/api, in %s", fwd.Resource, key, path))
+		}
+		if fwd.Port < 0 || fwd.Port > 65535 {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("k8s port %d for %s must be within 1-65535 in %s", fwd.Port, key, path))
+		}
+	}
+	for i, link := range cfg.Links {
+		switch {
+		case link.Key == "" || link.TargetFile == "" || link.TargetPath == "":
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("link %d needs key, target_file, and target_path in %s", i, path))
+		case !slices.Contains([]string{".json", ".yaml", ".yml"}, strings.ToLower(filepath.Ext(link.TargetFile))):
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("link target %s for %s must be a .json, .yaml, or .yml file in %s", link.TargetFile, link.Key, path))
+		}
+		for _, pattern := range link.SkipHosts {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				cfg.Errors = append(cfg.Errors, fmt.Errorf("link %d skip_hosts pattern %q in %s: %w", i, pattern, path, err))
+			}
+		}
+	}
+	if cfg.Canonical.Span < 0 {
+		cfg.Errors = append(cfg.Errors, fmt.Errorf("canonical span must not be negative in %s", path))
+	}
+	for name, patterns := range cfg.Categories {
+		if !isCategoryName(name) {
+			cfg.Errors = append(cfg.Errors, fmt.Errorf("category name %q in %s must be lowercase letters, digits, '-', or '_'", name, path))
+		}
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				cfg.Errors = append(cfg.Errors, fmt.Errorf("category %q pattern %q in %s: %w", name, pattern, path, err))
+			}
+		}
+	}
 	for name, preset := range cfg.Presets {
+		for _, pattern := range slices.Concat(preset.ExcludePatterns, preset.AppendExcludePatterns) {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				cfg.Errors = append(cfg.Errors, fmt.Errorf("preset %q exclude pattern %q in %s: %w", name, pattern, path, err))
+			}
+		}
 		if len(preset.Ignore) > 0 {
 			if len(preset.IgnorePrefixes) == 0 {
 				preset.IgnorePrefixes = append([]string{}, preset.Ignore...)
@@ -128,12 +759,241 @@ func loadFile(path string) (Config, bool) {
 	return cfg, true
 }
 
+// mergePresets adds src's presets to dst. A preset replaces an earlier one
+// of the same name, or the built-in, unless it uses append fields; then it
+// extends it.
 func mergePresets(dst, src map[string]Preset) {
 	for key, value := range src {
-		dst[key] = value
+		var base Preset
+		if value.appends() {
+			var ok bool
+			if base, ok = dst[key]; !ok {
+				base = BuiltInPresets[key]
+			}
+		}
+		dst[key] = value.Extend(base)
+	}
+}
+
+func mergeGroups(cfg *Config, src map[string][]string) {
+	if len(src) == 0 {
+		return
+	}
+	if cfg.Groups == nil {
+		cfg.Groups = make(map[string][]string, len(src))
+	}
+	for name, keys := range src {
+		cfg.Groups[name] = append([]string{}, keys...)
+	}
+}
+
+func mergeRanges(cfg *Config, src map[string]string) {
+	if len(src) == 0 {
+		return
+	}
+	if cfg.Ranges == nil {
+		cfg.Ranges = make(map[string]string, len(src))
+	}
+	for name, spec := range src {
+		cfg.Ranges[name] = spec
+	}
+}
+
+func mergeScripts(cfg *Config, src map[string]Script) {
+	if len(src) == 0 {
+		return
+	}
+	if cfg.Scripts == nil {
+		cfg.Scripts = make(map[string]Script, len(src))
+	}
+	for name, script := range src {
+		cfg.Scripts[name] = script
+	}
+}
+
+func isRangeName(s string) bool {
+	return s != "" && (s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z')
+}
+
+// ExpandRange replaces named ranges in a range spec with their numeric
+// definitions, so "frontend" or "frontend,backend,!3333" can be used wherever
+// a numeric spec is accepted. Numeric parts are passed through unchanged.
+func (c *Config) ExpandRange(spec string) (string, error) {
+	parts := strings.Split(spec, ",")
+	for i, part := range parts {
+		name := strings.TrimSpace(part)
+		exclude := strings.HasPrefix(name, "!")
+		name = strings.TrimPrefix(name, "!")
+		if !isRangeName(name) {
+			continue
+		}
+		var def string
+		var ok bool
+		if c != nil {
+			def, ok = c.Ranges[name]
+		}
+		if !ok {
+			return "", fmt.Errorf("unknown named range %q", name)
+		}
+		if exclude {
+			return "", fmt.Errorf("named range %q cannot be excluded", name)
+		}
+		parts[i] = def
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func mergeCanonical(dst *CanonicalConfig, src CanonicalConfig) {
+	if src.Span > 0 {
+		dst.Span = src.Span
+	}
+	if len(src.Ports) == 0 {
+		return
+	}
+	if dst.Ports == nil {
+		dst.Ports = make(map[string]int, len(src.Ports))
+	}
+	for key, p := range src.Ports {
+		dst.Ports[key] = p
+	}
+}
+
+// validateGroups reports keys claimed by more than one assignment group.
+func validateGroups(groups map[string][]string) []error {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	owner := make(map[string]string)
+	for _, name := range names {
+		if len(groups[name]) == 0 {
+			errs = append(errs, fmt.Errorf("group %q has no keys", name))
+			continue
+		}
+		for _, key := range groups[name] {
+			if prev, ok := owner[key]; ok && prev != name {
+				errs = append(errs, fmt.Errorf("key %s belongs to groups %q and %q", key, prev, name))
+				continue
+			}
+			owner[key] = name
+		}
+	}
+	return errs
+}
+
+// validatePorts checks the merged ports section, once every file's named
+// ranges are known. Two keys may share a pinned port only within a group.
+func (c *Config) validatePorts() []error {
+	var errs []error
+	pinned := map[int]string{}
+	for _, key := range slices.Sorted(maps.Keys(c.Ports)) {
+		spec, origin := c.Ports[key], c.Origin("ports."+key)
+		if spec.Range != "" {
+			if _, err := c.KeyRange(key); err != nil {
+				errs = append(errs, fmt.Errorf("ports range for %s in %s: %w", key, origin, err))
+			}
+			continue
+		}
+		if spec.Port < 1 || spec.Port > 65535 {
+			errs = append(errs, fmt.Errorf("pinned port %d for %s must be within 1-65535 in %s", spec.Port, key, origin))
+			continue
+		}
+		if prev, ok := pinned[spec.Port]; ok {
+			group, _ := c.GroupOf(key)
+			if other, _ := c.GroupOf(prev); group == "" || group != other {
+				errs = append(errs, fmt.Errorf("keys %s and %s are both pinned to port %d in %s", prev, key, spec.Port, origin))
+			}
+			continue
+		}
+		pinned[spec.Port] = key
+	}
+	return errs
+}
+
+// KeyRange returns the range key is confined to by the ports section, with
+// named ranges expanded. A key without a range gets the zero Range.
+func (c *Config) KeyRange(key string) (port.Range, error) {
+	if c == nil || c.Ports[key].Range == "" {
+		return port.Range{}, nil
+	}
+	spec, err := c.ExpandRange(c.Ports[key].Range)
+	if err != nil {
+		return port.Range{}, err
+	}
+	return port.ParseRange(spec)
+}
+
+// GroupOf returns the assignment group that contains key, if any.
+func (c *Config) GroupOf(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	for name, keys := range c.Groups {
+		for _, k := range keys {
+			if k == key {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// DefaultSeedBranchExclude lists the mainline branches that keep the
+// project's canonical ports under seed_branch.
+var DefaultSeedBranchExclude = []string{"main", "master"}
+
+// BranchSeeded reports whether seed_branch applies on branch. Detached HEADs
+// and unknown branches keep the canonical ports.
+func (c *Config) BranchSeeded(branch string) bool {
+	if c == nil || !c.SeedBranch || branch == "" || branch == "HEAD" {
+		return false
+	}
+	exclude := c.SeedBranchExclude
+	if len(exclude) == 0 {
+		exclude = DefaultSeedBranchExclude
+	}
+	for _, b := range exclude {
+		if b == branch {
+			return false
+		}
 	}
+	return true
+}
+
+// SeedPathSteps are the seed_path_normalization steps, in the order they
+// apply: replace the path with its git toplevel, resolve symlinks, and
+// lowercase it (for case-insensitive filesystems).
+var SeedPathSteps = []string{"git", "symlinks", "lowercase"}
+
+// NormalizesSeedPath reports whether step is enabled.
+func (c *Config) NormalizesSeedPath(step string) bool {
+	return c != nil && slices.Contains(c.SeedPathNormalization, step)
+}
+
+// Origin returns the config file that last set field (for example
+// "seed_from" or "presets.web"), or "" when no loaded file set it.
+func (c *Config) Origin(field string) string {
+	if c == nil {
+		return ""
+	}
+	return c.Origins[field]
 }
 
 func (c *Config) HasErrors() bool {
 	return c != nil && len(c.Errors) > 0
 }
+
+func isCategoryName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
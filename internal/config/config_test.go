@@ -1,9 +1,12 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -62,6 +65,12 @@ func TestLoad(t *testing.T) {
 		if cfg.Scanner.MaxDepth != 3 || !reflect.DeepEqual(cfg.Scanner.IgnoreDirs, []string{"node_modules"}) {
 			t.Fatalf("unexpected scanner config: %+v", cfg.Scanner)
 		}
+		if cfg.Origin("presets.web") != configB || cfg.Origin("presets.db2") != configB {
+			t.Fatalf("unexpected preset origins: %v", cfg.Origins)
+		}
+		if cfg.Origin("seed_from") != "" {
+			t.Fatalf("seed_from should have no origin, got %q", cfg.Origin("seed_from"))
+		}
 	})
 
 	t.Run("non-existent file", func(t *testing.T) {
@@ -103,3 +112,469 @@ func TestLoad_LegacyIgnoreMapping(t *testing.T) {
 		t.Fatalf("expected migration warning")
 	}
 }
+
+func TestLoad_Groups(t *testing.T) {
+	tmpDir := t.TempDir()
+	p := filepath.Join(tmpDir, "groups.json")
+	if err := os.WriteFile(p, []byte(`{
+		"groups": {
+			"web": ["PORT", "APP_PORT", "HTTP_PORT"]
+		}
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{p})
+	if cfg.HasErrors() {
+		t.Fatalf("unexpected errors: %v", cfg.Errors)
+	}
+	if group, ok := cfg.GroupOf("APP_PORT"); !ok || group != "web" {
+		t.Fatalf("GroupOf(APP_PORT) = %q, %v", group, ok)
+	}
+	if _, ok := cfg.GroupOf("DB_PORT"); ok {
+		t.Fatal("DB_PORT should not belong to a group")
+	}
+
+	overlap := filepath.Join(tmpDir, "overlap.json")
+	if err := os.WriteFile(overlap, []byte(`{
+		"groups": {
+			"api": ["API_PORT", "PORT"]
+		}
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg = Load([]string{p, overlap})
+	if !cfg.HasErrors() {
+		t.Fatal("expected error for key in multiple groups")
+	}
+}
+
+func TestLoad_NamedRanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	p := filepath.Join(tmpDir, "ranges.json")
+	if err := os.WriteFile(p, []byte(`{
+		"ranges": {"frontend": "3000-3999", "backend": "8000-8999,!8080"},
+		"presets": {"web": {"range": "frontend"}}
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{p})
+	if cfg.HasErrors() {
+		t.Fatalf("unexpected errors: %v", cfg.Errors)
+	}
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"frontend", "3000-3999", false},
+		{"frontend,backend,!3333", "3000-3999,8000-8999,!8080,!3333", false},
+		{"10000-20000", "10000-20000", false},
+		{"mobile", "", true},
+		{"3000-4000,!frontend", "", true},
+	}
+	for _, tt := range tests {
+		got, err := cfg.ExpandRange(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ExpandRange(%q) = %q, %v; want %q (err=%v)", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	bad := filepath.Join(tmpDir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"ranges": {"oops": "9000-8000", "1st": "1-2"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := Load([]string{bad}); len(cfg.Errors) != 2 {
+		t.Fatalf("expected two range errors, got %v", cfg.Errors)
+	}
+}
+
+func TestLoad_Scripts(t *testing.T) {
+	tmpDir := t.TempDir()
+	p := filepath.Join(tmpDir, "scripts.json")
+	if err := os.WriteFile(p, []byte(`{
+		"scripts": {
+			"dev": "npm run dev",
+			"api": {"command": "go run ./cmd/api", "presets": ["db"], "namespace": "api"},
+			"empty": {"presets": ["db"]}
+		}
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{p})
+	if cfg.Scripts["dev"].Command != "npm run dev" {
+		t.Fatalf("dev script = %+v", cfg.Scripts["dev"])
+	}
+	want := Script{Command: "go run ./cmd/api", Presets: []string{"db"}, Namespace: "api"}
+	if !reflect.DeepEqual(cfg.Scripts["api"], want) {
+		t.Fatalf("api script = %+v, want %+v", cfg.Scripts["api"], want)
+	}
+	if cfg.Origin("scripts.api") != p {
+		t.Fatalf("scripts.api origin = %q", cfg.Origin("scripts.api"))
+	}
+	if len(cfg.Errors) != 1 {
+		t.Fatalf("expected one error for the script without a command, got %v", cfg.Errors)
+	}
+}
+
+func TestLoad_Compose(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := filepath.Join(tmpDir, "home.json")
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(home, []byte(`{"compose": {"WEB_PORT": {"service": "frontend"}, "DB_PORT": {"service": "db", "container_port": 5432}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(project, []byte(`{"compose": {"WEB_PORT": {"service": "web", "container_port": 3000}, "BAD_PORT": {"container_port": 70000}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{home, project})
+	if got := cfg.Compose["WEB_PORT"]; got != (ComposeService{Service: "web", ContainerPort: 3000}) {
+		t.Fatalf("WEB_PORT mapping = %+v", got)
+	}
+	if got := cfg.Compose["DB_PORT"]; got.Service != "db" || cfg.Origin("compose.DB_PORT") != home {
+		t.Fatalf("DB_PORT mapping = %+v from %q", got, cfg.Origin("compose.DB_PORT"))
+	}
+	if len(cfg.Errors) != 2 {
+		t.Fatalf("expected missing service and bad port errors, got %v", cfg.Errors)
+	}
+}
+
+func TestLoad_PresetAppendFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := filepath.Join(tmpDir, "home.json")
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(home, []byte(`{"presets": {"db": {"append_ignore_prefixes": ["CASSANDRA"]}, "web": {"range": "9000-9100", "include_keys": ["WEB_PORT"]}, "queues": {"exclude_keys": ["MY_QUEUE_PORT"]}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(project, []byte(`{"presets": {"db": {"append_ignore_prefixes": ["SCYLLA"]}, "web": {"append_include_keys": ["API_PORT"]}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{home, project})
+	db := cfg.Presets["db"]
+	wantDB := append(slices.Clone(BuiltInPresets["db"].IgnorePrefixes), "CASSANDRA", "SCYLLA")
+	if !reflect.DeepEqual(db.IgnorePrefixes, wantDB) || db.AppendIgnorePrefixes != nil {
+		t.Fatalf("db preset = %+v, want built-in prefixes plus appends", db)
+	}
+	if web := cfg.Presets["web"]; web.Range != "9000-9100" || !reflect.DeepEqual(web.IncludeKeys, []string{"WEB_PORT", "API_PORT"}) {
+		t.Fatalf("web preset = %+v", web)
+	}
+	if queues := cfg.Presets["queues"]; !reflect.DeepEqual(queues.ExcludeKeys, []string{"MY_QUEUE_PORT"}) {
+		t.Fatalf("a preset without append fields should replace the built-in, got %+v", queues)
+	}
+	if len(BuiltInPresets["db"].IgnorePrefixes) != len(wantDB)-2 {
+		t.Fatal("extending a built-in must not modify it")
+	}
+}
+
+func TestLoad_PresetExcludePatterns(t *testing.T) {
+	tmpDir := t.TempDir()
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(project, []byte(`{"presets": {"k8s": {"append_exclude_patterns": ["*_SERVICE_PORT_*"]}, "bad": {"exclude_patterns": ["[A-"]}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{project})
+	want := append(slices.Clone(BuiltInPresets["k8s"].ExcludePatterns), "*_SERVICE_PORT_*")
+	if k8s := cfg.Presets["k8s"]; !reflect.DeepEqual(k8s.ExcludePatterns, want) {
+		t.Fatalf("k8s patterns = %v, want %v", k8s.ExcludePatterns, want)
+	}
+	if len(cfg.Errors) != 1 || !strings.Contains(cfg.Errors[0].Error(), `preset "bad" exclude pattern "[A-"`) {
+		t.Fatalf("expected a bad pattern error, got %v", cfg.Errors)
+	}
+}
+
+func TestLoad_BranchResolverCmd(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := filepath.Join(tmpDir, "home.json")
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(home, []byte(`{"branch_resolver_cmd": "vcs-branch"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(project, []byte(`{"branch_resolver_cmd": "sl-branch"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{home, project})
+	if cfg.BranchResolverCmd != "sl-branch" || cfg.Origin("branch_resolver_cmd") != project {
+		t.Fatalf("branch_resolver_cmd = %q from %q", cfg.BranchResolverCmd, cfg.Origin("branch_resolver_cmd"))
+	}
+}
+
+func TestLoad_Plugins(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := filepath.Join(tmpDir, "home.json")
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(home, []byte(`{"plugins": {"discoverers": {"manifest": "manifest-ports", "catalog": "catalog-ports"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(project, []byte(`{"plugins": {"discoverers": {"manifest": "./tools/manifest-ports"}, "formats": {"helm": "autoport-helm"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{home, project})
+	if cfg.Plugins.Discoverers["manifest"] != "./tools/manifest-ports" || cfg.Plugins.Discoverers["catalog"] != "catalog-ports" || cfg.Plugins.Formats["helm"] != "autoport-helm" {
+		t.Fatalf("plugins = %+v", cfg.Plugins)
+	}
+	if cfg.Origin("plugins.discoverers.manifest") != project || cfg.Origin("plugins.discoverers.catalog") != home || cfg.Origin("plugins.formats.helm") != project {
+		t.Fatalf("unexpected plugin origins: %v", cfg.Origins)
+	}
+}
+
+func TestLoad_Processes(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := filepath.Join(tmpDir, "home.json")
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(home, []byte(`{"processes": {"web": "npm start", "docs": "mkdocs serve"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(project, []byte(`{"processes": {"web": "npm run dev"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{home, project})
+	if cfg.Processes["web"] != "npm run dev" || cfg.Processes["docs"] != "mkdocs serve" {
+		t.Fatalf("processes = %v", cfg.Processes)
+	}
+	if cfg.Origin("processes.web") != project || cfg.Origin("processes.docs") != home {
+		t.Fatalf("unexpected process origins: %v", cfg.Origins)
+	}
+}
+
+func TestConfig_Reload(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := filepath.Join(tmpDir, "home.json")
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(home, []byte(`{"trusted_sources": ["/src"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Load([]string{home, project})
+	cfg.TrustUserConfig(home)
+	if err := os.WriteFile(project, []byte(`{"key_order": ["API_PORT"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	next := cfg.Reload()
+	if !reflect.DeepEqual(next.KeyOrder, []string{"API_PORT"}) || !reflect.DeepEqual(next.Files, []string{home, project}) {
+		t.Fatalf("reloaded config = %+v, want the new project file read", next)
+	}
+	if !reflect.DeepEqual(next.TrustedSources, []string{home, "/src"}) || !reflect.DeepEqual(next.Paths(), cfg.Paths()) {
+		t.Fatalf("reload lost the user config's trust or paths: %v %v", next.TrustedSources, next.Paths())
+	}
+	if bare := (&Config{}); bare.Reload() != bare {
+		t.Fatal("a config without files should reload to itself")
+	}
+}
+
+func TestLoad_Links(t *testing.T) {
+	tmpDir := t.TempDir()
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(project, []byte(`{"links": [{"key": "API_PORT", "target_file": "config/dev.yaml", "target_path": "services.api.url"}, {"key": "WEB_PORT", "target_file": "dev.toml", "target_path": "web.port"}, {"key": "DB_PORT"}, {"key": "API_PORT", "target_file": "dev.json", "target_path": "api", "skip_hosts": ["*.internal", "["]}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{project})
+	if len(cfg.Links) != 4 || cfg.Links[0].TargetPath != "services.api.url" || cfg.Links[3].SkipHosts[0] != "*.internal" || cfg.Origin("links") != project {
+		t.Fatalf("links = %+v", cfg.Links)
+	}
+	if len(cfg.Errors) != 3 || !strings.Contains(cfg.Errors[0].Error(), "dev.toml") || !strings.Contains(cfg.Errors[1].Error(), "link 2 needs") || !strings.Contains(cfg.Errors[2].Error(), `link 3 skip_hosts pattern "["`) {
+		t.Fatalf("expected format and missing field errors, got %v", cfg.Errors)
+	}
+}
+
+func TestLoad_Health(t *testing.T) {
+	tmpDir := t.TempDir()
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(project, []byte(`{"health": {"API_PORT": "/healthz", "WEB_PORT": "healthz"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{project})
+	if cfg.Health["API_PORT"] != "/healthz" || cfg.Origin("health.API_PORT") != project {
+		t.Fatalf("API_PORT health = %q from %q", cfg.Health["API_PORT"], cfg.Origin("health.API_PORT"))
+	}
+	if len(cfg.Errors) != 1 || !strings.Contains(cfg.Errors[0].Error(), "must start with /") {
+		t.Fatalf("expected a path error, got %v", cfg.Errors)
+	}
+}
+
+func TestLoad_Protocols(t *testing.T) {
+	tmpDir := t.TempDir()
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(project, []byte(`{"protocols": {"DNS_PORT": "udp", "QUIC_PORT": "quic"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{project})
+	if cfg.Protocols["DNS_PORT"] != "udp" || cfg.Origin("protocols.DNS_PORT") != project {
+		t.Fatalf("DNS_PORT protocol = %q from %q", cfg.Protocols["DNS_PORT"], cfg.Origin("protocols.DNS_PORT"))
+	}
+	if len(cfg.Errors) != 1 || !strings.Contains(cfg.Errors[0].Error(), `protocol for QUIC_PORT`) {
+		t.Fatalf("expected a protocol error, got %v", cfg.Errors)
+	}
+}
+
+func TestLoad_K8s(t *testing.T) {
+	tmpDir := t.TempDir()
+	project := filepath.Join(tmpDir, "project.json")
+	if err := os.WriteFile(project, []byte(`{"k8s": {"API_PORT": {"resource": "svc/api", "namespace": "dev", "port": 8080}, "WEB_PORT": {"resource": "web"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{project})
+	if got := cfg.K8s["API_PORT"]; got != (K8sForward{Resource: "svc/api", Namespace: "dev", Port: 8080}) || cfg.Origin("k8s.API_PORT") != project {
+		t.Fatalf("API_PORT forward = %+v from %q", got, cfg.Origin("k8s.API_PORT"))
+	}
+	if len(cfg.Errors) != 1 || !strings.Contains(cfg.Errors[0].Error(), `k8s resource "web" for WEB_PORT`) {
+		t.Fatalf("expected a resource error, got %v", cfg.Errors)
+	}
+}
+
+func TestLoad_Ports(t *testing.T) {
+	tmpDir := t.TempDir()
+	project := filepath.Join(tmpDir, "project.json")
+	local := filepath.Join(tmpDir, "local.json")
+	for path, body := range map[string]string{
+		project: `{"ranges": {"grpc": "50000-51000"}, "ports": {"WEB_PORT": 3000, "GRPC_PORT": "grpc", "API_PORT": 3000, "BAD_PORT": "nope", "BIG_PORT": 70000}}`,
+		local:   `{"ports": {"WEB_PORT": 3001}}`,
+	} {
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := Load([]string{project, local})
+	if cfg.Ports["WEB_PORT"].Port != 3001 || cfg.Origin("ports.WEB_PORT") != local {
+		t.Fatalf("WEB_PORT = %+v from %q", cfg.Ports["WEB_PORT"], cfg.Origin("ports.WEB_PORT"))
+	}
+	r, err := cfg.KeyRange("GRPC_PORT")
+	if err != nil || r.Start != 50000 || r.End != 51000 {
+		t.Fatalf("GRPC_PORT range = %v, %v", r, err)
+	}
+	var msgs []string
+	for _, err := range cfg.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	joined := strings.Join(msgs, "\n")
+	for _, want := range []string{"ports range for BAD_PORT", "pinned port 70000 for BIG_PORT"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected %q among errors:\n%s", want, joined)
+		}
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("WEB_PORT and API_PORT no longer share a pin, got:\n%s", joined)
+	}
+
+	data, err := json.Marshal(cfg.Ports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back map[string]PortSpec
+	if err := json.Unmarshal(data, &back); err != nil || !reflect.DeepEqual(back, cfg.Ports) {
+		t.Fatalf("ports did not round-trip: %s -> %+v, %v", data, back, err)
+	}
+}
+
+func TestLoad_Categories(t *testing.T) {
+	tmpDir := t.TempDir()
+	project := filepath.Join(tmpDir, "project.json")
+	body := `{"categories": {"search": ["MEILI_*"], "Cache": ["X"], "bad": ["["]}, "presets": {"lean": {"exclude_categories": ["debug"]}}}`
+	if err := os.WriteFile(project, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load([]string{project})
+	if got := cfg.Categories["search"]; len(got) != 1 || got[0] != "MEILI_*" || cfg.Origin("categories.search") != project {
+		t.Fatalf("search category = %v from %q", got, cfg.Origin("categories.search"))
+	}
+	if got := cfg.Presets["lean"].ExcludeCategories; len(got) != 1 || got[0] != "debug" {
+		t.Fatalf("lean exclude_categories = %v", got)
+	}
+	if len(cfg.Errors) != 2 {
+		t.Fatalf("expected name and pattern errors, got %v", cfg.Errors)
+	}
+}
+
+func TestConfig_TrustedSources(t *testing.T) {
+	tmpDir := t.TempDir()
+	user := filepath.Join(tmpDir, "home", ".autoport.json")
+	project := filepath.Join(tmpDir, "work", "app", ".autoport.json")
+	for path, body := range map[string]string{
+		user:    `{"trusted_sources": ["` + filepath.ToSlash(filepath.Join(tmpDir, "work")) + `"]}`,
+		project: `{"trusted_sources": ["/"], "hooks": {"pre_run": ["./seed.sh"]}}`,
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := Load([]string{user, project})
+	cfg.TrustUserConfig(user)
+	if !cfg.Trusted(user) || !cfg.Trusted(project) || !cfg.Trusted("") {
+		t.Fatalf("user config, sources under a trusted dir, and non-file commands should be trusted: %v", cfg.TrustedSources)
+	}
+	if cfg.Trusted(filepath.Join(tmpDir, "workshop", ".autoport.json")) || cfg.Trusted(filepath.Join(tmpDir, "other.json")) {
+		t.Fatal("paths outside trusted sources should not be trusted")
+	}
+	if cfg.Origin("hooks.pre_run") != project {
+		t.Fatalf("hooks.pre_run origin = %q", cfg.Origin("hooks.pre_run"))
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], "only honored in") {
+		t.Fatalf("project trusted_sources should be ignored with a warning, got %v", cfg.Warnings)
+	}
+}
+
+func TestConfig_BranchSeeded(t *testing.T) {
+	cfg := &Config{SeedBranch: true}
+	for branch, want := range map[string]bool{"main": false, "master": false, "HEAD": false, "": false, "feature/x": true} {
+		if got := cfg.BranchSeeded(branch); got != want {
+			t.Errorf("BranchSeeded(%q) = %v, want %v", branch, got, want)
+		}
+	}
+	cfg.SeedBranchExclude = []string{"trunk"}
+	if cfg.BranchSeeded("trunk") || !cfg.BranchSeeded("main") {
+		t.Fatal("seed_branch_exclude should replace the default list")
+	}
+	if (&Config{}).BranchSeeded("feature/x") {
+		t.Fatal("seed_branch is off by default")
+	}
+}
+
+func TestLoadFrom_LocalOverlay(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	shared := filepath.Join(dir, ".autoport.json")
+	local := filepath.Join(dir, LocalFile)
+	for path, body := range map[string]string{
+		shared: `{"namespace_from": "subdir", "canonical": {"ports": {"API_PORT": 8080, "WEB_PORT": 3000}}, "ranges": {"dev": "3000-3999"}}`,
+		local:  `{"namespace_from": "session", "canonical": {"ports": {"API_PORT": 9090}}, "ranges": {"dev": "5000-5999"}}`,
+	} {
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := LoadFrom(dir)
+	if cfg.HasErrors() {
+		t.Fatalf("unexpected errors: %v", cfg.Errors)
+	}
+	if cfg.NamespaceFrom != "session" || cfg.Canonical.Ports["API_PORT"] != 9090 || cfg.Canonical.Ports["WEB_PORT"] != 3000 || cfg.Ranges["dev"] != "5000-5999" {
+		t.Fatalf("overlay not merged over the shared config: %+v", cfg)
+	}
+	for field, want := range map[string]string{
+		"namespace_from":           local,
+		"canonical.ports.API_PORT": local,
+		"canonical.ports.WEB_PORT": shared,
+		"ranges.dev":               local,
+	} {
+		if got := cfg.Origin(field); got != want {
+			t.Errorf("Origin(%s) = %q, want %q", field, got, want)
+		}
+	}
+}
@@ -2,28 +2,246 @@
 package env
 
 import (
-	"bufio"
+	"fmt"
 	"io"
 	"strings"
 )
 
-// ExtractPortKeys scans a reader for lines matching .env format and returns keys related to ports.
-func ExtractPortKeys(r io.Reader) []string {
-	var keys []string
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
+// Entry is a key/value pair parsed from a .env file.
+type Entry struct {
+	Key   string
+	Value string
+}
+
+// ParseError reports a malformed line. Parsing continues past it.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse reads dotenv content and returns its entries in file order, following
+// the dotenv/direnv conventions: an optional "export " prefix, inline
+// comments after unquoted or quoted values, single-, double-, and
+// backtick-quoted values that may span several lines, and \n, \r, \t, \",
+// and \\ escapes inside double quotes. Malformed lines are skipped; the
+// first problem is reported as a *ParseError (or, with WithExpand, a
+// *CycleError) alongside the entries that did parse.
+func Parse(r io.Reader, opts ...ParseOption) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{src: string(data), line: 1}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p.parse()
+}
+
+// ParseOption configures Parse.
+type ParseOption func(*parser)
+
+// WithExpand enables ${VAR} expansion in unquoted and double-quoted values.
+// References resolve through lookup first and then through the file's own
+// entries, as dotenv-expand does; see Expand for the supported forms. A
+// nil lookup resolves references against the file only.
+func WithExpand(lookup func(string) (string, bool)) ParseOption {
+	return func(p *parser) {
+		if lookup == nil {
+			lookup = func(string) (string, bool) { return "", false }
+		}
+		p.lookup = lookup
+	}
+}
+
+type parser struct {
+	src    string
+	pos    int
+	line   int
+	err    error
+	lookup func(string) (string, bool)
+	// literal marks entries whose values are not expanded (single-quoted
+	// and backtick-quoted), parallel to the parsed entries.
+	literal []bool
+}
+
+func (p *parser) parse() ([]Entry, error) {
+	var entries []Entry
+	for p.pos < len(p.src) {
+		start := p.line
+		raw := p.readLine()
+		line := strings.TrimLeft(raw, " \t")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			line = strings.TrimSpace(rest)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			p.fail(start, "expected KEY=VALUE")
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if !validKey(key) {
+			p.fail(start, fmt.Sprintf("invalid key %q", key))
 			continue
 		}
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
+		trimmed := strings.TrimLeft(value, " \t")
+		value, ok = p.value(trimmed, start)
+		if !ok {
 			continue
 		}
-		key := strings.TrimSpace(parts[0])
-		if key == "PORT" || strings.HasSuffix(key, "_PORT") {
-			keys = append(keys, key)
+		entries = append(entries, Entry{Key: key, Value: value})
+		p.literal = append(p.literal, trimmed != "" && (trimmed[0] == '\'' || trimmed[0] == '`'))
+	}
+	if p.lookup != nil {
+		p.expand(entries)
+	}
+	return entries, p.err
+}
+
+// value interprets the text after '='. Quoted values may span several
+// lines; only double quotes process escapes. Unquoted values end at a '#'
+// preceded by whitespace, and text after a closing quote may only be a
+// comment.
+func (p *parser) value(v string, start int) (string, bool) {
+	if v == "" || v[0] == '#' {
+		return "", true
+	}
+	quote := v[0]
+	if quote != '"' && quote != '\'' && quote != '`' {
+		return stripComment(v), true
+	}
+	var b strings.Builder
+	rest := v[1:]
+	for {
+		for i := 0; i < len(rest); i++ {
+			c := rest[i]
+			if c == quote {
+				if tail := strings.TrimSpace(rest[i+1:]); tail != "" && tail[0] != '#' {
+					p.fail(start, fmt.Sprintf("unexpected %q after quoted value", tail))
+				}
+				return b.String(), true
+			}
+			if quote == '"' && c == '\\' && i+1 < len(rest) {
+				i++
+				if rest[i] == '$' && p.lookup != nil {
+					b.WriteString("$$")
+					continue
+				}
+				b.WriteString(unescape(rest[i]))
+				continue
+			}
+			b.WriteByte(c)
 		}
+		if p.pos >= len(p.src) {
+			p.fail(start, fmt.Sprintf("unterminated %c-quoted value", quote))
+			return "", false
+		}
+		b.WriteByte('\n')
+		rest = p.readLine()
+	}
+}
+
+// stripComment removes an inline comment from an unquoted value.
+func stripComment(v string) string {
+	for i := 1; i < len(v); i++ {
+		if v[i] == '#' && (v[i-1] == ' ' || v[i-1] == '\t') {
+			v = v[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(v)
+}
+
+func unescape(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case '"', '\\':
+		return string(c)
+	default:
+		return "\\" + string(c)
+	}
+}
+
+// readLine returns the next line without its terminator.
+func (p *parser) readLine() string {
+	end := strings.IndexByte(p.src[p.pos:], '\n')
+	var line string
+	if end < 0 {
+		line = p.src[p.pos:]
+		p.pos = len(p.src)
+	} else {
+		line = p.src[p.pos : p.pos+end]
+		p.pos += end + 1
+	}
+	p.line++
+	return strings.TrimSuffix(line, "\r")
+}
+
+func (p *parser) fail(line int, msg string) {
+	p.failWith(&ParseError{Line: line, Msg: msg})
+}
+
+func (p *parser) failWith(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '.' || r == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// IsPortKey reports whether key names a port: PORT or *_PORT. autoport's
+// own AUTOPORT_* variables, such as the AUTOPORT_HEALTH_PORT it hands a
+// child, are not port keys, so a nested run does not reassign them.
+func IsPortKey(key string) bool {
+	if strings.HasPrefix(key, "AUTOPORT_") {
+		return false
+	}
+	return key == "PORT" || strings.HasSuffix(key, "_PORT")
+}
+
+// ExtractPortKeys scans a reader for lines matching .env format and returns keys related to ports.
+func ExtractPortKeys(r io.Reader) []string {
+	var keys []string
+	for _, e := range ExtractPortEntries(r) {
+		keys = append(keys, e.Key)
 	}
 	return keys
 }
+
+// ExtractPortEntries scans a reader for lines matching .env format and returns
+// port-related keys together with their current values.
+func ExtractPortEntries(r io.Reader, opts ...ParseOption) []Entry {
+	all, _ := Parse(r, opts...)
+	var entries []Entry
+	for _, e := range all {
+		if IsPortKey(e.Key) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
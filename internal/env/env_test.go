@@ -1,6 +1,8 @@
 package env
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -47,3 +49,239 @@ OTHER_VAR=123
 		})
 	}
 }
+
+func TestExtractPortEntries(t *testing.T) {
+	content := `PORT=8080
+WEB_PORT="3000"
+API_PORT = '4000'
+OTHER=1
+`
+	got := ExtractPortEntries(strings.NewReader(content))
+	want := []Entry{
+		{Key: "PORT", Value: "8080"},
+		{Key: "WEB_PORT", Value: "3000"},
+		{Key: "API_PORT", Value: "4000"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ExtractPortEntries() = %v, want %v", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	content := "export PORT=8080\n" +
+		"export\tAPI_PORT = '4000'\n" +
+		"CERT=\"-----BEGIN-----\nabc\n-----END-----\"\n" +
+		"MSG=\"a\\tb\\nc \\\"q\\\" \\\\ \\d\"\n" +
+		"EMPTY=\n" +
+		"exported_PORT=1\n"
+	got, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []Entry{
+		{Key: "PORT", Value: "8080"},
+		{Key: "API_PORT", Value: "4000"},
+		{Key: "CERT", Value: "-----BEGIN-----\nabc\n-----END-----"},
+		{Key: "MSG", Value: "a\tb\nc \"q\" \\ \\d"},
+		{Key: "EMPTY", Value: ""},
+		{Key: "exported_PORT", Value: "1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Parse() = %#v, want %#v", got, want)
+	}
+}
+
+func TestParse_CommentsAndQuotes(t *testing.T) {
+	content := "PORT=3000 # api\n" +
+		"WEB_PORT=3001#not-a-comment\n" +
+		"API_PORT=\"3002\" # quoted\n" +
+		"DB_PORT= # nothing\n" +
+		"KEY='multi  \nline # kept'\n" +
+		"CMD=`echo \\n`\n" +
+		"HASH=\"a # b\"\n"
+	got, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []Entry{
+		{Key: "PORT", Value: "3000"},
+		{Key: "WEB_PORT", Value: "3001#not-a-comment"},
+		{Key: "API_PORT", Value: "3002"},
+		{Key: "DB_PORT", Value: ""},
+		{Key: "KEY", Value: "multi  \nline # kept"},
+		{Key: "CMD", Value: "echo \\n"},
+		{Key: "HASH", Value: "a # b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Parse() = %#v, want %#v", got, want)
+	}
+}
+
+func TestParse_ReportsFirstMalformedLine(t *testing.T) {
+	content := "PORT=1\nNOT A PAIR\nWEB_PORT=\"open\nAPI_PORT=2\n"
+	got, err := Parse(strings.NewReader(content))
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 2 {
+		t.Fatalf("Parse() error = %v, want ParseError on line 2", err)
+	}
+	if len(got) != 1 || got[0].Key != "PORT" {
+		t.Fatalf("Parse() = %#v, want only PORT before the unterminated quote", got)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"PORT=8080\n",
+		"export WEB_PORT='3000'\n# comment\n",
+		"CERT=\"a\nb\"\nAPI_PORT=1",
+		"MSG=\"\\n\\t\\\\\\\"\"\r\n",
+		"=\n\"\n",
+		"PORT=1 # c\nA='x\ny' # d\nB=`z`",
+		"A=${B:-${C}}\nB=$A\nC=${A+x}$$\n",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, content string) {
+		got, err := Parse(strings.NewReader(content))
+		again, err2 := Parse(strings.NewReader(content))
+		if !reflect.DeepEqual(got, again) || fmt.Sprint(err) != fmt.Sprint(err2) {
+			t.Fatalf("Parse(%q) is not deterministic", content)
+		}
+		if _, err := Parse(strings.NewReader(content), WithExpand(nil)); err == nil && fmt.Sprint(err2) != "<nil>" {
+			t.Fatalf("expansion hid parse error %v in %q", err2, content)
+		}
+		for _, e := range got {
+			if !validKey(e.Key) {
+				t.Fatalf("Parse(%q) returned invalid key %q", content, e.Key)
+			}
+		}
+	})
+}
+
+func FuzzParseRoundTrip(f *testing.F) {
+	f.Add("PORT", "8080")
+	f.Add("CERT", "line1\nline2\r\n\t\"quoted\" \\ end")
+	f.Fuzz(func(t *testing.T, key, value string) {
+		if !validKey(key) {
+			return
+		}
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+		content := "export " + key + "=\"" + r.Replace(value) + "\"\n"
+		got, err := Parse(strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", content, err)
+		}
+		if want := []Entry{{Key: key, Value: value}}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Parse(%q) = %#v, want %#v", content, got, want)
+		}
+	})
+}
+
+func TestParse_Expand(t *testing.T) {
+	content := "API_URL=http://localhost:${API_PORT}/v1\n" +
+		"API_PORT=4000\n" +
+		"WEB_PORT=${PORT:-3000}\n" +
+		"HOST=$HOSTNAME\n" +
+		"LITERAL='${API_PORT}'\n" +
+		"ESCAPED=\"\\${API_PORT} $$API_PORT\"\n" +
+		"SELF=${SELF:-fallback}\n" +
+		"ALT=${API_PORT:+set}${MISSING+unset}\n"
+	env := map[string]string{"HOSTNAME": "box"}
+	got, err := Parse(strings.NewReader(content), WithExpand(func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []Entry{
+		{Key: "API_URL", Value: "http://localhost:4000/v1"},
+		{Key: "API_PORT", Value: "4000"},
+		{Key: "WEB_PORT", Value: "3000"},
+		{Key: "HOST", Value: "box"},
+		{Key: "LITERAL", Value: "${API_PORT}"},
+		{Key: "ESCAPED", Value: "${API_PORT} $API_PORT"},
+		{Key: "SELF", Value: "fallback"},
+		{Key: "ALT", Value: "set"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Parse() = %#v, want %#v", got, want)
+	}
+}
+
+func TestParse_ExpandLookupWins(t *testing.T) {
+	content := "PORT=3000\nURL=http://localhost:${PORT}\n"
+	got, _ := Parse(strings.NewReader(content), WithExpand(func(k string) (string, bool) {
+		if k == "PORT" {
+			return "13000", true
+		}
+		return "", false
+	}))
+	if got[1].Value != "http://localhost:13000" {
+		t.Fatalf("URL = %q, want lookup value to win", got[1].Value)
+	}
+}
+
+func TestParse_ExpandCycle(t *testing.T) {
+	content := "A=${B}x\nB=${C}\nC=${A}\nD=ok\n"
+	got, err := Parse(strings.NewReader(content), WithExpand(nil))
+	var cycle *CycleError
+	if !errors.As(err, &cycle) || !reflect.DeepEqual(cycle.Keys, []string{"A", "B", "C", "A"}) {
+		t.Fatalf("Parse() error = %v, want cycle A -> B -> C -> A", err)
+	}
+	if len(got) != 4 || got[0].Value != "x" || got[3].Value != "ok" {
+		t.Fatalf("Parse() = %#v", got)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	lookup := func(k string) (string, bool) {
+		switch k {
+		case "SET":
+			return "v", true
+		case "EMPTY":
+			return "", true
+		}
+		return "", false
+	}
+	tests := map[string]string{
+		"${SET}":                 "v",
+		"${EMPTY:-d}":            "d",
+		"${EMPTY-d}":             "",
+		"${UNSET-${SET}}":        "v",
+		"${EMPTY+alt}":           "alt",
+		"${EMPTY:+alt}":          "",
+		"a$ b$":                  "a$ b$",
+		"${SET":                  "${SET",
+		"$SET.$SET":              "v.v",
+		"${SET?required}":        "${SET?required}",
+		"pre-${UNSET:-x-${SET}}": "pre-x-v",
+	}
+	for in, want := range tests {
+		if got := Expand(in, lookup); got != want {
+			t.Errorf("Expand(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	src := "# ports\r\nexport WEB_PORT=\"3000\" # web\r\nDB_URL=postgres://localhost:5432/app\r\nNOTE='multi\r\nline'\r\nAPI_PORT = 4000\r\nEMPTY_PORT=\r\nWEB_PORT=3001"
+	got, edits := Merge(src, map[string]string{"WEB_PORT": "10000", "API_PORT": "4000", "EMPTY_PORT": "10002", "ADMIN_PORT": "10003"})
+	want := "# ports\r\nexport WEB_PORT=\"10000\" # web\r\nDB_URL=postgres://localhost:5432/app\r\nNOTE='multi\r\nline'\r\nAPI_PORT = 4000\r\nEMPTY_PORT=10002\r\nWEB_PORT=10000\r\nADMIN_PORT=10003\r\n"
+	if got != want {
+		t.Fatalf("Merge() =\n%q\nwant\n%q", got, want)
+	}
+	wantEdits := []Edit{
+		{Key: "WEB_PORT", Line: 2, Old: `export WEB_PORT="3000" # web`, New: `export WEB_PORT="10000" # web`},
+		{Key: "EMPTY_PORT", Line: 7, Old: "EMPTY_PORT=", New: "EMPTY_PORT=10002"},
+		{Key: "WEB_PORT", Line: 8, Old: "WEB_PORT=3001", New: "WEB_PORT=10000"},
+		{Key: "ADMIN_PORT", New: "ADMIN_PORT=10003"},
+	}
+	if !reflect.DeepEqual(edits, wantEdits) {
+		t.Fatalf("edits = %+v\nwant %+v", edits, wantEdits)
+	}
+
+	if got, edits := Merge("A_PORT=1\n", map[string]string{"A_PORT": "1"}); got != "A_PORT=1\n" || len(edits) != 0 {
+		t.Fatalf("unchanged merge = %q, %+v", got, edits)
+	}
+}
@@ -0,0 +1,170 @@
+package env
+
+import (
+	"slices"
+	"strings"
+)
+
+// CycleError reports variable references that form a cycle, such as
+// A=${B} and B=${A}. The references in the cycle expand to empty strings.
+type CycleError struct {
+	Keys []string
+}
+
+func (e *CycleError) Error() string {
+	return "cycle in variable references: " + strings.Join(e.Keys, " -> ")
+}
+
+// Expand replaces variable references in s using lookup, following the
+// docker-compose interpolation forms:
+//
+//	$VAR, ${VAR}      value of VAR, empty when unset
+//	${VAR:-default}   default when VAR is unset or empty
+//	${VAR-default}    default when VAR is unset
+//	${VAR:+alt}       alt when VAR is set and not empty
+//	${VAR+alt}        alt when VAR is set
+//	$$                a literal $
+//
+// Defaults and alternatives may themselves contain references. A '$' that
+// does not start a reference, and an unterminated "${", are kept literally.
+func Expand(s string, lookup func(string) (string, bool)) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '$' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				b.WriteString(s[i:])
+				return b.String()
+			}
+			b.WriteString(expandBraced(s[i+2:end], lookup))
+			i = end
+		case isNameStart(next):
+			j := i + 2
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			v, _ := lookup(s[i+1 : j])
+			b.WriteString(v)
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// expandBraced expands the inside of "${...}".
+func expandBraced(expr string, lookup func(string) (string, bool)) string {
+	n := 0
+	for n < len(expr) && isNameChar(expr[n]) {
+		n++
+	}
+	name, op := expr[:n], expr[n:]
+	v, set := lookup(name)
+	colon := strings.HasPrefix(op, ":")
+	if colon {
+		op = op[1:]
+	}
+	nonEmpty := set && (!colon || v != "")
+	switch {
+	case op == "" && !colon:
+		return v
+	case strings.HasPrefix(op, "-"):
+		if nonEmpty {
+			return v
+		}
+		return Expand(op[1:], lookup)
+	case strings.HasPrefix(op, "+"):
+		if nonEmpty {
+			return Expand(op[1:], lookup)
+		}
+		return ""
+	default:
+		return "${" + expr + "}"
+	}
+}
+
+// closingBrace returns the index of the '}' closing a "${" whose contents
+// start at from, allowing nested references, or -1.
+func closingBrace(s string, from int) int {
+	depth := 1
+	for i := from; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
+
+// expand resolves references in every expandable entry. A reference is
+// looked up through p.lookup first and then through the file's last
+// definition of that key, which is expanded in turn. A key referring to
+// itself (A=${A:-x}) sees itself as unset; longer cycles are reported.
+func (p *parser) expand(entries []Entry) {
+	raw := make([]string, len(entries))
+	last := make(map[string]int, len(entries))
+	for i, e := range entries {
+		raw[i] = e.Value
+		last[e.Key] = i
+	}
+	done := make(map[string]string)
+	var stack []string
+	var resolve func(name string) (string, bool)
+	resolve = func(name string) (string, bool) {
+		if v, ok := p.lookup(name); ok {
+			return v, true
+		}
+		i, ok := last[name]
+		if !ok || (len(stack) > 0 && stack[len(stack)-1] == name) {
+			return "", false
+		}
+		if v, ok := done[name]; ok {
+			return v, true
+		}
+		if at := slices.Index(stack, name); at >= 0 {
+			p.failWith(&CycleError{Keys: append(slices.Clone(stack[at:]), name)})
+			return "", true
+		}
+		if p.literal[i] {
+			return raw[i], true
+		}
+		stack = append(stack, name)
+		v := Expand(raw[i], resolve)
+		stack = stack[:len(stack)-1]
+		done[name] = v
+		return v, true
+	}
+	for i := range entries {
+		if p.literal[i] {
+			continue
+		}
+		stack = append(stack[:0], entries[i].Key)
+		entries[i].Value = Expand(raw[i], resolve)
+	}
+}
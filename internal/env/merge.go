@@ -0,0 +1,150 @@
+package env
+
+import (
+	"slices"
+	"strings"
+)
+
+// Edit is one line Merge changed or added. Line is 1-based, or 0 for a key
+// appended at the end; Old is empty for appended keys.
+type Edit struct {
+	Key  string
+	Line int
+	Old  string
+	New  string
+}
+
+// Merge sets each key in values in dotenv content src and returns the
+// result with the edits made. Only the value of a managed key changes:
+// its "export " prefix, quotes, and inline comment stay, as does every
+// other byte of src, including comments, blank lines, unknown keys, and
+// line endings. Keys src does not set are appended, sorted. Content after
+// an unterminated quote is left as is.
+func Merge(src string, values map[string]string) (string, []Edit) {
+	var out strings.Builder
+	var edits []Edit
+	seen := map[string]bool{}
+	pos, line := 0, 1
+	for pos < len(src) {
+		start, startLine := pos, line
+		end := lineEnd(src, pos)
+		text := strings.TrimSuffix(src[pos:end], "\r")
+		pos, line = next(src, end), line+1
+
+		key, valueAt, ok := assignment(text)
+		if !ok {
+			out.WriteString(src[start:pos])
+			continue
+		}
+		valueAt += start
+		from, to := valueAt, valueAt
+		if q := quoteAt(src, valueAt); q != 0 {
+			closeAt := closingQuote(src, valueAt+1, q)
+			if closeAt < 0 {
+				out.WriteString(src[start:])
+				pos = len(src)
+				break
+			}
+			from, to = valueAt+1, closeAt
+			// A quoted value may span lines; continue after its last one.
+			if closeAt >= pos {
+				line += strings.Count(src[pos:closeAt], "\n") + 1
+				pos = next(src, lineEnd(src, closeAt))
+			}
+		} else if value := text[valueAt-start:]; value != "" && value[0] != '#' {
+			to = valueAt + len(stripComment(value))
+		}
+		v, managed := values[key]
+		if !managed {
+			out.WriteString(src[start:pos])
+			continue
+		}
+		seen[key] = true
+		out.WriteString(src[start:from])
+		out.WriteString(v)
+		out.WriteString(src[to:pos])
+		if src[from:to] != v {
+			oldLine := strings.TrimSuffix(src[start:lineEnd(src, start)], "\r")
+			newLine := oldLine[:from-start] + v + strings.TrimSuffix(src[to:lineEnd(src, to)], "\r")
+			edits = append(edits, Edit{Key: key, Line: startLine, Old: oldLine, New: newLine})
+		}
+	}
+
+	var missing []string
+	for key := range values {
+		if !seen[key] {
+			missing = append(missing, key)
+		}
+	}
+	slices.Sort(missing)
+	newline := "\n"
+	if strings.Contains(src, "\r\n") {
+		newline = "\r\n"
+	}
+	if len(missing) > 0 && src != "" && !strings.HasSuffix(src, "\n") {
+		out.WriteString(newline)
+	}
+	for _, key := range missing {
+		entry := key + "=" + values[key]
+		out.WriteString(entry + newline)
+		edits = append(edits, Edit{Key: key, New: entry})
+	}
+	return out.String(), edits
+}
+
+// assignment returns the key a dotenv line sets and the offset of its
+// value, skipping leading whitespace after '='.
+func assignment(line string) (key string, valueAt int, ok bool) {
+	rest := strings.TrimLeft(line, " \t")
+	if after, found := strings.CutPrefix(rest, "export"); found && after != "" && (after[0] == ' ' || after[0] == '\t') {
+		rest = strings.TrimLeft(after, " \t")
+	}
+	k, v, found := strings.Cut(rest, "=")
+	if !found {
+		return "", 0, false
+	}
+	key = strings.TrimSpace(k)
+	if !validKey(key) {
+		return "", 0, false
+	}
+	valueAt = len(line) - len(strings.TrimLeft(v, " \t"))
+	return key, valueAt, true
+}
+
+func quoteAt(src string, i int) byte {
+	if i < len(src) && (src[i] == '"' || src[i] == '\'' || src[i] == '`') {
+		return src[i]
+	}
+	return 0
+}
+
+// closingQuote returns the offset of the quote ending a value that opened
+// before from, or -1. Only double quotes have escapes.
+func closingQuote(src string, from int, quote byte) int {
+	for i := from; i < len(src); i++ {
+		switch {
+		case src[i] == quote:
+			return i
+		case quote == '"' && src[i] == '\\':
+			i++
+		}
+	}
+	return -1
+}
+
+// lineEnd returns the offset of the '\n' ending the line at pos, or
+// len(src).
+func lineEnd(src string, pos int) int {
+	if i := strings.IndexByte(src[pos:], '\n'); i >= 0 {
+		return pos + i
+	}
+	return len(src)
+}
+
+// next returns the offset after the line terminator at end.
+func next(src string, end int) int {
+	if end < len(src) {
+		return end + 1
+	}
+	return end
+}
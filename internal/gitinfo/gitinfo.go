@@ -0,0 +1,79 @@
+// Package gitinfo reads repository identity (remote URL, branch, toplevel) by invoking
+// the git binary.
+package gitinfo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// RemoteURL returns the URL of the named remote for the repository at dir.
+func RemoteURL(ctx context.Context, dir, remote string) (string, error) {
+	return run(ctx, dir, "remote", "get-url", remote)
+}
+
+// Branch returns the current branch name for the repository at dir, or
+// "HEAD" when detached.
+func Branch(ctx context.Context, dir string) (string, error) {
+	return run(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD")
+}
+
+// Toplevel returns the root directory of the work tree containing dir.
+func Toplevel(ctx context.Context, dir string) (string, error) {
+	return run(ctx, dir, "rev-parse", "--show-toplevel")
+}
+
+// Tracked reports whether file, relative to dir, is tracked in the
+// repository at dir. Errors, including dir not being in a work tree,
+// report false.
+func Tracked(ctx context.Context, dir, file string) bool {
+	_, err := run(ctx, dir, "ls-files", "--error-unmatch", "--", file)
+	return err == nil
+}
+
+// Ignored reports whether file, relative to dir, is excluded by the
+// repository's ignore rules. Errors report false.
+func Ignored(ctx context.Context, dir, file string) bool {
+	_, err := run(ctx, dir, "check-ignore", "-q", "--", file)
+	return err == nil
+}
+
+func run(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// NormalizeRemote reduces equivalent remote URLs to one form, so that
+// "git@github.com:acme/shop.git" and "https://github.com/acme/shop" both
+// become "github.com/acme/shop".
+func NormalizeRemote(url string) string {
+	u := strings.TrimSpace(url)
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	} else if at := strings.Index(u, "@"); at >= 0 && strings.Contains(u[at:], ":") {
+		// scp-like syntax: user@host:path
+		u = strings.Replace(u[at+1:], ":", "/", 1)
+	}
+	if at := strings.Index(u, "@"); at >= 0 && at < strings.Index(u+"/", "/") {
+		u = u[at+1:]
+	}
+	u = strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+	host, path, _ := strings.Cut(u, "/")
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	return strings.ToLower(host) + "/" + path
+}
@@ -0,0 +1,93 @@
+package gitinfo
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeRemote(t *testing.T) {
+	tests := map[string]string{
+		"git@github.com:acme/shop.git":           "github.com/acme/shop",
+		"https://github.com/acme/shop":           "github.com/acme/shop",
+		"https://user@GitHub.com/acme/shop.git/": "github.com/acme/shop",
+		"ssh://git@github.com:22/acme/shop.git":  "github.com/acme/shop",
+	}
+	for in, want := range tests {
+		if got := NormalizeRemote(in); got != want {
+			t.Errorf("NormalizeRemote(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// initRepo creates a repository with one commit on branch main.
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"remote", "add", "origin", "git@github.com:acme/shop.git"},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestRemoteURLAndBranch(t *testing.T) {
+	dir := initRepo(t)
+	ctx := context.Background()
+
+	url, err := RemoteURL(ctx, dir, "origin")
+	if err != nil || url != "git@github.com:acme/shop.git" {
+		t.Fatalf("RemoteURL() = %q, %v", url, err)
+	}
+	branch, err := Branch(ctx, dir)
+	if err != nil || branch != "main" {
+		t.Fatalf("Branch() = %q, %v", branch, err)
+	}
+	if _, err := RemoteURL(ctx, dir, "upstream"); err == nil {
+		t.Fatal("expected error for missing remote")
+	}
+	sub := filepath.Join(dir, "apps", "web")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	top, err := Toplevel(ctx, sub)
+	want, _ := filepath.EvalSymlinks(dir)
+	if err != nil || filepath.Clean(top) != want {
+		t.Fatalf("Toplevel() = %q, %v, want %q", top, err, want)
+	}
+}
+
+func TestTrackedAndIgnored(t *testing.T) {
+	dir := initRepo(t)
+	ctx := context.Background()
+	for name, body := range map[string]string{".gitignore": "*.log\n", "kept.txt": "x", "debug.log": "x"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("git", "-C", dir, "add", "kept.txt")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+
+	if !Tracked(ctx, dir, "kept.txt") || Tracked(ctx, dir, "debug.log") {
+		t.Fatal("Tracked() should report only added files")
+	}
+	if !Ignored(ctx, dir, "debug.log") || Ignored(ctx, dir, "kept.txt") {
+		t.Fatal("Ignored() should follow .gitignore")
+	}
+	if Tracked(ctx, t.TempDir(), "kept.txt") {
+		t.Fatal("Tracked() outside a repository should be false")
+	}
+}
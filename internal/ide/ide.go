@@ -0,0 +1,124 @@
+// Package ide implements the line-delimited JSON-RPC 2.0 transport used by
+// `autoport ide serve`, so editor plugins can ask which port a key will get.
+package ide
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Standard JSON-RPC error codes plus one for application failures.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeServerError    = -32000
+)
+
+// maxLine bounds a single request line.
+const maxLine = 1 << 20
+
+// Request is one call from the editor. Requests without an id are
+// notifications and get no response.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response answers a Request with either Result or Error.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error object. Handlers may return one to choose the
+// code; any other error is reported as CodeServerError.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Errorf builds an *Error with code.
+func Errorf(code int, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrShutdown may be returned by a handler (with a result) to end Serve
+// after the response is written.
+var ErrShutdown = errors.New("shutdown requested")
+
+// Handler answers one method call.
+type Handler func(ctx context.Context, method string, params json.RawMessage) (any, error)
+
+// Serve reads one request per line from r and writes one response per line
+// to w until r is exhausted, ctx is done, or a handler returns ErrShutdown.
+func Serve(ctx context.Context, r io.Reader, w io.Writer, h Handler) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req Request
+		if err := json.Unmarshal(line, &req); err != nil {
+			if err := enc.Encode(Response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: Errorf(CodeParseError, "parse error: %v", err)}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "" {
+			if err := enc.Encode(Response{JSONRPC: "2.0", ID: idOrNull(req.ID), Error: Errorf(CodeInvalidRequest, "missing method")}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		result, err := h(ctx, req.Method, req.Params)
+		shutdown := errors.Is(err, ErrShutdown)
+		if len(req.ID) > 0 {
+			resp := Response{JSONRPC: "2.0", ID: req.ID}
+			if err != nil && !shutdown {
+				var rpcErr *Error
+				if !errors.As(err, &rpcErr) {
+					rpcErr = &Error{Code: CodeServerError, Message: err.Error()}
+				}
+				resp.Error = rpcErr
+			} else {
+				resp.Result = result
+			}
+			if err := enc.Encode(resp); err != nil {
+				return err
+			}
+		}
+		if shutdown {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func idOrNull(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
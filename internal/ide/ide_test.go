@@ -0,0 +1,50 @@
+package ide
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"echo","params":{"v":"x"}}`,
+		`not json`,
+		`{"jsonrpc":"2.0","id":2,"method":"missing"}`,
+		`{"jsonrpc":"2.0","method":"echo","params":{}}`,
+		`{"jsonrpc":"2.0","id":"3","method":"fail"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","id":5,"method":"echo"}`,
+	}, "\n")
+
+	h := func(ctx context.Context, method string, params json.RawMessage) (any, error) {
+		switch method {
+		case "echo":
+			return json.RawMessage(params), nil
+		case "fail":
+			return nil, errors.New("boom")
+		case "shutdown":
+			return "bye", ErrShutdown
+		}
+		return nil, Errorf(CodeMethodNotFound, "unknown method %q", method)
+	}
+
+	var out bytes.Buffer
+	if err := Serve(context.Background(), strings.NewReader(input), &out, h); err != nil {
+		t.Fatalf("Serve() error: %v", err)
+	}
+	want := []string{
+		`{"jsonrpc":"2.0","id":1,"result":{"v":"x"}}`,
+		`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error: invalid character 'o' in literal null (expecting 'u')"}}`,
+		`{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"unknown method \"missing\""}}`,
+		`{"jsonrpc":"2.0","id":"3","error":{"code":-32000,"message":"boom"}}`,
+		`{"jsonrpc":"2.0","id":4,"result":"bye"}`,
+	}
+	got := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("responses:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
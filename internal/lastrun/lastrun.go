@@ -0,0 +1,142 @@
+// Package lastrun persists the assignments of the previous run per project so
+// the run summary can explain why a port moved.
+package lastrun
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/gelleson/autoport/internal/state"
+	"github.com/gelleson/autoport/pkg/port"
+)
+
+const Version = 1
+
+// Reasons reported for a changed assignment, most specific first.
+const (
+	ReasonRangeChanged       = "range changed"
+	ReasonBranchChanged      = "branch changed"
+	ReasonSeedChanged        = "seed changed"
+	ReasonKeySetChanged      = "key set changed"
+	ReasonOccupied           = "occupied"
+	ReasonPreviouslyOccupied = "previously occupied"
+	ReasonUnknown            = "unknown"
+)
+
+// Entry is one key's port and how many busy ports were skipped to reach it.
+type Entry struct {
+	Key    string `json:"key"`
+	Port   int    `json:"port"`
+	Probes int    `json:"probes"`
+}
+
+// Record is the persisted state of one run.
+type Record struct {
+	Version     int     `json:"version"`
+	CWD         string  `json:"cwd"`
+	Branch      string  `json:"branch,omitempty"`
+	Seed        uint32  `json:"seed"`
+	Range       string  `json:"range"`
+	Assignments []Entry `json:"assignments"`
+	RecordedAt  string  `json:"recorded_at"`
+}
+
+// Change describes a key whose port differs from the previous run.
+type Change struct {
+	Key      string `json:"key"`
+	Previous int    `json:"previous"`
+	Current  int    `json:"current"`
+	Reason   string `json:"reason"`
+}
+
+// DefaultDir returns the directory last-run records are kept in:
+// $XDG_STATE_HOME/autoport/lastrun, falling back to ~/.local/state.
+func DefaultDir() string {
+	return state.Dir("lastrun")
+}
+
+// PathFor returns the record path for the project at cwd.
+func PathFor(dir, cwd string) string {
+	return filepath.Join(dir, fmt.Sprintf("%08x.json", port.HashPath(cwd)))
+}
+
+// Read loads a record. A missing file is reported as os.ErrNotExist.
+func Read(path string) (Record, error) {
+	var rec Record
+	if err := state.ReadJSON(path, Version, &rec); err != nil {
+		return Record{}, fmt.Errorf("read last run: %w", err)
+	}
+	return rec, nil
+}
+
+// Write stores rec at path, replacing any previous record atomically.
+func Write(path string, rec Record) error {
+	normalize(&rec)
+	if err := state.WriteJSON(path, rec); err != nil {
+		return fmt.Errorf("write last run: %w", err)
+	}
+	return nil
+}
+
+// Swap stores rec at path and returns the record it replaced, under the
+// path's lock so concurrent runs of a project each see the previous one.
+// ok is false when there was no readable previous record.
+func Swap(path string, rec Record) (prev Record, ok bool, err error) {
+	normalize(&rec)
+	err = state.Update(path, Version, func(doc *Record, exists bool) error {
+		prev, ok = *doc, exists
+		*doc = rec
+		return nil
+	})
+	if err != nil {
+		return Record{}, false, fmt.Errorf("write last run: %w", err)
+	}
+	return prev, ok, nil
+}
+
+func normalize(rec *Record) {
+	rec.Version = Version
+	sort.Slice(rec.Assignments, func(i, j int) bool { return rec.Assignments[i].Key < rec.Assignments[j].Key })
+}
+
+// Diff reports keys present in both records whose port changed, sorted by
+// key, each with the most likely reason.
+func Diff(prev, cur Record) []Change {
+	before := make(map[string]Entry, len(prev.Assignments))
+	for _, e := range prev.Assignments {
+		before[e.Key] = e
+	}
+	keySetChanged := len(prev.Assignments) != len(cur.Assignments)
+	for _, e := range cur.Assignments {
+		if _, ok := before[e.Key]; !ok {
+			keySetChanged = true
+		}
+	}
+
+	var changes []Change
+	for _, e := range cur.Assignments {
+		old, ok := before[e.Key]
+		if !ok || old.Port == e.Port {
+			continue
+		}
+		reason := ReasonUnknown
+		switch {
+		case prev.Range != cur.Range:
+			reason = ReasonRangeChanged
+		case prev.Branch != "" && cur.Branch != "" && prev.Branch != cur.Branch:
+			reason = ReasonBranchChanged
+		case prev.Seed != cur.Seed:
+			reason = ReasonSeedChanged
+		case keySetChanged:
+			reason = ReasonKeySetChanged
+		case e.Probes > 0:
+			reason = ReasonOccupied
+		case old.Probes > 0:
+			reason = ReasonPreviouslyOccupied
+		}
+		changes = append(changes, Change{Key: e.Key, Previous: old.Port, Current: e.Port, Reason: reason})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
@@ -0,0 +1,71 @@
+package lastrun
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteRead_RoundTrip(t *testing.T) {
+	path := PathFor(filepath.Join(t.TempDir(), "state"), "/repo")
+	rec := Record{CWD: "/repo", Branch: "main", Seed: 7, Range: "10000-20000", Assignments: []Entry{{Key: "WEB_PORT", Port: 10002}, {Key: "API_PORT", Port: 10001, Probes: 1}}}
+	if err := Write(path, rec); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if got.Version != Version || got.Branch != "main" || got.Assignments[0].Key != "API_PORT" {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+}
+
+func TestRead_Missing(t *testing.T) {
+	_, err := Read(filepath.Join(t.TempDir(), "missing.json"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestDiff_Reasons(t *testing.T) {
+	base := Record{Seed: 1, Range: "10000-20000", Branch: "main", Assignments: []Entry{{Key: "PORT", Port: 10001}, {Key: "WEB_PORT", Port: 10002}}}
+
+	tests := []struct {
+		name   string
+		mutate func(r *Record)
+		want   string
+	}{
+		{"occupied", func(r *Record) { r.Assignments[0] = Entry{Key: "PORT", Port: 10003, Probes: 2} }, ReasonOccupied},
+		{"range", func(r *Record) { r.Range = "3000-4000"; r.Assignments[0].Port = 3001 }, ReasonRangeChanged},
+		{"branch", func(r *Record) { r.Branch = "feature"; r.Seed = 2; r.Assignments[0].Port = 10009 }, ReasonBranchChanged},
+		{"seed", func(r *Record) { r.Seed = 2; r.Assignments[0].Port = 10009 }, ReasonSeedChanged},
+		{"key set", func(r *Record) {
+			r.Assignments = append(r.Assignments, Entry{Key: "API_PORT", Port: 10003})
+			r.Assignments[0].Port = 10004
+		}, ReasonKeySetChanged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur := base
+			cur.Assignments = append([]Entry{}, base.Assignments...)
+			tt.mutate(&cur)
+			got := Diff(base, cur)
+			if len(got) != 1 || got[0].Key != "PORT" || got[0].Reason != tt.want {
+				t.Fatalf("Diff() = %+v, want PORT with %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := Diff(base, base); got != nil {
+		t.Fatalf("expected no changes, got %+v", got)
+	}
+	prev := base
+	prev.Assignments = []Entry{{Key: "PORT", Port: 10005, Probes: 1}, {Key: "WEB_PORT", Port: 10002}}
+	want := []Change{{Key: "PORT", Previous: 10005, Current: 10001, Reason: ReasonPreviouslyOccupied}}
+	if got := Diff(prev, base); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff() = %+v, want %+v", got, want)
+	}
+}
@@ -1,8 +1,10 @@
 package lockfile
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
@@ -27,6 +29,21 @@ type LockFile struct {
 	Range          string       `json:"range"`
 	Assignments    []Assignment `json:"assignments"`
 	CreatedAt      string       `json:"created_at"`
+	SeedString     string       `json:"seed_string,omitempty"`
+}
+
+// WriteOption sets optional lockfile metadata.
+type WriteOption func(*LockFile)
+
+// WithSeedString records the string a --seed-string seed was derived from.
+func WithSeedString(s string) WriteOption {
+	return func(lf *LockFile) { lf.SeedString = s }
+}
+
+// WithCreatedAt sets the creation time recorded in the lockfile instead of
+// the current time.
+func WithCreatedAt(t time.Time) WriteOption {
+	return func(lf *LockFile) { lf.CreatedAt = t.UTC().Format(time.RFC3339) }
 }
 
 func Fingerprint(cwd string) string {
@@ -37,7 +54,7 @@ func PathFor(cwd string) string {
 	return filepath.Join(cwd, FileName)
 }
 
-func Write(path, cwd, rangeSpec string, overrides map[string]string) error {
+func Write(path, cwd, rangeSpec string, overrides map[string]string, opts ...WriteOption) error {
 	keys := make([]string, 0, len(overrides))
 	for k := range overrides {
 		keys = append(keys, k)
@@ -55,23 +72,70 @@ func Write(path, cwd, rangeSpec string, overrides map[string]string) error {
 		Assignments:    assignments,
 		CreatedAt:      time.Now().UTC().Format(time.RFC3339),
 	}
+	for _, opt := range opts {
+		opt(&lf)
+	}
 
 	data, err := json.MarshalIndent(lf, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal lockfile: %w", err)
 	}
 	data = append(data, '\n')
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	// Write through a temporary file so an interrupted write never leaves
+	// a truncated lockfile behind.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".autoport.lock-*")
+	if err != nil {
+		return fmt.Errorf("write lockfile: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write lockfile: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write lockfile: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write lockfile: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
 		return fmt.Errorf("write lockfile: %w", err)
 	}
 	return nil
 }
 
+// WriteContext is Write that returns ctx.Err() as soon as ctx is done,
+// without waiting for a write blocked on a hung (e.g. network) filesystem.
+// The abandoned write either completes atomically or leaves no lockfile.
+func WriteContext(ctx context.Context, path, cwd, rangeSpec string, overrides map[string]string, opts ...WriteOption) error {
+	_, err := withContext(ctx, func() (struct{}, error) {
+		return struct{}{}, Write(path, cwd, rangeSpec, overrides, opts...)
+	})
+	return err
+}
+
 func Read(path string) (LockFile, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return LockFile{}, err
 	}
+	return decode(data)
+}
+
+// ReadFS reads the lockfile name from fsys.
+func ReadFS(fsys fs.FS, name string) (LockFile, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return LockFile{}, err
+	}
+	return decode(data)
+}
+
+func decode(data []byte) (LockFile, error) {
 	var lf LockFile
 	if err := json.Unmarshal(data, &lf); err != nil {
 		return LockFile{}, fmt.Errorf("parse lockfile: %w", err)
@@ -82,6 +146,37 @@ func Read(path string) (LockFile, error) {
 	return lf, nil
 }
 
+// ReadContext is Read that returns ctx.Err() as soon as ctx is done, without
+// waiting for a read blocked on a hung (e.g. network) filesystem.
+func ReadContext(ctx context.Context, path string) (LockFile, error) {
+	return withContext(ctx, func() (LockFile, error) { return Read(path) })
+}
+
+// withContext runs fn in its own goroutine and returns its result, or
+// ctx.Err() if ctx is done first. fn keeps running in the background; file
+// system calls cannot be interrupted.
+func withContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := fn()
+		done <- result{v, err}
+	}()
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
 func ToMap(assignments []Assignment) map[string]string {
 	m := make(map[string]string, len(assignments))
 	for _, a := range assignments {
@@ -1,6 +1,8 @@
 package lockfile
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -30,6 +32,21 @@ func TestWriteReadRoundTrip(t *testing.T) {
 	}
 }
 
+func TestWrite_SeedString(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, FileName)
+	if err := Write(path, tmp, "10000-10100", map[string]string{"PORT": "10001"}, WithSeedString("my-service-dev")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	lf, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if lf.SeedString != "my-service-dev" {
+		t.Fatalf("seed_string=%q", lf.SeedString)
+	}
+}
+
 func TestRead_UnsupportedVersion(t *testing.T) {
 	tmp := t.TempDir()
 	path := filepath.Join(tmp, FileName)
@@ -40,3 +57,32 @@ func TestRead_UnsupportedVersion(t *testing.T) {
 		t.Fatalf("expected version error")
 	}
 }
+
+func TestContextIO_Canceled(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, FileName)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := WriteContext(ctx, path, tmp, "10000-10100", map[string]string{"PORT": "10001"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("WriteContext() error = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("canceled write left a lockfile: %v", err)
+	}
+	if _, err := ReadContext(ctx, path); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReadContext() error = %v, want context.Canceled", err)
+	}
+
+	if err := WriteContext(context.Background(), path, tmp, "10000-10100", map[string]string{"PORT": "10001"}); err != nil {
+		t.Fatalf("WriteContext() error = %v", err)
+	}
+	lf, err := ReadContext(context.Background(), path)
+	if err != nil || len(lf.Assignments) != 1 {
+		t.Fatalf("ReadContext() = %+v, %v", lf, err)
+	}
+	entries, _ := os.ReadDir(tmp)
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left behind: %v", entries)
+	}
+}
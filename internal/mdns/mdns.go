@@ -0,0 +1,299 @@
+// Package mdns advertises services on the local network using multicast DNS
+// (RFC 6762) and DNS-SD (RFC 6763) records. It implements only what autoport
+// needs: announcing a fixed set of services, answering queries for them, and
+// withdrawing them on shutdown.
+package mdns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	typeA   = 1
+	typePTR = 12
+	typeTXT = 16
+	typeSRV = 33
+
+	classIN         = 1
+	classCacheFlush = 0x8000
+
+	defaultTTL = 120
+)
+
+var groupAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Service describes one advertised instance, e.g. instance "web-api_port" of
+// service type "_autoport._tcp" on port 12345.
+type Service struct {
+	Instance string
+	Type     string
+	Port     int
+	Text     []string
+}
+
+// FullName returns the DNS-SD instance name, e.g. "web._autoport._tcp.local.".
+func (s Service) FullName() string {
+	return s.Instance + "." + s.Type + ".local."
+}
+
+func (s Service) typeName() string {
+	return s.Type + ".local."
+}
+
+type record struct {
+	name  string
+	rtype uint16
+	class uint16
+	ttl   uint32
+	data  []byte
+}
+
+// Records builds the PTR, SRV, TXT and A records announcing services on host
+// (a bare host name such as "laptop") with address ip.
+func Records(host string, ip net.IP, services []Service, ttl uint32) ([]byte, error) {
+	target := host + ".local."
+	var records []record
+	for _, s := range services {
+		ptr, err := encodeName(s.FullName())
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record{name: s.typeName(), rtype: typePTR, class: classIN, ttl: ttl, data: ptr})
+
+		tgt, err := encodeName(target)
+		if err != nil {
+			return nil, err
+		}
+		srv := make([]byte, 6, 6+len(tgt))
+		binary.BigEndian.PutUint16(srv[4:], uint16(s.Port))
+		srv = append(srv, tgt...)
+		records = append(records, record{name: s.FullName(), rtype: typeSRV, class: classIN | classCacheFlush, ttl: ttl, data: srv})
+
+		records = append(records, record{name: s.FullName(), rtype: typeTXT, class: classIN | classCacheFlush, ttl: ttl, data: encodeTXT(s.Text)})
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		records = append(records, record{name: target, rtype: typeA, class: classIN | classCacheFlush, ttl: ttl, data: []byte(ip4)})
+	}
+	return encodeResponse(records)
+}
+
+func encodeResponse(records []record) ([]byte, error) {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[2:], 0x8400) // response, authoritative
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(records)))
+	for _, r := range records {
+		name, err := encodeName(r.name)
+		if err != nil {
+			return nil, err
+		}
+		msg = append(msg, name...)
+		var fixed [10]byte
+		binary.BigEndian.PutUint16(fixed[0:], r.rtype)
+		binary.BigEndian.PutUint16(fixed[2:], r.class)
+		binary.BigEndian.PutUint32(fixed[4:], r.ttl)
+		binary.BigEndian.PutUint16(fixed[8:], uint16(len(r.data)))
+		msg = append(msg, fixed[:]...)
+		msg = append(msg, r.data...)
+	}
+	return msg, nil
+}
+
+func encodeName(name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	var out []byte
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid dns label %q in %q", label, name)
+		}
+		out = append(out, byte(len(label)))
+		out = append(out, label...)
+	}
+	return append(out, 0), nil
+}
+
+func encodeTXT(text []string) []byte {
+	if len(text) == 0 {
+		return []byte{0}
+	}
+	var out []byte
+	for _, t := range text {
+		if len(t) > 255 {
+			t = t[:255]
+		}
+		out = append(out, byte(len(t)))
+		out = append(out, t...)
+	}
+	return out
+}
+
+// Questions returns the lower-cased names asked for in a DNS query message.
+func Questions(msg []byte) ([]string, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("short dns message")
+	}
+	if binary.BigEndian.Uint16(msg[2:])&0x8000 != 0 {
+		return nil, nil // response, not a query
+	}
+	count := int(binary.BigEndian.Uint16(msg[4:]))
+	off := 12
+	names := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		name, next, err := decodeName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(msg) {
+			return nil, errors.New("truncated question")
+		}
+		names = append(names, strings.ToLower(name))
+		off = next + 4
+	}
+	return names, nil
+}
+
+func decodeName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; jumps < 16; {
+		if off >= len(msg) {
+			return "", 0, errors.New("name out of bounds")
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case l&0xC0 == 0xC0:
+			if off+1 >= len(msg) {
+				return "", 0, errors.New("truncated pointer")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+			jumps++
+		default:
+			if off+1+l > len(msg) {
+				return "", 0, errors.New("label out of bounds")
+			}
+			labels = append(labels, string(msg[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+	return "", 0, errors.New("too many name compression pointers")
+}
+
+// Publish announces services until ctx is cancelled, answers matching queries,
+// and sends goodbye packets (TTL 0) on the way out.
+func Publish(ctx context.Context, services []Service) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, groupAddr)
+	if err != nil {
+		return fmt.Errorf("mdns listen: %w", err)
+	}
+	defer conn.Close()
+
+	host, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("mdns hostname: %w", err)
+	}
+	host = strings.SplitN(host, ".", 2)[0]
+	ip := outboundIP()
+
+	announce, err := Records(host, ip, services, defaultTTL)
+	if err != nil {
+		return err
+	}
+	goodbye, err := Records(host, ip, services, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _, _ = conn.WriteToUDP(goodbye, groupAddr) }()
+
+	names := map[string]bool{host + ".local.": true}
+	for _, s := range services {
+		names[strings.ToLower(s.FullName())] = true
+		names[strings.ToLower(s.typeName())] = true
+	}
+
+	go func() {
+		// RFC 6762 section 8.3: announce at least twice, one second apart.
+		for i := 0; i < 3; i++ {
+			_, _ = conn.WriteToUDP(announce, groupAddr)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second << i):
+			}
+		}
+	}()
+
+	buf := make([]byte, 9000)
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("mdns read: %w", err)
+		}
+		questions, err := Questions(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, q := range questions {
+			if names[q] {
+				_, _ = conn.WriteToUDP(announce, groupAddr)
+				break
+			}
+		}
+	}
+}
+
+func outboundIP() net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return net.IPv4(127, 0, 0, 1)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP
+		}
+	}
+	return net.IPv4(127, 0, 0, 1)
+}
+
+// Label converts s into a DNS-safe label: lower-case letters, digits and
+// hyphens, at most 63 bytes.
+func Label(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	out := strings.Trim(b.String(), "-")
+	if len(out) > 63 {
+		out = out[:63]
+	}
+	if out == "" {
+		out = "autoport"
+	}
+	return out
+}
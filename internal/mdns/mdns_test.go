@@ -0,0 +1,63 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestRecords_EncodesAnswers(t *testing.T) {
+	services := []Service{{Instance: "shop-web-port", Type: "_autoport._tcp", Port: 12345, Text: []string{"key=WEB_PORT"}}}
+	msg, err := Records("laptop", net.IPv4(192, 168, 1, 2), services, 120)
+	if err != nil {
+		t.Fatalf("Records() error: %v", err)
+	}
+	if got := binary.BigEndian.Uint16(msg[6:]); got != 4 {
+		t.Fatalf("answer count = %d, want 4 (PTR, SRV, TXT, A)", got)
+	}
+	name, _, err := decodeName(msg, 12)
+	if err != nil {
+		t.Fatalf("decodeName() error: %v", err)
+	}
+	if name != "_autoport._tcp.local." {
+		t.Fatalf("first record name = %q", name)
+	}
+}
+
+func TestQuestions(t *testing.T) {
+	q := make([]byte, 12)
+	binary.BigEndian.PutUint16(q[4:], 2)
+	name, _ := encodeName("_autoport._tcp.local.")
+	q = append(q, name...)
+	q = append(q, 0, typePTR, 0, classIN)
+	// Second question uses a compression pointer to the first name.
+	q = append(q, 0xC0, 12, 0, typePTR, 0, classIN)
+
+	got, err := Questions(q)
+	if err != nil {
+		t.Fatalf("Questions() error: %v", err)
+	}
+	want := []string{"_autoport._tcp.local.", "_autoport._tcp.local."}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Questions() = %v, want %v", got, want)
+	}
+
+	if _, err := Questions([]byte{1, 2}); err == nil {
+		t.Fatal("expected error for short message")
+	}
+}
+
+func TestLabel(t *testing.T) {
+	tests := map[string]string{
+		"WEB_PORT":  "web-port",
+		"My App!":   "my-app",
+		"__":        "autoport",
+		"ok-label1": "ok-label1",
+	}
+	for in, want := range tests {
+		if got := Label(in); got != want {
+			t.Errorf("Label(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	var r Registry
+	c := r.NewCounter("autoport_allocations_total", "Ports allocated.")
+	g := r.NewGauge("autoport_active_leases", "Ports held by running commands.")
+	c.Add(3)
+	c.Inc()
+	g.Set(2)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := "# HELP autoport_allocations_total Ports allocated.\n" +
+		"# TYPE autoport_allocations_total counter\n" +
+		"autoport_allocations_total 4\n" +
+		"# HELP autoport_active_leases Ports held by running commands.\n" +
+		"# TYPE autoport_active_leases gauge\n" +
+		"autoport_active_leases 2\n"
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("metrics =\n%s\nwant\n%s", got, want)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type = %q", ct)
+	}
+}
@@ -0,0 +1,113 @@
+// Package msg is the message catalog for user-facing text output.
+//
+// Messages are identified by their English format string, gettext style, so
+// an untranslated message falls back to English as written. Distributions
+// ship translations by registering a Catalog for a language, typically from
+// an init function in a file added to this package. Machine-readable output
+// (JSON fields, warning codes, doctor check names) never goes through a
+// catalog and stays English.
+package msg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Catalog maps English format strings to translated format strings. A
+// translation must take the same verbs in the same order; use explicit
+// argument indexes ("%[2]s") to reorder them.
+type Catalog map[string]string
+
+var (
+	mu       sync.RWMutex
+	catalogs = map[string]Catalog{}
+)
+
+// Register adds or replaces the catalog for lang, a language tag such as
+// "de" or "pt_BR".
+func Register(lang string, c Catalog) {
+	mu.Lock()
+	defer mu.Unlock()
+	catalogs[normalize(lang)] = c
+}
+
+// langVars are consulted in order; the first non-empty value wins, as in
+// POSIX locale resolution with an autoport-specific override first.
+var langVars = []string{"AUTOPORT_LANG", "LC_ALL", "LC_MESSAGES", "LANG"}
+
+// Lang returns the message language selected by environ, or "" for
+// English. Encodings and modifiers are dropped ("de_DE.UTF-8" -> "de_DE");
+// the C and POSIX locales select English.
+func Lang(environ []string) string {
+	values := map[string]string{}
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			values[k] = v
+		}
+	}
+	for _, key := range langVars {
+		if v := values[key]; v != "" {
+			lang := normalize(v)
+			if lang == "c" || lang == "posix" {
+				return ""
+			}
+			return lang
+		}
+	}
+	return ""
+}
+
+// Printer renders messages in one language. The zero value and a nil
+// *Printer print English.
+type Printer struct {
+	catalog Catalog
+}
+
+// NewPrinter returns a printer for lang, falling back from a regional
+// catalog ("pt_BR") to the base language ("pt") and then to English.
+func NewPrinter(lang string) *Printer {
+	lang = normalize(lang)
+	mu.RLock()
+	defer mu.RUnlock()
+	if c, ok := catalogs[lang]; ok {
+		return &Printer{catalog: c}
+	}
+	if base, _, ok := strings.Cut(lang, "_"); ok {
+		if c, ok := catalogs[base]; ok {
+			return &Printer{catalog: c}
+		}
+	}
+	return &Printer{}
+}
+
+// Translate returns the translation of format, or format itself.
+func (p *Printer) Translate(format string) string {
+	if p == nil {
+		return format
+	}
+	if t, ok := p.catalog[format]; ok && t != "" {
+		return t
+	}
+	return format
+}
+
+// Sprintf formats the translation of format with args.
+func (p *Printer) Sprintf(format string, args ...any) string {
+	return fmt.Sprintf(p.Translate(format), args...)
+}
+
+// Fprintf writes the translation of format, formatted with args, to w.
+func (p *Printer) Fprintf(w io.Writer, format string, args ...any) (int, error) {
+	return fmt.Fprintf(w, p.Translate(format), args...)
+}
+
+// normalize lowercases the language and region and strips the encoding
+// and modifier: "pt-BR.UTF-8@euro" -> "pt_br".
+func normalize(lang string) string {
+	if i := strings.IndexAny(lang, ".@"); i >= 0 {
+		lang = lang[:i]
+	}
+	return strings.ToLower(strings.ReplaceAll(lang, "-", "_"))
+}
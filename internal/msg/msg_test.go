@@ -0,0 +1,55 @@
+package msg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLang(t *testing.T) {
+	cases := []struct {
+		environ []string
+		want    string
+	}{
+		{nil, ""},
+		{[]string{"LANG=de_DE.UTF-8"}, "de_de"},
+		{[]string{"LANG=de_DE.UTF-8", "LC_ALL=fr_FR"}, "fr_fr"},
+		{[]string{"LC_ALL=fr_FR", "AUTOPORT_LANG=pt-BR"}, "pt_br"},
+		{[]string{"LANG=C.UTF-8"}, ""},
+		{[]string{"LC_ALL=", "LANG=POSIX"}, ""},
+	}
+	for _, tc := range cases {
+		if got := Lang(tc.environ); got != tc.want {
+			t.Errorf("Lang(%v) = %q, want %q", tc.environ, got, tc.want)
+		}
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	Register("xx", Catalog{
+		"range %s (size=%d)": "bereich %s (%d ports)",
+		"%s moved to %d":     "%[2]d <- %[1]s",
+		"untranslated: %s":   "",
+	})
+	t.Cleanup(func() { Register("xx", nil) })
+
+	p := NewPrinter("xx_YY")
+	if got := p.Sprintf("range %s (size=%d)", "3000-3999", 1000); got != "bereich 3000-3999 (1000 ports)" {
+		t.Fatalf("regional fallback: %q", got)
+	}
+	if got := p.Sprintf("%s moved to %d", "PORT", 3001); got != "3001 <- PORT" {
+		t.Fatalf("reordered arguments: %q", got)
+	}
+	if got := p.Sprintf("untranslated: %s", "x"); got != "untranslated: x" {
+		t.Fatalf("empty translation should fall back: %q", got)
+	}
+
+	var buf bytes.Buffer
+	var english *Printer
+	english.Fprintf(&buf, "range %s (size=%d)", "1-2", 2)
+	if buf.String() != "range 1-2 (size=2)" {
+		t.Fatalf("nil printer: %q", buf.String())
+	}
+	if got := NewPrinter("de").Translate("range %s (size=%d)"); got != "range %s (size=%d)" {
+		t.Fatalf("unknown language: %q", got)
+	}
+}
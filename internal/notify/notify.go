@@ -0,0 +1,45 @@
+// Package notify builds the platform command that shows a desktop
+// notification: notify-send on Linux and the BSDs, osascript on macOS, and a
+// PowerShell balloon tip on Windows.
+package notify
+
+import (
+	"runtime"
+	"strings"
+)
+
+// Command returns the program and arguments showing a notification with
+// title and body on goos, or ok=false when goos has no supported notifier.
+func Command(goos, title, body string) (name string, args []string, ok bool) {
+	switch goos {
+	case "darwin":
+		script := "display notification " + appleString(body) + " with title " + appleString(title)
+		return "osascript", []string{"-e", script}, true
+	case "windows":
+		script := "Add-Type -AssemblyName System.Windows.Forms;" +
+			"$n=New-Object System.Windows.Forms.NotifyIcon;" +
+			"$n.Icon=[System.Drawing.SystemIcons]::Information;$n.Visible=$true;" +
+			"$n.ShowBalloonTip(5000," + psString(title) + "," + psString(body) + ",'Info');" +
+			"Start-Sleep -Seconds 5;$n.Dispose()"
+		return "powershell", []string{"-NoProfile", "-Command", script}, true
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		return "notify-send", []string{"--app-name=autoport", title, body}, true
+	default:
+		return "", nil, false
+	}
+}
+
+// Local returns Command for the running platform.
+func Local(title, body string) (string, []string, bool) {
+	return Command(runtime.GOOS, title, body)
+}
+
+// appleString quotes s as an AppleScript string literal.
+func appleString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// psString quotes s as a single-quoted PowerShell string literal.
+func psString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
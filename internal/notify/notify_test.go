@@ -0,0 +1,25 @@
+package notify
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	name, args, ok := Command("linux", "autoport", "WEB_PORT moved")
+	if !ok || name != "notify-send" || !reflect.DeepEqual(args, []string{"--app-name=autoport", "autoport", "WEB_PORT moved"}) {
+		t.Fatalf("linux = %s %q %v", name, args, ok)
+	}
+	name, args, ok = Command("darwin", `say "hi"`, `a\b`)
+	if !ok || name != "osascript" || args[1] != `display notification "a\\b" with title "say \"hi\""` {
+		t.Fatalf("darwin = %s %q %v", name, args, ok)
+	}
+	name, args, ok = Command("windows", "it's", "body")
+	if !ok || name != "powershell" || !strings.Contains(args[2], "'it''s','body'") {
+		t.Fatalf("windows = %s %q %v", name, args, ok)
+	}
+	if _, _, ok := Command("plan9", "t", "b"); ok {
+		t.Fatal("plan9 should have no notifier")
+	}
+}
@@ -0,0 +1,254 @@
+// Package portowner names the processes holding TCP ports: procfs on
+// Linux, lsof on macOS, and GetExtendedTcpTable on Windows. The parsers
+// for each source are platform independent, so all of them are tested on
+// any platform.
+package portowner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Owner is the process holding a listening socket.
+type Owner struct {
+	PID  int
+	Name string
+	// Cmdline is the command line the process started with, or its
+	// executable path where the platform does not expose one.
+	Cmdline string
+}
+
+func (o Owner) String() string {
+	if o.Name == "" {
+		return fmt.Sprintf("pid %d", o.PID)
+	}
+	return fmt.Sprintf("pid %d (%s)", o.PID, o.Name)
+}
+
+// Table maps listening TCP ports to the processes holding them.
+type Table map[int]Owner
+
+// ErrUnsupported is returned on platforms without an owner source.
+var ErrUnsupported = errors.New("port owners are not supported on this platform")
+
+// Listeners returns the owners of the TCP ports listening on this machine,
+// on any address. Sockets of processes the caller may not inspect, such as
+// another user's without privileges, are left out.
+func Listeners() (Table, error) {
+	return listeners()
+}
+
+// Lookup returns the owner of TCP port p.
+func Lookup(p int) (Owner, bool, error) {
+	t, err := Listeners()
+	if err != nil {
+		return Owner{}, false, err
+	}
+	o, ok := t[p]
+	return o, ok, nil
+}
+
+// tcpListen is the socket state /proc/net/tcp reports for a listener.
+const tcpListen = "0A"
+
+// readProc builds the table from a procfs tree: listening sockets from
+// net/tcp and net/tcp6, matched by inode against the fd links of each
+// process.
+func readProc(fsys fs.FS) (Table, error) {
+	inodes := map[string]int{}
+	for _, name := range []string{"net/tcp", "net/tcp6"} {
+		data, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := parseProcNet(string(data), inodes); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	t := Table{}
+	if len(inodes) == 0 {
+		return t, nil
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		fds, err := fs.ReadDir(fsys, path.Join(e.Name(), "fd"))
+		if err != nil {
+			// Exited, or not ours to inspect.
+			continue
+		}
+		var owner *Owner
+		for _, fd := range fds {
+			link, err := fs.ReadLink(fsys, path.Join(e.Name(), "fd", fd.Name()))
+			if err != nil {
+				continue
+			}
+			inode, ok := strings.CutPrefix(link, "socket:[")
+			if !ok {
+				continue
+			}
+			p, ok := inodes[strings.TrimSuffix(inode, "]")]
+			if !ok {
+				continue
+			}
+			if owner == nil {
+				owner = &Owner{PID: pid}
+				if comm, err := fs.ReadFile(fsys, path.Join(e.Name(), "comm")); err == nil {
+					owner.Name = strings.TrimSpace(string(comm))
+				}
+				if cmdline, err := fs.ReadFile(fsys, path.Join(e.Name(), "cmdline")); err == nil {
+					owner.Cmdline = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+				}
+			}
+			if _, taken := t[p]; !taken {
+				t[p] = *owner
+			}
+		}
+	}
+	return t, nil
+}
+
+// parseProcNet adds the listening sockets of a /proc/net/tcp{,6} table to
+// inodes, keyed by inode.
+func parseProcNet(data string, inodes map[string]int) error {
+	s := bufio.NewScanner(strings.NewReader(data))
+	for first := true; s.Scan(); first = false {
+		fields := strings.Fields(s.Text())
+		if first || len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			return fmt.Errorf("invalid local address %q", fields[1])
+		}
+		p, err := strconv.ParseUint(hexPort, 16, 16)
+		if err != nil {
+			return fmt.Errorf("invalid local address %q", fields[1])
+		}
+		if fields[9] != "0" {
+			inodes[fields[9]] = int(p)
+		}
+	}
+	return s.Err()
+}
+
+// parseLsof reads the output of lsof -nP -iTCP -sTCP:LISTEN -Fpcn: a
+// "p<pid>" line and a "c<command>" line per process, each followed by
+// "n<address>:<port>" lines for its sockets.
+func parseLsof(out string) Table {
+	t := Table{}
+	var owner Owner
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		value := line[1:]
+		switch line[0] {
+		case 'p':
+			pid, _ := strconv.Atoi(value)
+			owner = Owner{PID: pid}
+		case 'c':
+			owner.Name = value
+		case 'n':
+			i := strings.LastIndexByte(value, ':')
+			if i < 0 {
+				continue
+			}
+			p, err := strconv.Atoi(value[i+1:])
+			if err != nil || owner.PID == 0 {
+				continue
+			}
+			if _, taken := t[p]; !taken {
+				t[p] = owner
+			}
+		}
+	}
+	return t
+}
+
+// parsePS reads the output of ps -ww -o pid=,command= and sets the command
+// line of the owners in t.
+func parsePS(out string, t Table) {
+	cmdlines := map[int]string{}
+	for _, line := range strings.Split(out, "\n") {
+		pidText, cmdline, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		if pid, err := strconv.Atoi(pidText); err == nil {
+			cmdlines[pid] = strings.TrimSpace(cmdline)
+		}
+	}
+	for p, o := range t {
+		if cmdline, ok := cmdlines[o.PID]; ok {
+			o.Cmdline = cmdline
+			t[p] = o
+		}
+	}
+}
+
+// pids returns the distinct pids in t, sorted.
+func (t Table) pids() []int {
+	seen := map[int]bool{}
+	var pids []int
+	for _, o := range t {
+		if !seen[o.PID] {
+			seen[o.PID] = true
+			pids = append(pids, o.PID)
+		}
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+// Row sizes of MIB_TCPROW_OWNER_PID and MIB_TCP6ROW_OWNER_PID, and the
+// listening state both report.
+const (
+	tcpRowSize  = 24
+	tcp6RowSize = 56
+	mibListen   = 2
+)
+
+// parseTCPTable reads a MIB_TCPTABLE_OWNER_PID (or, with ipv6, a
+// MIB_TCP6TABLE_OWNER_PID) buffer into port to pid pairs of listening
+// sockets. Ports are stored in network byte order.
+func parseTCPTable(buf []byte, ipv6 bool, ports map[int]int) error {
+	if len(buf) < 4 {
+		return errors.New("short TCP table")
+	}
+	n := int(binary.LittleEndian.Uint32(buf))
+	size, state, localPort, pid := tcpRowSize, 0, 8, 20
+	if ipv6 {
+		size, state, localPort, pid = tcp6RowSize, 48, 20, 52
+	}
+	if len(buf) < 4+n*size {
+		return fmt.Errorf("TCP table of %d rows needs %d bytes, got %d", n, 4+n*size, len(buf))
+	}
+	for i := range n {
+		row := buf[4+i*size : 4+(i+1)*size]
+		if binary.LittleEndian.Uint32(row[state:]) != mibListen {
+			continue
+		}
+		p := int(binary.BigEndian.Uint16(row[localPort:]))
+		if _, taken := ports[p]; !taken {
+			ports[p] = int(binary.LittleEndian.Uint32(row[pid:]))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build darwin
+
+package portowner
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// listeners asks lsof, which ships with macOS, rather than libproc, which
+// needs cgo.
+func listeners() (Table, error) {
+	out, err := exec.Command("lsof", "-nP", "-iTCP", "-sTCP:LISTEN", "-Fpcn").Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(out) == 0 {
+		// lsof exits 1 when nothing matches.
+		return Table{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lsof: %w", err)
+	}
+	t := parseLsof(string(out))
+	if pids := t.pids(); len(pids) > 0 {
+		list := make([]string, len(pids))
+		for i, pid := range pids {
+			list[i] = strconv.Itoa(pid)
+		}
+		if out, err := exec.Command("ps", "-ww", "-o", "pid=,command=", "-p", strings.Join(list, ",")).Output(); err == nil {
+			parsePS(string(out), t)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,9 @@
+//go:build linux
+
+package portowner
+
+import "os"
+
+func listeners() (Table, error) {
+	return readProc(os.DirFS("/proc"))
+}
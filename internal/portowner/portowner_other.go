@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !windows
+
+package portowner
+
+func listeners() (Table, error) {
+	return nil, ErrUnsupported
+}
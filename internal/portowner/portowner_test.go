@@ -0,0 +1,109 @@
+package portowner
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"net"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadProc(t *testing.T) {
+	procFS := fstest.MapFS{
+		"net/tcp": {Data: []byte(`  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 4711 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:D431 0100007F:1F90 01 00000000:00000000 00:00000000 00000000  1000        0 4712 1 0000000000000000 20 4 30 10 -1
+`)},
+		"net/tcp6": {Data: []byte(`  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:0BB8 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 4713 1 0000000000000000 100 0 0 10 0
+`)},
+		"42/comm":    {Data: []byte("node\n")},
+		"42/cmdline": {Data: []byte("node\x00server.js\x00")},
+		"42/fd/3":    {Data: []byte("socket:[4711]"), Mode: fs.ModeSymlink},
+		"42/fd/4":    {Data: []byte("socket:[4712]"), Mode: fs.ModeSymlink},
+		"42/fd/5":    {Data: []byte("/dev/null"), Mode: fs.ModeSymlink},
+		"77/comm":    {Data: []byte("python3\n")},
+		"77/cmdline": {Data: []byte("python3\x00-m\x00http.server\x003000\x00")},
+		"77/fd/7":    {Data: []byte("socket:[4713]"), Mode: fs.ModeSymlink},
+		"self":       {Data: []byte("42"), Mode: fs.ModeSymlink},
+		"99/comm":    {Data: []byte("idle\n")},
+	}
+	got, err := readProc(procFS)
+	if err != nil {
+		t.Fatalf("readProc() unexpected error: %v", err)
+	}
+	want := Table{
+		8080: {PID: 42, Name: "node", Cmdline: "node server.js"},
+		3000: {PID: 77, Name: "python3", Cmdline: "python3 -m http.server 3000"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("readProc() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseLsof(t *testing.T) {
+	out := "p311\ncnode\nf22\nn*:3000\nf23\nn[::1]:3000\np512\ncpostgres\nf7\nn127.0.0.1:5432\n"
+	got := parseLsof(out)
+	parsePS("  311 node /usr/local/bin/vite --port 3000\n  512 /opt/pg/bin/postgres -D data\n", got)
+	want := Table{
+		3000: {PID: 311, Name: "node", Cmdline: "node /usr/local/bin/vite --port 3000"},
+		5432: {PID: 512, Name: "postgres", Cmdline: "/opt/pg/bin/postgres -D data"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseLsof() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseTCPTable(t *testing.T) {
+	row := func(size, state, localPort, pidAt int, p uint16, st, pid uint32) []byte {
+		b := make([]byte, size)
+		binary.LittleEndian.PutUint32(b[state:], st)
+		binary.BigEndian.PutUint16(b[localPort:], p)
+		binary.LittleEndian.PutUint32(b[pidAt:], pid)
+		return b
+	}
+	table := func(rows ...[]byte) []byte {
+		b := binary.LittleEndian.AppendUint32(nil, uint32(len(rows)))
+		for _, r := range rows {
+			b = append(b, r...)
+		}
+		return b
+	}
+	ports := map[int]int{}
+	v4 := table(row(tcpRowSize, 0, 8, 20, 8080, mibListen, 1200), row(tcpRowSize, 0, 8, 20, 50000, 5, 1300))
+	if err := parseTCPTable(v4, false, ports); err != nil {
+		t.Fatalf("parseTCPTable(v4) unexpected error: %v", err)
+	}
+	v6 := table(row(tcp6RowSize, 48, 20, 52, 5432, mibListen, 1400), row(tcp6RowSize, 48, 20, 52, 8080, mibListen, 1500))
+	if err := parseTCPTable(v6, true, ports); err != nil {
+		t.Fatalf("parseTCPTable(v6) unexpected error: %v", err)
+	}
+	if want := map[int]int{8080: 1200, 5432: 1400}; !reflect.DeepEqual(ports, want) {
+		t.Fatalf("ports = %v, want %v", ports, want)
+	}
+	if err := parseTCPTable(v4[:30], false, ports); err == nil {
+		t.Fatal("expected an error for a truncated table")
+	}
+}
+
+func TestLookup_OwnListener(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads procfs")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer ln.Close()
+	p := ln.Addr().(*net.TCPAddr).Port
+	owner, ok, err := Lookup(p)
+	if err != nil {
+		t.Fatalf("Lookup() unexpected error: %v", err)
+	}
+	if !ok || owner.PID != os.Getpid() || owner.Name == "" {
+		t.Fatalf("Lookup(%d) = %+v, %v; want this process", p, owner, ok)
+	}
+}
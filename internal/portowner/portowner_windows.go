@@ -0,0 +1,85 @@
+//go:build windows
+
+package portowner
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	iphlpapi                       = syscall.NewLazyDLL("iphlpapi.dll")
+	procGetExtendedTcpTable        = iphlpapi.NewProc("GetExtendedTcpTable")
+	kernel32                       = syscall.NewLazyDLL("kernel32.dll")
+	procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
+)
+
+const (
+	afInet6                        = 23
+	tcpTableOwnerPIDListener       = 3
+	errorInsufficientBuffer        = 122
+	processQueryLimitedInformation = 0x1000
+)
+
+func listeners() (Table, error) {
+	ports := map[int]int{}
+	for _, af := range []uint32{syscall.AF_INET, afInet6} {
+		buf, err := tcpTable(af)
+		if err != nil {
+			return nil, err
+		}
+		if err := parseTCPTable(buf, af == afInet6, ports); err != nil {
+			return nil, err
+		}
+	}
+	t := Table{}
+	owners := map[int]Owner{}
+	for p, pid := range ports {
+		o, ok := owners[pid]
+		if !ok {
+			o = Owner{PID: pid}
+			if image, err := imagePath(pid); err == nil {
+				o.Name, o.Cmdline = filepath.Base(image), image
+			}
+			owners[pid] = o
+		}
+		t[p] = o
+	}
+	return t, nil
+}
+
+// tcpTable returns the listening sockets of address family af with their
+// owning pids.
+func tcpTable(af uint32) ([]byte, error) {
+	size := uint32(4096)
+	for {
+		buf := make([]byte, size)
+		r, _, _ := procGetExtendedTcpTable.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0, uintptr(af), tcpTableOwnerPIDListener, 0)
+		switch r {
+		case 0:
+			return buf[:size], nil
+		case errorInsufficientBuffer:
+			continue
+		default:
+			return nil, fmt.Errorf("GetExtendedTcpTable: %w", syscall.Errno(r))
+		}
+	}
+}
+
+// imagePath returns the executable of process pid. Windows keeps other
+// processes' command lines in their own memory, so the path stands in.
+func imagePath(pid int) (string, error) {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return "", err
+	}
+	defer syscall.CloseHandle(h)
+	buf := make([]uint16, syscall.MAX_PATH)
+	size := uint32(len(buf))
+	if r, _, err := procQueryFullProcessImageNameW.Call(uintptr(h), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size))); r == 0 {
+		return "", err
+	}
+	return syscall.UTF16ToString(buf[:size]), nil
+}
@@ -0,0 +1,109 @@
+// Package proxy implements a small HTTP reverse proxy that maps stable
+// "<service>.<project>.localhost" host names to assigned local ports.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Route maps one host name to a local port.
+type Route struct {
+	Host string
+	Key  string
+	Port int
+}
+
+// HostFor returns the host name for key in project: "PORT" maps to
+// "<project>.localhost" and "API_PORT" to "api.<project>.localhost".
+func HostFor(project, key string) string {
+	host := label(project) + ".localhost"
+	service := strings.TrimSuffix(strings.TrimSuffix(key, "PORT"), "_")
+	if service == "" {
+		return host
+	}
+	return label(service) + "." + host
+}
+
+func label(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// Routes builds sorted routes for project from key -> port assignments.
+func Routes(project string, ports map[string]int) []Route {
+	routes := make([]Route, 0, len(ports))
+	for key, p := range ports {
+		routes = append(routes, Route{Host: HostFor(project, key), Key: key, Port: p})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Host < routes[j].Host })
+	return routes
+}
+
+// Handler proxies requests by Host header to the matching route's port on
+// 127.0.0.1 and answers unknown hosts with 502 and the list of known hosts.
+func Handler(routes []Route) http.Handler {
+	byHost := make(map[string]*httputil.ReverseProxy, len(routes))
+	for _, r := range routes {
+		target := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", r.Port)}
+		rp := httputil.NewSingleHostReverseProxy(target)
+		director := rp.Director
+		rp.Director = func(req *http.Request) {
+			host := req.Host
+			director(req)
+			req.Header.Set("X-Forwarded-Host", host)
+		}
+		byHost[r.Host] = rp
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := strings.ToLower(req.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if rp, ok := byHost[host]; ok {
+			rp.ServeHTTP(w, req)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintf(w, "autoport proxy: no route for host %q\nknown hosts:\n", host)
+		for _, r := range routes {
+			fmt.Fprintf(w, "  %s -> %d (%s)\n", r.Host, r.Port, r.Key)
+		}
+	})
+}
+
+// Serve runs the proxy on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string, routes []Route) error {
+	srv := &http.Server{Addr: addr, Handler: Handler(routes), ReadHeaderTimeout: 10 * time.Second}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("proxy listen %s: %w", addr, err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
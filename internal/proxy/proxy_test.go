@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHostFor(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"PORT", "shop.localhost"},
+		{"API_PORT", "api.shop.localhost"},
+		{"ADMIN_UI_PORT", "admin-ui.shop.localhost"},
+	}
+	for _, tt := range tests {
+		if got := HostFor("Shop", tt.key); got != tt.want {
+			t.Errorf("HostFor(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestHandler_RoutesByHost(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "api:"+r.Header.Get("X-Forwarded-Host"))
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	p, _ := strconv.Atoi(u.Port())
+
+	h := Handler(Routes("shop", map[string]int{"API_PORT": p}))
+
+	req := httptest.NewRequest(http.MethodGet, "http://api.shop.localhost:8080/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "api:api.shop.localhost:8080" {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://nope.localhost/", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "api.shop.localhost") {
+		t.Fatalf("unexpected fallback response %d %q", rec.Code, rec.Body.String())
+	}
+}
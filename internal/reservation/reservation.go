@@ -0,0 +1,123 @@
+// Package reservation reads and writes port reservation files shared with
+// other local port-management tools, so autoport avoids ports they hand out
+// and publishes its own. File formats are pluggable adapters.
+package reservation
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gelleson/autoport/internal/state"
+)
+
+// Reservation is one reserved port and the name its owner gave it.
+type Reservation struct {
+	Port int
+	Name string
+}
+
+// Store is a reservations file in one format.
+type Store interface {
+	// Load returns every reservation in the file; a missing file has none.
+	Load() ([]Reservation, error)
+	// Save replaces the file's reservations with rs. Callers that read,
+	// modify, and save hold state.WithLock on the file's path.
+	Save(rs []Reservation) error
+}
+
+// Opener opens the reservations file at path in one format.
+type Opener func(path string) Store
+
+var (
+	mu       sync.RWMutex
+	adapters = map[string]Opener{"lines": func(path string) Store { return Lines{Path: path} }}
+)
+
+// DefaultFormat is the format used when none is configured.
+const DefaultFormat = "lines"
+
+// Register makes a file format available under name, replacing any adapter
+// already registered with that name.
+func Register(name string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	adapters[name] = open
+}
+
+// Open returns the store for path in format.
+func Open(format, path string) (Store, error) {
+	if format == "" {
+		format = DefaultFormat
+	}
+	mu.RLock()
+	open, ok := adapters[format]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown reservations format %q", format)
+	}
+	return open(path), nil
+}
+
+// Owner is the name prefix autoport uses for the reservations of the
+// project at cwd; each entry is named Owner(cwd) + key.
+func Owner(cwd string) string {
+	return "autoport:" + cwd + ":"
+}
+
+// Lines is the plain format most port tools understand: one reservation per
+// line as "<port> <name>", with blank lines and # comments ignored.
+type Lines struct {
+	Path string
+}
+
+// Load implements Store.
+func (l Lines) Load() ([]Reservation, error) {
+	data, err := os.ReadFile(l.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rs []Reservation
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		portText, name, _ := strings.Cut(line, " ")
+		p, err := strconv.Atoi(portText)
+		if err != nil || p < 1 || p > 65535 {
+			return nil, fmt.Errorf("%s:%d: invalid port %q", l.Path, n, portText)
+		}
+		rs = append(rs, Reservation{Port: p, Name: strings.TrimSpace(name)})
+	}
+	return rs, sc.Err()
+}
+
+// Save implements Store. Entries are sorted by port and written
+// atomically; an existing file keeps its permissions.
+func (l Lines) Save(rs []Reservation) error {
+	sorted := append([]Reservation{}, rs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Port < sorted[j].Port })
+	var b strings.Builder
+	for _, r := range sorted {
+		fmt.Fprintf(&b, "%d %s\n", r.Port, r.Name)
+	}
+	perm := os.FileMode(0o644)
+	if info, err := os.Stat(l.Path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := state.WriteFile(l.Path, []byte(b.String()), perm); err != nil {
+		return fmt.Errorf("write reservations: %w", err)
+	}
+	return nil
+}
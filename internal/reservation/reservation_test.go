@@ -0,0 +1,89 @@
+package reservation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestLines_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ports")
+	if err := os.WriteFile(path, []byte("# shared ports\n8080 grafana\n\n3000  web dev server\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := Open("", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	want := []Reservation{{Port: 8080, Name: "grafana"}, {Port: 3000, Name: "web dev server"}}
+	if !reflect.DeepEqual(rs, want) {
+		t.Fatalf("Load() = %+v, want %+v", rs, want)
+	}
+	if err := store.Save(rs); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "3000 web dev server\n8080 grafana\n" {
+		t.Fatalf("saved %q", data)
+	}
+}
+
+func TestLines_SaveKeepsPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+	path := filepath.Join(t.TempDir(), "ports")
+	if err := os.WriteFile(path, []byte("8080 grafana\n"), 0o664); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o664); err != nil {
+		t.Fatal(err)
+	}
+	if err := (Lines{Path: path}).Save([]Reservation{{Port: 3000, Name: "web"}}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0o664 {
+		t.Fatalf("mode after Save() = %v, want -rw-rw-r--", got)
+	}
+}
+
+func TestLines_LoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if rs, err := (Lines{Path: filepath.Join(dir, "missing")}).Load(); err != nil || rs != nil {
+		t.Fatalf("missing file: %v, %v", rs, err)
+	}
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("http 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Lines{Path: bad}).Load(); err == nil {
+		t.Fatal("expected an invalid port error")
+	}
+}
+
+type memStore struct{ rs []Reservation }
+
+func (m *memStore) Load() ([]Reservation, error) { return m.rs, nil }
+func (m *memStore) Save(rs []Reservation) error  { m.rs = rs; return nil }
+
+func TestRegister(t *testing.T) {
+	mem := &memStore{}
+	Register("mem", func(string) Store { return mem })
+	store, err := Open("mem", "ignored")
+	if err != nil || store != mem {
+		t.Fatalf("Open(mem) = %v, %v", store, err)
+	}
+	if _, err := Open("nope", "x"); err == nil {
+		t.Fatal("expected unknown format error")
+	}
+}
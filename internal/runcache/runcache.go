@@ -0,0 +1,75 @@
+// Package runcache keeps the result of a run for a few seconds so scripts
+// that call autoport many times in a row get the identical answer without
+// scanning and probing again.
+package runcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gelleson/autoport/internal/state"
+)
+
+const Version = 1
+
+// Entry is one cached result.
+type Entry struct {
+	Version  int             `json:"version"`
+	Key      string          `json:"key"`
+	StoredAt time.Time       `json:"stored_at"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// DefaultDir returns the directory cached results are kept in:
+// the user cache dir (e.g. $XDG_CACHE_HOME) plus autoport/runs.
+func DefaultDir() string {
+	return state.CacheDir("runs")
+}
+
+// Key hashes the parts identifying a result, such as the cwd, branch, and a
+// description of the flags.
+func Key(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// PathFor returns the cache file for key.
+func PathFor(dir, key string) string {
+	return filepath.Join(dir, key+".json")
+}
+
+// Get returns the data stored for key if it is younger than ttl at now.
+// Missing, expired, and unreadable entries are all misses.
+func Get(dir, key string, ttl time.Duration, now time.Time) (json.RawMessage, bool) {
+	data, err := os.ReadFile(PathFor(dir, key))
+	if err != nil {
+		return nil, false
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil || e.Version != Version || e.Key != key {
+		return nil, false
+	}
+	if age := now.Sub(e.StoredAt); age < 0 || age >= ttl {
+		return nil, false
+	}
+	return e.Data, true
+}
+
+// Put stores data under key, replacing any previous entry atomically so
+// concurrent callers never read a partial file.
+func Put(dir, key string, data json.RawMessage, now time.Time) error {
+	encoded, err := json.Marshal(Entry{Version: Version, Key: key, StoredAt: now.UTC(), Data: data})
+	if err != nil {
+		return fmt.Errorf("marshal cache entry: %w", err)
+	}
+	if err := state.WriteFile(PathFor(dir, key), encoded, 0o644); err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package runcache
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPutGet_ExpiresAfterTTL(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	key := Key("/repo", "main", "flags")
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := Put(dir, key, json.RawMessage(`{"PORT":"10001"}`), now); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	got, ok := Get(dir, key, 5*time.Second, now.Add(4*time.Second))
+	if !ok || string(got) != `{"PORT":"10001"}` {
+		t.Fatalf("Get() = %s, %v; want the stored data", got, ok)
+	}
+	if _, ok := Get(dir, key, 5*time.Second, now.Add(5*time.Second)); ok {
+		t.Fatal("Get() hit after the TTL elapsed")
+	}
+	if _, ok := Get(dir, Key("/repo", "dev", "flags"), 5*time.Second, now); ok {
+		t.Fatal("Get() hit for a different key")
+	}
+}
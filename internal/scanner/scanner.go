@@ -1,11 +1,14 @@
 // Package scanner provides functionality to discover port-related environment
-// variables from the current environment and local .env files.
+// variables from the current environment, local .env files, and task runner
+// files (Makefile, Taskfile, justfile).
 package scanner
 
 import (
 	"context"
+	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -13,18 +16,49 @@ import (
 	"github.com/gelleson/autoport/internal/env"
 )
 
-// Discovery records a discovered port key and its source.
+// Discovery records a discovered port key, its source, the kind of that
+// source, and the value the source currently assigns (empty for default keys).
 type Discovery struct {
 	Key    string
 	Source string
+	Kind   string
+	Value  string
+	// IgnoredBy is the ignore prefix matching Key. It is only set when the
+	// scanner keeps ignored keys (WithKeepIgnored).
+	IgnoredBy string
+	// Unmanaged marks a task runner file value that takes precedence over
+	// the environment, so an assigned port does not reach the task.
+	Unmanaged bool
 }
 
+// Source kinds classify where a key was discovered.
+const (
+	// KindEnvironment is the process environment.
+	KindEnvironment = "environment"
+	// KindApp is an application env file such as .env or .env.local.
+	KindApp = "app"
+	// KindCompose is a docker compose project .env: a .env next to a
+	// compose file, or one setting COMPOSE_* variables. Compose reads it to
+	// configure itself rather than handing it to the application.
+	KindCompose = "compose"
+	// KindTask is a task runner file: a Makefile, Taskfile, or justfile.
+	// Env files take precedence over it.
+	KindTask = "task"
+	// KindDefault is the implicit PORT key.
+	KindDefault = "default"
+)
+
+// composeFiles are the file names docker compose looks for by default.
+var composeFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
 // Stats captures scanner execution metrics for explain/doctor.
 type Stats struct {
 	FilesVisited    int
 	EnvFilesParsed  int
 	SkippedIgnore   int
 	SkippedMaxDepth int
+	ComposeEnvFiles int
+	TaskFilesParsed int
 }
 
 // Scanner handles discovering port keys from environment variables and files.
@@ -35,6 +69,16 @@ type Scanner struct {
 	environ    []string
 	ignoreDirs map[string]struct{}
 	maxDepth   int
+	// excludeCompose lets app env files claim keys also set by a compose
+	// project .env, which is parsed first.
+	excludeCompose bool
+	keepIgnored    bool
+	// noEnviron and noFiles turn off discovery from the environment or
+	// from files; environ still expands ${VAR} references in env files.
+	noEnviron bool
+	noFiles   bool
+	// fsys, when set, replaces the OS file system below cwd.
+	fsys fs.FS
 }
 
 // Option defines a functional option for the Scanner.
@@ -76,6 +120,50 @@ func WithMaxDepth(depth int) Option {
 	}
 }
 
+// WithExcludeCompose makes keys from a compose project .env yield to the
+// same keys in application env files. Callers drop the remaining
+// KindCompose discoveries from selection.
+func WithExcludeCompose(exclude bool) Option {
+	return func(s *Scanner) {
+		s.excludeCompose = exclude
+	}
+}
+
+// WithKeepIgnored makes ScanDetailed report keys matching an ignore prefix,
+// marked with IgnoredBy, instead of dropping them, so callers can explain
+// why a key was left out.
+func WithKeepIgnored(keep bool) Option {
+	return func(s *Scanner) {
+		s.keepIgnored = keep
+	}
+}
+
+// WithEnvironmentScan turns discovery of keys from the environment on or
+// off (default on). CI runners often export many unrelated *_PORT
+// variables, such as Kubernetes service links.
+func WithEnvironmentScan(enabled bool) Option {
+	return func(s *Scanner) {
+		s.noEnviron = !enabled
+	}
+}
+
+// WithFileScan turns discovery of keys from env and task runner files on
+// or off (default on).
+func WithFileScan(enabled bool) Option {
+	return func(s *Scanner) {
+		s.noFiles = !enabled
+	}
+}
+
+// WithFS scans env files from fsys, rooted at the scanned directory,
+// instead of the OS file system (e.g. an fstest.MapFS in tests or an
+// in-memory project).
+func WithFS(fsys fs.FS) Option {
+	return func(s *Scanner) {
+		s.fsys = fsys
+	}
+}
+
 // New creates a new Scanner with the given working directory and options.
 func New(cwd string, opts ...Option) *Scanner {
 	s := &Scanner{
@@ -89,18 +177,24 @@ func New(cwd string, opts ...Option) *Scanner {
 	return s
 }
 
-// isIgnored checks if a given key starts with any of the ignore prefixes.
-func (s *Scanner) isIgnored(key string) bool {
+// ignoredBy returns the first ignore prefix key starts with.
+func (s *Scanner) ignoredBy(key string) (string, bool) {
 	for _, ignore := range s.ignores {
 		if strings.HasPrefix(key, ignore) {
-			return true
+			return ignore, true
 		}
 	}
-	return false
+	return "", false
 }
 
-func isPortKey(key string) bool {
-	return key == "PORT" || strings.HasSuffix(key, "_PORT")
+// skip reports whether key is dropped from the scan, and otherwise the
+// ignore prefix to record for it.
+func (s *Scanner) skip(key string) (bool, string) {
+	if !env.IsPortKey(key) {
+		return true, ""
+	}
+	prefix, ignored := s.ignoredBy(key)
+	return ignored && !s.keepIgnored, prefix
 }
 
 // Scan discovers port-related keys from the environment and .env files.
@@ -112,7 +206,9 @@ func (s *Scanner) Scan(ctx context.Context) ([]string, error) {
 	}
 	keys := make([]string, 0, len(discoveries))
 	for _, d := range discoveries {
-		keys = append(keys, d.Key)
+		if d.IgnoredBy == "" {
+			keys = append(keys, d.Key)
+		}
 	}
 	return keys, nil
 }
@@ -120,20 +216,24 @@ func (s *Scanner) Scan(ctx context.Context) ([]string, error) {
 // ScanDetailed discovers keys with source metadata and scanner stats.
 func (s *Scanner) ScanDetailed(ctx context.Context) ([]Discovery, Stats, error) {
 	stats := Stats{}
-	keySource := make(map[string]string)
+	keySource := make(map[string]Discovery)
 
-	if err := s.scanEnvironment(ctx, keySource); err != nil {
-		return nil, stats, err
+	if !s.noEnviron {
+		if err := s.scanEnvironment(ctx, keySource); err != nil {
+			return nil, stats, err
+		}
 	}
 
-	err := s.scanEnvFiles(ctx, keySource, &stats)
-	if err != nil && err != context.Canceled && err != context.DeadlineExceeded {
-		return nil, stats, err
+	if !s.noFiles {
+		err := s.scanEnvFiles(ctx, keySource, &stats)
+		if err != nil && err != context.Canceled && err != context.DeadlineExceeded {
+			return nil, stats, err
+		}
 	}
 
-	if !s.isIgnored("PORT") {
+	if skip, prefix := s.skip("PORT"); !skip {
 		if _, ok := keySource["PORT"]; !ok {
-			keySource["PORT"] = "default"
+			keySource["PORT"] = Discovery{Key: "PORT", Source: "default", Kind: KindDefault, IgnoredBy: prefix}
 		}
 	}
 
@@ -145,13 +245,13 @@ func (s *Scanner) ScanDetailed(ctx context.Context) ([]Discovery, Stats, error)
 
 	discoveries := make([]Discovery, 0, len(keys))
 	for _, key := range keys {
-		discoveries = append(discoveries, Discovery{Key: key, Source: keySource[key]})
+		discoveries = append(discoveries, keySource[key])
 	}
 
 	return discoveries, stats, ctx.Err()
 }
 
-func (s *Scanner) scanEnvironment(ctx context.Context, out map[string]string) error {
+func (s *Scanner) scanEnvironment(ctx context.Context, out map[string]Discovery) error {
 	for _, environmentVar := range s.environ {
 		if err := ctx.Err(); err != nil {
 			return err
@@ -163,18 +263,23 @@ func (s *Scanner) scanEnvironment(ctx context.Context, out map[string]string) er
 		}
 
 		key := parts[0]
-		if s.isIgnored(key) || !isPortKey(key) {
+		skip, prefix := s.skip(key)
+		if skip {
 			continue
 		}
 		if _, exists := out[key]; !exists {
-			out[key] = "env"
+			out[key] = Discovery{Key: key, Source: "env", Kind: KindEnvironment, Value: parts[1], IgnoredBy: prefix}
 		}
 	}
 	return nil
 }
 
-func (s *Scanner) scanEnvFiles(ctx context.Context, out map[string]string, stats *Stats) error {
-	return filepath.WalkDir(s.cwd, func(path string, d fs.DirEntry, walkErr error) error {
+func (s *Scanner) scanEnvFiles(ctx context.Context, out map[string]Discovery, stats *Stats) error {
+	fsys := s.fsys
+	if fsys == nil {
+		fsys = os.DirFS(s.cwd)
+	}
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return nil
 		}
@@ -183,64 +288,127 @@ func (s *Scanner) scanEnvFiles(ctx context.Context, out map[string]string, stats
 			return err
 		}
 
-		rel, err := filepath.Rel(s.cwd, path)
-		if err != nil {
-			rel = path
-		}
-		depth := pathDepth(rel)
-
 		if d.IsDir() {
+			if name == "." {
+				return nil
+			}
 			if isHiddenDir(d.Name()) {
-				return filepath.SkipDir
+				return fs.SkipDir
 			}
 			if _, skip := s.ignoreDirs[d.Name()]; skip {
 				stats.SkippedIgnore++
-				return filepath.SkipDir
+				return fs.SkipDir
 			}
-			if s.maxDepth > 0 && depth > s.maxDepth {
+			if s.maxDepth > 0 && pathDepth(name) > s.maxDepth {
 				stats.SkippedMaxDepth++
-				return filepath.SkipDir
+				return fs.SkipDir
 			}
 			return nil
 		}
 
 		stats.FilesVisited++
+		if parse := taskFileParser(name); parse != nil {
+			s.scanTaskFile(fsys, name, parse, out, stats)
+			return nil
+		}
 		if !isEnvFile(d.Name()) {
 			return nil
 		}
 		stats.EnvFilesParsed++
 
-		file, err := os.Open(path)
+		file, err := fsys.Open(name)
 		if err != nil {
 			return nil
 		}
 		defer file.Close()
 
-		keys := env.ExtractPortKeys(file)
-		source := rel
-		for _, key := range keys {
-			if s.isIgnored(key) || !isPortKey(key) {
+		entries, _ := env.Parse(file, env.WithExpand(s.lookupEnv))
+		kind := KindApp
+		if isComposeEnv(fsys, name, entries) {
+			kind = KindCompose
+			stats.ComposeEnvFiles++
+		}
+		source := filepath.FromSlash(name)
+		for _, e := range entries {
+			skip, prefix := s.skip(e.Key)
+			if skip {
 				continue
 			}
-			if _, exists := out[key]; !exists {
-				out[key] = source
+			existing, exists := out[e.Key]
+			if !exists || existing.Kind == KindTask || (s.excludeCompose && existing.Kind == KindCompose && kind == KindApp) {
+				out[e.Key] = Discovery{Key: e.Key, Source: source, Kind: kind, Value: e.Value, IgnoredBy: prefix}
 			}
 		}
 		return nil
 	})
 }
 
-func pathDepth(rel string) int {
-	if rel == "." || rel == "" {
+// scanTaskFile records port keys assigned in a task runner file that no
+// environment or env file provides.
+func (s *Scanner) scanTaskFile(fsys fs.FS, name string, parse func(io.Reader) []taskEntry, out map[string]Discovery, stats *Stats) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	stats.TaskFilesParsed++
+	source := filepath.FromSlash(name)
+	for _, e := range parse(file) {
+		skip, prefix := s.skip(e.Key)
+		if skip {
+			continue
+		}
+		if _, exists := out[e.Key]; !exists {
+			out[e.Key] = Discovery{Key: e.Key, Source: source, Kind: KindTask, Value: e.Value, IgnoredBy: prefix, Unmanaged: e.Unmanaged}
+		}
+	}
+}
+
+// lookupEnv resolves ${VAR} references in env files against the scanned
+// environment.
+func (s *Scanner) lookupEnv(key string) (string, bool) {
+	for i := len(s.environ) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(s.environ[i], "="); ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// pathDepth returns the depth of a slash-separated directory below the scan
+// root: 0 for top-level directories.
+func pathDepth(name string) int {
+	if name == "." || name == "" {
 		return 0
 	}
-	return len(strings.Split(rel, string(filepath.Separator))) - 1
+	return strings.Count(name, "/")
 }
 
 func isHiddenDir(name string) bool {
 	return strings.HasPrefix(name, ".") && name != "."
 }
 
+// isComposeEnv reports whether the env file at path is a compose project
+// .env: named exactly .env and either next to a compose file or setting
+// COMPOSE_* variables.
+func isComposeEnv(fsys fs.FS, name string, entries []env.Entry) bool {
+	if path.Base(name) != ".env" {
+		return false
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Key, "COMPOSE_") {
+			return true
+		}
+	}
+	dir := path.Dir(name)
+	for _, compose := range composeFiles {
+		if _, err := fs.Stat(fsys, path.Join(dir, compose)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 func isEnvFile(name string) bool {
 	return name == ".env" || strings.HasPrefix(name, ".env.")
 }
@@ -2,10 +2,12 @@ package scanner
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"testing/fstest"
 )
 
 func TestScanner_ScanEnv(t *testing.T) {
@@ -13,6 +15,7 @@ func TestScanner_ScanEnv(t *testing.T) {
 		"PORT=8080",
 		"API_PORT=9090",
 		"DB_PORT=5432",
+		"AUTOPORT_HEALTH_PORT=10123",
 		"OTHER_VAR=123",
 		"INVALID_ENV_VAR",
 	}
@@ -134,3 +137,165 @@ func TestScanner_ScanDetailed_StatsAndSources(t *testing.T) {
 		t.Fatalf("expected ignored directories count")
 	}
 }
+
+func TestScanner_ScanDetailed_ExpandsEnvFileValues(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "BASE=12000\nWEB_PORT=${BASE}\nAPI_PORT=${API_BASE:-4000}\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ".env"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(tmpDir, WithEnviron([]string{"BASE=13000"}))
+	discoveries, _, err := s.ScanDetailed(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]string{}
+	for _, d := range discoveries {
+		values[d.Key] = d.Value
+	}
+	if values["WEB_PORT"] != "13000" || values["API_PORT"] != "4000" {
+		t.Fatalf("values = %v, want expanded WEB_PORT=13000 API_PORT=4000", values)
+	}
+}
+
+func TestScanner_ScanDetailed_ClassifiesComposeEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"compose.yaml":      "services: {}\n",
+		".env":              "DB_PORT=5432\nWEB_PORT=8080\n",
+		".env.local":        "WEB_PORT=3000\n",
+		"api/.env":          "API_PORT=4000\n",
+		"worker/.env":       "COMPOSE_PROJECT_NAME=w\nWORKER_PORT=5000\n",
+		"worker/.env.extra": "EXTRA_PORT=5001\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kinds := func(opts ...Option) map[string]string {
+		t.Helper()
+		s := New(tmpDir, append([]Option{WithEnviron(nil)}, opts...)...)
+		discoveries, stats, err := s.ScanDetailed(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.ComposeEnvFiles != 2 {
+			t.Fatalf("ComposeEnvFiles = %d, want 2", stats.ComposeEnvFiles)
+		}
+		out := map[string]string{}
+		for _, d := range discoveries {
+			out[d.Key] = d.Kind + " " + d.Source
+		}
+		return out
+	}
+
+	got := kinds()
+	want := map[string]string{
+		"PORT":        "default default",
+		"DB_PORT":     "compose .env",
+		"WEB_PORT":    "compose .env",
+		"API_PORT":    "app " + filepath.Join("api", ".env"),
+		"WORKER_PORT": "compose " + filepath.Join("worker", ".env"),
+		"EXTRA_PORT":  "app " + filepath.Join("worker", ".env.extra"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("kinds = %v, want %v", got, want)
+	}
+
+	got = kinds(WithExcludeCompose(true))
+	if got["WEB_PORT"] != "app .env.local" || got["DB_PORT"] != "compose .env" {
+		t.Fatalf("with exclude, kinds = %v; want app file to claim WEB_PORT", got)
+	}
+}
+
+func TestScanner_ScanDetailed_FromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		".env":                {Data: []byte("WEB_PORT=3000\n")},
+		"api/.env.local":      {Data: []byte("API_PORT=4000\n")},
+		"node_modules/x/.env": {Data: []byte("DEP_PORT=1\n")},
+	}
+	s := New("/does/not/exist", WithEnviron(nil), WithFS(fsys), WithIgnoreDirs([]string{"node_modules"}))
+	discoveries, stats, err := s.ScanDetailed(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, d := range discoveries {
+		got[d.Key] = d.Source
+	}
+	want := map[string]string{"PORT": "default", "WEB_PORT": ".env", "API_PORT": filepath.Join("api", ".env.local")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sources = %v, want %v", got, want)
+	}
+	if stats.EnvFilesParsed != 2 || stats.SkippedIgnore != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestScanner_ScanDetailed_LimitsSources(t *testing.T) {
+	fsys := fstest.MapFS{".env": {Data: []byte("WEB_PORT=${BASE_PORT}\n")}}
+	environ := []string{"BASE_PORT=3000", "REDIS_SERVICE_PORT=6379"}
+	scan := func(opts ...Option) map[string]string {
+		t.Helper()
+		s := New("/does/not/exist", append([]Option{WithEnviron(environ), WithFS(fsys)}, opts...)...)
+		discoveries, _, err := s.ScanDetailed(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]string{}
+		for _, d := range discoveries {
+			got[d.Key] = d.Source + "=" + d.Value
+		}
+		return got
+	}
+
+	// Env files still expand references to the environment.
+	if got, want := scan(WithEnvironmentScan(false)), map[string]string{"PORT": "default=", "WEB_PORT": ".env=3000"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files only = %v, want %v", got, want)
+	}
+	want := map[string]string{"PORT": "default=", "BASE_PORT": "env=3000", "REDIS_SERVICE_PORT": "env=6379"}
+	if got := scan(WithFileScan(false)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("env only = %v, want %v", got, want)
+	}
+}
+
+func TestScanner_ScanDetailed_TaskFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Makefile":     {Data: []byte("WEB_PORT ?= 3000\nAPI_PORT := 4000 # api\nexport METRICS_PORT=9100\nrun:\n\tPROBE_PORT=1 ./run\n")},
+		".env":         {Data: []byte("API_PORT=4001\n")},
+		"justfile":     {Data: []byte("admin_port := \"5000\"\nDOCS_PORT := env_var_or_default('DOCS_PORT', '6000')\n\nserve:\n    RECIPE_PORT := 2\n")},
+		"Taskfile.yml": {Data: []byte("version: '3'\nvars:\n  QUEUE_PORT: 7000\nenv:\n  GRPC_PORT: \"8000\"\n  DYN_PORT:\n    sh: echo 1\ntasks:\n  up:\n    cmds: [echo]\n")},
+	}
+	s := New("/does/not/exist", WithEnviron(nil), WithFS(fsys))
+	discoveries, stats, err := s.ScanDetailed(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, d := range discoveries {
+		got[d.Key] = fmt.Sprintf("%s %s %s %t", d.Kind, d.Source, d.Value, d.Unmanaged)
+	}
+	want := map[string]string{
+		"PORT":         "default default  false",
+		"WEB_PORT":     "task Makefile 3000 false",
+		"API_PORT":     "app .env 4001 false",
+		"METRICS_PORT": "task Makefile 9100 true",
+		"DOCS_PORT":    "task justfile 6000 false",
+		"QUEUE_PORT":   "task Taskfile.yml 7000 true",
+		"GRPC_PORT":    "task Taskfile.yml 8000 false",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("discoveries = %v, want %v", got, want)
+	}
+	if stats.TaskFilesParsed != 3 {
+		t.Fatalf("TaskFilesParsed = %d, want 3", stats.TaskFilesParsed)
+	}
+}
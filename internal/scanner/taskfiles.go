@@ -0,0 +1,129 @@
+package scanner
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// taskEntry is one variable assignment found in a task runner file.
+type taskEntry struct {
+	Key   string
+	Value string
+	// Unmanaged is set when the file's value wins over the environment.
+	Unmanaged bool
+}
+
+var (
+	makeAssign = regexp.MustCompile(`^\s*(override\s+)?(?:export\s+)?([A-Za-z_][A-Za-z0-9_]*)\s*(\?=|::=|:=|\+=|=)\s*(.*)$`)
+	justAssign = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_]*)\s*:=\s*(.*)$`)
+	justEnv    = regexp.MustCompile(`^env(?:_var_or_default)?\(\s*["']([^"']+)["']\s*(?:,\s*["']([^"']*)["']\s*)?\)$`)
+	yamlEntry  = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*:\s*(.*)$`)
+)
+
+// taskFileParser returns the parser for a Makefile, Taskfile, or justfile,
+// or nil for other files.
+func taskFileParser(name string) func(io.Reader) []taskEntry {
+	switch base := path.Base(name); {
+	case base == "Makefile" || base == "makefile" || base == "GNUmakefile" || strings.HasSuffix(base, ".mk"):
+		return parseMakefile
+	case base == "justfile" || base == "Justfile" || base == ".justfile":
+		return parseJustfile
+	case strings.EqualFold(base, "Taskfile.yml") || strings.EqualFold(base, "Taskfile.yaml"):
+		return parseTaskfile
+	}
+	return nil
+}
+
+// parseMakefile reads top-level variable assignments. Only ?= defers to
+// the environment; =, :=, and override assignments replace it.
+func parseMakefile(r io.Reader) []taskEntry {
+	var entries []taskEntry
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "\t") {
+			continue // recipe line
+		}
+		m := makeAssign.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		value, _, _ := strings.Cut(m[4], "#")
+		entries = append(entries, taskEntry{
+			Key:       m[2],
+			Value:     strings.TrimSpace(value),
+			Unmanaged: m[1] != "" || m[3] != "?=",
+		})
+	}
+	return entries
+}
+
+// parseJustfile reads top-level assignments. A value read with env() or
+// env_var_or_default() from the same variable defers to the environment,
+// with the default as its value; anything else replaces it.
+func parseJustfile(r io.Reader) []taskEntry {
+	var entries []taskEntry
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		m := justAssign.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		value := strings.TrimSpace(m[2])
+		if env := justEnv.FindStringSubmatch(value); env != nil && env[1] == m[1] {
+			entries = append(entries, taskEntry{Key: m[1], Value: env[2]})
+			continue
+		}
+		entries = append(entries, taskEntry{Key: m[1], Value: unquote(value), Unmanaged: true})
+	}
+	return entries
+}
+
+// parseTaskfile reads the entries of env: and vars: blocks. Task gives
+// declared vars priority over the environment, so literal vars are
+// unmanaged; env entries are reported as plain discoveries.
+func parseTaskfile(r io.Reader) []taskEntry {
+	var entries []taskEntry
+	block, blockIndent, entryIndent := "", -1, -1
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if block != "" && indent <= blockIndent {
+			block = ""
+		}
+		if block == "" {
+			if trimmed == "env:" || trimmed == "vars:" {
+				block, blockIndent, entryIndent = strings.TrimSuffix(trimmed, ":"), indent, -1
+			}
+			continue
+		}
+		if entryIndent < 0 {
+			entryIndent = indent
+		}
+		if indent != entryIndent {
+			continue
+		}
+		m := yamlEntry.FindStringSubmatch(trimmed)
+		if m == nil || m[2] == "" {
+			continue // nested value such as {sh: ...}
+		}
+		value, _, _ := strings.Cut(m[2], " #")
+		entries = append(entries, taskEntry{Key: m[1], Value: unquote(strings.TrimSpace(value)), Unmanaged: block == "vars"})
+	}
+	return entries
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
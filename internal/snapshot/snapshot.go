@@ -0,0 +1,84 @@
+// Package snapshot reads and writes portable assignment snapshots. Unlike
+// lockfiles, snapshots are not tied to a project path and can be replayed on
+// another machine or checkout.
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const Version = 1
+
+type Assignment struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type Snapshot struct {
+	Version     int          `json:"version"`
+	CWD         string       `json:"cwd"`
+	Seed        uint32       `json:"seed"`
+	Range       string       `json:"range"`
+	Namespace   string       `json:"namespace,omitempty"`
+	Assignments []Assignment `json:"assignments"`
+	CreatedAt   string       `json:"created_at"`
+}
+
+// New builds a snapshot from overrides, sorted by key.
+func New(cwd string, seed uint32, rangeSpec, namespace string, overrides map[string]string, createdAt string) Snapshot {
+	keys := make([]string, 0, len(overrides))
+	for k := range overrides {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	assignments := make([]Assignment, 0, len(keys))
+	for _, k := range keys {
+		assignments = append(assignments, Assignment{Key: k, Value: overrides[k]})
+	}
+	return Snapshot{
+		Version:     Version,
+		CWD:         cwd,
+		Seed:        seed,
+		Range:       rangeSpec,
+		Namespace:   namespace,
+		Assignments: assignments,
+		CreatedAt:   createdAt,
+	}
+}
+
+func Write(w io.Writer, s Snapshot) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
+
+func Read(path string) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Snapshot{}, fmt.Errorf("parse snapshot: %w", err)
+	}
+	if s.Version != Version {
+		return Snapshot{}, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	return s, nil
+}
+
+func (s Snapshot) ToMap() map[string]string {
+	m := make(map[string]string, len(s.Assignments))
+	for _, a := range s.Assignments {
+		m[a.Key] = a.Value
+	}
+	return m
+}
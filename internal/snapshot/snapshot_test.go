@@ -0,0 +1,46 @@
+package snapshot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snap.json")
+	s := New("/repo", 42, "10000-10010", "api", map[string]string{"WEB_PORT": "10001", "API_PORT": "10002"}, "2026-01-01T00:00:00Z")
+
+	var buf bytes.Buffer
+	if err := Write(&buf, s); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Fatalf("Read() = %+v, want %+v", got, s)
+	}
+	if got.Assignments[0].Key != "API_PORT" {
+		t.Fatalf("expected sorted assignments, got %+v", got.Assignments)
+	}
+	if m := got.ToMap(); m["WEB_PORT"] != "10001" {
+		t.Fatalf("ToMap() = %v", m)
+	}
+}
+
+func TestReadRejectsUnknownVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snap.json")
+	if err := os.WriteFile(path, []byte(`{"version": 9}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); err == nil {
+		t.Fatal("expected version error")
+	}
+}
@@ -0,0 +1,163 @@
+// Package state is the file layer for autoport's per-user state and cache
+// directories: XDG paths, advisory file locks, atomic writes, and versioned
+// JSON documents that are read, modified, and written under a lock, so
+// concurrent autoport processes never see partial files or lose updates.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Dir returns $XDG_STATE_HOME/autoport/<sub>, falling back to
+// ~/.local/state, or "" when neither is known.
+func Dir(sub ...string) string {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(append([]string{base, "autoport"}, sub...)...)
+}
+
+// CacheDir returns the user cache dir (e.g. $XDG_CACHE_HOME) plus
+// autoport/<sub>, or "" when it is not known.
+func CacheDir(sub ...string) string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(append([]string{base, "autoport"}, sub...)...)
+}
+
+// VersionError reports a document written with another schema version.
+type VersionError struct {
+	Path string
+	Got  int
+	Want int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%s: unsupported version %d (want %d)", e.Path, e.Got, e.Want)
+}
+
+// WriteFile replaces path with data atomically: readers see the old or the
+// new content, never a partial file. Missing directories are created.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// ReadJSON decodes the document at path into v after checking that its
+// "version" field is version. A missing file is reported as
+// os.ErrNotExist, another version as *VersionError.
+func ReadJSON(path string, version int, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(path, data, version, v)
+}
+
+func decodeJSON(path string, data []byte, version int, v any) error {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if header.Version != version {
+		return &VersionError{Path: path, Got: header.Version, Want: version}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// WriteJSON stores v at path as indented JSON, atomically. The document
+// carries its own version field.
+func WriteJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", path, err)
+	}
+	return WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// WithLock runs fn while holding an exclusive advisory lock on path (a
+// "<path>.lock" file next to it), waiting for other holders.
+func WithLock(path string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("lock %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("lock %s: %w", path, err)
+	}
+	defer unlockFile(f)
+	return fn()
+}
+
+// Update reads the document at path into a T under the path's lock, lets
+// fn modify it, and writes the result back atomically. exists reports
+// whether a document was read; a corrupt document or one with another
+// version counts as missing and is replaced. fn returning an error leaves
+// the file as is.
+func Update[T any](path string, version int, fn func(doc *T, exists bool) error) error {
+	return WithLock(path, func() error {
+		var doc T
+		exists := false
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if decodeJSON(path, data, version, &doc) == nil {
+				exists = true
+			} else {
+				doc = *new(T)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+		if err := fn(&doc, exists); err != nil {
+			return err
+		}
+		return WriteJSON(path, &doc)
+	})
+}
@@ -0,0 +1,82 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type counter struct {
+	Version int `json:"version"`
+	N       int `json:"n"`
+}
+
+func TestUpdate_ConcurrentUpdatesAreNotLost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "counter.json")
+	const workers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- Update(path, 1, func(c *counter, exists bool) error {
+				c.Version = 1
+				c.N++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Update() error: %v", err)
+		}
+	}
+	var got counter
+	if err := ReadJSON(path, 1, &got); err != nil {
+		t.Fatalf("ReadJSON() error: %v", err)
+	}
+	if got.N != workers {
+		t.Fatalf("n = %d, want %d", got.N, workers)
+	}
+}
+
+func TestReadJSON_VersionAndMissing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "doc.json")
+	if err := ReadJSON(path, 1, &counter{}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing file: err = %v, want os.ErrNotExist", err)
+	}
+	if err := WriteJSON(path, counter{Version: 2, N: 7}); err != nil {
+		t.Fatal(err)
+	}
+	var verr *VersionError
+	if err := ReadJSON(path, 1, &counter{}); !errors.As(err, &verr) || verr.Got != 2 {
+		t.Fatalf("err = %v, want *VersionError for version 2", err)
+	}
+
+	// Update replaces documents it cannot use.
+	err := Update(path, 1, func(c *counter, exists bool) error {
+		if exists || c.N != 0 {
+			t.Fatalf("stale document passed to Update: %+v, exists %v", c, exists)
+		}
+		c.Version, c.N = 1, 1
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "doc.json" && e.Name() != "doc.json.lock" {
+			t.Fatalf("leftover file %s", e.Name())
+		}
+	}
+}
@@ -15,11 +15,16 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gelleson/autoport/internal/app"
+	"github.com/gelleson/autoport/internal/config"
+	"github.com/gelleson/autoport/internal/lastrun"
+	"github.com/gelleson/autoport/internal/runcache"
 )
 
 var (
@@ -63,10 +68,32 @@ func (p *portEnvFlags) Set(value string) error {
 	return nil
 }
 
+// keyListFlags collects keys given as repeated flags or comma-separated
+// lists.
+type keyListFlags []string
+
+func (k *keyListFlags) String() string {
+	return strings.Join(*k, ",")
+}
+
+func (k *keyListFlags) Set(value string) error {
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			*k = append(*k, key)
+		}
+	}
+	return nil
+}
+
 func main() {
-	// Handle termination signals gracefully.
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+	// Handle termination signals gracefully. The signal is the context's
+	// cause, so a command it stops exits with 128+signal.
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() { cancel(&app.SignalError{Signal: <-signals}) }()
 
 	if err := run(ctx); err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -97,7 +124,17 @@ func run(ctx context.Context) error {
 		return nil
 	}
 
-	application := app.New()
+	appOpts := []app.AppOption{app.WithStateDir(lastrun.DefaultDir()), app.WithCacheDir(runcache.DefaultDir())}
+	if opts.Workdir != "" {
+		// The project config comes from the workdir, not from where
+		// autoport was started.
+		dir := opts.Workdir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(opts.CWD, dir)
+		}
+		appOpts = append(appOpts, app.WithConfig(config.LoadFrom(dir)))
+	}
+	application := app.New(appOpts...)
 	return application.Run(ctx, opts, cmdArgs)
 }
 
@@ -115,39 +152,164 @@ func parseCLIArgs(args []string) (app.Options, []string, error) {
 	var portEnv portEnvFlags
 	var includes portEnvFlags
 	var excludes portEnvFlags
+	var excludeCategories portEnvFlags
 	var format string
 	var quiet bool
 	var dryRun bool
 	var namespace string
+	var namespaceFrom string
 	var seed string
 	var useLock bool
+	var preferCurrent bool
+	var respectExisting bool
+	var loopbackAlias bool
+	var workdir string
+	var project string
+	var umask string
+	var noProcessGroup bool
+	var onHUP string
+	var watch bool
+	var shell string
+	var notifyFlag bool
+	var mergeWith string
+	var mnemonics bool
+	var onlyOverrides bool
+	var envFilter portEnvFlags
+	var assumeKeys portEnvFlags
+	var requireKeys keyListFlags
+	var requirePreferred bool
+	var pure bool
+	var yes bool
+	var manageGitignore bool
+	var showEnv bool
+	var redactEnv bool
+	var mdnsFlag bool
+	var listen string
+	var tokenFile string
+	var health bool
+	var fromSnapshot string
+	var seedFrom string
+	var seedRoot string
+	var seedString string
+	var urls bool
+	var silent bool
+	var noTruncate bool
+	var changedOnly bool
+	var reserve bool
+	var probe string
+	var passFDs bool
+	var cacheTTL time.Duration
+	var timeout time.Duration
+	var probeTTL time.Duration
+	var provenance string
+	var filesOnly bool
+	var envOnly bool
+	var healthyTimeout time.Duration
+	var revert bool
+	var docsCheck bool
+	var docsWrite bool
+	var record string
+	var replay string
+	var metricsAddr string
+	var projects, keysPerProject, trials int
 
 	targetMode := "run"
+	scriptMode, exportMode := false, false
 	if len(args) > 0 {
 		switch args[0] {
-		case "version", "explain", "doctor", "lock":
+		case "run":
+			scriptMode = true
+			args = args[1:]
+		case "export":
+			exportMode = true
+			args = args[1:]
+		case "version", "explain", "doctor", "lock", "adopt", "simulate", "proxy", "snapshot", "batch", "docs", "compose", "up", "hook", "serve", "status":
 			targetMode = args[0]
 			args = args[1:]
+		case "ide":
+			if len(args) < 2 || args[1] != "serve" {
+				return app.Options{}, nil, errors.New("usage: autoport ide serve [flags]")
+			}
+			targetMode = "ide"
+			args = args[2:]
 		}
 	}
 
 	fs := flag.NewFlagSet("autoport", flag.ContinueOnError)
 	fs.SetOutput(ioDiscard{})
 	rangeFlag := fs.String("r", "", "Port range to use (e.g., 3000-4000). Default is 10000-20000.")
+	fs.StringVar(rangeFlag, "range", "", "Port range to use (e.g., 3000-4000). Default is 10000-20000.")
 	fs.StringVar(&format, "f", defaultFormatForMode(targetMode), "Output format")
 	fs.StringVar(&format, "format", defaultFormatForMode(targetMode), "Output format")
 	fs.BoolVar(&quiet, "q", false, "Suppress command-mode override summary output")
 	fs.BoolVar(&quiet, "quiet", false, "Suppress command-mode override summary output")
+	fs.BoolVar(&silent, "silent", false, "Suppress all autoport output including warnings; only the command's output remains")
 	fs.BoolVar(&dryRun, "n", false, "Preview mode: print planned overrides and do not execute command")
 	fs.BoolVar(&dryRun, "dry-run", false, "Preview mode: print planned overrides and do not execute command")
 	fs.StringVar(&namespace, "namespace", "", "Namespace for deterministic seed")
+	fs.StringVar(&namespaceFrom, "namespace-from", "", "Mix a namespace source into the seed: session (tmux/screen session or terminal) or subdir (path below the git toplevel)")
 	fs.StringVar(&seed, "seed", "", "Explicit deterministic seed (uint32)")
+	fs.StringVar(&seedString, "seed-string", "", "Explicit deterministic seed given as a memorable string (hashed)")
+	fs.StringVar(&seedFrom, "seed-from", "", "Seed material: path (default) or a git remote name such as origin")
+	fs.StringVar(&seedRoot, "seed-root", "", "Path hashed into path seeds: cwd (default) or git (the repository toplevel)")
+	fs.DurationVar(&cacheTTL, "cache-ttl", 0, "Reuse the result of an identical invocation from within this duration (e.g. 5s)")
+	fs.DurationVar(&timeout, "timeout", 0, "Fail when scanning and allocating take longer than this (e.g. 10s); the command itself is not limited")
 	fs.BoolVar(&useLock, "use-lock", false, "Use .autoport.lock.json assignments")
+	fs.BoolVar(&requirePreferred, "require-preferred", false, "Fail instead of probing past a busy preferred port")
+	fs.BoolVar(&requirePreferred, "no-probe-fallback", false, "Fail instead of probing past a busy preferred port")
+	fs.BoolVar(&pure, "pure", false, "Emit the preferred deterministic ports without checking availability")
+	fs.BoolVar(&yes, "yes", false, "Run scripts and hooks from untrusted config files without asking")
+	fs.BoolVar(&manageGitignore, "manage-gitignore", false, "Lock and adopt modes: add the lockfile to .gitignore when lockfile.commit is false")
+	fs.BoolVar(&revert, "revert", false, "Print the statements undoing an earlier shell export (from AUTOPORT_REVERT)")
+	fs.BoolVar(&docsCheck, "check", false, "Docs mode: fail when the port table in the file is out of date")
+	fs.BoolVar(&docsWrite, "write", false, "Docs mode: replace the port table in the file; compose mode: write the override file (the .env file with -f dotenv); with --merge-with, rewrite the env file in place")
+	fs.BoolVar(&showEnv, "show-env", false, "With -n, print the full environment the command would receive")
+	fs.BoolVar(&redactEnv, "redact", false, "With --show-env, hide values not set by autoport")
+	fs.BoolVar(&mdnsFlag, "mdns", false, "Advertise assigned ports via mDNS while the command runs")
+	fs.StringVar(&listen, "listen", "", "Proxy and serve modes: address to listen on (default "+app.DefaultProxyListen+" for proxy, "+app.DefaultServeListen+" for serve)")
+	fs.StringVar(&tokenFile, "token-file", "", "Serve mode: file holding the bearer token clients send, created if missing (default serve.token in the state dir)")
+	fs.IntVar(&projects, "projects", 0, "Simulate mode: number of projects running side by side")
+	fs.IntVar(&keysPerProject, "keys-per-project", 0, "Simulate mode: port keys in each project")
+	fs.IntVar(&trials, "trials", app.DefaultSimTrials, "Simulate mode: random layouts to sample")
+	fs.DurationVar(&probeTTL, "probe-ttl", app.DefaultProbeTTL, "IDE and serve modes: reuse each port check outcome for this long (0 checks every time)")
+	fs.StringVar(&metricsAddr, "metrics", "", "Serve Prometheus metrics on this address (e.g. 127.0.0.1:9464) while autoport runs")
+	fs.BoolVar(&filesOnly, "files-only", false, "Discover keys from env and task files only, not from the environment")
+	fs.BoolVar(&envOnly, "env-only", false, "Discover keys from the environment only, not from files")
+	fs.BoolVar(&onlyOverrides, "only-overrides", false, "Start the command with a minimal environment: PATH, HOME, and the assigned ports")
+	fs.Var(&requireKeys, "require-keys", "Fail before running anything unless these keys are assigned a port (comma-separated, can be used multiple times)")
+	fs.Var(&assumeKeys, "assume-key", "Explain mode: preview the port a key not in the project yet would get, and which keys it would move (can be used multiple times)")
+	fs.Var(&envFilter, "env-filter", "Glob of variables the command inherits; prefix with ! to drop matches (can be used multiple times)")
+	fs.StringVar(&workdir, "workdir", "", "Plan for and run the command in this directory instead of the current one")
+	fs.StringVar(&project, "project", "", "Diagnose, explain, or report the status of the project in this directory instead of the current one (doctor, explain, and status)")
+	fs.StringVar(&probe, "probe", "", "Check ports for tcp, udp, or both on the IPv4 and IPv6 wildcard and loopback addresses")
+	fs.BoolVar(&reserve, "reserve", false, "Hold the assigned ports bound until the command starts")
+	fs.BoolVar(&passFDs, "pass-fds", false, "Hand the reserved ports to the command as socket-activation descriptors (LISTEN_FDS); implies --reserve")
+	fs.StringVar(&umask, "umask", "", "File mode creation mask for the command, in octal (e.g. 027)")
+	fs.BoolVar(&noProcessGroup, "no-process-group", false, "Run the command in autoport's process group; only the command itself is stopped")
+	fs.BoolVar(&notifyFlag, "notify", false, "Show a desktop notification when allocation fails, doctor finds fatal issues, or the command exits non-zero")
+	fs.StringVar(&onHUP, "on-hup", "", "On SIGHUP while the command runs: reload (replan and rewrite templates and links) or restart (also restart the command)")
+	fs.StringVar(&shell, "shell", "", "Shell syntax of -f shell output and --revert: bash, zsh, fish, powershell, cmd, or posix (default)")
+	fs.BoolVar(&watch, "watch", false, "Replan when .env files or the config change: restart the command with the new ports, or print the exports again")
+	fs.BoolVar(&health, "health", false, "Serve a local /health endpoint for the wrapped command")
+	fs.DurationVar(&healthyTimeout, "healthy-timeout", 0, "Stop the command when a config health URL is not ready within this duration (default 1m)")
+	fs.StringVar(&record, "record", "", "Write every input of the allocation (discoveries, probe outcomes, seed, config) to this trace file")
+	fs.StringVar(&provenance, "provenance", "", "Write the files (with SHA-256 hashes) and environment variables the assignments were derived from to this file")
+	fs.StringVar(&replay, "replay", "", "Reproduce the allocation recorded in a trace file instead of scanning and probing")
+	fs.StringVar(&mergeWith, "merge-with", "", "Export into this existing env file: set the assigned ports and keep everything else byte for byte (stdout, or in place with --write; -n previews the diff)")
+	fs.StringVar(&fromSnapshot, "from-snapshot", "", "Reproduce assignments from a snapshot file")
+	fs.BoolVar(&noTruncate, "no-truncate", false, "Never shorten long values in the override summary")
+	fs.BoolVar(&changedOnly, "changed-only", false, "List only keys whose port differs from the lockfile or the previous run in the override summary")
+	fs.BoolVar(&mnemonics, "mnemonics", false, "Show a pronounceable word for each port and for the whole set in the summary, JSON output, and explain")
+	fs.BoolVar(&urls, "urls", false, "Add a localhost URL column for HTTP-looking keys to the summary and JSON output")
+	fs.BoolVar(&preferCurrent, "prefer-current", false, "Keep the value a key's project file assigns when it is free and inside the range")
+	fs.BoolVar(&respectExisting, "respect-existing", false, "Keep a key's value from the invoking environment as is, reported as inherited")
+	fs.BoolVar(&loopbackAlias, "loopback-alias", false, "Give the project its own 127.0.0.x address, exported as <KEY>_HOST next to each key")
 	fs.Var(&ignores, "i", "Ignore environment variables starting with this prefix (can be used multiple times)")
 	fs.Var(&presets, "p", "Apply a preset (built-in or from .autoport.json)")
 	fs.Var(&portEnv, "k", "Include a port environment key manually (can be used multiple times)")
 	fs.Var(&includes, "include", "Include exact port key (can be used multiple times)")
 	fs.Var(&excludes, "exclude", "Exclude exact port key (can be used multiple times)")
+	fs.Var(&excludeCategories, "exclude-category", "Exclude discovered keys of a category: web, db, queue, debug, other, or one from config (can be used multiple times)")
 
 	if err := fs.Parse(args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
@@ -156,10 +318,68 @@ func parseCLIArgs(args []string) (app.Options, []string, error) {
 		return app.Options{}, nil, err
 	}
 
+	origins := map[string]string{}
+	visited := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		visited[f.Name] = true
+		if option, ok := flagOptions[f.Name]; ok {
+			origins[option] = "flag -" + dashes(f.Name) + f.Name
+		}
+	})
+	if err := applyEnvFlags(fs, visited, origins); err != nil {
+		return app.Options{}, nil, err
+	}
+	// AUTOPORT_FORMAT is typically exported for run/export; modes that do
+	// not support its value fall back to their default instead of failing.
+	if strings.HasPrefix(origins["format"], "env ") && validateFormat(targetMode, format) != nil {
+		format = defaultFormatForMode(targetMode)
+		delete(origins, "format")
+	}
+
 	if err := validateFormat(targetMode, format); err != nil {
 		return app.Options{}, nil, err
 	}
 
+	if mergeWith != "" && (targetMode != "run" || scriptMode) {
+		return app.Options{}, nil, errors.New("--merge-with only applies to export")
+	}
+	if mergeWith != "" && format != "shell" && format != "dotenv" {
+		return app.Options{}, nil, fmt.Errorf("--merge-with writes a dotenv file; -f %s does not apply", format)
+	}
+	if docsWrite && targetMode == "run" && mergeWith == "" {
+		return app.Options{}, nil, errors.New("--write needs --merge-with outside docs mode")
+	}
+
+	if project != "" {
+		if targetMode != "doctor" && targetMode != "explain" && targetMode != "status" {
+			return app.Options{}, nil, errors.New("--project only applies to doctor, explain, and status; use --workdir to run a command elsewhere")
+		}
+		if workdir != "" {
+			return app.Options{}, nil, errors.New("--project and --workdir are mutually exclusive")
+		}
+		// The project directory is handled as a workdir: its config,
+		// lockfile, and path seed are used.
+		workdir = project
+	}
+
+	if showEnv && !dryRun {
+		return app.Options{}, nil, errors.New("--show-env requires -n/--dry-run")
+	}
+
+	if seed != "" && seedString != "" {
+		return app.Options{}, nil, errors.New("--seed and --seed-string are mutually exclusive")
+	}
+
+	var umaskPtr *int
+	if umask != "" {
+		v, err := strconv.ParseUint(umask, 8, 32)
+		if err != nil || v > 0o777 {
+			return app.Options{}, nil, fmt.Errorf("invalid --umask %q: want an octal mask such as 022", umask)
+		}
+		tmp := int(v)
+		umaskPtr = &tmp
+	}
+
 	var seedPtr *uint32
 	if seed != "" {
 		v, err := strconv.ParseUint(seed, 10, 32)
@@ -175,23 +395,231 @@ func parseCLIArgs(args []string) (app.Options, []string, error) {
 		return app.Options{}, nil, fmt.Errorf("get cwd: %w", err)
 	}
 
+	cmdArgs := fs.Args()
+	if exportMode && len(cmdArgs) > 0 {
+		return app.Options{}, nil, fmt.Errorf("export does not take a command; use autoport [flags] %s", strings.Join(cmdArgs, " "))
+	}
+	var script string
+	if scriptMode {
+		if len(cmdArgs) == 0 {
+			return app.Options{}, nil, errors.New("usage: autoport run [flags] <script> [-- args ...]")
+		}
+		script = cmdArgs[0]
+		cmdArgs = cmdArgs[1:]
+		if len(cmdArgs) > 0 && cmdArgs[0] == "--" {
+			cmdArgs = cmdArgs[1:]
+		}
+	}
+
 	opts := app.Options{
-		Mode:      targetMode,
-		Ignores:   ignores,
-		Includes:  includes,
-		Excludes:  excludes,
-		Presets:   presets,
-		PortEnv:   portEnv,
-		Range:     *rangeFlag,
-		Format:    format,
-		Quiet:     quiet,
-		DryRun:    dryRun,
-		CWD:       cwd,
-		Namespace: namespace,
-		Seed:      seedPtr,
-		UseLock:   useLock,
+		Mode:              targetMode,
+		Ignores:           ignores,
+		Includes:          includes,
+		Excludes:          excludes,
+		Presets:           presets,
+		PortEnv:           portEnv,
+		Range:             *rangeFlag,
+		Format:            format,
+		Quiet:             quiet,
+		DryRun:            dryRun,
+		CWD:               cwd,
+		Namespace:         namespace,
+		NamespaceFrom:     namespaceFrom,
+		Seed:              seedPtr,
+		UseLock:           useLock,
+		PreferCurrent:     preferCurrent,
+		RespectExisting:   respectExisting,
+		LoopbackAlias:     loopbackAlias,
+		NoProcessGroup:    noProcessGroup,
+		Workdir:           workdir,
+		Umask:             umaskPtr,
+		OnlyOverrides:     onlyOverrides,
+		EnvFilter:         envFilter,
+		AssumeKeys:        assumeKeys,
+		RequireKeys:       requireKeys,
+		DocsCheck:         docsCheck,
+		DocsWrite:         docsWrite,
+		Record:            record,
+		Replay:            replay,
+		RequirePreferred:  requirePreferred,
+		Pure:              pure,
+		Yes:               yes,
+		ManageGitignore:   manageGitignore,
+		ShowEnv:           showEnv,
+		RedactEnv:         redactEnv,
+		MDNS:              mdnsFlag,
+		Listen:            listen,
+		TokenFile:         tokenFile,
+		Health:            health,
+		FromSnapshot:      fromSnapshot,
+		SeedFrom:          seedFrom,
+		SeedRoot:          seedRoot,
+		SeedString:        seedString,
+		Script:            script,
+		CacheTTL:          cacheTTL,
+		Timeout:           timeout,
+		ProbeTTL:          probeTTL,
+		Provenance:        provenance,
+		FilesOnly:         filesOnly,
+		EnvOnly:           envOnly,
+		HealthyTimeout:    healthyTimeout,
+		Revert:            revert,
+		Origins:           origins,
+		URLs:              urls,
+		Silent:            silent,
+		NoTruncate:        noTruncate,
+		ChangedOnly:       changedOnly,
+		ExcludeCategories: excludeCategories,
+		Probe:             probe,
+		Reserve:           reserve,
+		PassFDs:           passFDs,
+		Metrics:           metricsAddr,
+		Projects:          projects,
+		KeysPerProject:    keysPerProject,
+		Trials:            trials,
+		OnHUP:             onHUP,
+		Watch:             watch,
+		Shell:             shell,
+		Notify:            notifyFlag,
+		MergeWith:         mergeWith,
+		Mnemonics:         mnemonics,
+	}
+	return opts, cmdArgs, nil
+}
+
+// flagOptions maps flag names to the resolved option they set, for explain's
+// origin report.
+var flagOptions = map[string]string{
+	"r":                "range",
+	"range":            "range",
+	"f":                "format",
+	"format":           "format",
+	"namespace":        "namespace",
+	"namespace-from":   "namespace-from",
+	"p":                "presets",
+	"i":                "ignores",
+	"include":          "includes",
+	"exclude":          "excludes",
+	"exclude-category": "exclude_categories",
+	"k":                "keys",
+	"seed":             "seed",
+	"seed-string":      "seed",
+	"seed-from":        "seed",
+	"seed-root":        "seed-root",
+}
+
+// envFlag binds an AUTOPORT_* environment variable to a flag. The variable
+// is ignored when any flag in overriddenBy was given on the command line, so
+// CLI flags always take precedence.
+type envFlag struct {
+	env          string
+	flag         string
+	overriddenBy []string
+	list         bool
+}
+
+// envFlags binds every flag except those asking one invocation for a
+// one-off action or query, which a variable would repeat on every command.
+var envFlags = []envFlag{
+	{env: "AUTOPORT_RANGE", flag: "r", overriddenBy: []string{"r", "range"}},
+	{env: "AUTOPORT_FORMAT", flag: "format", overriddenBy: []string{"f", "format"}},
+	{env: "AUTOPORT_PRESETS", flag: "p", overriddenBy: []string{"p"}, list: true},
+	{env: "AUTOPORT_IGNORE", flag: "i", overriddenBy: []string{"i"}, list: true},
+	{env: "AUTOPORT_KEYS", flag: "k", overriddenBy: []string{"k"}, list: true},
+	{env: "AUTOPORT_INCLUDE", flag: "include", overriddenBy: []string{"include"}, list: true},
+	{env: "AUTOPORT_EXCLUDE", flag: "exclude", overriddenBy: []string{"exclude"}, list: true},
+	{env: "AUTOPORT_EXCLUDE_CATEGORY", flag: "exclude-category", overriddenBy: []string{"exclude-category"}, list: true},
+	{env: "AUTOPORT_NAMESPACE", flag: "namespace", overriddenBy: []string{"namespace"}},
+	{env: "AUTOPORT_NAMESPACE_FROM", flag: "namespace-from", overriddenBy: []string{"namespace-from"}},
+	{env: "AUTOPORT_SEED", flag: "seed", overriddenBy: []string{"seed", "seed-string"}},
+	{env: "AUTOPORT_SEED_STRING", flag: "seed-string", overriddenBy: []string{"seed", "seed-string"}},
+	{env: "AUTOPORT_SEED_FROM", flag: "seed-from", overriddenBy: []string{"seed-from"}},
+	{env: "AUTOPORT_SEED_ROOT", flag: "seed-root", overriddenBy: []string{"seed-root"}},
+	{env: "AUTOPORT_QUIET", flag: "quiet", overriddenBy: []string{"q", "quiet"}},
+	{env: "AUTOPORT_SILENT", flag: "silent", overriddenBy: []string{"silent"}},
+	{env: "AUTOPORT_DRY_RUN", flag: "dry-run", overriddenBy: []string{"n", "dry-run"}},
+	{env: "AUTOPORT_CACHE_TTL", flag: "cache-ttl", overriddenBy: []string{"cache-ttl"}},
+	{env: "AUTOPORT_TIMEOUT", flag: "timeout", overriddenBy: []string{"timeout"}},
+	{env: "AUTOPORT_USE_LOCK", flag: "use-lock", overriddenBy: []string{"use-lock"}},
+	{env: "AUTOPORT_PREFER_CURRENT", flag: "prefer-current", overriddenBy: []string{"prefer-current"}},
+	{env: "AUTOPORT_RESPECT_EXISTING", flag: "respect-existing", overriddenBy: []string{"respect-existing"}},
+	{env: "AUTOPORT_LOOPBACK_ALIAS", flag: "loopback-alias", overriddenBy: []string{"loopback-alias"}},
+	{env: "AUTOPORT_REQUIRE_PREFERRED", flag: "require-preferred", overriddenBy: []string{"require-preferred", "no-probe-fallback"}},
+	{env: "AUTOPORT_PURE", flag: "pure", overriddenBy: []string{"pure"}},
+	{env: "AUTOPORT_YES", flag: "yes", overriddenBy: []string{"yes"}},
+	{env: "AUTOPORT_MANAGE_GITIGNORE", flag: "manage-gitignore", overriddenBy: []string{"manage-gitignore"}},
+	{env: "AUTOPORT_SHOW_ENV", flag: "show-env", overriddenBy: []string{"show-env"}},
+	{env: "AUTOPORT_REDACT", flag: "redact", overriddenBy: []string{"redact"}},
+	{env: "AUTOPORT_MDNS", flag: "mdns", overriddenBy: []string{"mdns"}},
+	{env: "AUTOPORT_LISTEN", flag: "listen", overriddenBy: []string{"listen"}},
+	{env: "AUTOPORT_PROBE_TTL", flag: "probe-ttl", overriddenBy: []string{"probe-ttl"}},
+	{env: "AUTOPORT_HEALTH", flag: "health", overriddenBy: []string{"health"}},
+	{env: "AUTOPORT_FILES_ONLY", flag: "files-only", overriddenBy: []string{"files-only", "env-only"}},
+	{env: "AUTOPORT_ENV_ONLY", flag: "env-only", overriddenBy: []string{"files-only", "env-only"}},
+	{env: "AUTOPORT_ONLY_OVERRIDES", flag: "only-overrides", overriddenBy: []string{"only-overrides"}},
+	{env: "AUTOPORT_ENV_FILTER", flag: "env-filter", overriddenBy: []string{"env-filter"}, list: true},
+	{env: "AUTOPORT_NO_PROCESS_GROUP", flag: "no-process-group", overriddenBy: []string{"no-process-group"}},
+	{env: "AUTOPORT_ON_HUP", flag: "on-hup", overriddenBy: []string{"on-hup"}},
+	{env: "AUTOPORT_WATCH", flag: "watch", overriddenBy: []string{"watch"}},
+	{env: "AUTOPORT_SHELL", flag: "shell", overriddenBy: []string{"shell"}},
+	{env: "AUTOPORT_NOTIFY", flag: "notify", overriddenBy: []string{"notify"}},
+	{env: "AUTOPORT_WORKDIR", flag: "workdir", overriddenBy: []string{"workdir", "project"}},
+	{env: "AUTOPORT_PROVENANCE", flag: "provenance", overriddenBy: []string{"provenance"}},
+	{env: "AUTOPORT_UMASK", flag: "umask", overriddenBy: []string{"umask"}},
+	{env: "AUTOPORT_PROBE", flag: "probe", overriddenBy: []string{"probe"}},
+	{env: "AUTOPORT_HEALTHY_TIMEOUT", flag: "healthy-timeout", overriddenBy: []string{"healthy-timeout"}},
+	{env: "AUTOPORT_METRICS", flag: "metrics", overriddenBy: []string{"metrics"}},
+	{env: "AUTOPORT_URLS", flag: "urls", overriddenBy: []string{"urls"}},
+	{env: "AUTOPORT_MNEMONICS", flag: "mnemonics", overriddenBy: []string{"mnemonics"}},
+	{env: "AUTOPORT_NO_TRUNCATE", flag: "no-truncate", overriddenBy: []string{"no-truncate"}},
+	{env: "AUTOPORT_CHANGED_ONLY", flag: "changed-only", overriddenBy: []string{"changed-only"}},
+	{env: "AUTOPORT_REQUIRE_KEYS", flag: "require-keys", overriddenBy: []string{"require-keys"}, list: true},
+	{env: "AUTOPORT_FROM_SNAPSHOT", flag: "from-snapshot", overriddenBy: []string{"from-snapshot"}},
+	{env: "AUTOPORT_RECORD", flag: "record", overriddenBy: []string{"record", "replay"}},
+	{env: "AUTOPORT_RESERVE", flag: "reserve", overriddenBy: []string{"reserve"}},
+	{env: "AUTOPORT_PASS_FDS", flag: "pass-fds", overriddenBy: []string{"pass-fds"}},
+	{env: "AUTOPORT_TOKEN_FILE", flag: "token-file", overriddenBy: []string{"token-file"}},
+}
+
+// applyEnvFlags sets flags not given on the command line from their
+// AUTOPORT_* environment variables. List flags take comma-separated values.
+func applyEnvFlags(fs *flag.FlagSet, visited map[string]bool, origins map[string]string) error {
+	for _, ef := range envFlags {
+		value, ok := os.LookupEnv(ef.env)
+		if !ok || value == "" || anyVisited(visited, ef.overriddenBy) {
+			continue
+		}
+		values := []string{value}
+		if ef.list {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			if err := fs.Set(ef.flag, strings.TrimSpace(v)); err != nil {
+				return fmt.Errorf("invalid %s %q: %w", ef.env, value, err)
+			}
+		}
+		if option, ok := flagOptions[ef.flag]; ok && origins[option] == "" {
+			origins[option] = "env " + ef.env
+		}
+	}
+	return nil
+}
+
+func anyVisited(visited map[string]bool, names []string) bool {
+	for _, name := range names {
+		if visited[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// dashes returns the dash prefix a flag is conventionally written with.
+func dashes(name string) string {
+	if len(name) == 1 {
+		return ""
 	}
-	return opts, fs.Args(), nil
+	return "-"
 }
 
 type ioDiscard struct{}
@@ -213,20 +641,58 @@ func printHelp(w io.Writer, mode string) {
 	fmt.Fprintln(w)
 	fmt.Fprintln(w, "Usage:")
 	fmt.Fprintln(w, "  autoport [flags] [command ...]")
+	fmt.Fprintln(w, "  autoport run [flags] <script> [-- args ...]")
 	fmt.Fprintln(w, "  autoport explain [flags]")
 	fmt.Fprintln(w, "  autoport doctor [flags]")
 	fmt.Fprintln(w, "  autoport lock [flags]")
+	fmt.Fprintln(w, "  autoport adopt [flags]")
+	fmt.Fprintln(w, "  autoport simulate --projects <n> --keys-per-project <n> [flags]")
+	fmt.Fprintln(w, "  autoport proxy [flags]")
+	fmt.Fprintln(w, "  autoport snapshot [flags] > snap.json")
+	fmt.Fprintln(w, "  autoport ide serve [flags]")
+	fmt.Fprintln(w, "  autoport serve [flags]")
+	fmt.Fprintln(w, "  autoport batch [flags] <path ...>")
+	fmt.Fprintln(w, "  autoport docs [--check|--write] [file]")
+	fmt.Fprintln(w, "  autoport compose [--write] [compose file]")
+	fmt.Fprintln(w, "  autoport up [flags] [process ...]")
+	fmt.Fprintln(w, "  autoport status [flags] [command ...]")
+	fmt.Fprintln(w, "  autoport export [flags]")
+	fmt.Fprintln(w, "  autoport hook bash|zsh|fish")
 	fmt.Fprintln(w, "  autoport version")
 	fmt.Fprintln(w)
 	switch mode {
 	case "explain":
-		fmt.Fprintln(w, "Explain flags: -r, -p, -i, --include, --exclude, -k, --namespace, --seed, -f text|json")
+		fmt.Fprintln(w, "Explain flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --require-keys, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --prefer-current, --respect-existing, --pure, --mnemonics, --assume-key, --project <dir>, --record <file>, --replay <file>, --timeout <duration>, -f text|json|html")
 	case "doctor":
-		fmt.Fprintln(w, "Doctor flags: -r, -p, -i, --include, --exclude, -k, --namespace, --seed, --use-lock, -f text|json")
+		fmt.Fprintln(w, "Doctor flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --use-lock, --loopback-alias, --project <dir>, --timeout <duration>, --notify, -f text|json")
+	case "proxy":
+		fmt.Fprintln(w, "Proxy flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --use-lock, -q, --silent, --listen <addr>, --metrics <addr>")
+	case "ide":
+		fmt.Fprintln(w, "IDE flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --use-lock, --probe-ttl <duration>, --metrics <addr> (JSON-RPC 2.0 over stdin/stdout, one message per line)")
+	case "serve":
+		fmt.Fprintln(w, "Serve flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --use-lock, -q, --listen <addr>, --token-file <file>, --probe-ttl <duration>, --metrics <addr> (HTTP: GET /v1/assign?path=<dir>[&key=<KEY>] with Authorization: Bearer <token>)")
+	case "batch":
+		fmt.Fprintln(w, "Batch flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --require-keys, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --use-lock, --prefer-current, --respect-existing, --require-preferred, --pure, --timeout <duration>, -f json|dotenv")
+	case "docs":
+		fmt.Fprintln(w, "Docs flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --require-keys, --namespace, --seed, --seed-string, --seed-from, --seed-root, --timeout <duration>, --check, --write (file defaults to README.md)")
+	case "snapshot":
+		fmt.Fprintln(w, "Snapshot flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --require-keys, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --use-lock, --pure, --timeout <duration>")
 	case "lock":
-		fmt.Fprintln(w, "Lock flags: -r, -p, -i, --include, --exclude, -k, --namespace, --seed")
+		fmt.Fprintln(w, "Lock flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --require-keys, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --prefer-current, --respect-existing, --require-preferred, --pure, --manage-gitignore, --timeout <duration>")
+	case "compose":
+		fmt.Fprintln(w, "Compose flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --require-keys, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --use-lock, --prefer-current, --respect-existing, --require-preferred, --pure, --loopback-alias, --probe tcp|udp|both, --timeout <duration>, -q, --write, -f compose|dotenv")
+	case "up":
+		fmt.Fprintln(w, "Up flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --require-keys, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --use-lock, --prefer-current, --respect-existing, --require-preferred, --pure, --loopback-alias, --probe tcp|udp|both, --timeout <duration>, -q, --silent, -n, --mnemonics, --no-truncate, --yes, --only-overrides, --env-filter <glob> (runs the Procfile or config processes)")
+	case "status":
+		fmt.Fprintln(w, "Status flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --use-lock, --project <dir>, --timeout <duration>, --no-truncate, -f text|json (reports which process holds each port; a command names the process expected on them)")
+	case "hook":
+		fmt.Fprintln(w, "Hook: prints a snippet for your shell rc file that exports the ports of the project holding the working directory (the nearest directory up with .autoport.json or .autoport.local.json) after every cd, reverting the previous project's, e.g. eval \"$(autoport hook bash)\"")
+	case "simulate":
+		fmt.Fprintln(w, "Simulate flags: -r, --range, --projects <n>, --keys-per-project <n>, --trials <n>, --seed, --timeout <duration>, -f text|json")
+	case "adopt":
+		fmt.Fprintln(w, "Adopt flags: -r, -p, -i, --include, --exclude, --exclude-category, -n, --manage-gitignore, --timeout <duration> (writes the ports project files hardcode to the lockfile)")
 	default:
-		fmt.Fprintln(w, "Run/export flags: -r, -p, -i, --include, --exclude, -k, --namespace, --seed, --use-lock, -f shell|json|dotenv|yaml, -q, -n")
+		fmt.Fprintln(w, "Run/export flags: -r, -p, -i, --include, --exclude, --exclude-category, -k, --require-keys, --files-only, --env-only, --namespace, --namespace-from, --seed, --seed-string, --seed-from, --seed-root, --use-lock, --cache-ttl, --timeout <duration>, --prefer-current, --respect-existing, --require-preferred, --pure, --loopback-alias, --probe tcp|udp|both, -f shell|json|dotenv|yaml|compose|k8s|skaffold|plugin:<name>, -q, --silent, -n, --urls, --mnemonics, --no-truncate, --changed-only, --show-env, --redact, --mdns, --health, --healthy-timeout, --metrics <addr>, --from-snapshot <file>, --merge-with <file> [--write], --shell bash|zsh|fish|powershell|cmd, --yes, --revert, --no-process-group, --on-hup reload|restart, --watch, --notify, --only-overrides, --env-filter <glob>, --workdir <dir>, --umask <mask>, --reserve, --pass-fds, --record <file>, --replay <file>, --provenance <file>")
 	}
 	fmt.Fprintln(w)
 	fmt.Fprintln(w, "Examples:")
@@ -234,12 +700,20 @@ func printHelp(w io.Writer, mode string) {
 	fmt.Fprintln(w, "  autoport explain -f json")
 	fmt.Fprintln(w, "  autoport doctor")
 	fmt.Fprintln(w, "  autoport lock && autoport --use-lock npm start")
+	fmt.Fprintln(w, "  autoport snapshot > snap.json && autoport --from-snapshot snap.json npm start")
+	fmt.Fprintln(w, "  autoport --merge-with .env --write")
 }
 
 func defaultFormatForMode(mode string) string {
 	switch mode {
-	case "explain", "doctor":
+	case "explain", "doctor", "proxy", "ide", "serve", "adopt", "simulate", "up", "status":
 		return "text"
+	case "snapshot", "batch":
+		return "json"
+	case "docs":
+		return "markdown"
+	case "compose":
+		return "compose"
 	default:
 		return "shell"
 	}
@@ -248,14 +722,36 @@ func defaultFormatForMode(mode string) string {
 func validateFormat(mode, format string) error {
 	allowed := map[string]bool{}
 	switch mode {
-	case "explain", "doctor":
+	case "explain", "doctor", "simulate", "status":
+		allowed["text"] = true
+		allowed["json"] = true
+		allowed["html"] = mode == "explain"
+	case "proxy", "ide", "serve", "adopt", "up":
 		allowed["text"] = true
+	case "snapshot":
+		allowed["json"] = true
+	case "docs":
+		allowed["markdown"] = true
+	case "hook":
+		allowed["shell"] = true
+	case "compose":
+		allowed["compose"] = true
+		allowed["dotenv"] = true
+	case "batch":
 		allowed["json"] = true
+		allowed["dotenv"] = true
 	default:
 		allowed["shell"] = true
 		allowed["json"] = true
 		allowed["dotenv"] = true
 		allowed["yaml"] = true
+		allowed["compose"] = true
+		allowed["k8s"] = true
+		allowed["skaffold"] = true
+		// Format plugins are looked up once the config is loaded.
+		if name, ok := strings.CutPrefix(format, "plugin:"); ok && name != "" {
+			allowed[format] = true
+		}
 	}
 	if !allowed[format] {
 		return fmt.Errorf("invalid format %q for mode %q", format, mode)
@@ -27,6 +27,8 @@ func TestParseCLIArgs_RunMode(t *testing.T) {
 		"--namespace", "svc-a",
 		"--seed", "123",
 		"--use-lock",
+		"--prefer-current",
+		"--no-probe-fallback",
 		"-r", "3000-4000",
 		"-f", "json",
 		"-q",
@@ -58,6 +60,12 @@ func TestParseCLIArgs_RunMode(t *testing.T) {
 	if !opts.UseLock {
 		t.Fatal("expected use-lock true")
 	}
+	if !opts.PreferCurrent {
+		t.Fatal("expected prefer-current true")
+	}
+	if !opts.RequirePreferred {
+		t.Fatal("expected require-preferred true")
+	}
 	if !opts.Quiet {
 		t.Fatal("parseCLIArgs() Quiet = false, want true")
 	}
@@ -100,11 +108,266 @@ func TestParseCLIArgs_ExplainModeDefaults(t *testing.T) {
 	}
 }
 
+func TestParseCLIArgs_SeedString(t *testing.T) {
+	opts, _, err := parseCLIArgs([]string{"--seed-string", "my-service-dev"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.SeedString != "my-service-dev" || opts.Seed != nil {
+		t.Fatalf("unexpected seed opts: %+v", opts)
+	}
+	if _, _, err := parseCLIArgs([]string{"--seed", "1", "--seed-string", "x"}); err == nil {
+		t.Fatal("expected error for --seed with --seed-string")
+	}
+}
+
+func TestParseCLIArgs_RequireKeys(t *testing.T) {
+	opts, _, err := parseCLIArgs([]string{"--require-keys", "PORT, API_PORT", "--require-keys", "WORKER_PORT", "npm", "start"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if want := []string{"PORT", "API_PORT", "WORKER_PORT"}; !reflect.DeepEqual(opts.RequireKeys, want) {
+		t.Fatalf("RequireKeys = %v, want %v", opts.RequireKeys, want)
+	}
+}
+
+func TestParseCLIArgs_RecordsFlagOrigins(t *testing.T) {
+	opts, _, err := parseCLIArgs([]string{"explain", "-r", "3000-4000", "--format", "json", "--seed-from", "origin"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := map[string]string{"range": "flag -r", "format": "flag --format", "seed": "flag --seed-from"}
+	if !reflect.DeepEqual(opts.Origins, want) {
+		t.Fatalf("origins = %v, want %v", opts.Origins, want)
+	}
+}
+
+func TestParseCLIArgs_EnvEquivalents(t *testing.T) {
+	t.Setenv("AUTOPORT_RANGE", "5000-6000")
+	t.Setenv("AUTOPORT_PRESETS", "db, queues")
+	t.Setenv("AUTOPORT_NAMESPACE", "ci")
+	t.Setenv("AUTOPORT_QUIET", "true")
+	t.Setenv("AUTOPORT_FORMAT", "yaml")
+
+	opts, _, err := parseCLIArgs([]string{"-f", "json"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Range != "5000-6000" || opts.Namespace != "ci" || !opts.Quiet {
+		t.Fatalf("env values not applied: %+v", opts)
+	}
+	if !reflect.DeepEqual(opts.Presets, []string{"db", "queues"}) {
+		t.Fatalf("presets = %v", opts.Presets)
+	}
+	if opts.Format != "json" {
+		t.Fatalf("CLI flag should beat AUTOPORT_FORMAT, got %q", opts.Format)
+	}
+	if opts.Origins["range"] != "env AUTOPORT_RANGE" || opts.Origins["format"] != "flag -f" {
+		t.Fatalf("origins = %v", opts.Origins)
+	}
+
+	t.Setenv("AUTOPORT_SEED", "7")
+	opts, _, err = parseCLIArgs([]string{"--seed-string", "svc"})
+	if err != nil {
+		t.Fatalf("--seed-string should override AUTOPORT_SEED: %v", err)
+	}
+	if opts.Seed != nil || opts.SeedString != "svc" {
+		t.Fatalf("unexpected seed opts: %+v", opts)
+	}
+
+	t.Setenv("AUTOPORT_DRY_RUN", "maybe")
+	if _, _, err := parseCLIArgs(nil); err == nil || !strings.Contains(err.Error(), "AUTOPORT_DRY_RUN") {
+		t.Fatalf("expected AUTOPORT_DRY_RUN error, got %v", err)
+	}
+}
+
+func TestParseCLIArgs_EnvFormatFallsBackForOtherModes(t *testing.T) {
+	t.Setenv("AUTOPORT_FORMAT", "dotenv")
+	for _, mode := range []string{"explain", "doctor"} {
+		opts, _, err := parseCLIArgs([]string{mode})
+		if err != nil {
+			t.Fatalf("%s with AUTOPORT_FORMAT=dotenv: %v", mode, err)
+		}
+		if opts.Format != "text" || opts.Origins["format"] != "" {
+			t.Fatalf("%s format = %q (origin %q), want its default", mode, opts.Format, opts.Origins["format"])
+		}
+	}
+	if _, _, err := parseCLIArgs([]string{"explain", "-f", "dotenv"}); err == nil {
+		t.Fatal("an explicit -f dotenv for explain should still fail")
+	}
+	t.Setenv("AUTOPORT_FORMAT", "json")
+	if opts, _, err := parseCLIArgs([]string{"doctor"}); err != nil || opts.Format != "json" {
+		t.Fatalf("doctor should use a supported AUTOPORT_FORMAT: %q, %v", opts.Format, err)
+	}
+}
+
+func TestParseCLIArgs_EnvRunFlags(t *testing.T) {
+	t.Setenv("AUTOPORT_RECORD", "trace.json")
+	t.Setenv("AUTOPORT_RESERVE", "true")
+	t.Setenv("AUTOPORT_PASS_FDS", "1")
+	t.Setenv("AUTOPORT_TOKEN_FILE", "/run/autoport.token")
+	opts, _, err := parseCLIArgs(nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Record != "trace.json" || !opts.Reserve || !opts.PassFDs || opts.TokenFile != "/run/autoport.token" {
+		t.Fatalf("env values not applied: %+v", opts)
+	}
+	if opts, _, err = parseCLIArgs([]string{"--replay", "old.json"}); err != nil || opts.Record != "" {
+		t.Fatalf("--replay should override AUTOPORT_RECORD: record %q, %v", opts.Record, err)
+	}
+}
+
+func TestParseCLIArgs_NamespaceFrom(t *testing.T) {
+	t.Setenv("AUTOPORT_NAMESPACE_FROM", "session")
+	opts, _, err := parseCLIArgs(nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.NamespaceFrom != "session" || opts.Origins["namespace-from"] != "env AUTOPORT_NAMESPACE_FROM" {
+		t.Fatalf("unexpected opts: %+v", opts)
+	}
+}
+
+func TestParseCLIArgs_RunScript(t *testing.T) {
+	opts, args, err := parseCLIArgs([]string{"run", "-n", "dev", "--", "--inspect", "x"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Mode != "run" || opts.Script != "dev" || !opts.DryRun || !reflect.DeepEqual(args, []string{"--inspect", "x"}) {
+		t.Fatalf("unexpected opts: %+v args=%v", opts, args)
+	}
+	if _, _, err := parseCLIArgs([]string{"run"}); err == nil {
+		t.Fatal("expected an error without a script name")
+	}
+}
+
+func TestParseCLIArgs_IDEServe(t *testing.T) {
+	opts, _, err := parseCLIArgs([]string{"ide", "serve", "-r", "3000-4000"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Mode != "ide" || opts.Range != "3000-4000" {
+		t.Fatalf("unexpected opts: %+v", opts)
+	}
+	if _, _, err := parseCLIArgs([]string{"ide"}); err == nil {
+		t.Fatal("expected usage error for bare ide")
+	}
+}
+
+func TestParseCLIArgs_ProxyMode(t *testing.T) {
+	opts, _, err := parseCLIArgs([]string{"proxy", "--listen", "127.0.0.1:9999"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Mode != "proxy" || opts.Listen != "127.0.0.1:9999" || opts.Format != "text" {
+		t.Fatalf("unexpected opts: %+v", opts)
+	}
+	if _, _, err := parseCLIArgs([]string{"proxy", "-f", "json"}); err == nil {
+		t.Fatal("expected json format to be rejected in proxy mode")
+	}
+}
+
+func TestParseCLIArgs_AdoptMode(t *testing.T) {
+	opts, _, err := parseCLIArgs([]string{"adopt", "-n"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Mode != "adopt" || opts.Format != "text" || !opts.DryRun {
+		t.Fatalf("unexpected opts: %+v", opts)
+	}
+}
+
+func TestParseCLIArgs_SimulateMode(t *testing.T) {
+	opts, _, err := parseCLIArgs([]string{"simulate", "--projects", "50", "--keys-per-project", "6", "--range", "10000-20000"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Mode != "simulate" || opts.Projects != 50 || opts.KeysPerProject != 6 || opts.Range != "10000-20000" || opts.Trials != 1000 || opts.Format != "text" {
+		t.Fatalf("unexpected opts: %+v", opts)
+	}
+}
+
+func TestParseCLIArgs_BatchMode(t *testing.T) {
+	opts, args, err := parseCLIArgs([]string{"batch", "-f", "dotenv", "svc/a", "svc/b"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Mode != "batch" || opts.Format != "dotenv" || !reflect.DeepEqual(args, []string{"svc/a", "svc/b"}) {
+		t.Fatalf("unexpected opts: %+v args=%v", opts, args)
+	}
+	if opts, _, _ := parseCLIArgs([]string{"batch", "a"}); opts.Format != "json" {
+		t.Fatalf("default batch format = %q, want json", opts.Format)
+	}
+	if _, _, err := parseCLIArgs([]string{"batch", "-f", "shell", "a"}); err == nil {
+		t.Fatal("expected shell format to be rejected in batch mode")
+	}
+}
+
+func TestParseCLIArgs_ComposeMode(t *testing.T) {
+	opts, args, err := parseCLIArgs([]string{"compose", "--write", "docker-compose.yml"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Mode != "compose" || opts.Format != "compose" || !opts.DocsWrite || !reflect.DeepEqual(args, []string{"docker-compose.yml"}) {
+		t.Fatalf("unexpected opts: %+v args=%v", opts, args)
+	}
+	if _, _, err := parseCLIArgs([]string{"compose", "-f", "shell"}); err == nil {
+		t.Fatal("expected shell format to be rejected in compose mode")
+	}
+}
+
+func TestParseCLIArgs_UpMode(t *testing.T) {
+	opts, args, err := parseCLIArgs([]string{"up", "-q", "web", "worker"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Mode != "up" || opts.Format != "text" || !opts.Quiet || !reflect.DeepEqual(args, []string{"web", "worker"}) {
+		t.Fatalf("unexpected opts: %+v args=%v", opts, args)
+	}
+}
+
+func TestParseCLIArgs_ExportAndHook(t *testing.T) {
+	opts, args, err := parseCLIArgs([]string{"export", "--shell", "fish"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Mode != "run" || opts.Shell != "fish" || opts.Format != "shell" || len(args) != 0 {
+		t.Fatalf("unexpected opts: %+v args=%v", opts, args)
+	}
+	if _, _, err := parseCLIArgs([]string{"export", "npm", "start"}); err == nil || !strings.Contains(err.Error(), "does not take a command") {
+		t.Fatalf("expected export to refuse a command, got %v", err)
+	}
+	opts, args, err = parseCLIArgs([]string{"hook", "zsh"})
+	if err != nil || opts.Mode != "hook" || !reflect.DeepEqual(args, []string{"zsh"}) {
+		t.Fatalf("hook zsh: opts=%+v args=%v err=%v", opts, args, err)
+	}
+}
+
 func TestParseCLIArgs_InvalidFormat(t *testing.T) {
 	_, _, err := parseCLIArgs([]string{"-f", "xml"})
 	if err == nil {
 		t.Fatal("parseCLIArgs() expected error for invalid format")
 	}
+	if _, _, err := parseCLIArgs([]string{"explain", "-f", "html"}); err != nil {
+		t.Fatalf("explain -f html: unexpected err: %v", err)
+	}
+	if _, _, err := parseCLIArgs([]string{"doctor", "-f", "html"}); err == nil {
+		t.Fatal("expected html format to be rejected in doctor mode")
+	}
+}
+
+func TestParseCLIArgs_ShowEnvRequiresDryRun(t *testing.T) {
+	if _, _, err := parseCLIArgs([]string{"--show-env", "npm", "start"}); err == nil {
+		t.Fatal("expected error for --show-env without -n")
+	}
+	opts, _, err := parseCLIArgs([]string{"-n", "--show-env", "--redact", "npm", "start"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !opts.ShowEnv || !opts.RedactEnv {
+		t.Fatalf("expected show-env and redact, got %+v", opts)
+	}
 }
 
 func TestParseCLIArgs_HelpReturnsTypedError(t *testing.T) {
@@ -184,3 +447,23 @@ func TestVersionString(t *testing.T) {
 		t.Fatalf("versionString() = %q, want %q", got, want)
 	}
 }
+
+func TestParseCLIArgs_Project(t *testing.T) {
+	opts, _, err := parseCLIArgs([]string{"doctor", "--project", "../billing", "-f", "json"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if opts.Mode != "doctor" || opts.Workdir != "../billing" {
+		t.Fatalf("unexpected opts: %+v", opts)
+	}
+	opts, args, err := parseCLIArgs([]string{"status", "--project", "../billing", "npm", "start"})
+	if err != nil || opts.Mode != "status" || opts.Workdir != "../billing" || opts.Format != "text" || !reflect.DeepEqual(args, []string{"npm", "start"}) {
+		t.Fatalf("status: opts %+v args %v err %v", opts, args, err)
+	}
+	if _, _, err := parseCLIArgs([]string{"--project", "../billing", "npm", "start"}); err == nil || !strings.Contains(err.Error(), "only applies to doctor, explain, and status") {
+		t.Fatalf("expected --project to be refused in run mode, got %v", err)
+	}
+	if _, _, err := parseCLIArgs([]string{"explain", "--project", "a", "--workdir", "b"}); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Fatalf("expected --project and --workdir to conflict, got %v", err)
+	}
+}
@@ -1,12 +1,16 @@
 package port
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"net"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
@@ -17,20 +21,140 @@ const (
 // IsFreeFunc defines a function signature for checking if a port is free.
 type IsFreeFunc func(p int) bool
 
-// Range represents an inclusive port range.
+// Range represents an inclusive port range. Ranges parsed from a multi-range
+// spec such as "3000-3999,4100-4999,!4444" carry their disjoint segments and
+// exclusions; Start and End then bound the whole set.
 type Range struct {
 	Start int
 	End   int
+
+	set *portSet
+}
+
+// Segment is one inclusive span of a multi-range spec.
+type Segment struct {
+	Start int
+	End   int
+}
+
+// portSet is the combined space of a multi-range spec.
+type portSet struct {
+	written  []Segment // as written, for overlap reporting
+	merged   []Segment // sorted and merged
+	excluded []int     // sorted, unique, inside merged
 }
 
 // Size returns the number of ports in the range.
 func (r Range) Size() int {
-	return r.End - r.Start + 1
+	if r.set == nil {
+		return r.End - r.Start + 1
+	}
+	n := -len(r.set.excluded)
+	for _, s := range r.set.merged {
+		n += s.End - s.Start + 1
+	}
+	return n
+}
+
+// At returns the i-th port of the range in ascending order, skipping
+// exclusions. i must be in [0, Size()).
+func (r Range) At(i int) int {
+	if r.set == nil {
+		return r.Start + i
+	}
+	for _, s := range r.set.merged {
+		lo := sort.SearchInts(r.set.excluded, s.Start)
+		hi := sort.SearchInts(r.set.excluded, s.End+1)
+		ex := r.set.excluded[lo:hi]
+		n := s.End - s.Start + 1 - len(ex)
+		if i >= n {
+			i -= n
+			continue
+		}
+		p := s.Start + i
+		for _, e := range ex {
+			if e > p {
+				break
+			}
+			p++
+		}
+		return p
+	}
+	return -1
+}
+
+// Contains reports whether p is part of the range.
+func (r Range) Contains(p int) bool {
+	if r.set == nil {
+		return p >= r.Start && p <= r.End
+	}
+	for _, s := range r.set.merged {
+		if p >= s.Start && p <= s.End {
+			i := sort.SearchInts(r.set.excluded, p)
+			return i == len(r.set.excluded) || r.set.excluded[i] != p
+		}
+	}
+	return false
+}
+
+// Segments returns the merged, sorted spans of the range.
+func (r Range) Segments() []Segment {
+	if r.set == nil {
+		return []Segment{{Start: r.Start, End: r.End}}
+	}
+	return append([]Segment{}, r.set.merged...)
+}
+
+// Excluded returns the ports removed from the range with "!" entries.
+func (r Range) Excluded() []int {
+	if r.set == nil {
+		return nil
+	}
+	return append([]int{}, r.set.excluded...)
+}
+
+// Overlaps describes segments of the spec that overlap each other. They are
+// merged for allocation but usually indicate a typo.
+func (r Range) Overlaps() []string {
+	if r.set == nil {
+		return nil
+	}
+	var out []string
+	w := r.set.written
+	for i := range w {
+		for j := i + 1; j < len(w); j++ {
+			if w[i].Start <= w[j].End && w[j].Start <= w[i].End {
+				out = append(out, fmt.Sprintf("%d-%d overlaps %d-%d", w[i].Start, w[i].End, w[j].Start, w[j].End))
+			}
+		}
+	}
+	return out
+}
+
+// String returns the canonical spec of the range.
+func (r Range) String() string {
+	if r.set == nil {
+		return fmt.Sprintf("%d-%d", r.Start, r.End)
+	}
+	parts := make([]string, 0, len(r.set.merged)+len(r.set.excluded))
+	for _, s := range r.set.merged {
+		parts = append(parts, fmt.Sprintf("%d-%d", s.Start, s.End))
+	}
+	for _, p := range r.set.excluded {
+		parts = append(parts, fmt.Sprintf("!%d", p))
+	}
+	return strings.Join(parts, ",")
 }
 
 // DefaultIsFree checks if a given port is available on the local machine.
 func DefaultIsFree(p int) bool {
-	ln, err := net.Listen("tcp", ":"+strconv.Itoa(p))
+	return IsFreeOn("", p)
+}
+
+// IsFreeOn checks if a given port can be bound on host; an empty host
+// means every interface.
+func IsFreeOn(host string, p int) bool {
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(p)))
 	if err != nil {
 		return false
 	}
@@ -38,27 +162,153 @@ func DefaultIsFree(p int) bool {
 	return true
 }
 
-// ParseRange parses a range string like "10000-20000" into a Range.
+// Protocol names the sockets a port must be free for.
+type Protocol string
+
+const (
+	TCP  Protocol = "tcp"
+	UDP  Protocol = "udp"
+	Both Protocol = "both"
+)
+
+// ParseProtocol parses "tcp", "udp", or "both".
+func ParseProtocol(s string) (Protocol, error) {
+	switch p := Protocol(s); p {
+	case TCP, UDP, Both:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown protocol %q (want tcp, udp, or both)", s)
+}
+
+// IsFreeFor checks that p can be bound for proto on host. An empty host
+// checks the IPv4 and IPv6 wildcard and loopback addresses one by one,
+// since some systems let a wildcard bind succeed next to a loopback
+// listener; the IPv6 addresses are skipped where IPv6 is unavailable.
+func IsFreeFor(proto Protocol, host string, p int) bool {
+	hosts := []string{host}
+	if host == "" {
+		hosts = []string{"0.0.0.0", "127.0.0.1"}
+		if hasIPv6() {
+			hosts = append(hosts, "::", "::1")
+		}
+	}
+	for _, h := range hosts {
+		addr := net.JoinHostPort(h, strconv.Itoa(p))
+		if proto != UDP {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return false
+			}
+			ln.Close()
+		}
+		if proto != TCP {
+			conn, err := net.ListenPacket("udp", addr)
+			if err != nil {
+				return false
+			}
+			conn.Close()
+		}
+	}
+	return true
+}
+
+// hasIPv6 reports whether the IPv6 loopback can be bound at all.
+var hasIPv6 = sync.OnceValue(func() bool {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+})
+
+// ParseRange parses a range string like "10000-20000" into a Range. Several
+// comma-separated segments may be given, and "!port" or "!start-end" entries
+// remove ports: "3000-3999,4100-4999,!4444".
 func ParseRange(spec string) (Range, error) {
+	if !strings.ContainsAny(spec, ",!") {
+		seg, err := parseSegment(spec)
+		if err != nil {
+			return Range{}, err
+		}
+		return Range{Start: seg.Start, End: seg.End}, nil
+	}
+
+	set := &portSet{}
+	var excludes []Segment
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		exclude := strings.HasPrefix(part, "!")
+		part = strings.TrimPrefix(part, "!")
+		if exclude && !strings.Contains(part, "-") {
+			part = part + "-" + part
+		}
+		seg, err := parseSegment(part)
+		if err != nil {
+			return Range{}, err
+		}
+		if exclude {
+			excludes = append(excludes, seg)
+		} else {
+			set.written = append(set.written, seg)
+		}
+	}
+	if len(set.written) == 0 {
+		return Range{}, fmt.Errorf("range %q has no ports, only exclusions", spec)
+	}
+
+	sorted := append([]Segment{}, set.written...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	for _, seg := range sorted {
+		if n := len(set.merged); n > 0 && seg.Start <= set.merged[n-1].End+1 {
+			if seg.End > set.merged[n-1].End {
+				set.merged[n-1].End = seg.End
+			}
+			continue
+		}
+		set.merged = append(set.merged, seg)
+	}
+
+	r := Range{Start: set.merged[0].Start, End: set.merged[len(set.merged)-1].End, set: set}
+	seen := map[int]bool{}
+	for _, ex := range excludes {
+		for p := ex.Start; p <= ex.End; p++ {
+			if !r.Contains(p) {
+				return Range{}, fmt.Errorf("excluded port %d is outside range %q", p, spec)
+			}
+			if !seen[p] {
+				seen[p] = true
+				set.excluded = append(set.excluded, p)
+			}
+		}
+	}
+	sort.Ints(set.excluded)
+	if r.Size() == 0 {
+		return Range{}, fmt.Errorf("range %q excludes every port", spec)
+	}
+	return r, nil
+}
+
+func parseSegment(spec string) (Segment, error) {
 	parts := strings.Split(spec, "-")
 	if len(parts) != 2 {
-		return Range{}, fmt.Errorf("invalid range format %q, expected start-end", spec)
+		return Segment{}, fmt.Errorf("invalid range format %q, expected start-end", spec)
 	}
 	start, err := strconv.Atoi(parts[0])
 	if err != nil {
-		return Range{}, fmt.Errorf("invalid start port %q: %w", parts[0], err)
+		return Segment{}, fmt.Errorf("invalid start port %q: %w", parts[0], err)
 	}
 	end, err := strconv.Atoi(parts[1])
 	if err != nil {
-		return Range{}, fmt.Errorf("invalid end port %q: %w", parts[1], err)
+		return Segment{}, fmt.Errorf("invalid end port %q: %w", parts[1], err)
 	}
 	if start > end {
-		return Range{}, fmt.Errorf("start port %d must be less than or equal to end port %d", start, end)
+		return Segment{}, fmt.Errorf("start port %d must be less than or equal to end port %d", start, end)
 	}
 	if start < 1 || end > 65535 {
-		return Range{}, fmt.Errorf("range %d-%d must be within 1-65535", start, end)
+		return Segment{}, fmt.Errorf("range %d-%d must be within 1-65535", start, end)
 	}
-	return Range{Start: start, End: end}, nil
+	return Segment{Start: start, End: end}, nil
 }
 
 // HashPath generates a deterministic 32-bit hash for a given file path.
@@ -72,6 +322,22 @@ func HashPath(path string) uint32 {
 	return h.Sum32()
 }
 
+// HashString generates a deterministic 32-bit hash for arbitrary seed material.
+func HashString(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// SeedForMaterial derives the deterministic seed for non-path material (such
+// as a normalized remote URL) plus namespace.
+func SeedForMaterial(material, namespace string) uint32 {
+	if namespace == "" {
+		return HashString(material)
+	}
+	return HashString(material + "|" + namespace)
+}
+
 // SeedFor derives the deterministic seed for path+namespace.
 func SeedFor(path, namespace string) uint32 {
 	if namespace == "" {
@@ -95,6 +361,12 @@ func (a Allocator) PortFor(index int) (int, error) {
 
 // PortForWithStats returns allocated port plus preferred candidate and probe count.
 func (a Allocator) PortForWithStats(index int) (assigned int, preferred int, probes int, err error) {
+	return a.PortForContext(context.Background(), index)
+}
+
+// PortForContext is PortForWithStats that stops probing once ctx is done and
+// returns ctx.Err(), so a slow walk through a congested range can be aborted.
+func (a Allocator) PortForContext(ctx context.Context, index int) (assigned int, preferred int, probes int, err error) {
 	isFree := a.IsFree
 	if isFree == nil {
 		isFree = DefaultIsFree
@@ -105,13 +377,119 @@ func (a Allocator) PortForWithStats(index int) (assigned int, preferred int, pro
 	}
 
 	base := int(a.Seed) + index
-	preferred = a.Range.Start + base%size
+	preferred = a.Range.At(base % size)
 
 	for i := 0; i < size; i++ {
-		p := a.Range.Start + (base+i)%size
+		if err := ctx.Err(); err != nil {
+			return 0, preferred, i, err
+		}
+		p := a.Range.At((base + i) % size)
 		if isFree(p) {
 			return p, preferred, i, nil
 		}
 	}
-	return 0, preferred, size, fmt.Errorf("no free ports in range %d-%d", a.Range.Start, a.Range.End)
+	return 0, preferred, size, &ExhaustedError{Range: a.Range}
+}
+
+// CheckAllocation verifies the allocator's invariants for index and returns
+// the first violation: allocation is deterministic, the preferred and
+// assigned ports lie in the range, the assigned port is free, and every port
+// probed before it was busy. It is the property behind the package fuzz
+// targets and can back fuzzers for custom IsFree implementations.
+func CheckAllocation(a Allocator, index int) error {
+	isFree := a.IsFree
+	if isFree == nil {
+		isFree = DefaultIsFree
+	}
+	assigned, preferred, probes, err := a.PortForWithStats(index)
+	again, preferred2, probes2, err2 := a.PortForWithStats(index)
+	if assigned != again || preferred != preferred2 || probes != probes2 || (err == nil) != (err2 == nil) {
+		return fmt.Errorf("allocation for index %d is not deterministic", index)
+	}
+	if !a.Range.Contains(preferred) {
+		return fmt.Errorf("preferred port %d is outside range %s", preferred, a.Range)
+	}
+	size := a.Range.Size()
+	if err != nil {
+		var exhausted *ExhaustedError
+		if !errors.As(err, &exhausted) {
+			return fmt.Errorf("unexpected error: %w", err)
+		}
+		for i := 0; i < size; i++ {
+			if p := a.Range.At(i); isFree(p) {
+				return fmt.Errorf("range reported exhausted but port %d is free", p)
+			}
+		}
+		return nil
+	}
+	if !a.Range.Contains(assigned) || !isFree(assigned) {
+		return fmt.Errorf("assigned port %d is outside range %s or busy", assigned, a.Range)
+	}
+	if probes >= size {
+		return fmt.Errorf("probes %d exceed range size %d", probes, size)
+	}
+	base := int(a.Seed) + index
+	for i := 0; i < probes; i++ {
+		if p := a.Range.At((base + i) % size); isFree(p) {
+			return fmt.Errorf("skipped free port %d before assigning %d", p, assigned)
+		}
+	}
+	if a.Range.At((base+probes)%size) != assigned {
+		return fmt.Errorf("assigned port %d does not follow %d probes", assigned, probes)
+	}
+	return nil
+}
+
+// ExhaustedError reports that every port of a range was busy.
+type ExhaustedError struct {
+	Range Range
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("no free ports in range %s", e.Range)
+}
+
+// DefaultOffsetSpan is the number of candidate offsets used by SharedOffset
+// when no span is configured.
+const DefaultOffsetSpan = 100
+
+// SharedOffset picks one deterministic offset in 1..span that is applied to
+// every base port, so related ports keep their relationship (3017/4017).
+// Offsets are probed in order until all shifted ports are free.
+func (a Allocator) SharedOffset(bases []int, span int) (offset int, preferred int, probes int, err error) {
+	return a.SharedOffsetContext(context.Background(), bases, span)
+}
+
+// SharedOffsetContext is SharedOffset that stops probing once ctx is done.
+func (a Allocator) SharedOffsetContext(ctx context.Context, bases []int, span int) (offset int, preferred int, probes int, err error) {
+	isFree := a.IsFree
+	if isFree == nil {
+		isFree = DefaultIsFree
+	}
+	if span <= 0 {
+		span = DefaultOffsetSpan
+	}
+
+	base := int(a.Seed % uint32(span))
+	preferred = 1 + base
+	for i := 0; i < span; i++ {
+		if err := ctx.Err(); err != nil {
+			return 0, preferred, i, err
+		}
+		candidate := 1 + (base+i)%span
+		if offsetFits(bases, candidate, isFree) {
+			return candidate, preferred, i, nil
+		}
+	}
+	return 0, preferred, span, fmt.Errorf("no shared offset in 1-%d leaves all base ports free", span)
+}
+
+func offsetFits(bases []int, offset int, isFree IsFreeFunc) bool {
+	for _, b := range bases {
+		p := b + offset
+		if p > 65535 || !isFree(p) {
+			return false
+		}
+	}
+	return true
 }
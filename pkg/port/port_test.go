@@ -1,6 +1,10 @@
 package port
 
 import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
 	"testing"
 )
 
@@ -33,6 +37,44 @@ func TestParseRange(t *testing.T) {
 	}
 }
 
+func TestParseRange_MultiSegment(t *testing.T) {
+	r, err := ParseRange("3000-3004,3010-3012,!3002")
+	if err != nil {
+		t.Fatalf("ParseRange() error: %v", err)
+	}
+	if r.Start != 3000 || r.End != 3012 || r.Size() != 7 {
+		t.Fatalf("unexpected bounds/size: %d-%d size=%d", r.Start, r.End, r.Size())
+	}
+	var got []int
+	for i := 0; i < r.Size(); i++ {
+		got = append(got, r.At(i))
+	}
+	want := []int{3000, 3001, 3003, 3004, 3010, 3011, 3012}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ports = %v, want %v", got, want)
+	}
+	if r.Contains(3002) || r.Contains(3007) || !r.Contains(3011) {
+		t.Fatal("Contains() disagrees with At()")
+	}
+	if r.String() != "3000-3004,3010-3012,!3002" {
+		t.Fatalf("String() = %q", r.String())
+	}
+
+	overlapping, err := ParseRange("3000-3010,3005-3020,!3006-3007")
+	if err != nil {
+		t.Fatalf("ParseRange() error: %v", err)
+	}
+	if overlapping.Size() != 19 || len(overlapping.Overlaps()) != 1 {
+		t.Fatalf("size=%d overlaps=%v", overlapping.Size(), overlapping.Overlaps())
+	}
+
+	for _, bad := range []string{"!4444", "3000-3001,!3000-3001", "3000-3010,!4000", "3000-3010,x"} {
+		if _, err := ParseRange(bad); err == nil {
+			t.Errorf("ParseRange(%q) expected error", bad)
+		}
+	}
+}
+
 func TestHashPath(t *testing.T) {
 	hash1 := HashPath("/path/to/projectA")
 	hash2 := HashPath("/path/to/projectB")
@@ -57,6 +99,19 @@ func TestSeedFor(t *testing.T) {
 	}
 }
 
+func TestSeedForMaterial(t *testing.T) {
+	a := SeedForMaterial("github.com/acme/shop@main", "")
+	if a != SeedForMaterial("github.com/acme/shop@main", "") {
+		t.Fatalf("seed must be deterministic")
+	}
+	if a == SeedForMaterial("github.com/acme/shop@main", "api") {
+		t.Fatalf("namespace should alter seed")
+	}
+	if a == SeedForMaterial("github.com/acme/shop@dev", "") {
+		t.Fatalf("material should alter seed")
+	}
+}
+
 func TestAllocator_PortFor(t *testing.T) {
 	seed := uint32(12345)
 	r := Range{Start: 10000, End: 10009} // range size 10
@@ -104,8 +159,141 @@ func TestAllocator_PortFor(t *testing.T) {
 			IsFree: func(p int) bool { return false },
 		}
 		_, err := a.PortFor(0)
-		if err == nil {
-			t.Errorf("PortFor() expected error when no ports free")
+		var exhausted *ExhaustedError
+		if !errors.As(err, &exhausted) || exhausted.Range != r {
+			t.Errorf("PortFor() error = %v, want ExhaustedError for %v", err, r)
+		}
+	})
+}
+
+func TestAllocator_MultiRangeSkipsExclusions(t *testing.T) {
+	r, err := ParseRange("10000-10002,10010-10012,!10011")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Allocator{Seed: 3, Range: r, IsFree: func(p int) bool { return p != 10010 }}
+	p, preferred, probes, err := a.PortForWithStats(0)
+	if err != nil {
+		t.Fatalf("PortForWithStats() error: %v", err)
+	}
+	if preferred != 10010 || p != 10012 || probes != 1 {
+		t.Fatalf("got port=%d preferred=%d probes=%d", p, preferred, probes)
+	}
+}
+
+func TestAllocator_PortForContextStopsProbing(t *testing.T) {
+	r, _ := ParseRange("10000-19999")
+	ctx, cancel := context.WithCancel(context.Background())
+	probed := 0
+	a := Allocator{Seed: 1, Range: r, IsFree: func(p int) bool {
+		probed++
+		if probed == 5 {
+			cancel()
+		}
+		return false
+	}}
+	_, _, probes, err := a.PortForContext(ctx, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("PortForContext() error = %v, want context.Canceled", err)
+	}
+	if probed != 5 || probes != 5 {
+		t.Fatalf("probed %d ports (probes=%d) after cancel, want 5", probed, probes)
+	}
+}
+
+func TestAllocator_SharedOffset(t *testing.T) {
+	a := Allocator{Seed: 16, IsFree: func(p int) bool { return true }}
+	offset, preferred, probes, err := a.SharedOffset([]int{3000, 4000}, 100)
+	if err != nil {
+		t.Fatalf("SharedOffset() error: %v", err)
+	}
+	if offset != 17 || preferred != 17 || probes != 0 {
+		t.Fatalf("SharedOffset() = %d, %d, %d; want 17, 17, 0", offset, preferred, probes)
+	}
+
+	busy := Allocator{Seed: 16, IsFree: func(p int) bool { return p != 4017 }}
+	offset, preferred, probes, err = busy.SharedOffset([]int{3000, 4000}, 100)
+	if err != nil {
+		t.Fatalf("SharedOffset() error: %v", err)
+	}
+	if offset != 18 || preferred != 17 || probes != 1 {
+		t.Fatalf("SharedOffset() = %d, %d, %d; want 18, 17, 1", offset, preferred, probes)
+	}
+
+	none := Allocator{Seed: 1, IsFree: func(p int) bool { return false }}
+	if _, _, _, err := none.SharedOffset([]int{3000}, 5); err == nil {
+		t.Fatal("expected error when no offset fits")
+	}
+}
+
+func FuzzParseRange(f *testing.F) {
+	for _, seed := range []string{"3000-4000", "3000-3999,4100-4999,!4444", "1-65535", "5-5,!5", "!1", "10-20,15-30,!16-18"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, spec string) {
+		r, err := ParseRange(spec)
+		if err != nil {
+			return
+		}
+		again, err := ParseRange(r.String())
+		if err != nil || again.String() != r.String() || again.Size() != r.Size() {
+			t.Fatalf("canonical spec %q of %q does not round-trip: %v", r.String(), spec, err)
+		}
+		size := r.Size()
+		if size < 1 || size > 65535 {
+			t.Fatalf("size %d out of bounds for %q", size, spec)
+		}
+		prev := 0
+		for _, i := range []int{0, size / 3, size / 2, size - 1} {
+			p := r.At(i)
+			if !r.Contains(p) || p < r.Start || p > r.End {
+				t.Fatalf("At(%d)=%d is not in %q", i, p, spec)
+			}
+			if p < prev {
+				t.Fatalf("At is not ascending for %q", spec)
+			}
+			prev = p
+		}
+	})
+}
+
+func FuzzAllocator(f *testing.F) {
+	f.Add(uint32(12345), "10000-10009", uint8(0), uint64(0))
+	f.Add(uint32(7), "3000-3010,4000-4005,!3005", uint8(3), uint64(0xff))
+	f.Add(uint32(0), "20-21", uint8(1), uint64(3))
+	f.Fuzz(func(t *testing.T, seed uint32, spec string, index uint8, busy uint64) {
+		r, err := ParseRange(spec)
+		if err != nil || r.Size() > 4096 {
+			return
+		}
+		a := Allocator{Seed: seed, Range: r, IsFree: func(p int) bool { return busy&(1<<(uint(p)%64)) == 0 }}
+		if err := CheckAllocation(a, int(index)); err != nil {
+			t.Fatal(err)
 		}
 	})
 }
+
+func TestIsFreeFor(t *testing.T) {
+	if _, err := ParseProtocol("sctp"); err == nil {
+		t.Fatal("ParseProtocol(sctp) should fail")
+	}
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer udp.Close()
+	p := udp.LocalAddr().(*net.UDPAddr).Port
+	if IsFreeFor(UDP, "", p) || IsFreeFor(Both, "", p) {
+		t.Fatalf("UDP port %d held on loopback should not be free for udp or both", p)
+	}
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer tcp.Close()
+	p = tcp.Addr().(*net.TCPAddr).Port
+	if IsFreeFor(TCP, "", p) {
+		t.Fatalf("TCP port %d held on loopback should not be free for tcp", p)
+	}
+}